@@ -0,0 +1,124 @@
+package endpoint
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//自适应超时配置
+type AdaptiveTimeoutConfig struct {
+	Min        time.Duration //读超时下限
+	Max        time.Duration //读超时上限
+	Percentile float64       //参考的响应时间分位数，默认0.95
+	Multiplier float64       //读超时为分位数响应时间的倍数，默认1.5
+	Samples    int           //统计最近多少次响应，默认50
+}
+
+//自适应超时：统计每次写后到收到响应的时间，按分位数调整读超时并限制在[Min, Max]内
+type AdaptiveTimeout struct {
+	EndPoint
+	config    AdaptiveTimeoutConfig
+	mu        sync.Mutex
+	samples   []time.Duration //响应时间环形缓冲区
+	next      int             //下一个写入位置
+	lastWrite time.Time       //最近一次写入时间，零值表示没有等待中的响应
+}
+
+//创建自适应超时的EndPoint，初始读超时限制在[Min, Max]内。p需支持TimeoutSetter，否则不调整读超时
+func NewAdaptiveTimeout(p EndPoint, c *AdaptiveTimeoutConfig) *AdaptiveTimeout {
+	cfg := *c
+	if cfg.Percentile <= 0 || cfg.Percentile > 1 {
+		cfg.Percentile = 0.95
+	}
+	if cfg.Multiplier <= 0 {
+		cfg.Multiplier = 1.5
+	}
+	if cfg.Samples <= 0 {
+		cfg.Samples = 50
+	}
+
+	a := &AdaptiveTimeout{EndPoint: p, config: cfg}
+	setReadTimeout(p, a.clamp(p.ReadTimeout()))
+
+	return a
+}
+
+//写数据并开始计时
+func (a *AdaptiveTimeout) Write(b []byte) (n int, err error) {
+	if n, err = a.EndPoint.Write(b); err == nil {
+		a.mu.Lock()
+		a.lastWrite = time.Now()
+		a.mu.Unlock()
+	}
+	return
+}
+
+//读取数据，收到响应或超时后更新读超时
+func (a *AdaptiveTimeout) Read(b []byte) (n int, err error) {
+	n, err = a.EndPoint.Read(b)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.lastWrite.IsZero() {
+		return
+	}
+	if n > 0 && err == nil {
+		a.add(time.Since(a.lastWrite))
+	} else if IsTimeout(err) {
+		//超时的响应时间至少为当前读超时
+		a.add(a.EndPoint.ReadTimeout())
+	} else {
+		return
+	}
+	a.lastWrite = time.Time{}
+	setReadTimeout(a.EndPoint, a.estimate())
+
+	return
+}
+
+//返回当前生效的读超时
+func (a *AdaptiveTimeout) Effective() time.Duration {
+	return a.EndPoint.ReadTimeout()
+}
+
+//修改底层EndPoint的读超时，底层不支持TimeoutSetter时忽略
+func (a *AdaptiveTimeout) SetReadTimeout(d time.Duration) {
+	setReadTimeout(a.EndPoint, d)
+}
+
+//修改底层EndPoint的写超时，底层不支持TimeoutSetter时忽略
+func (a *AdaptiveTimeout) SetWriteTimeout(d time.Duration) {
+	setWriteTimeout(a.EndPoint, d)
+}
+
+//加入响应时间样本，调用方需持有锁
+func (a *AdaptiveTimeout) add(d time.Duration) {
+	if len(a.samples) < a.config.Samples {
+		a.samples = append(a.samples, d)
+		return
+	}
+	a.samples[a.next] = d
+	a.next = (a.next + 1) % len(a.samples)
+}
+
+//按分位数估算读超时，调用方需持有锁
+func (a *AdaptiveTimeout) estimate() time.Duration {
+	sorted := append([]time.Duration(nil), a.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	i := int(float64(len(sorted)-1) * a.config.Percentile)
+	return a.clamp(time.Duration(float64(sorted[i]) * a.config.Multiplier))
+}
+
+//把读超时限制在[Min, Max]内
+func (a *AdaptiveTimeout) clamp(d time.Duration) time.Duration {
+	if a.config.Min > 0 && d < a.config.Min {
+		d = a.config.Min
+	}
+	if a.config.Max > 0 && d > a.config.Max {
+		d = a.config.Max
+	}
+	return d
+}
@@ -0,0 +1,189 @@
+package endpoint
+
+import (
+	"sync"
+	"time"
+)
+
+//告警类型
+type AlarmKind int
+
+const (
+	AlarmErrorRate   AlarmKind = iota //读写错误率
+	AlarmTimeoutRate                  //读写超时率
+	AlarmCRCRate                      //CRC校验失败率
+)
+
+func (k AlarmKind) String() string {
+	switch k {
+	case AlarmErrorRate:
+		return "error-rate"
+	case AlarmTimeoutRate:
+		return "timeout-rate"
+	case AlarmCRCRate:
+		return "crc-rate"
+	default:
+		return "unknown"
+	}
+}
+
+//告警事件，比率超过阈值时触发，回落到阈值以下时以Cleared为true再触发一次
+type AlarmEvent struct {
+	Endpoint  string    //EndPoint名称
+	Kind      AlarmKind //告警类型
+	Rate      float64   //当前比率
+	Threshold float64   //阈值
+	Cleared   bool      //告警是否解除
+	Time      time.Time //触发时间
+}
+
+//告警配置，比率按最近Window次操作计算，阈值为0表示不检测该类型
+type AlarmConfig struct {
+	Window         int              //统计窗口（操作次数），默认100
+	ErrorRate      float64          //错误率阈值
+	TimeoutRate    float64          //超时率阈值
+	CRCFailureRate float64          //CRC校验失败率阈值
+	OnAlarm        func(AlarmEvent) //告警回调，在读写的协程中同步调用
+}
+
+//滑动窗口内的比率统计
+type rateWindow struct {
+	samples []bool //环形缓冲区，true表示失败
+	next    int    //下一个写入位置
+	count   int    //已有样本数
+	failed  int    //窗口内失败数
+	raised  bool   //是否处于告警状态
+}
+
+//加入样本，窗口填满后返回当前比率
+func (w *rateWindow) add(failed bool) (rate float64, full bool) {
+	if w.count == len(w.samples) {
+		if w.samples[w.next] {
+			w.failed--
+		}
+	} else {
+		w.count++
+	}
+	w.samples[w.next] = failed
+	if failed {
+		w.failed++
+	}
+	w.next = (w.next + 1) % len(w.samples)
+
+	return float64(w.failed) / float64(w.count), w.count == len(w.samples)
+}
+
+//错误率告警，包装EndPoint统计读写结果
+type AlarmMonitor struct {
+	EndPoint
+	name     string
+	config   AlarmConfig
+	mu       sync.Mutex
+	errors   rateWindow //读写错误
+	timeouts rateWindow //读写超时
+	crc      rateWindow //CRC校验
+}
+
+//创建错误率告警，name用于告警事件中标识EndPoint
+func NewAlarmMonitor(p EndPoint, name string, c *AlarmConfig) *AlarmMonitor {
+	cfg := *c
+	if cfg.Window <= 0 {
+		cfg.Window = 100
+	}
+
+	return &AlarmMonitor{
+		EndPoint: p,
+		name:     name,
+		config:   cfg,
+		errors:   rateWindow{samples: make([]bool, cfg.Window)},
+		timeouts: rateWindow{samples: make([]bool, cfg.Window)},
+		crc:      rateWindow{samples: make([]bool, cfg.Window)},
+	}
+}
+
+//读取数据并统计结果
+func (m *AlarmMonitor) Read(b []byte) (n int, err error) {
+	n, err = m.EndPoint.Read(b)
+	m.observe(err)
+	return
+}
+
+//写数据并统计结果
+func (m *AlarmMonitor) Write(b []byte) (n int, err error) {
+	n, err = m.EndPoint.Write(b)
+	m.observe(err)
+	return
+}
+
+//上报一次CRC校验结果，供上层报文解析使用
+func (m *AlarmMonitor) ReportCRC(ok bool) {
+	m.mu.Lock()
+	ev := m.check(&m.crc, AlarmCRCRate, m.config.CRCFailureRate, !ok)
+	m.mu.Unlock()
+
+	m.emit(ev)
+}
+
+//修改底层EndPoint的读超时，底层不支持TimeoutSetter时忽略
+func (m *AlarmMonitor) SetReadTimeout(d time.Duration) {
+	setReadTimeout(m.EndPoint, d)
+}
+
+//修改底层EndPoint的写超时，底层不支持TimeoutSetter时忽略
+func (m *AlarmMonitor) SetWriteTimeout(d time.Duration) {
+	setWriteTimeout(m.EndPoint, d)
+}
+
+//统计读写结果，超时和其他错误分别计数
+func (m *AlarmMonitor) observe(err error) {
+	timeout := IsTimeout(err)
+
+	m.mu.Lock()
+	evs := []*AlarmEvent{
+		m.check(&m.errors, AlarmErrorRate, m.config.ErrorRate, err != nil && !timeout),
+		m.check(&m.timeouts, AlarmTimeoutRate, m.config.TimeoutRate, timeout),
+	}
+	m.mu.Unlock()
+
+	m.emit(evs...)
+}
+
+//加入样本并判断是否需要触发或解除告警，调用方需持有锁
+func (m *AlarmMonitor) check(w *rateWindow, kind AlarmKind, threshold float64, failed bool) *AlarmEvent {
+	if threshold <= 0 {
+		return nil
+	}
+
+	rate, full := w.add(failed)
+	if !full {
+		return nil
+	}
+	if rate >= threshold && !w.raised {
+		w.raised = true
+	} else if rate < threshold && w.raised {
+		w.raised = false
+	} else {
+		return nil
+	}
+
+	return &AlarmEvent{
+		Endpoint:  m.name,
+		Kind:      kind,
+		Rate:      rate,
+		Threshold: threshold,
+		Cleared:   !w.raised,
+		Time:      time.Now(),
+	}
+}
+
+//调用告警回调
+func (m *AlarmMonitor) emit(evs ...*AlarmEvent) {
+	if m.config.OnAlarm == nil {
+		return
+	}
+	for _, ev := range evs {
+		if ev != nil {
+			m.config.OnAlarm(*ev)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//蜂窝模块未注册到网络
+var ErrNotRegistered = errors.New("at: not registered to network")
+
+//AT命令的默认超时
+const atCommandTimeout = 5 * time.Second
+
+//AT命令的最终结果码
+var atFinalResult = regexp.MustCompile(`(?m)^(OK|ERROR|\+CM[ES] ERROR:[^\r\n]*)\r?\n`)
+
+//AT命令助手，在蜂窝模块的AT控制口上执行命令并解析应答
+type AT struct {
+	mu      sync.Mutex
+	e       *Expecter     //控制口上的交互会话
+	timeout time.Duration //单条命令的超时
+}
+
+//在AT控制口上创建命令助手，timeout为0时使用5s
+func NewAT(p EndPoint, timeout time.Duration) *AT {
+	if timeout <= 0 {
+		timeout = atCommandTimeout
+	}
+	return &AT{e: NewExpecter(p), timeout: timeout}
+}
+
+//执行AT命令，返回最终结果码之前的应答行（不含回显和空行）。
+//最终结果为ERROR、+CME ERROR或+CMS ERROR时返回错误
+func (a *AT) Command(cmd string) ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	//丢弃之前收到的主动上报
+	a.e.Discard()
+	if err := a.e.Send(cmd + "\r"); err != nil {
+		return nil, fmt.Errorf("at: %v: %v", cmd, err)
+	}
+
+	_, out, err := a.e.expect(a.timeout, func(data []byte) (int, int) {
+		if loc := atFinalResult.FindIndex(data); loc != nil {
+			return 0, loc[1]
+		}
+		return -1, 0
+	})
+	if err != nil {
+		return nil, fmt.Errorf("at: %v: %v", cmd, err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && line != cmd {
+			lines = append(lines, line)
+		}
+	}
+	result := lines[len(lines)-1]
+	if result != "OK" {
+		return nil, fmt.Errorf("at: %v: %v", cmd, result)
+	}
+
+	return lines[:len(lines)-1], nil
+}
+
+//执行查询命令，返回以prefix开始的应答行去除前缀后的内容
+func (a *AT) Query(cmd, prefix string) (string, error) {
+	lines, err := a.Command(cmd)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(line[len(prefix):]), nil
+		}
+	}
+	return "", fmt.Errorf("at: %v: no %v in response", cmd, prefix)
+}
+
+//蜂窝模块的网络注册和信号状态
+type CellularStatus struct {
+	Registered bool      //是否已注册到网络（本地或漫游）
+	Roaming    bool      //是否漫游
+	RegStatus  int       //注册状态（+CEREG/+CREG的stat）：0未注册，1本地，2搜索中，3被拒绝，5漫游
+	RSSI       int       //接收信号强度（dBm），未知时为0
+	RSRP       int       //LTE参考信号接收功率（dBm），未知或模块不支持时为0
+	Time       time.Time //查询时间
+}
+
+//查询网络注册状态和信号强度。优先查询LTE注册状态（+CEREG），未注册时再查询+CREG
+func (a *AT) Status() (*CellularStatus, error) {
+	s := &CellularStatus{Time: time.Now()}
+
+	stat, err := a.regStatus("AT+CEREG?", "+CEREG:")
+	if err != nil || (stat != 1 && stat != 5) {
+		if stat2, err2 := a.regStatus("AT+CREG?", "+CREG:"); err2 == nil {
+			stat, err = stat2, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.RegStatus = stat
+	s.Registered = stat == 1 || stat == 5
+	s.Roaming = stat == 5
+
+	//+CSQ: <rssi>,<ber>，rssi为0～31，99表示未知
+	if v, err := a.Query("AT+CSQ", "+CSQ:"); err == nil {
+		if n, ok := atField(v, 0); ok && n != 99 {
+			s.RSSI = -113 + 2*n
+		}
+	}
+	//+CESQ: <rxlev>,<ber>,<rscp>,<ecno>,<rsrq>,<rsrp>，rsrp为0～97，255表示未知
+	if v, err := a.Query("AT+CESQ", "+CESQ:"); err == nil {
+		if n, ok := atField(v, 5); ok && n != 255 {
+			s.RSRP = -141 + n
+		}
+	}
+
+	return s, nil
+}
+
+//查询注册状态，应答为<n>,<stat>[,...]
+func (a *AT) regStatus(cmd, prefix string) (int, error) {
+	v, err := a.Query(cmd, prefix)
+	if err != nil {
+		return 0, err
+	}
+	stat, ok := atField(v, 1)
+	if !ok {
+		return 0, fmt.Errorf("at: %v: invalid response %q", cmd, v)
+	}
+	return stat, nil
+}
+
+//返回逗号分隔的第i个整数字段
+func atField(v string, i int) (int, bool) {
+	fields := strings.Split(v, ",")
+	if i >= len(fields) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.Trim(strings.TrimSpace(fields[i]), `"`))
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+//设置EndPoint的蜂窝模块，打开前先查询注册状态，未注册时不打开并返回ErrNotRegistered，
+//避免在模块搜网时建立数据会话。at为nil表示取消
+func (m *Manager) SetCellular(name string, at *AT) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, ok := m.endpoints[name]
+	if !ok {
+		return fmt.Errorf("manager: endpoint %v not found", name)
+	}
+	me.cellular = at
+	me.cellStatus = nil
+
+	return nil
+}
+
+//返回EndPoint的蜂窝模块最近一次查询的状态，包括RSSI和RSRP。状态在打开时和调用RefreshCellular时更新，
+//需要实时信号强度时先调用RefreshCellular
+func (m *Manager) CellularStatus(name string) (CellularStatus, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	me, ok := m.endpoints[name]
+	if !ok || me.cellStatus == nil {
+		return CellularStatus{}, false
+	}
+	return *me.cellStatus, true
+}
+
+//重新查询EndPoint的蜂窝模块状态并更新CellularStatus。AT命令在锁外执行，不阻塞其他操作
+func (m *Manager) RefreshCellular(name string) (CellularStatus, error) {
+	m.mu.RLock()
+	me, ok := m.endpoints[name]
+	var at *AT
+	if ok {
+		at = me.cellular
+	}
+	m.mu.RUnlock()
+	if !ok {
+		return CellularStatus{}, fmt.Errorf("manager: endpoint %v not found", name)
+	}
+	if at == nil {
+		return CellularStatus{}, fmt.Errorf("manager: endpoint %v has no cellular module", name)
+	}
+
+	s, err := at.Status()
+	if err != nil {
+		return CellularStatus{}, fmt.Errorf("manager: cellular %v: %w", name, err)
+	}
+
+	m.mu.Lock()
+	if me.cellular == at {
+		me.cellStatus = s
+	}
+	m.mu.Unlock()
+
+	return *s, nil
+}
+
+//打开前查询蜂窝模块的注册状态，at为nil时不检查。执行AT命令，调用方不能持有锁
+func checkCellular(at *AT) (*CellularStatus, error) {
+	if at == nil {
+		return nil, nil
+	}
+
+	s, err := at.Status()
+	if err != nil {
+		return nil, err
+	}
+	if !s.Registered {
+		return s, fmt.Errorf("%w: stat %v", ErrNotRegistered, s.RegStatus)
+	}
+	return s, nil
+}
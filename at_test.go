@@ -0,0 +1,157 @@
+package endpoint
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//在伪终端主端模拟蜂窝模块，收到命令后通知asked，release关闭后才应答
+type fakeModem struct {
+	mu      sync.Mutex
+	csq     int           //+CSQ的rssi
+	asked   chan struct{} //收到第一条命令时通知
+	release chan struct{} //关闭后应答命令
+	stop    chan struct{} //关闭后serve退出
+	wg      sync.WaitGroup
+}
+
+func newFakeModem(csq int) *fakeModem {
+	return &fakeModem{
+		csq:     csq,
+		asked:   make(chan struct{}, 1),
+		release: make(chan struct{}),
+		stop:    make(chan struct{}),
+	}
+}
+
+func (f *fakeModem) setCSQ(n int) {
+	f.mu.Lock()
+	f.csq = n
+	f.mu.Unlock()
+}
+
+func (f *fakeModem) start(p EndPoint) {
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.serve(p)
+	}()
+}
+
+//通知serve退出并等待，之后才能关闭主端
+func (f *fakeModem) shutdown() {
+	close(f.stop)
+	f.wg.Wait()
+}
+
+func (f *fakeModem) serve(p EndPoint) {
+	var line []byte
+	b := make([]byte, 64)
+	for {
+		select {
+		case <-f.stop:
+			return
+		default:
+		}
+		n, err := p.Read(b)
+		if err != nil && !IsTimeout(err) {
+			return
+		}
+		for _, c := range b[:n] {
+			if c != '\r' {
+				line = append(line, c)
+				continue
+			}
+			cmd := strings.TrimSpace(string(line))
+			line = line[:0]
+
+			select {
+			case f.asked <- struct{}{}:
+			default:
+			}
+			select {
+			case <-f.release:
+			case <-f.stop:
+				return
+			}
+			f.mu.Lock()
+			csq := f.csq
+			f.mu.Unlock()
+			var resp string
+			switch cmd {
+			case "AT+CEREG?":
+				resp = "+CEREG: 0,1\r\n"
+			case "AT+CSQ":
+				resp = "+CSQ: " + strconv.Itoa(csq) + ",99\r\n"
+			case "AT+CESQ":
+				resp = "+CESQ: 99,99,255,255,20,50\r\n"
+			}
+			if _, err = p.Write([]byte("\r\n" + resp + "OK\r\n")); err != nil {
+				return
+			}
+		}
+	}
+}
+
+//蜂窝模块查询不应持有Manager的锁，RefreshCellular更新信号强度
+func TestManagerCellularOutsideLock(t *testing.T) {
+	master, slave, err := OpenPTY(&SerialConfig{BaudRate: 115200, ReadTimeout: 100 * time.Millisecond, InterFrameGap: 10 * time.Millisecond})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+	modem := newFakeModem(20)
+	modem.start(master)
+	defer modem.shutdown()
+
+	m := NewManager()
+	defer m.CloseAll()
+	if err = m.Add("cell", &NullConfig{Address: "cell"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Add("other", &NullConfig{Address: "other"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.SetCellular("cell", NewAT(slave, 5*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	cellDone := make(chan error, 1)
+	go func() { cellDone <- m.Open("cell") }()
+	<-modem.asked
+
+	//模块未应答期间打开其他EndPoint应先于cell完成
+	otherDone := make(chan error, 1)
+	go func() { otherDone <- m.Open("other") }()
+	select {
+	case err = <-otherDone:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case err = <-cellDone:
+		t.Fatalf("Open(cell) returned %v before Open(other), the modem query held the lock", err)
+	}
+	close(modem.release)
+	if err = <-cellDone; err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := m.CellularStatus("cell"); !ok || s.RSSI != -73 || s.RSRP != -91 {
+		t.Errorf("CellularStatus = %+v, %v, want RSSI -73, RSRP -91", s, ok)
+	}
+
+	modem.setCSQ(10)
+	s, err := m.RefreshCellular("cell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.RSSI != -93 {
+		t.Errorf("RefreshCellular RSSI = %v, want -93", s.RSSI)
+	}
+	if s, _ = m.CellularStatus("cell"); s.RSSI != -93 {
+		t.Errorf("CellularStatus after refresh RSSI = %v, want -93", s.RSSI)
+	}
+}
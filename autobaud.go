@@ -0,0 +1,83 @@
+package endpoint
+
+import (
+	"fmt"
+)
+
+//自动探测时默认的候选波特率（常用速率从高到低）
+var DefaultBaudRates = []int{115200, 57600, 38400, 19200, 9600, 4800, 2400, 1200}
+
+//波特率自动探测配置
+type AutoBaudConfig struct {
+	Rates    []int             //候选波特率，为空则使用DefaultBaudRates
+	Probe    []byte            //探测报文，为空则被动监听线路上的数据
+	Validate func([]byte) bool //判断收到的数据是否为合法报文，为空则收到任意数据即认为合法
+	Attempts int               //每个波特率的尝试次数，默认1次
+}
+
+//自动探测串口波特率，依次以候选波特率打开串口，发送探测报文（或被动监听），
+//返回首个收到合法数据的波特率。串口的其他参数（数据位、校验等）取自c
+func DetectBaudRate(c *SerialConfig, ac *AutoBaudConfig) (int, error) {
+	if ac == nil {
+		ac = &AutoBaudConfig{}
+	}
+	rates := ac.Rates
+	if len(rates) == 0 {
+		rates = DefaultBaudRates
+	}
+	attempts := ac.Attempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	for _, rate := range rates {
+		if _, ok := baudRates[rate]; !ok {
+			return 0, fmt.Errorf("serial: unsupported baud rate %v", rate)
+		}
+
+		cfg := *c
+		cfg.BaudRate = rate
+		for i := 0; i < attempts; i++ {
+			ok, err := probeBaudRate(&cfg, ac)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				return rate, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("serial: no valid traffic detected on %v", c.Address)
+}
+
+//以指定波特率打开串口并判断是否能收到合法数据，串口打开失败时返回错误
+func probeBaudRate(c *SerialConfig, ac *AutoBaudConfig) (bool, error) {
+	p, err := Open(c)
+	if err != nil {
+		return false, err
+	}
+	defer p.Close()
+
+	//丢弃切换波特率前残留的数据
+	if err = p.Flush(); err != nil {
+		return false, err
+	}
+
+	if len(ac.Probe) > 0 {
+		if _, err = p.Write(ac.Probe); err != nil {
+			return false, nil
+		}
+	}
+
+	b := make([]byte, 256)
+	n, err := p.Read(b)
+	if err != nil || n == 0 { //超时或读失败，视为该波特率无效
+		return false, nil
+	}
+
+	if ac.Validate == nil {
+		return true, nil
+	}
+	return ac.Validate(b[:n]), nil
+}
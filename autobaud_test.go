@@ -0,0 +1,119 @@
+package endpoint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+//打开伪终端，返回主端和从端路径，从端在测试期间保持打开以免主端读到EIO
+func openAutoBaudPTY(t *testing.T) (master EndPoint, address string, closer func()) {
+	master, slave, err := OpenPTY(&SerialConfig{BaudRate: 9600, ReadTimeout: 5 * time.Second})
+	if err != nil {
+		t.Skip(err)
+	}
+	return master, slave.(*serial).address, func() {
+		slave.Close()
+		master.Close()
+	}
+}
+
+//模拟设备：每收到一个完整的探测报文按顺序回复一条应答
+func startAutoBaudPeer(master EndPoint, probe []byte, replies ...string) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b := make([]byte, len(probe))
+		for _, reply := range replies {
+			if _, err := ReadExact(master, b); err != nil || !bytes.Equal(b, probe) {
+				return
+			}
+			master.Write([]byte(reply))
+		}
+	}()
+	return done
+}
+
+func TestDetectBaudRate(t *testing.T) {
+	probe := []byte("AT\r")
+	validate := func(b []byte) bool { return bytes.Contains(b, []byte("OK")) }
+
+	tests := []struct {
+		name     string
+		rates    []int
+		attempts int
+		replies  []string
+		want     int
+	}{
+		{"first rate", []int{9600, 4800}, 1, []string{"OK"}, 9600},
+		{"third rate", []int{9600, 4800, 2400}, 1, []string{"\xfe\x00", "?x", "\r\nOK\r\n"}, 2400},
+		{"second attempt", []int{9600, 4800}, 2, []string{"\xfe", "OK"}, 9600},
+		{"after attempts", []int{9600, 4800}, 2, []string{"\xfe", "\xfe", "OK"}, 4800},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			master, address, closer := openAutoBaudPTY(t)
+			defer closer()
+			done := startAutoBaudPeer(master, probe, tt.replies...)
+
+			c := &SerialConfig{Address: address, DataBits: 8, StopBits: 1, ReadTimeout: 200 * time.Millisecond}
+			rate, err := DetectBaudRate(c, &AutoBaudConfig{Rates: tt.rates, Probe: probe, Validate: validate, Attempts: tt.attempts})
+			if err != nil || rate != tt.want {
+				t.Errorf("DetectBaudRate = %v, %v, want %v", rate, err, tt.want)
+			}
+			<-done
+			if c.BaudRate != 0 {
+				t.Errorf("DetectBaudRate modified the config: BaudRate = %v", c.BaudRate)
+			}
+		})
+	}
+}
+
+//被动监听时收到任意数据即认为合法，没有数据时所有候选波特率都失败
+func TestDetectBaudRatePassive(t *testing.T) {
+	master, address, closer := openAutoBaudPTY(t)
+	defer closer()
+
+	c := &SerialConfig{Address: address, DataBits: 8, StopBits: 1, ReadTimeout: 20 * time.Millisecond}
+	_, err := DetectBaudRate(c, &AutoBaudConfig{Rates: []int{9600, 4800}})
+	if err == nil || !strings.Contains(err.Error(), "no valid traffic") {
+		t.Errorf("silent line: err = %v, want no valid traffic", err)
+	}
+
+	//设备周期性发送数据，直到探测结束
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+				master.Write([]byte("$GPGGA"))
+			}
+		}
+	}()
+	rate, err := DetectBaudRate(c, &AutoBaudConfig{Rates: []int{4800}, Attempts: 100})
+	close(stop)
+	<-done
+	if err != nil || rate != 4800 {
+		t.Errorf("DetectBaudRate = %v, %v, want 4800", rate, err)
+	}
+}
+
+func TestDetectBaudRateErrors(t *testing.T) {
+	_, address, closer := openAutoBaudPTY(t)
+	defer closer()
+
+	c := &SerialConfig{Address: address, DataBits: 8, StopBits: 1, ReadTimeout: 20 * time.Millisecond}
+	if _, err := DetectBaudRate(c, &AutoBaudConfig{Rates: []int{12345}}); err == nil || !strings.Contains(err.Error(), "unsupported baud rate") {
+		t.Errorf("unsupported rate: err = %v", err)
+	}
+
+	c.Address = "/dev/endpoint-no-such-tty"
+	if _, err := DetectBaudRate(c, &AutoBaudConfig{Rates: []int{9600}}); err == nil || strings.Contains(err.Error(), "no valid traffic") {
+		t.Errorf("missing device: err = %v, want open error", err)
+	}
+}
@@ -0,0 +1,208 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+//延迟发送队列已满
+var ErrBatchFull = errors.New("batch: queue full")
+
+//单个EndPoint默认最多缓存的延迟报文数
+const batchQueue = 256
+
+//延迟发送配置：非紧急报文先缓存，在无线模块唤醒时集中发送，
+//减少太阳能站点上蜂窝模块的上电次数
+type BatchConfig struct {
+	Interval        time.Duration                //唤醒周期，比如15min
+	Windows         []ScheduleWindow             //允许唤醒的时间窗口，为空表示任何时间
+	Queue           int                          //单个EndPoint最多缓存的报文数，默认256
+	CloseAfterFlush bool                         //发送后关闭唤醒时才打开的EndPoint，让模块回到休眠
+	OnError         func(name string, err error) //打开或发送失败时的回调，可为nil
+}
+
+//单个EndPoint的延迟发送结果
+type FlushResult struct {
+	Name   string //EndPoint名称
+	Frames int    //发送成功的报文数
+	Err    error  //打开或发送失败时非nil，未发送的报文保留到下次唤醒
+}
+
+//开启延迟发送，按Interval周期在时间窗口内唤醒并发送所有EndPoint缓存的报文
+func (m *Manager) EnableBatching(c *BatchConfig) error {
+	if c.Interval <= 0 {
+		return fmt.Errorf("batch: invalid interval %v", c.Interval)
+	}
+	cfg := *c
+	if cfg.Queue <= 0 {
+		cfg.Queue = batchQueue
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.batch != nil {
+		return fmt.Errorf("batch: already enabled")
+	}
+	m.batch = &cfg
+	done := make(chan struct{})
+	m.batchDone = done
+	m.batchWg.Add(1)
+
+	go func() {
+		defer m.batchWg.Done()
+
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if !inWindows(cfg.Windows, now) {
+					continue
+				}
+				for _, r := range m.Wake() {
+					if r.Err != nil && cfg.OnError != nil {
+						cfg.OnError(r.Name, r.Err)
+					}
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+//关闭延迟发送，缓存的报文被丢弃，需要保留时先调用Wake
+func (m *Manager) DisableBatching() {
+	m.mu.Lock()
+	done := m.batchDone
+	m.batch, m.batchDone = nil, nil
+	for _, me := range m.endpoints {
+		me.deferred = nil
+	}
+	m.mu.Unlock()
+
+	if done != nil {
+		close(done)
+		m.batchWg.Wait()
+	}
+}
+
+//缓存非紧急报文，在下次唤醒时发送。未开启延迟发送时立即发送
+func (m *Manager) WriteDeferred(name string, frame []byte) error {
+	m.mu.Lock()
+	me, ok := m.endpoints[name]
+	if !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("manager: endpoint %v not found", name)
+	}
+	if err := me.guarded(GuardWrite); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+
+	if m.batch != nil {
+		defer m.mu.Unlock()
+		if len(me.deferred) >= m.batch.Queue {
+			return ErrBatchFull
+		}
+		me.deferred = append(me.deferred, append([]byte(nil), frame...))
+		return nil
+	}
+
+	p := me.ep
+	if p == nil {
+		m.mu.Unlock()
+		return fmt.Errorf("manager: endpoint %v is not open", name)
+	}
+	me.busy.begin()
+	m.mu.Unlock()
+
+	//在锁外发送，较慢的写入不阻塞其他操作
+	defer me.busy.end()
+	_, err := p.Write(frame)
+	return err
+}
+
+//立即唤醒，发送所有EndPoint缓存的报文，结果按名称排序。
+//发送紧急报文时调用可以顺带发出缓存的报文，避免模块再次上电
+func (m *Manager) Wake() []FlushResult {
+	m.mu.RLock()
+	closeAfter := m.batch != nil && m.batch.CloseAfterFlush
+	var list []*managedEndPoint
+	for _, me := range m.sorted() {
+		if len(me.deferred) > 0 {
+			list = append(list, me)
+		}
+	}
+	m.mu.RUnlock()
+
+	var results []FlushResult
+	for _, me := range list {
+		r := FlushResult{Name: me.name}
+		m.mu.RLock()
+		wokeUp := me.ep == nil //由本次唤醒打开
+		m.mu.RUnlock()
+
+		//在锁外打开和发送，连接或写入较慢时不阻塞其他操作
+		if r.Err = m.open(me); r.Err == nil {
+			r.Frames, r.Err = m.flush(me)
+			m.mu.Lock()
+			if wokeUp && closeAfter {
+				m.close(me)
+			}
+			m.mu.Unlock()
+		}
+		results = append(results, r)
+	}
+
+	return results
+}
+
+//取出EndPoint缓存的报文在锁外发送，返回发送成功的报文数。
+//发送期间缓存的报文被取出，失败时未发送的报文放回队列头部，延迟发送已关闭时丢弃
+func (m *Manager) flush(me *managedEndPoint) (int, error) {
+	m.mu.Lock()
+	p, frames := me.ep, me.deferred
+	if p == nil {
+		m.mu.Unlock()
+		return 0, fmt.Errorf("batch: %v closed before flush", me.name)
+	}
+	me.deferred = nil
+	me.busy.begin()
+	m.mu.Unlock()
+
+	n := 0
+	var err error
+	for ; n < len(frames); n++ {
+		if _, err = p.Write(frames[n]); err != nil {
+			err = fmt.Errorf("batch: write %v: %v", me.name, err)
+			break
+		}
+	}
+	me.busy.end()
+
+	if n < len(frames) {
+		m.mu.Lock()
+		if m.batch != nil {
+			me.deferred = append(frames[n:len(frames):len(frames)], me.deferred...)
+		}
+		m.mu.Unlock()
+	}
+	return n, err
+}
+
+//返回指定EndPoint缓存的报文数
+func (m *Manager) Deferred(name string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if me, ok := m.endpoints[name]; ok {
+		return len(me.deferred)
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+package endpoint
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+//基准测试默认的往返次数
+const benchmarkCount = 10
+
+//被动计时方式下ReadTimeout为0时等待应答的超时
+const benchmarkTimeout = 5 * time.Second
+
+//基准测试配置
+type BenchmarkConfig struct {
+	Request []byte //每次发送的报文，为空则使用64字节的DefaultSelfTestPattern重复填充
+	Count   int    //往返次数，默认10
+	Echo    bool   //对端回显：读取与Request等长的数据并比对；否则为被动计时，收到任意应答即结束一次往返
+}
+
+//基准测试结果，用于容量规划
+type BenchmarkStats struct {
+	Count         int           //往返次数
+	Failures      int           //失败（超时、比对不一致）的次数
+	MinRTT        time.Duration //最小往返时延
+	MaxRTT        time.Duration //最大往返时延
+	AvgRTT        time.Duration //成功往返的平均时延
+	BytesSent     int           //发送的字节数
+	BytesReceived int           //收到的字节数
+	Elapsed       time.Duration //测试总耗时
+}
+
+//返回收发的总吞吐量，单位字节/秒
+func (s *BenchmarkStats) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.BytesSent+s.BytesReceived) / s.Elapsed.Seconds()
+}
+
+//基准测试：按配置发送请求并等待应答，统计往返时延和吞吐量。
+//Echo方式需要对端回显（比如环回头或echo服务），被动计时方式适用于一问一答的设备。
+//单次往返失败计入Failures，写失败或对端关闭时中止并返回已统计的结果
+func Benchmark(p EndPoint, c *BenchmarkConfig) (*BenchmarkStats, error) {
+	if c == nil {
+		c = &BenchmarkConfig{}
+	}
+	request := c.Request
+	if len(request) == 0 {
+		request = bytes.Repeat(DefaultSelfTestPattern, 64/len(DefaultSelfTestPattern))
+	}
+	count := c.Count
+	if count <= 0 {
+		count = benchmarkCount
+	}
+
+	if sp, ok := p.(SerialEndPoint); ok {
+		//丢弃残留数据，避免计入第一次往返
+		if err := sp.FlushInput(); err != nil {
+			return nil, fmt.Errorf("benchmark: %v", err)
+		}
+	}
+
+	s := &BenchmarkStats{}
+	var total time.Duration
+	buf := make([]byte, len(request)+queryBufferSize)
+	start := time.Now()
+	defer func() {
+		s.Elapsed = time.Since(start)
+		if ok := s.Count - s.Failures; ok > 0 {
+			s.AvgRTT = total / time.Duration(ok)
+		}
+	}()
+
+	for i := 0; i < count; i++ {
+		sent := time.Now()
+		n, err := p.Write(request)
+		s.BytesSent += n
+		if err != nil {
+			return s, fmt.Errorf("benchmark: write: %v", err)
+		}
+		s.Count++
+
+		var failed bool
+		if c.Echo {
+			n, err = ReadExact(p, buf[:len(request)])
+			if err == ErrShortRead {
+				failed, err = true, nil
+			} else if err == nil && !bytes.Equal(buf[:n], request) {
+				failed = true
+			}
+		} else {
+			timeout := p.ReadTimeout()
+			if timeout <= 0 {
+				timeout = benchmarkTimeout
+			}
+			n, err = readWithin(p, buf, timeout)
+			failed = n == 0
+		}
+		s.BytesReceived += n
+		rtt := time.Since(sent)
+
+		if err != nil {
+			return s, fmt.Errorf("benchmark: read: %v", err)
+		}
+		if failed {
+			s.Failures++
+			continue
+		}
+
+		total += rtt
+		if s.MinRTT == 0 || rtt < s.MinRTT {
+			s.MinRTT = rtt
+		}
+		if rtt > s.MaxRTT {
+			s.MaxRTT = rtt
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,11 @@
+package endpoint
+
+import (
+	"os"
+	"syscall"
+)
+
+//把套接字绑定到指定网络接口（SO_BINDTODEVICE），需要CAP_NET_RAW权限
+func bindToDevice(fd, family int, iface string) error {
+	return os.NewSyscallError("setsockopt", syscall.BindToDevice(fd, iface))
+}
@@ -0,0 +1,12 @@
+// +build !linux,!darwin
+
+package endpoint
+
+import (
+	"fmt"
+)
+
+//当前系统不支持把套接字绑定到网络接口
+func bindToDevice(fd, family int, iface string) error {
+	return fmt.Errorf("binding to interface %v is not supported", iface)
+}
@@ -0,0 +1,148 @@
+package endpoint
+
+import (
+	"fmt"
+	"sync"
+)
+
+//广播到单个EndPoint的结果
+type BroadcastResult struct {
+	Name string //EndPoint名称
+	N    int    //发送的字节数
+	Err  error  //发送失败或EndPoint未打开时非nil
+}
+
+//按名称排序的广播结果
+type BroadcastResults []BroadcastResult
+
+//汇总失败的EndPoint，全部成功时返回nil，否则返回*MultiError
+func (r BroadcastResults) Err() error {
+	var errs MultiError
+	for _, res := range r {
+		errs.add(res.Name, res.Err)
+	}
+	return errs.err()
+}
+
+//把同一报文并发写入所有符合条件的EndPoint，用于对时等全局命令。
+//结果按名称排序，未打开的EndPoint在结果中返回错误，可通过Err汇总
+func (m *Manager) Broadcast(sel Selector, frame []byte) BroadcastResults {
+	m.mu.RLock()
+	list := m.selected(sel)
+	results := make(BroadcastResults, len(list))
+	eps := make([]EndPoint, len(list))
+	for i, me := range list {
+		results[i].Name = me.name
+		if eps[i] = me.exposed(); eps[i] != nil {
+			me.busy.begin()
+		}
+	}
+	m.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for i := range results {
+		if eps[i] == nil {
+			results[i].Err = fmt.Errorf("manager: endpoint %v is not open", results[i].Name)
+			continue
+		}
+
+		wg.Add(1)
+		go func(r *BroadcastResult, p EndPoint, busy *inflight) {
+			defer wg.Done()
+			defer busy.end()
+			r.N, r.Err = p.Write(frame)
+		}(&results[i], eps[i], &list[i].busy)
+	}
+	wg.Wait()
+
+	return results
+}
+
+//批量查询时单个应答的缓冲区大小
+const queryBufferSize = 4096
+
+//单个EndPoint的查询结果
+type QueryResult struct {
+	Name     string //EndPoint名称
+	Response []byte //应答数据
+	Err      error  //构造请求、发送或接收失败时非nil
+}
+
+//构造发往指定EndPoint的请求报文
+type RequestBuilder func(name string, labels map[string]string) ([]byte, error)
+
+//对所有符合条件的EndPoint发送请求并接收应答，最多concurrency个并发，
+//结果按完成顺序通过通道返回，全部完成后关闭通道。用于批量读取固件版本等巡检场景
+func (m *Manager) QueryAll(sel Selector, build RequestBuilder, concurrency int) <-chan QueryResult {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	type query struct {
+		name   string
+		labels map[string]string
+		ep     EndPoint
+		busy   *inflight
+	}
+
+	m.mu.RLock()
+	list := m.selected(sel)
+	queries := make([]query, len(list))
+	for i, me := range list {
+		queries[i] = query{name: me.name, labels: me.copyLabels(), ep: me.exposed(), busy: &me.busy}
+		if queries[i].ep != nil {
+			me.busy.begin()
+		}
+	}
+	m.mu.RUnlock()
+
+	results := make(chan QueryResult, concurrency)
+	go func() {
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for _, q := range queries {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(q query) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+
+				r := QueryResult{Name: q.name}
+				r.Response, r.Err = queryEndPoint(q.name, q.labels, q.ep, build)
+				if q.ep != nil {
+					q.busy.end()
+				}
+				results <- r
+			}(q)
+		}
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+//向单个EndPoint发送请求并接收应答
+func queryEndPoint(name string, labels map[string]string, p EndPoint, build RequestBuilder) ([]byte, error) {
+	if p == nil {
+		return nil, fmt.Errorf("manager: endpoint %v is not open", name)
+	}
+
+	req, err := build(name, labels)
+	if err != nil {
+		return nil, fmt.Errorf("manager: build request for %v: %v", name, err)
+	}
+	if _, err = p.Write(req); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, queryBufferSize)
+	n, err := p.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf[:n], nil
+}
@@ -0,0 +1,30 @@
+package endpoint
+
+import (
+	"sync"
+)
+
+//当前系统和内核上可用的功能，应用可据此降级处理，界面可隐藏不支持的选项
+type Features struct {
+	RS485          bool //串口RS485配置（TIOCSRS485），具体串口驱动是否支持需打开后通过RS485()确认
+	CustomBaud     bool //任意波特率（BOTHER），为false时只能使用标准波特率
+	TCPFastOpen    bool //客户端TCP Fast Open（net.ipv4.tcp_fastopen开启客户端）
+	TCPUserTimeout bool //TCP_USER_TIMEOUT
+	BindToDevice   bool //绑定网络接口（SO_BINDTODEVICE/IP_BOUND_IF），老内核上需要CAP_NET_RAW
+	Transparent    bool //透明代理（IP_TRANSPARENT），需要CAP_NET_ADMIN
+	VSock          bool //内核支持AF_VSOCK，用于虚拟机与宿主机通信
+	PTY            bool //伪终端（OpenPTY）
+}
+
+var (
+	capabilitiesOnce sync.Once
+	capabilities     Features
+)
+
+//返回当前系统和内核上可用的功能，第一次调用时探测，之后返回缓存的结果
+func Capabilities() Features {
+	capabilitiesOnce.Do(func() {
+		capabilities = probeCapabilities()
+	})
+	return capabilities
+}
@@ -0,0 +1,46 @@
+package endpoint
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+//内核TCP Fast Open开关，第0位表示允许客户端使用
+const tcpFastOpenSysctl = "/proc/sys/net/ipv4/tcp_fastopen"
+
+//探测当前内核上可用的功能，通过创建临时套接字并设置选项确认权限
+func probeCapabilities() Features {
+	c := Features{
+		RS485:      true,
+		CustomBaud: false, //只支持baudRates中的标准波特率
+	}
+
+	if b, err := ioutil.ReadFile(tcpFastOpenSysctl); err == nil {
+		if v, err := strconv.Atoi(string(bytes.TrimSpace(b))); err == nil {
+			c.TCPFastOpen = v&1 != 0
+		}
+	}
+
+	if fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, syscall.IPPROTO_TCP); err == nil {
+		c.TCPUserTimeout = setUserTimeout(fd, 1) == nil
+		c.BindToDevice = bindToDevice(fd, syscall.AF_INET, "lo") == nil
+		c.Transparent = setNonLocalBind(fd, syscall.AF_INET, false, true) == nil
+		syscall.Close(fd)
+	}
+
+	if fd, err := syscall.Socket(unix.AF_VSOCK, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0); err == nil {
+		c.VSock = true
+		syscall.Close(fd)
+	}
+
+	if _, err := os.Stat(ptmxPath); err == nil {
+		c.PTY = true
+	}
+
+	return c
+}
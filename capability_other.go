@@ -0,0 +1,8 @@
+// +build !linux
+
+package endpoint
+
+//当前系统只支持基本功能
+func probeCapabilities() Features {
+	return Features{}
+}
@@ -0,0 +1,127 @@
+package endpoint
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+//采集时间线，多个EndPoint共享同一时间线，使不同链路的记录可按时间对齐。
+//偏移量基于单调时钟，不受系统时间调整影响
+type Timeline struct {
+	start time.Time //时间线起点
+}
+
+//创建以当前时间为起点的时间线
+func NewTimeline() *Timeline {
+	return &Timeline{start: time.Now()}
+}
+
+//返回时间线起点
+func (t *Timeline) Start() time.Time {
+	return t.start
+}
+
+//返回当前时刻相对起点的偏移
+func (t *Timeline) Now() time.Duration {
+	return time.Since(t.start)
+}
+
+//采集记录
+type CaptureRecord struct {
+	Endpoint  string        //EndPoint名称
+	Direction Direction     //数据方向，Read为RX，Write为TX
+	Offset    time.Duration //相对时间线起点的偏移
+	Data      []byte        //数据
+}
+
+//采集记录的输出
+type CaptureSink interface {
+	WriteRecord(r *CaptureRecord) error
+}
+
+//内存中的采集记录
+type CaptureBuffer struct {
+	mu      sync.Mutex
+	records []CaptureRecord
+}
+
+//保存采集记录
+func (b *CaptureBuffer) WriteRecord(r *CaptureRecord) error {
+	b.mu.Lock()
+	b.records = append(b.records, *r)
+	b.mu.Unlock()
+	return nil
+}
+
+//返回已保存的采集记录
+func (b *CaptureBuffer) Records() []CaptureRecord {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]CaptureRecord(nil), b.records...)
+}
+
+//capture在EndPoint的读写上采集数据
+type capture struct {
+	EndPoint
+	name     string      //EndPoint名称
+	timeline *Timeline   //共享时间线
+	sink     CaptureSink //记录输出
+}
+
+//创建采集读写数据的EndPoint，记录的时间为相对timeline起点的偏移
+func NewCapture(p EndPoint, name string, timeline *Timeline, sink CaptureSink) EndPoint {
+	return &capture{EndPoint: p, name: name, timeline: timeline, sink: sink}
+}
+
+//读取数据并采集
+func (p *capture) Read(b []byte) (n int, err error) {
+	if n, err = p.EndPoint.Read(b); n > 0 {
+		p.record(DirRX, b[:n])
+	}
+	return
+}
+
+//写数据并采集实际发出的部分
+func (p *capture) Write(b []byte) (n int, err error) {
+	if n, err = p.EndPoint.Write(b); n > 0 {
+		p.record(DirTX, b[:n])
+	}
+	return
+}
+
+//修改底层EndPoint的读超时，底层不支持TimeoutSetter时忽略
+func (p *capture) SetReadTimeout(d time.Duration) {
+	setReadTimeout(p.EndPoint, d)
+}
+
+//修改底层EndPoint的写超时，底层不支持TimeoutSetter时忽略
+func (p *capture) SetWriteTimeout(d time.Duration) {
+	setWriteTimeout(p.EndPoint, d)
+}
+
+//输出采集记录，输出失败仅告警
+func (p *capture) record(dir Direction, b []byte) {
+	r := &CaptureRecord{
+		Endpoint:  p.name,
+		Direction: dir,
+		Offset:    p.timeline.Now(),
+		Data:      append([]byte(nil), b...),
+	}
+	if err := p.sink.WriteRecord(r); err != nil {
+		// Warning only.
+		log.Printf("capture: could not write record of %v: %v\n", p.name, err)
+	}
+}
+
+//按时间线偏移合并多路采集记录，偏移相同时保持输入顺序
+func MergeCaptures(captures ...[]CaptureRecord) []CaptureRecord {
+	var merged []CaptureRecord
+	for _, records := range captures {
+		merged = append(merged, records...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Offset < merged[j].Offset })
+
+	return merged
+}
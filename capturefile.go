@@ -0,0 +1,344 @@
+package endpoint
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//保存采集文件密钥的环境变量，取值为十六进制编码的AES密钥
+const CaptureKeyEnv = "ENDPOINT_CAPTURE_KEY"
+
+//单条采集记录的最大长度
+const maxCaptureRecordSize = 16 * 1024 * 1024
+
+//从环境变量CaptureKeyEnv读取采集文件密钥
+func CaptureKeyFromEnv() ([]byte, error) {
+	v := os.Getenv(CaptureKeyEnv)
+	if v == "" {
+		return nil, fmt.Errorf("capture: %v is not set", CaptureKeyEnv)
+	}
+	return parseCaptureKey([]byte(v))
+}
+
+//从密钥文件读取采集文件密钥，文件内容为十六进制编码或原始的16、24、32字节AES密钥
+func CaptureKeyFromFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("capture: read key file: %v", err)
+	}
+	return parseCaptureKey(b)
+}
+
+//解析AES密钥
+func parseCaptureKey(b []byte) ([]byte, error) {
+	key := b
+	if k, err := hex.DecodeString(strings.TrimSpace(string(b))); err == nil {
+		key = k
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("capture: invalid AES key length %v", len(key))
+	}
+}
+
+//创建AES-GCM，key为nil时返回nil表示不加密
+func newCaptureAEAD(key []byte) (cipher.AEAD, error) {
+	if key == nil {
+		return nil, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("capture: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("capture: %v", err)
+	}
+	return aead, nil
+}
+
+//采集文件格式的魔数
+const CaptureMagic = "EPCF"
+
+//采集文件格式的版本。主版本不兼容时读取器拒绝读取；次版本只增加字段，
+//旧的读取器忽略记录和元数据中不认识的部分，因此可以读取新的次版本
+const (
+	CaptureVersionMajor = 1
+	CaptureVersionMinor = 0
+)
+
+//采集文件头的标志
+const captureFlagEncrypted = 0x0001
+
+//采集文件的主版本高于读取器支持的版本
+var ErrCaptureVersion = errors.New("capture: unsupported file version")
+
+//采集文件的元数据，以JSON保存在文件头中，增加字段不影响旧的读取器
+type CaptureHeader struct {
+	Start     time.Time         `json:"start"`               //时间线起点，记录的Offset相对该时间
+	Endpoints []CaptureEndpoint `json:"endpoints,omitempty"` //采集的EndPoint
+	Comment   string            `json:"comment,omitempty"`   //备注
+}
+
+//采集的EndPoint的描述
+type CaptureEndpoint struct {
+	Name    string `json:"name"`              //名称，与CaptureRecord.Endpoint对应
+	Type    string `json:"type,omitempty"`    //类型，比如serial、tcp
+	Address string `json:"address,omitempty"` //地址，比如/dev/ttyS0、192.168.1.1:502
+}
+
+//采集文件写入器，实现CaptureSink。
+//文件头为魔数(4)、主版本(1)、次版本(1)、标志(2)、元数据长度(4)和JSON元数据，
+//之后每条记录为4字节长度加记录内容；加密时元数据和记录内容为随机nonce加AES-GCM密文
+type CaptureWriter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	aead cipher.AEAD //为nil表示不加密
+}
+
+//创建采集文件写入器并写入以当前时间为起点的文件头，key为nil时不加密
+func NewCaptureWriter(w io.Writer, key []byte) (*CaptureWriter, error) {
+	return NewCaptureWriterHeader(w, key, nil)
+}
+
+//创建采集文件写入器并写入带元数据的文件头，h为nil时只记录当前时间为起点
+func NewCaptureWriterHeader(w io.Writer, key []byte, h *CaptureHeader) (*CaptureWriter, error) {
+	aead, err := newCaptureAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if h == nil {
+		h = &CaptureHeader{Start: time.Now()}
+	}
+	meta, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("capture: encode header: %v", err)
+	}
+
+	cw := &CaptureWriter{w: w, aead: aead}
+	if meta, err = cw.seal(meta); err != nil {
+		return nil, err
+	}
+
+	var hdr [12]byte
+	copy(hdr[:4], CaptureMagic)
+	hdr[4], hdr[5] = CaptureVersionMajor, CaptureVersionMinor
+	if aead != nil {
+		binary.BigEndian.PutUint16(hdr[6:], captureFlagEncrypted)
+	}
+	binary.BigEndian.PutUint32(hdr[8:], uint32(len(meta)))
+	if _, err = w.Write(append(hdr[:], meta...)); err != nil {
+		return nil, fmt.Errorf("capture: write header: %v", err)
+	}
+
+	return cw, nil
+}
+
+//写入一条采集记录
+func (w *CaptureWriter) WriteRecord(r *CaptureRecord) error {
+	payload, err := w.seal(encodeCaptureRecord(r))
+	if err != nil {
+		return err
+	}
+
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(payload)))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err = w.w.Write(payload)
+	return err
+}
+
+//加密时返回随机nonce加密文
+func (w *CaptureWriter) seal(payload []byte) ([]byte, error) {
+	if w.aead == nil {
+		return payload, nil
+	}
+	nonce := make([]byte, w.aead.NonceSize(), w.aead.NonceSize()+len(payload)+w.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("capture: generate nonce: %v", err)
+	}
+	return w.aead.Seal(nonce, nonce, payload, nil), nil
+}
+
+//采集文件读取器，兼容没有文件头的旧格式（版本0.0）
+type CaptureReader struct {
+	r      io.Reader
+	aead   cipher.AEAD    //为nil表示不加密
+	major  int            //文件主版本
+	minor  int            //文件次版本
+	header *CaptureHeader //文件元数据
+}
+
+//创建采集文件读取器并读取文件头，key须与写入时一致
+func NewCaptureReader(r io.Reader, key []byte) (*CaptureReader, error) {
+	aead, err := newCaptureAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	cr := &CaptureReader{r: br, aead: aead, header: &CaptureHeader{}}
+
+	//旧格式以记录长度开始，不超过maxCaptureRecordSize，不会与魔数混淆
+	if magic, err := br.Peek(len(CaptureMagic)); err != nil || string(magic) != CaptureMagic {
+		return cr, nil
+	}
+
+	var hdr [12]byte
+	if _, err = io.ReadFull(br, hdr[:]); err != nil {
+		return nil, fmt.Errorf("capture: truncated header: %v", err)
+	}
+	cr.major, cr.minor = int(hdr[4]), int(hdr[5])
+	if cr.major > CaptureVersionMajor {
+		return nil, fmt.Errorf("%w %v.%v", ErrCaptureVersion, cr.major, cr.minor)
+	}
+	if encrypted := binary.BigEndian.Uint16(hdr[6:])&captureFlagEncrypted != 0; encrypted != (aead != nil) {
+		if encrypted {
+			return nil, errors.New("capture: file is encrypted, key required")
+		}
+		return nil, errors.New("capture: file is not encrypted")
+	}
+
+	size := binary.BigEndian.Uint32(hdr[8:])
+	if size > maxCaptureRecordSize {
+		return nil, fmt.Errorf("capture: header too large: %v", size)
+	}
+	meta := make([]byte, size)
+	if _, err = io.ReadFull(br, meta); err != nil {
+		return nil, fmt.Errorf("capture: truncated header: %v", err)
+	}
+	if meta, err = cr.open(meta); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(meta, cr.header); err != nil {
+		return nil, fmt.Errorf("capture: decode header: %v", err)
+	}
+
+	return cr, nil
+}
+
+//返回文件的主版本和次版本，旧格式为0.0
+func (r *CaptureReader) Version() (major, minor int) {
+	return r.major, r.minor
+}
+
+//返回文件元数据，旧格式没有元数据，返回零值
+func (r *CaptureReader) Header() CaptureHeader {
+	return *r.header
+}
+
+//读取一条采集记录，读完返回io.EOF
+func (r *CaptureReader) ReadRecord() (*CaptureRecord, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[:])
+	if size > maxCaptureRecordSize {
+		return nil, fmt.Errorf("capture: record too large: %v", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return nil, fmt.Errorf("capture: truncated record: %v", err)
+	}
+
+	payload, err := r.open(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.major == 0 {
+		return decodeLegacyCaptureRecord(payload)
+	}
+	return decodeCaptureRecord(payload)
+}
+
+//加密时解密随机nonce加密文
+func (r *CaptureReader) open(payload []byte) ([]byte, error) {
+	if r.aead == nil {
+		return payload, nil
+	}
+	ns := r.aead.NonceSize()
+	if len(payload) < ns {
+		return nil, errors.New("capture: truncated nonce")
+	}
+	b, err := r.aead.Open(nil, payload[:ns], payload[ns:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("capture: decrypt record: %v", err)
+	}
+	return b, nil
+}
+
+//编码采集记录：名称长度(2)、名称、方向(1)、偏移纳秒(8)、数据长度(4)、数据。
+//之后的次版本只在末尾追加字段
+func encodeCaptureRecord(r *CaptureRecord) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint16(len(r.Endpoint)))
+	buf.WriteString(r.Endpoint)
+	buf.WriteByte(byte(r.Direction))
+	binary.Write(&buf, binary.BigEndian, int64(r.Offset))
+	binary.Write(&buf, binary.BigEndian, uint32(len(r.Data)))
+	buf.Write(r.Data)
+	return buf.Bytes()
+}
+
+//解码采集记录，忽略末尾新版本追加的字段
+func decodeCaptureRecord(b []byte) (*CaptureRecord, error) {
+	r, rest, err := decodeCaptureRecordHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < 4 || uint32(len(rest)-4) < binary.BigEndian.Uint32(rest) {
+		return nil, errors.New("capture: malformed record")
+	}
+	r.Data = append([]byte(nil), rest[4:4+binary.BigEndian.Uint32(rest)]...)
+	return r, nil
+}
+
+//解码旧格式的采集记录，名称、方向和偏移之后全部为数据
+func decodeLegacyCaptureRecord(b []byte) (*CaptureRecord, error) {
+	r, rest, err := decodeCaptureRecordHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	r.Data = append([]byte(nil), rest...)
+	return r, nil
+}
+
+//解码名称、方向和偏移，返回剩余部分
+func decodeCaptureRecordHeader(b []byte) (*CaptureRecord, []byte, error) {
+	if len(b) < 2 {
+		return nil, nil, errors.New("capture: malformed record")
+	}
+	nameLen := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < nameLen+9 {
+		return nil, nil, errors.New("capture: malformed record")
+	}
+
+	return &CaptureRecord{
+		Endpoint:  string(b[:nameLen]),
+		Direction: Direction(b[nameLen]),
+		Offset:    time.Duration(binary.BigEndian.Uint64(b[nameLen+1:])),
+	}, b[nameLen+9:], nil
+}
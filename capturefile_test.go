@@ -0,0 +1,288 @@
+package endpoint
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testCaptureRecords = []CaptureRecord{
+	{Endpoint: "plc", Direction: DirTX, Offset: 0, Data: []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0a}},
+	{Endpoint: "plc", Direction: DirRX, Offset: 35 * time.Millisecond, Data: []byte{0x01, 0x03, 0x14}},
+	{Endpoint: "网关", Direction: DirRX, Offset: time.Hour},
+	{Endpoint: "", Direction: DirTX, Offset: 2 * time.Hour, Data: bytes.Repeat([]byte{0xff}, 1000)},
+}
+
+//写入采集文件，返回文件内容
+func writeCaptureFile(t *testing.T, key []byte, h *CaptureHeader, records []CaptureRecord) []byte {
+	var buf bytes.Buffer
+	w, err := NewCaptureWriterHeader(&buf, key, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range records {
+		if err = w.WriteRecord(&records[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+//读出采集文件中的全部记录，直到io.EOF或出错
+func readCaptureFile(r *CaptureReader) ([]CaptureRecord, error) {
+	var records []CaptureRecord
+	for {
+		rec, err := r.ReadRecord()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		records = append(records, *rec)
+	}
+}
+
+func TestCaptureFileRoundTrip(t *testing.T) {
+	h := &CaptureHeader{
+		Start:     time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC),
+		Endpoints: []CaptureEndpoint{{Name: "plc", Type: "serial", Address: "/dev/ttyS0"}, {Name: "网关", Type: "tcp", Address: "192.168.1.1:502"}},
+		Comment:   "现场采集",
+	}
+	file := writeCaptureFile(t, nil, h, testCaptureRecords)
+
+	r, err := NewCaptureReader(bytes.NewReader(file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if major, minor := r.Version(); major != CaptureVersionMajor || minor != CaptureVersionMinor {
+		t.Errorf("Version = %v.%v, want %v.%v", major, minor, CaptureVersionMajor, CaptureVersionMinor)
+	}
+	got := r.Header()
+	if !got.Start.Equal(h.Start) || !reflect.DeepEqual(got.Endpoints, h.Endpoints) || got.Comment != h.Comment {
+		t.Errorf("Header = %+v, want %+v", got, *h)
+	}
+	records, err := readCaptureFile(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(records, testCaptureRecords) {
+		t.Errorf("records = %+v, want %+v", records, testCaptureRecords)
+	}
+}
+
+//文件在任意位置被截断时，完整的记录仍能读出，之后返回错误而不是panic或静默结束
+func TestCaptureFileTruncated(t *testing.T) {
+	file := writeCaptureFile(t, nil, nil, testCaptureRecords)
+	headerLen := 12 + int(binary.BigEndian.Uint32(file[8:]))
+
+	//每条记录的结束位置
+	var ends []int
+	for off := headerLen; off < len(file); {
+		off += 4 + int(binary.BigEndian.Uint32(file[off:]))
+		ends = append(ends, off)
+	}
+	if len(ends) != len(testCaptureRecords) || ends[len(ends)-1] != len(file) {
+		t.Fatalf("record ends %v, file length %v", ends, len(file))
+	}
+
+	for cut := 0; cut < len(file); cut++ {
+		r, err := NewCaptureReader(bytes.NewReader(file[:cut]), nil)
+		if cut < headerLen {
+			//魔数不完整时按旧格式处理，否则文件头被截断
+			if cut >= len(CaptureMagic) && (err == nil || !strings.Contains(err.Error(), "truncated header")) {
+				t.Errorf("cut %v: NewCaptureReader err = %v, want truncated header", cut, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("cut %v: %v", cut, err)
+		}
+
+		complete := 0
+		for complete < len(ends) && ends[complete] <= cut {
+			complete++
+		}
+		records, err := readCaptureFile(r)
+		if len(records) != complete || (complete > 0 && !reflect.DeepEqual(records, testCaptureRecords[:complete])) {
+			t.Errorf("cut %v: read %v records, want %v", cut, len(records), complete)
+		}
+		atBoundary := cut == headerLen || (complete > 0 && ends[complete-1] == cut)
+		if atBoundary && err != nil {
+			t.Errorf("cut %v at record boundary: err = %v, want io.EOF", cut, err)
+		} else if !atBoundary && err == nil {
+			t.Errorf("cut %v inside record: err = nil, want truncated", cut)
+		}
+	}
+}
+
+//没有文件头的旧格式记录以名称、方向和偏移之后的全部内容为数据
+func TestCaptureFileLegacy(t *testing.T) {
+	var file []byte
+	for _, rec := range testCaptureRecords[:2] {
+		payload := encodeCaptureRecord(&rec)
+		//旧格式没有数据长度字段
+		headLen := 2 + len(rec.Endpoint) + 9
+		payload = append(payload[:headLen:headLen], rec.Data...)
+		var hdr [4]byte
+		binary.BigEndian.PutUint32(hdr[:], uint32(len(payload)))
+		file = append(append(file, hdr[:]...), payload...)
+	}
+
+	r, err := NewCaptureReader(bytes.NewReader(file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if major, minor := r.Version(); major != 0 || minor != 0 {
+		t.Errorf("Version = %v.%v, want 0.0", major, minor)
+	}
+	records, err := readCaptureFile(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(records, testCaptureRecords[:2]) {
+		t.Errorf("records = %+v, want %+v", records, testCaptureRecords[:2])
+	}
+}
+
+var testCaptureKey = bytes.Repeat([]byte{0x42}, 32)
+
+//加密的采集文件可用同一密钥读回，文件中不出现明文
+func TestCaptureFileEncrypted(t *testing.T) {
+	h := &CaptureHeader{Start: time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC), Comment: "secret-comment"}
+	file := writeCaptureFile(t, testCaptureKey, h, testCaptureRecords)
+
+	for _, plain := range []string{"secret-comment", "plc", "\x01\x03\x00\x00\x00\x0a"} {
+		if bytes.Contains(file, []byte(plain)) {
+			t.Errorf("encrypted file contains %q", plain)
+		}
+	}
+
+	r, err := NewCaptureReader(bytes.NewReader(file), testCaptureKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Header(); got.Comment != h.Comment || !got.Start.Equal(h.Start) {
+		t.Errorf("Header = %+v, want %+v", got, *h)
+	}
+	records, err := readCaptureFile(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(records, testCaptureRecords) {
+		t.Errorf("records = %+v, want %+v", records, testCaptureRecords)
+	}
+}
+
+//密文被篡改时认证失败，不返回被篡改的数据
+func TestCaptureFileTampered(t *testing.T) {
+	file := writeCaptureFile(t, testCaptureKey, nil, testCaptureRecords[:1])
+	headerLen := 12 + int(binary.BigEndian.Uint32(file[8:]))
+
+	//篡改元数据
+	bad := append([]byte(nil), file...)
+	bad[headerLen-1] ^= 0x01
+	if _, err := NewCaptureReader(bytes.NewReader(bad), testCaptureKey); err == nil || !strings.Contains(err.Error(), "decrypt") {
+		t.Errorf("tampered header: err = %v, want decrypt error", err)
+	}
+
+	//篡改记录的nonce、密文和认证标签
+	for _, off := range []int{headerLen + 4, headerLen + 4 + 12, len(file) - 1} {
+		bad = append(bad[:0], file...)
+		bad[off] ^= 0x80
+		r, err := NewCaptureReader(bytes.NewReader(bad), testCaptureKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec, err := r.ReadRecord(); err == nil || !strings.Contains(err.Error(), "decrypt") {
+			t.Errorf("tampered byte %v: ReadRecord = %+v, %v, want decrypt error", off, rec, err)
+		}
+	}
+
+	//截断到nonce之内
+	bad = append(bad[:0], file[:headerLen]...)
+	bad = append(bad, 0, 0, 0, 4, 1, 2, 3, 4)
+	r, err := NewCaptureReader(bytes.NewReader(bad), testCaptureKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.ReadRecord(); err == nil || !strings.Contains(err.Error(), "truncated nonce") {
+		t.Errorf("short record: err = %v, want truncated nonce", err)
+	}
+}
+
+//密钥错误、缺少密钥或对未加密文件提供密钥时拒绝读取
+func TestCaptureFileWrongKey(t *testing.T) {
+	encrypted := writeCaptureFile(t, testCaptureKey, nil, testCaptureRecords[:1])
+	plain := writeCaptureFile(t, nil, nil, testCaptureRecords[:1])
+
+	wrong := bytes.Repeat([]byte{0x24}, 32)
+	if _, err := NewCaptureReader(bytes.NewReader(encrypted), wrong); err == nil || !strings.Contains(err.Error(), "decrypt") {
+		t.Errorf("wrong key: err = %v, want decrypt error", err)
+	}
+	if _, err := NewCaptureReader(bytes.NewReader(encrypted), testCaptureKey[:16]); err == nil {
+		t.Error("wrong key length: err = nil")
+	}
+	if _, err := NewCaptureReader(bytes.NewReader(encrypted), nil); err == nil || !strings.Contains(err.Error(), "key required") {
+		t.Errorf("no key: err = %v, want key required", err)
+	}
+	if _, err := NewCaptureReader(bytes.NewReader(plain), testCaptureKey); err == nil || !strings.Contains(err.Error(), "not encrypted") {
+		t.Errorf("key for plain file: err = %v, want not encrypted", err)
+	}
+}
+
+func TestCaptureKey(t *testing.T) {
+	hexKey := strings.Repeat("42", 32)
+	tests := []struct {
+		name    string
+		in      string
+		wantLen int //0表示应返回错误
+	}{
+		{"hex", hexKey, 32},
+		{"hex with newline", hexKey[:32] + "\n", 16},
+		{"raw", strings.Repeat("k", 24), 24},
+		{"short", "0102", 0},
+		{"odd length", strings.Repeat("k", 20), 0},
+	}
+	for _, tt := range tests {
+		key, err := parseCaptureKey([]byte(tt.in))
+		if tt.wantLen == 0 {
+			if err == nil {
+				t.Errorf("%v: err = nil, want invalid key length", tt.name)
+			}
+			continue
+		}
+		if err != nil || len(key) != tt.wantLen {
+			t.Errorf("%v: key length %v, err %v, want %v", tt.name, len(key), err, tt.wantLen)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "capture.key")
+	if err = ioutil.WriteFile(path, []byte(hexKey+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := CaptureKeyFromFile(path); err != nil || !bytes.Equal(key, testCaptureKey) {
+		t.Errorf("CaptureKeyFromFile = %x, %v", key, err)
+	}
+
+	os.Setenv(CaptureKeyEnv, hexKey)
+	defer os.Unsetenv(CaptureKeyEnv)
+	if key, err := CaptureKeyFromEnv(); err != nil || !bytes.Equal(key, testCaptureKey) {
+		t.Errorf("CaptureKeyFromEnv = %x, %v", key, err)
+	}
+	os.Unsetenv(CaptureKeyEnv)
+	if _, err := CaptureKeyFromEnv(); err == nil {
+		t.Error("CaptureKeyFromEnv without variable: err = nil")
+	}
+}
@@ -0,0 +1,139 @@
+package endpoint
+
+import (
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+//混沌测试注入的断开错误
+var ErrChaosDisconnect = errors.New("chaos: injected disconnect")
+
+//混沌测试配置，各概率取值范围[0, 1]，对每次Read/Write独立判定
+type ChaosConfig struct {
+	Seed           int64         //随机种子，相同种子和名称的EndPoint注入序列相同
+	DisconnectRate float64       //注入断开的概率，断开后EndPoint被关闭
+	DelayRate      float64       //注入延迟的概率
+	MaxDelay       time.Duration //注入延迟的上限
+	BitErrorRate   float64       //注入比特错误（随机翻转1个比特）的概率
+}
+
+//chaosEndPoint在EndPoint的读写上注入故障
+type chaosEndPoint struct {
+	EndPoint
+	config ChaosConfig //混沌测试配置
+	mu     sync.Mutex  //保护rnd
+	rnd    *rand.Rand  //随机数发生器
+}
+
+//开启混沌测试，已打开和之后打开的EndPoint都会被注入故障
+func (m *Manager) EnableChaos(c ChaosConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.chaos = &c
+	for _, me := range m.endpoints {
+		if me.raw == nil {
+			continue
+		}
+		me.chaos = newChaos(me.raw, m.chaos, me.name)
+		me.wrap()
+	}
+}
+
+//关闭混沌测试，恢复原始EndPoint
+func (m *Manager) DisableChaos() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.chaos = nil
+	for _, me := range m.endpoints {
+		me.chaos = nil
+		me.wrap()
+	}
+}
+
+//创建注入故障的EndPoint，随机种子由配置种子和名称共同决定
+func newChaos(p EndPoint, c *ChaosConfig, name string) EndPoint {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+
+	return &chaosEndPoint{
+		EndPoint: p,
+		config:   *c,
+		rnd:      rand.New(rand.NewSource(c.Seed ^ int64(h.Sum64()))),
+	}
+}
+
+//读取数据，按配置注入延迟、断开和比特错误
+func (p *chaosEndPoint) Read(b []byte) (n int, err error) {
+	if err = p.inject(); err != nil {
+		return
+	}
+	if n, err = p.EndPoint.Read(b); n > 0 {
+		p.corrupt(b[:n])
+	}
+
+	return
+}
+
+//写数据，按配置注入延迟、断开和比特错误
+func (p *chaosEndPoint) Write(b []byte) (int, error) {
+	if err := p.inject(); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, len(b))
+	copy(buf, b)
+	p.corrupt(buf)
+
+	return p.EndPoint.Write(buf)
+}
+
+//修改底层EndPoint的读超时，底层不支持TimeoutSetter时忽略
+func (p *chaosEndPoint) SetReadTimeout(d time.Duration) {
+	setReadTimeout(p.EndPoint, d)
+}
+
+//修改底层EndPoint的写超时，底层不支持TimeoutSetter时忽略
+func (p *chaosEndPoint) SetWriteTimeout(d time.Duration) {
+	setWriteTimeout(p.EndPoint, d)
+}
+
+//注入延迟和断开
+func (p *chaosEndPoint) inject() error {
+	p.mu.Lock()
+	var delay time.Duration
+	if p.config.MaxDelay > 0 && p.rnd.Float64() < p.config.DelayRate {
+		delay = time.Duration(p.rnd.Int63n(int64(p.config.MaxDelay)))
+	}
+	disconnect := p.rnd.Float64() < p.config.DisconnectRate
+	p.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if disconnect {
+		p.EndPoint.Close()
+		return ErrChaosDisconnect
+	}
+
+	return nil
+}
+
+//注入比特错误
+func (p *chaosEndPoint) corrupt(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.rnd.Float64() < p.config.BitErrorRate {
+		i := p.rnd.Intn(len(b) * 8)
+		b[i/8] ^= 1 << uint(i%8)
+	}
+}
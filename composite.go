@@ -0,0 +1,76 @@
+package endpoint
+
+import (
+	"fmt"
+	"sync"
+)
+
+//通过控制EndPoint把设备切换到指定通道，比如选择RS485多路复用器的通道
+type SwitchFunc func(control EndPoint, channel int) error
+
+//组合EndPoint：控制EndPoint负责切换设备通道，数据EndPoint承载业务报文。
+//切换和数据收发在同一把锁内完成，多个协程并发访问不同通道时不会互相打断
+type Composite struct {
+	mu       sync.Mutex
+	control  EndPoint   //控制EndPoint
+	data     EndPoint   //数据EndPoint
+	switchFn SwitchFunc //通道切换函数
+	channel  int        //当前通道，-1表示未知
+}
+
+//创建组合EndPoint，control和data需已打开
+func NewComposite(control, data EndPoint, fn SwitchFunc) *Composite {
+	return &Composite{
+		control:  control,
+		data:     data,
+		switchFn: fn,
+		channel:  -1,
+	}
+}
+
+//切换到channel后在数据EndPoint上执行fn，切换和fn之间不会插入其他事务。
+//已处于该通道时不重复切换，切换失败时当前通道置为未知
+func (c *Composite) Transact(channel int, fn func(data EndPoint) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.channel != channel {
+		if err := c.switchFn(c.control, channel); err != nil {
+			c.channel = -1
+			return fmt.Errorf("composite: switch to channel %v: %v", channel, err)
+		}
+		c.channel = channel
+	}
+
+	return fn(c.data)
+}
+
+//返回当前通道，-1表示未知
+func (c *Composite) Channel() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.channel
+}
+
+//使当前通道失效，下次事务会重新切换，用于设备被外部复位等情况
+func (c *Composite) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.channel = -1
+}
+
+//关闭控制和数据EndPoint，返回遇到的第一个错误
+func (c *Composite) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.data.Close()
+	if e := c.control.Close(); e != nil && err == nil {
+		err = e
+	}
+	c.channel = -1
+
+	return err
+}
@@ -0,0 +1,124 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+//等待总线空闲超时
+var ErrBusBusy = errors.New("csma: bus busy")
+
+//CSMA默认参数
+const (
+	csmaIdleChars   = 4           //判定总线空闲的静默字符数
+	csmaMaxAttempts = 10          //发生冲突时的最大发送次数
+	csmaIdleTimeout = time.Second //等待总线空闲的超时
+	csmaMaxBackoff  = 10          //退避时隙数上限的指数（2^10）
+)
+
+//载波侦听多路访问配置，用于没有单一主站的点对点RS485网络
+type CSMAConfig struct {
+	BaudRate    int           //波特率，用于计算字符时间（按每字符11位）
+	IdleChars   int           //连续多少个字符时间没有收到数据判定为总线空闲，默认4
+	SlotTime    time.Duration //冲突退避的时隙，默认IdleChars个字符时间
+	MaxAttempts int           //发生冲突时的最大发送次数，默认10
+	IdleTimeout time.Duration //每次发送前等待总线空闲的超时，超过时返回ErrBusBusy，默认1s
+}
+
+//载波侦听多路访问：发送前侦听总线空闲，冲突后随机退避重发。
+//冲突检测依赖串口的VerifyEcho，写返回ErrCollision时视为冲突
+type CSMA struct {
+	SerialEndPoint
+	idle        time.Duration //判定总线空闲的静默时长
+	poll        time.Duration //侦听总线的间隔（一个字符时间）
+	slot        time.Duration //退避时隙
+	maxAttempts int           //最大发送次数
+	idleTimeout time.Duration //等待总线空闲的超时
+	rand        *rand.Rand
+}
+
+//创建CSMA发送门控
+func NewCSMA(p SerialEndPoint, c *CSMAConfig) (*CSMA, error) {
+	if c.BaudRate <= 0 {
+		return nil, fmt.Errorf("csma: invalid baud rate %v", c.BaudRate)
+	}
+
+	charTime := time.Duration(11) * time.Second / time.Duration(c.BaudRate)
+	idleChars := c.IdleChars
+	if idleChars <= 0 {
+		idleChars = csmaIdleChars
+	}
+
+	m := &CSMA{
+		SerialEndPoint: p,
+		idle:           charTime * time.Duration(idleChars),
+		poll:           charTime,
+		slot:           c.SlotTime,
+		maxAttempts:    c.MaxAttempts,
+		idleTimeout:    c.IdleTimeout,
+		rand:           rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if m.poll < time.Millisecond {
+		m.poll = time.Millisecond
+	}
+	if m.slot <= 0 {
+		m.slot = m.idle
+	}
+	if m.maxAttempts <= 0 {
+		m.maxAttempts = csmaMaxAttempts
+	}
+	if m.idleTimeout <= 0 {
+		m.idleTimeout = csmaIdleTimeout
+	}
+
+	return m, nil
+}
+
+//等待总线空闲后发送，发生冲突时按二进制指数随机退避后重发
+func (m *CSMA) Write(b []byte) (n int, err error) {
+	for attempt := 1; ; attempt++ {
+		if err = m.waitIdle(); err != nil {
+			return 0, err
+		}
+
+		n, err = m.SerialEndPoint.Write(b)
+		if !errors.Is(err, ErrCollision) || attempt >= m.maxAttempts {
+			return
+		}
+
+		exp := attempt
+		if exp > csmaMaxBackoff {
+			exp = csmaMaxBackoff
+		}
+		time.Sleep(m.slot * time.Duration(m.rand.Intn(1<<uint(exp))))
+	}
+}
+
+//等待总线静默一段时间，通过接收缓冲区字节数的变化侦听总线，不消费收到的数据
+func (m *CSMA) waitIdle() error {
+	expireTime := time.Now().Add(m.idleTimeout)
+
+	last, err := m.InputWaiting()
+	if err != nil {
+		return fmt.Errorf("csma: %v", err)
+	}
+	quietSince := time.Now()
+	for time.Since(quietSince) < m.idle {
+		if time.Now().After(expireTime) {
+			return ErrBusBusy
+		}
+		time.Sleep(m.poll)
+
+		waiting, err := m.InputWaiting()
+		if err != nil {
+			return fmt.Errorf("csma: %v", err)
+		}
+		if waiting != last {
+			last, quietSince = waiting, time.Now()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package endpoint
+
+import (
+	"sync"
+	"time"
+)
+
+//EndPoint默认配置，配置中未设置（<=0）的项使用默认值
+type Defaults struct {
+	ReadTimeout  time.Duration //默认读超时，0表示不设置
+	WriteTimeout time.Duration //默认写超时，0表示不设置
+}
+
+var (
+	defaultsMu sync.RWMutex
+	defaults   = map[EndPointType]Defaults{
+		EndPointSerial: {
+			ReadTimeout:  5000 * time.Millisecond, //默认读超时5000ms
+			WriteTimeout: 1000 * time.Millisecond, //默认写超时1000ms
+		},
+	}
+)
+
+//设置指定类型EndPoint的默认配置，只影响之后打开的EndPoint
+func SetDefaults(t EndPointType, d Defaults) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+
+	defaults[t] = d
+}
+
+//返回指定类型EndPoint的默认配置
+func GetDefaults(t EndPointType) Defaults {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+
+	return defaults[t]
+}
+
+//返回生效的读写超时，未配置时使用默认值
+func defaultTimeouts(t EndPointType, read, write time.Duration) (time.Duration, time.Duration) {
+	d := GetDefaults(t)
+	if read <= 0 {
+		read = d.ReadTimeout
+	}
+	if write <= 0 {
+		write = d.WriteTimeout
+	}
+
+	return read, write
+}
@@ -1,6 +1,7 @@
 package endpoint
 
 import (
+	"fmt"
 	"io"
 	"net"
 	"syscall"
@@ -15,8 +16,34 @@ const (
 	EndPointUnix
 	EndPointUDP
 	EndPointSerial
+	EndPointNull
+	EndPointFile
+	EndPointRFC2217
+	EndPointModem
+	EndPointTLS
 )
 
+//EndPoint类型名称
+var endPointTypeNames = []string{
+	EndPointTCP:     "tcp",
+	EndPointUnix:    "unix",
+	EndPointUDP:     "udp",
+	EndPointSerial:  "serial",
+	EndPointNull:    "null",
+	EndPointFile:    "file",
+	EndPointRFC2217: "rfc2217",
+	EndPointModem:   "modem",
+	EndPointTLS:     "tls",
+}
+
+//返回类型名称，比如tcp、serial
+func (t EndPointType) String() string {
+	if t >= 0 && int(t) < len(endPointTypeNames) {
+		return endPointTypeNames[t]
+	}
+	return fmt.Sprintf("EndPointType(%d)", int(t))
+}
+
 //EndPoint配置基类
 type EndPointConfig interface {
 	Type() EndPointType  //返回Endpoint类型
@@ -36,10 +63,107 @@ type EndPoint interface {
 	WriteTimeout() time.Duration //一次完整数据包发送超时
 }
 
+//超时修改接口，可通过类型断言从EndPoint获取，内置EndPoint及Manager返回的包装均支持
+type TimeoutSetter interface {
+	SetReadTimeout(time.Duration)  //修改读取超时
+	SetWriteTimeout(time.Duration) //修改发送超时
+}
+
+//修改p的读超时，p不支持TimeoutSetter时返回false
+func setReadTimeout(p EndPoint, d time.Duration) bool {
+	if s, ok := p.(TimeoutSetter); ok {
+		s.SetReadTimeout(d)
+		return true
+	}
+	return false
+}
+
+//修改p的写超时，p不支持TimeoutSetter时返回false
+func setWriteTimeout(p EndPoint, d time.Duration) bool {
+	if s, ok := p.(TimeoutSetter); ok {
+		s.SetWriteTimeout(d)
+		return true
+	}
+	return false
+}
+
+//串口扩展接口，可通过类型断言从串口EndPoint获取
+type SerialEndPoint interface {
+	EndPoint
+	ModemStatus() (ModemLine, error)                                            //返回调制解调器控制线状态
+	WaitForLineChange(mask ModemLine, timeout time.Duration) (ModemLine, error) //阻塞直到mask中的控制线变化或超时
+	RS485() (RS485Config, error)                                                //返回驱动实际生效的RS485配置
+	SetConfig(c *SerialConfig) error                                            //不重新打开串口，重新设置波特率、数据位、停止位和校验位
+	FlushInput() error                                                          //丢弃已收到但未读取的数据
+	FlushOutput() error                                                         //丢弃已写入但未发送的数据
+	Drain() error                                                               //阻塞直到已写入的数据全部发出
+	InputWaiting() (int, error)                                                 //返回已收到但未读取的字节数
+	OutputPending() (int, error)                                                //返回已写入但未发送的字节数
+	ParityErrors() uint64                                                       //返回累计的校验和帧错误字节数
+	WriteAddressed(addr byte, data []byte) (int, error)                         //多机通信：地址字节以MARK校验、数据以SPACE校验发送
+	SendBreak(d time.Duration) error                                            //发送持续d的BREAK信号，d<=0时使用系统默认时长（0.25～0.5秒）
+	SetCanonical(on bool) error                                                 //切换行模式（ICANON）和原始模式，不影响波特率等其他配置
+}
+
+//报文扩展接口，可通过类型断言从UDP EndPoint获取，一个EndPoint可与多个对端通信
+type PacketEndPoint interface {
+	EndPoint
+	ReadFrom(b []byte) (int, net.Addr, error)     //读取一个报文，同时返回来源地址
+	WriteTo(b []byte, addr net.Addr) (int, error) //向指定地址发送一个报文，addr须为*net.UDPAddr
+	ReadMsg(b []byte) (int, *PacketInfo, error)   //读取一个报文及其目的地址、接收接口和TTL，需开启ReceivePacketInfo
+	MTU() (int, error)                            //返回内核已知的到目标地址的路径MTU，需开启Connected
+	ReadError() (*ICMPError, error)               //从错误队列读取一个ICMP差错，不等待，队列为空时返回nil，需开启ReceiveErrors
+	ReadBatch(msgs []Datagram) (int, error)       //一次系统调用（recvmmsg）读取多个报文，返回读取的报文数
+	WriteBatch(msgs []Datagram) (int, error)      //一次系统调用（sendmmsg）发送多个报文，返回发送的报文数
+}
+
+//半关闭接口，TCP、TLS和UnixSocket EndPoint均支持，用于以半关闭表示请求结束的协议
+type HalfCloser interface {
+	CloseWrite() error //关闭发送方向（shutdown SHUT_WR），对端读到EOF，仍可继续读取
+	CloseRead() error  //关闭接收方向（shutdown SHUT_RD），仍可继续发送
+}
+
+//TCP扩展接口，可通过类型断言从TCP EndPoint获取
+type TCPEndPoint interface {
+	EndPoint
+	HalfCloser
+	DetectStale(probe []byte, timeout time.Duration) error //检查长时间空闲的连接是否失效，失效时返回包装ErrStale的错误
+	SetQuickAck(on bool) error                             //开启或关闭TCP_QUICKACK，开启后每次读取后重新设置，避免延迟确认增加事务时延
+	Info() (*TCPInfo, error)                               //返回连接的内核统计（TCP_INFO），包括RTT、重传和拥塞窗口
+	WriteOOB(b []byte) (int, error)                        //以紧急数据（MSG_OOB）发送，最后一个字节为紧急字节
+	ReadOOB() (byte, error)                                //在读超时内等待并读取紧急字节，开启OOBInline时不可用
+	AtMark() (bool, error)                                 //读位置是否在紧急数据标记处，开启OOBInline时用于定位紧急字节
+}
+
+//调制解调器控制线，取值与TIOCM_*一致
+type ModemLine int
+
+const (
+	LineDTR ModemLine = 0x002 //数据终端就绪
+	LineRTS ModemLine = 0x004 //请求发送
+	LineCTS ModemLine = 0x020 //清除发送
+	LineDCD ModemLine = 0x040 //载波检测
+	LineRI  ModemLine = 0x080 //振铃指示
+	LineDSR ModemLine = 0x100 //数据设备就绪
+)
+
 //打开串口或网口
 func Open(c EndPointConfig) (p EndPoint, err error) {
-	p = newEndPoint(c)
+	if p = newEndPoint(c); p == nil {
+		err = fmt.Errorf("endpoint: unsupported endpoint type %v", c.Type())
+		return
+	}
 	err = p.Open(c)
+
+	//配置了RetryCount时，暂时的连接失败按指数退避重试
+	if rc, ok := c.(retryConfig); ok && err != nil {
+		count, backoff := rc.retryPolicy()
+		for i := 0; i < count && isTransientDialError(err); i++ {
+			time.Sleep(retryDelay(backoff, i))
+			p = newEndPoint(c)
+			err = p.Open(c)
+		}
+	}
 	return
 }
 
@@ -54,6 +178,16 @@ func newEndPoint(c EndPointConfig) EndPoint {
 		return newUnixSocket()
 	case EndPointSerial:
 		return newSerial()
+	case EndPointNull:
+		return newNull()
+	case EndPointFile:
+		return newFile()
+	case EndPointRFC2217:
+		return newRFC2217()
+	case EndPointModem:
+		return newModem()
+	case EndPointTLS:
+		return newTLS()
 	default:
 		return nil
 	}
@@ -70,16 +204,44 @@ const (
 	PARITY_SPACE ParityMode = 4 //空白校验（全是0）
 )
 
+//1.5位停止位，仅在5位数据位时可用
+const STOPBITS_1_5 = 15
+
 //串口配置
 type SerialConfig struct {
-	Address      string        //串口路径，比如/dev/ttyS0
-	BaudRate     int           //波特率，默认值9600
-	DataBits     int           //数据位长度（5、6、7、8），默认8
-	StopBits     int           //停止位长度（1、2），默认1
-	Parity       ParityMode    //校验模式
-	ReadTimeout  time.Duration //一次完全数据包的收取超时
-	WriteTimeout time.Duration //一次完整数据包的发送超时
-	RS485        RS485Config   //RS485配置
+	Address        string        //串口路径，比如/dev/ttyS0
+	BaudRate       int           //波特率，默认值9600
+	DataBits       int           //数据位长度（5、6、7、8），默认8
+	StopBits       int           //停止位长度（1、2、STOPBITS_1_5），默认1
+	Parity         ParityMode    //校验模式
+	ReadTimeout    time.Duration //一次完全数据包的收取超时
+	WriteTimeout   time.Duration //一次完整数据包的发送超时
+	MaxReadSize    int           //单次读取的最大报文长度，超过时返回FrameSizeError，0表示不限制
+	MaxWriteSize   int           //单次发送的最大报文长度，超过时返回FrameSizeError，0表示不限制
+	RS485          RS485Config   //RS485配置
+	Exclusive      bool          //独占串口（TIOCEXCL），其他进程无法再打开
+	LockFile       bool          //创建/var/lock/LCK..ttyX锁文件，与其他遵循UUCP锁约定的程序互斥
+	MarkParity     bool          //开启PARMRK标记校验和帧错误，Read返回ParityError而不是静默传递错误字节
+	InterFrameGap  time.Duration //帧间隔（如Modbus的T3.5），收到数据后线路静默该时长即返回，0表示等待至读超时
+	CarrierDetect  bool          //不忽略控制线（清除CLOCAL），打开时等待DCD，载波丢失后读写返回ErrCarrierLost，用于拨号调制解调器
+	CarrierTimeout time.Duration //开启CarrierDetect时打开串口等待DCD的超时，0表示一直等待
+	VerifyEcho     bool          //每次写后读回本地回显（2线RS485）并比对，不一致时返回ErrCollision
+	Canonical      bool          //行模式（ICANON）：Read按行返回，收到的CR转换为NL，用于基于行的文本协议；默认为原始模式，不做任何输入输出处理
+	RawIFlag       TermiosMask   //输入模式标志（c_iflag）的附加修改，比如置位IGNBRK，在标准配置之后应用
+	RawOFlag       TermiosMask   //输出模式标志（c_oflag）的附加修改，比如置位OPOST|ONLCR
+	RawCFlag       TermiosMask   //控制模式标志（c_cflag）的附加修改
+	RawLFlag       TermiosMask   //本地模式标志（c_lflag）的附加修改
+}
+
+//termios标志的附加修改，用于结构化配置未覆盖的特殊设备，先清除Clear中的位再置位Set中的位
+type TermiosMask struct {
+	Set   uint32 //需要置位的标志，取值同unix.IGNBRK等
+	Clear uint32 //需要清除的标志
+}
+
+//应用到标志上
+func (m TermiosMask) apply(flag uint32) uint32 {
+	return flag&^m.Clear | m.Set
 }
 
 //RS485配置
@@ -90,6 +252,7 @@ type RS485Config struct {
 	RtsHighDuringSend  bool   //发送期间RTS高电平
 	RtsHighAfterSend   bool   //发送后RTS高电平
 	RxDuringTx         bool   //支持发送期间读取
+	SoftwareRTS        bool   //由软件切换RTS控制收发方向，用于不支持TIOCSRS485的USB转换器
 }
 
 //TCP socket配置
@@ -102,28 +265,91 @@ const (
 
 //TCP配置
 type TCPConfig struct {
-	Network      string        //TCP网络类型（tcp、tcp4、tcp6）
-	Address      string        //主机地址，比如192.168.1.1:8080
-	KeepAlive    time.Duration //TCP保活周期，如果不启用则配0
-	NoDelay      TCPSocketOpt  //TCP数据延迟发送，默认no delay
-	ReadTimeout  time.Duration //一次完全数据包的收取超时
-	WriteTimeout time.Duration //一次完整数据包的发送超时
+	Network           string            //TCP网络类型（tcp、tcp4、tcp6）
+	Address           string            //主机地址，比如192.168.1.1:8080
+	Proxy             string            //HTTP代理地址，比如proxy.corp:3128，配置时连接代理并通过CONNECT方法建立到Address的隧道，Address可为代理才能解析的主机名
+	ProxyUsername     string            //代理认证用户名，配置时发送Basic认证的Proxy-Authorization头
+	ProxyPassword     string            //代理认证密码
+	ProxyHeader       map[string]string //CONNECT请求附加的头部，比如User-Agent或其他认证方式的Proxy-Authorization
+	Resolver          Resolver          //主机名解析器，为nil时使用DefaultResolver；解析出多个地址时依次尝试，DialTimeout为全部地址的总超时
+	LocalAddress      string            //本地绑定地址，比如192.168.2.1或192.168.2.1:0，为空时由系统选择源地址
+	Interface         string            //绑定的网络接口，比如eth0、wwan0，为空时按路由表选择
+	FreeBind          bool              //允许LocalAddress尚未配置在本机接口上（IP_FREEBIND）
+	Transparent       bool              //透明代理（IP_TRANSPARENT），LocalAddress可为任意地址，用于冒充设备源地址，需要CAP_NET_ADMIN和策略路由
+	DialTimeout       time.Duration     //连接超时，0表示由系统决定（可能长达数分钟）
+	RetryCount        int               //连接暂时失败（ECONNREFUSED、EHOSTUNREACH、超时等）时Open的重试次数，0表示不重试
+	RetryBackoff      time.Duration     //第一次重试前的等待时间，之后每次加倍（上限30s）并随机抖动
+	KeepAlive         time.Duration     //TCP保活周期，同时作为KeepAliveIdle和KeepAliveInterval的缺省值，如果不启用则配0
+	KeepAliveIdle     time.Duration     //连接空闲多久后开始发送保活探测（TCP_KEEPIDLE），0表示使用KeepAlive
+	KeepAliveInterval time.Duration     //保活探测的间隔（TCP_KEEPINTVL），0表示使用KeepAlive
+	KeepAliveCount    int               //连续多少次探测无应答后断开连接（TCP_KEEPCNT），0表示使用系统默认值
+	UserTimeout       time.Duration     //已发送数据超过该时间未被确认时断开连接（TCP_USER_TIMEOUT），0表示使用系统默认值
+	OnDisconnect      func(err error)   //连接被保活、TCP_USER_TIMEOUT或RST断开时立即回调，在后台goroutine中调用，Close后不再回调，可为nil
+	NoDelay           TCPSocketOpt      //TCP数据延迟发送，默认no delay
+	OOBInline         bool              //紧急数据留在普通数据流中（SO_OOBINLINE），由AtMark定位，否则通过ReadOOB单独读取
+	FastOpen          bool              //TCP Fast Open：Open时不连接，第一次Write随SYN发送报文，节省一个往返，打开后需先Write
+	ReceiveBufferSize int               //套接字接收缓冲区大小（SO_RCVBUF），0表示系统默认值
+	SendBufferSize    int               //套接字发送缓冲区大小（SO_SNDBUF），0表示系统默认值
+	DSCP              int               //DSCP标记（0～63，比如46表示EF），通过IP_TOS/IPV6_TCLASS设置，用于网络QoS优先级，0表示不设置
+	TTL               int               //报文TTL或IPv6跳数限制（1～255），通过IP_TTL/IPV6_UNICAST_HOPS设置，0表示系统默认值
+	ReadTimeout       time.Duration     //一次完全数据包的收取超时
+	WriteTimeout      time.Duration     //一次完整数据包的发送超时
+	MaxReadSize       int               //单次读取的最大报文长度，超过时返回FrameSizeError，0表示不限制
+	MaxWriteSize      int               //单次发送的最大报文长度，超过时返回FrameSizeError，0表示不限制
 }
 
 //UDP配置
 type UDPConfig struct {
-	Network      string        //UDP网络类型（udp、udp4、udp6）
-	Address      string        //主机地址，比如192.168.1.1:8080
-	ReadTimeout  time.Duration //一次完全数据包的收取超时
-	WriteTimeout time.Duration //一次完整数据包的发送超时
+	Network           string        //UDP网络类型（udp、udp4、udp6）
+	Address           string        //主机地址，比如192.168.1.1:8080
+	LocalAddress      string        //本地绑定地址，比如:5000或192.168.2.1:5000，部分仪表只应答固定源端口的请求，为空时由系统选择
+	Interface         string        //绑定的网络接口，比如eth0、wwan0，为空时按路由表选择
+	Connected         bool          //连接到Address（connect），只接收来自Address的报文，可通过MTU查询路径MTU，ICMP错误在下次读写时返回
+	PMTUDiscovery     PMTUDiscovery //路径MTU发现模式，PMTUDo时设置DF位，超过路径MTU的报文发送失败而不是分片
+	ReceivePacketInfo bool          //接收报文的目的地址、接口和TTL（IP_PKTINFO/IPV6_RECVPKTINFO），通过ReadMsg获取
+	ReceiveErrors     bool          //接收ICMP差错（IP_RECVERR/IPV6_RECVERR），端口不可达、TTL超时等在读写时返回ICMPError，也可通过ReadError读取
+	Broadcast         bool          //允许发送到广播地址（SO_BROADCAST），比如255.255.255.255或子网广播地址，用于设备发现
+	MaxDatagramSize   int           //内部接收缓冲区的大小，Read、ReadFrom和ReadBatch按此长度接收，超过的报文被截断并返回FrameSizeError，0表示65535
+	ReceiveBufferSize int           //套接字接收缓冲区大小（SO_RCVBUF），0表示系统默认值，高速率遥测需调大以免丢包
+	SendBufferSize    int           //套接字发送缓冲区大小（SO_SNDBUF），0表示系统默认值
+	DSCP              int           //DSCP标记（0～63），通过IP_TOS/IPV6_TCLASS设置，0表示不设置
+	TTL               int           //单播和组播报文的TTL或IPv6跳数限制（1～255），用于类traceroute探测和限定组播范围，0表示系统默认值
+	ReadTimeout       time.Duration //一次完全数据包的收取超时
+	WriteTimeout      time.Duration //一次完整数据包的发送超时
+	MaxReadSize       int           //单次读取的最大报文长度，超过时返回FrameSizeError，0表示不限制
+	MaxWriteSize      int           //单次发送的最大报文长度，超过时返回FrameSizeError，0表示不限制
 }
 
 //UnixSocket配置
 type UnixSocketConfig struct {
 	Network      string        //UnixSocket网络类型（unix）
-	Address      string        //UnixSocket文件路径，比如/tmp/a.sock
+	Address      string        //UnixSocket文件路径，比如/tmp/a.sock，以@或NUL开头时为抽象命名空间地址，比如@/org/example/daemon
+	RetryCount   int           //连接暂时失败（ECONNREFUSED、套接字文件不存在等）时Open的重试次数，0表示不重试
+	RetryBackoff time.Duration //第一次重试前的等待时间，之后每次加倍（上限30s）并随机抖动
 	ReadTimeout  time.Duration //一次完全数据包的收取超时
 	WriteTimeout time.Duration //一次完整数据包的发送超时
+	MaxReadSize  int           //单次读取的最大报文长度，超过时返回FrameSizeError，0表示不限制
+	MaxWriteSize int           //单次发送的最大报文长度，超过时返回FrameSizeError，0表示不限制
+}
+
+//Null配置，写入的数据被丢弃，读取返回预设数据，用于演练和压测
+type NullConfig struct {
+	Address      string          //名称，仅用于标识
+	ReadData     [][]byte        //依次由Read返回的预设数据，读完后Read等待至超时
+	Latency      *LatencyProfile //每个预设数据返回前的模拟响应延迟，nil表示立即返回
+	ReadTimeout  time.Duration   //一次完全数据包的收取超时，0表示一直等待直到关闭
+	WriteTimeout time.Duration   //一次完整数据包的发送超时
+}
+
+//File配置，从文件读取录制的数据流，写入的数据追加到另一文件
+type FileConfig struct {
+	ReadPath     string          //读取的文件路径，为空时Read返回io.EOF
+	WritePath    string          //追加写入的文件路径，为空时丢弃写入的数据
+	ReadChunk    int             //单次Read最多返回的字节数，0表示不限制
+	ReadInterval time.Duration   //两次Read之间的最小间隔，用于模拟设备的发送节奏，0表示不限速
+	Latency      *LatencyProfile //每次Read前的模拟响应延迟，nil表示不延迟
+	ReadTimeout  time.Duration   //一次完全数据包的收取超时
+	WriteTimeout time.Duration   //一次完整数据包的发送超时
 }
 
 func (c *SerialConfig) Type() EndPointType {
@@ -157,3 +383,19 @@ func (c *UnixSocketConfig) Type() EndPointType {
 func (c *UnixSocketConfig) AddressName() string {
 	return c.Address
 }
+
+func (c *NullConfig) Type() EndPointType {
+	return EndPointNull
+}
+
+func (c *NullConfig) AddressName() string {
+	return c.Address
+}
+
+func (c *FileConfig) Type() EndPointType {
+	return EndPointFile
+}
+
+func (c *FileConfig) AddressName() string {
+	return c.ReadPath
+}
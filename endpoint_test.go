@@ -0,0 +1,35 @@
+package endpoint
+
+import (
+	"testing"
+	"time"
+)
+
+//Manager返回的包装应把超时修改转发给底层EndPoint
+func TestTimeoutSetterThroughManager(t *testing.T) {
+	m := NewManager()
+	if err := m.Add("null", &NullConfig{Address: "null"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Open("null"); err != nil {
+		t.Fatal(err)
+	}
+	defer m.CloseAll()
+	if err := m.SetReadOnly("null", ReadOnlyReject); err != nil {
+		t.Fatal(err)
+	}
+
+	p := m.Get("null")
+	s, ok := p.(TimeoutSetter)
+	if !ok {
+		t.Fatalf("%T does not implement TimeoutSetter", p)
+	}
+	s.SetReadTimeout(123 * time.Millisecond)
+	s.SetWriteTimeout(456 * time.Millisecond)
+	if got := m.Get("null").ReadTimeout(); got != 123*time.Millisecond {
+		t.Errorf("ReadTimeout = %v, want 123ms", got)
+	}
+	if got := m.Get("null").WriteTimeout(); got != 456*time.Millisecond {
+		t.Errorf("WriteTimeout = %v, want 456ms", got)
+	}
+}
@@ -0,0 +1,141 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+//ReadExact在超时前未收齐数据
+var ErrShortRead = errors.New("endpoint: short read")
+
+//TCP连接已失效（半开连接、对端关闭或探测报文未被确认）
+var ErrStale = errors.New("tcp: stale connection")
+
+//串口开启CarrierDetect时载波丢失（调制解调器挂断）
+var ErrCarrierLost = errors.New("serial: carrier lost")
+
+//开启VerifyEcho时本地回显与发送的数据不一致，总线上发生了冲突，可退避后重试
+var ErrCollision = errors.New("serial: bus collision")
+
+//读写超时错误，实现net.Error的Timeout方法
+type TimeoutError struct {
+	Op       string        //发生超时的EndPoint，比如serial、tcp
+	Duration time.Duration //超时时间
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%v: select timeout: %v", e.Op, e.Duration)
+}
+
+//实现net.Error
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+//实现net.Error
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
+
+//判断错误是否为超时错误
+func IsTimeout(err error) bool {
+	var t interface{ Timeout() bool }
+	return errors.As(err, &t) && t.Timeout()
+}
+
+//报文长度超过MaxReadSize或MaxWriteSize
+type FrameSizeError struct {
+	Op    string //EndPoint类型及读写方向，比如serial read
+	Size  int    //报文长度，读取时为至少收到的长度
+	Limit int    //长度限制
+}
+
+func (e *FrameSizeError) Error() string {
+	return fmt.Sprintf("%v: frame size %v exceeds limit %v", e.Op, e.Size, e.Limit)
+}
+
+//串口收到校验或帧错误的字节（需开启SerialConfig.MarkParity）
+type ParityError struct {
+	Offsets []int //错误字节在本次读取数据中的位置
+}
+
+func (e *ParityError) Error() string {
+	return fmt.Sprintf("serial: %v parity/framing errors at offsets %v", len(e.Offsets), e.Offsets)
+}
+
+//Manager批量操作中部分EndPoint失败，按EndPoint名称记录各自的错误。
+//errors.Is和errors.As依次匹配其中的每个错误，序列化为JSON时为名称到错误信息的对象
+type MultiError struct {
+	Errors map[string]error //EndPoint名称到错误的映射
+}
+
+//记录指定EndPoint的错误，err为nil时忽略
+func (e *MultiError) add(name string, err error) {
+	if err == nil {
+		return
+	}
+	if e.Errors == nil {
+		e.Errors = make(map[string]error)
+	}
+	e.Errors[name] = err
+}
+
+//没有错误时返回nil，避免返回包含nil指针的error接口
+func (e *MultiError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+//按名称排序的出错EndPoint
+func (e *MultiError) Names() []string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *MultiError) Error() string {
+	names := e.Names()
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%v: %v", name, e.Errors[name])
+	}
+	return fmt.Sprintf("manager: %v endpoints failed: %v", len(names), strings.Join(msgs, "; "))
+}
+
+//支持errors.Is，任一EndPoint的错误匹配即返回true
+func (e *MultiError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+//支持errors.As，按名称顺序取第一个匹配的错误
+func (e *MultiError) As(target interface{}) bool {
+	for _, name := range e.Names() {
+		if errors.As(e.Errors[name], target) {
+			return true
+		}
+	}
+	return false
+}
+
+//序列化为名称到错误信息的JSON对象
+func (e *MultiError) MarshalJSON() ([]byte, error) {
+	msgs := make(map[string]string, len(e.Errors))
+	for name, err := range e.Errors {
+		msgs[name] = err.Error()
+	}
+	return json.Marshal(msgs)
+}
@@ -0,0 +1,111 @@
+package endpoint
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+//交互式会话，用于登录提示、菜单式设备控制台等场景，适用于所有EndPoint
+type Expecter struct {
+	p   EndPoint
+	buf []byte //已收到但尚未被匹配消费的数据
+}
+
+//创建交互式会话
+func NewExpecter(p EndPoint) *Expecter {
+	return &Expecter{p: p}
+}
+
+//发送字符串
+func (e *Expecter) Send(s string) error {
+	return e.SendBytes([]byte(s))
+}
+
+//发送数据
+func (e *Expecter) SendBytes(b []byte) error {
+	if _, err := e.p.Write(b); err != nil {
+		return fmt.Errorf("expect: send %q: %v", b, err)
+	}
+	return nil
+}
+
+//在timeout内等待收到b，返回截至b末尾（含b）的数据，之后的数据留给下次匹配
+func (e *Expecter) ExpectBytes(b []byte, timeout time.Duration) ([]byte, error) {
+	_, out, err := e.expect(timeout, func(data []byte) (int, int) {
+		if i := bytes.Index(data, b); i >= 0 {
+			return 0, i + len(b)
+		}
+		return -1, 0
+	})
+	return out, err
+}
+
+//在timeout内等待匹配re，返回匹配的整体和各子匹配
+func (e *Expecter) ExpectRegexp(re *regexp.Regexp, timeout time.Duration) ([]string, error) {
+	_, match, err := e.ExpectAny(timeout, re)
+	return match, err
+}
+
+//在timeout内等待任一正则匹配，用于分支判断（比如密码提示或登录成功）。
+//多个正则同时匹配时取匹配位置最靠前的，返回其下标和子匹配
+func (e *Expecter) ExpectAny(timeout time.Duration, res ...*regexp.Regexp) (int, []string, error) {
+	var match []string
+	index, _, err := e.expect(timeout, func(data []byte) (int, int) {
+		index, start, end := -1, 0, 0
+		var loc []int
+		for i, re := range res {
+			if l := re.FindSubmatchIndex(data); l != nil && (index < 0 || l[0] < start) {
+				index, start, end, loc = i, l[0], l[1], l
+			}
+		}
+		if index >= 0 {
+			match = make([]string, len(loc)/2)
+			for i := range match {
+				if loc[2*i] >= 0 {
+					match[i] = string(data[loc[2*i]:loc[2*i+1]])
+				}
+			}
+		}
+		return index, end
+	})
+	if err != nil {
+		return -1, nil, err
+	}
+	return index, match, nil
+}
+
+//返回已收到但尚未被匹配消费的数据
+func (e *Expecter) Buffered() []byte {
+	return e.buf
+}
+
+//丢弃已收到但尚未被匹配消费的数据
+func (e *Expecter) Discard() {
+	e.buf = nil
+}
+
+//在timeout内读取数据直到match成功。match返回匹配的分支下标（-1表示未匹配）和消费的长度，
+//返回分支下标和被消费的数据
+func (e *Expecter) expect(timeout time.Duration, match func([]byte) (int, int)) (int, []byte, error) {
+	buf := make([]byte, 1024)
+	expireTime := time.Now().Add(timeout)
+	for {
+		if index, end := match(e.buf); index >= 0 {
+			out := append([]byte(nil), e.buf[:end]...)
+			e.buf = e.buf[end:]
+			return index, out, nil
+		}
+
+		remainTime := expireTime.Sub(time.Now())
+		if remainTime <= 0 {
+			return -1, nil, fmt.Errorf("expect: got %q: %w", e.buf, &TimeoutError{Op: "expect", Duration: timeout})
+		}
+		n, err := readWithin(e.p, buf, remainTime)
+		if err != nil {
+			return -1, nil, fmt.Errorf("expect: got %q: %w", e.buf, err)
+		}
+		e.buf = append(e.buf, buf[:n]...)
+	}
+}
@@ -0,0 +1,159 @@
+package endpoint
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+//file实现EndPoint接口
+type file struct {
+	readFile     *os.File        //读取的文件
+	writeFile    *os.File        //追加写入的文件
+	readPath     string          //读取的文件路径
+	readChunk    int             //单次Read最多返回的字节数
+	readInterval time.Duration   //两次Read之间的最小间隔
+	nextRead     time.Time       //下一次允许Read的时间
+	latency      *latencySampler //模拟响应延迟
+	readTimeout  time.Duration   //一次完全数据包的收取超时
+	writeTimeout time.Duration   //一次完整数据包的发送超时
+}
+
+//创建file对象
+func newFile() EndPoint {
+	return &file{}
+}
+
+//打开读取和写入的文件
+func (p *file) Open(config EndPointConfig) (err error) {
+	c := config.(*FileConfig)
+
+	if p.latency, err = newLatencySampler(c.Latency, c.ReadPath); err != nil {
+		err = fmt.Errorf("file: %v", err)
+		return
+	}
+	p.readPath = c.ReadPath
+	if c.ReadPath != "" {
+		if p.readFile, err = os.Open(c.ReadPath); err != nil {
+			err = fmt.Errorf("file: open %v: %v", c.ReadPath, err)
+			return
+		}
+	}
+	if c.WritePath != "" {
+		if p.writeFile, err = os.OpenFile(c.WritePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+			p.Close()
+			err = fmt.Errorf("file: open %v: %v", c.WritePath, err)
+			return
+		}
+	}
+
+	p.readChunk = c.ReadChunk
+	p.readInterval = c.ReadInterval
+	p.nextRead = time.Time{}
+	p.readTimeout, p.writeTimeout = defaultTimeouts(EndPointFile, c.ReadTimeout, c.WriteTimeout)
+
+	return
+}
+
+//返回endpoint类型
+func (p *file) Type() EndPointType {
+	return EndPointFile
+}
+
+//关闭文件
+func (p *file) Close() (err error) {
+	if p.readFile != nil {
+		err = p.readFile.Close()
+		p.readFile = nil
+	}
+	if p.writeFile != nil {
+		if e := p.writeFile.Close(); e != nil && err == nil {
+			err = e
+		}
+		p.writeFile = nil
+	}
+
+	return
+}
+
+//按节奏读取文件，读完返回io.EOF
+func (p *file) Read(b []byte) (int, error) {
+	if p.readFile == nil {
+		return 0, io.EOF
+	}
+
+	if p.readInterval > 0 {
+		if wait := p.nextRead.Sub(time.Now()); wait > 0 {
+			time.Sleep(wait)
+		}
+		p.nextRead = time.Now().Add(p.readInterval)
+	}
+	if delay := p.latency.next(); delay > 0 {
+		time.Sleep(delay)
+	}
+	if p.readChunk > 0 && len(b) > p.readChunk {
+		b = b[:p.readChunk]
+	}
+
+	return p.readFile.Read(b)
+}
+
+//追加写入文件
+func (p *file) Write(b []byte) (int, error) {
+	if p.writeFile == nil {
+		return len(b), nil
+	}
+	return p.writeFile.Write(b)
+}
+
+//返回读取文件的文件句柄
+func (p *file) Fd() int {
+	if p.readFile == nil {
+		return -1
+	}
+	return int(p.readFile.Fd())
+}
+
+//把写入的数据同步到磁盘
+func (p *file) Flush() error {
+	if p.writeFile == nil {
+		return nil
+	}
+	return p.writeFile.Sync()
+}
+
+//返回读取文件的地址
+func (p *file) NetAddr() net.Addr {
+	return &net.UnixAddr{
+		Net:  "file",
+		Name: p.readPath,
+	}
+}
+
+//文件没有socket地址
+func (p *file) SockAddr() syscall.Sockaddr {
+	return nil
+}
+
+//返回读超时
+func (p *file) ReadTimeout() time.Duration {
+	return p.readTimeout
+}
+
+//返回写超时
+func (p *file) WriteTimeout() time.Duration {
+	return p.writeTimeout
+}
+
+//修改读超时
+func (p *file) SetReadTimeout(d time.Duration) {
+	p.readTimeout = d
+}
+
+//修改写超时
+func (p *file) SetWriteTimeout(d time.Duration) {
+	p.writeTimeout = d
+}
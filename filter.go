@@ -0,0 +1,298 @@
+package endpoint
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//报文不在写入白名单中
+var ErrFrameBlocked = errors.New("filter: frame blocked")
+
+//报文匹配条件
+type FrameFilter func(frame []byte) bool
+
+//匹配以任一前缀开始的报文
+func MatchPrefix(prefixes ...[]byte) FrameFilter {
+	return func(frame []byte) bool {
+		for _, prefix := range prefixes {
+			if bytes.HasPrefix(frame, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//匹配正则表达式
+func MatchRegexp(re *regexp.Regexp) FrameFilter {
+	return func(frame []byte) bool {
+		return re.Match(frame)
+	}
+}
+
+//匹配任一十六进制模式，比如"01 03 ?? ?? 00 0A"，??匹配任意字节，末尾的*匹配任意长度的剩余部分，
+//没有*时报文长度须与模式一致
+func MatchPattern(patterns ...string) (FrameFilter, error) {
+	type pattern struct {
+		value  []byte
+		mask   []byte
+		prefix bool
+	}
+
+	compiled := make([]pattern, 0, len(patterns))
+	for _, s := range patterns {
+		var p pattern
+		fields := strings.Fields(s)
+		if n := len(fields); n > 0 && fields[n-1] == "*" {
+			p.prefix = true
+			fields = fields[:n-1]
+		}
+		for _, f := range fields {
+			if f == "??" {
+				p.value, p.mask = append(p.value, 0), append(p.mask, 0)
+				continue
+			}
+			b, err := hex.DecodeString(f)
+			if err != nil || len(b) != 1 {
+				return nil, fmt.Errorf("filter: invalid pattern %q", s)
+			}
+			p.value, p.mask = append(p.value, b[0]), append(p.mask, 0xFF)
+		}
+		compiled = append(compiled, p)
+	}
+
+	return func(frame []byte) bool {
+		for _, p := range compiled {
+			if len(frame) < len(p.value) || (!p.prefix && len(frame) != len(p.value)) {
+				continue
+			}
+			if maskedEqual(frame[:len(p.value)], p.value, p.mask) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+//writeFilter只发送白名单中的报文
+type writeFilter struct {
+	EndPoint
+	name  string        //EndPoint名称
+	allow []FrameFilter //白名单
+}
+
+//创建只发送白名单中报文的EndPoint，每次Write视为一个报文，匹配任一条件才发送，
+//其余报文不发送并返回ErrFrameBlocked。用于防止软件缺陷向现场设备发出非预期的控制命令。
+//allow为空时返回p
+func NewWriteFilter(p EndPoint, name string, allow ...FrameFilter) EndPoint {
+	if len(allow) == 0 {
+		return p
+	}
+	return &writeFilter{EndPoint: p, name: name, allow: allow}
+}
+
+//发送白名单中的报文
+func (p *writeFilter) Write(b []byte) (int, error) {
+	for _, allow := range p.allow {
+		if allow(b) {
+			return p.EndPoint.Write(b)
+		}
+	}
+
+	log.Printf("filter: blocked write to %v: % x\n", p.name, b)
+	return 0, fmt.Errorf("%w: %v", ErrFrameBlocked, p.name)
+}
+
+//修改底层EndPoint的读超时，底层不支持TimeoutSetter时忽略
+func (p *writeFilter) SetReadTimeout(d time.Duration) {
+	setReadTimeout(p.EndPoint, d)
+}
+
+//修改底层EndPoint的写超时，底层不支持TimeoutSetter时忽略
+func (p *writeFilter) SetWriteTimeout(d time.Duration) {
+	setWriteTimeout(p.EndPoint, d)
+}
+
+//设置EndPoint的写入白名单，已打开的EndPoint立即生效，allow为空表示取消
+func (m *Manager) SetWriteFilter(name string, allow ...FrameFilter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, ok := m.endpoints[name]
+	if !ok {
+		return fmt.Errorf("manager: endpoint %v not found", name)
+	}
+	me.allow = append([]FrameFilter(nil), allow...)
+	me.wrap()
+
+	return nil
+}
+
+//收到的报文未通过结构检查
+var ErrFrameRejected = errors.New("filter: frame rejected")
+
+//报文结构检查，不通过时返回原因
+type FrameCheck func(frame []byte) error
+
+//检查报文长度在[min, max]内，max为0表示不限制上限
+func CheckLength(min, max int) FrameCheck {
+	return func(frame []byte) error {
+		if len(frame) < min || (max > 0 && len(frame) > max) {
+			return fmt.Errorf("length %v out of range [%v, %v]", len(frame), min, max)
+		}
+		return nil
+	}
+}
+
+//检查长度字段：offset处size字节（1、2或4，大端）的取值加adjust须等于报文长度
+func CheckLengthField(offset, size, adjust int) FrameCheck {
+	return func(frame []byte) error {
+		if offset+size > len(frame) {
+			return fmt.Errorf("frame too short for length field")
+		}
+		v := 0
+		for _, b := range frame[offset : offset+size] {
+			v = v<<8 | int(b)
+		}
+		if v+adjust != len(frame) {
+			return fmt.Errorf("length field %v does not match frame length %v", v, len(frame))
+		}
+		return nil
+	}
+}
+
+//检查offset处的字节不是禁止的取值，比如Modbus报文中禁止的功能码
+func ForbidBytes(offset int, values ...byte) FrameCheck {
+	return func(frame []byte) error {
+		if offset >= len(frame) {
+			return nil
+		}
+		for _, v := range values {
+			if frame[offset] == v {
+				return fmt.Errorf("forbidden value 0x%02X at offset %v", v, offset)
+			}
+		}
+		return nil
+	}
+}
+
+//收到的报文未通过结构检查时的处理方式
+type InboundAction int
+
+const (
+	InboundDrop InboundAction = iota //丢弃报文并记录日志，在读超时内继续读取下一个报文
+	InboundFlag                      //返回报文和包装ErrFrameRejected的错误，由上层决定是否使用
+)
+
+//readFilter检查收到的报文
+type readFilter struct {
+	EndPoint
+	name   string        //EndPoint名称
+	action InboundAction //未通过检查时的处理方式
+	checks []FrameCheck  //结构检查
+}
+
+//创建检查收到报文的EndPoint，每次Read读到的数据视为一个报文，依次执行checks，
+//在报文到达应用之前丢弃或标记长度字段错误、功能码非法等畸形报文。checks为空时返回p
+func NewReadFilter(p EndPoint, name string, action InboundAction, checks ...FrameCheck) EndPoint {
+	if len(checks) == 0 {
+		return p
+	}
+	return &readFilter{EndPoint: p, name: name, action: action, checks: checks}
+}
+
+//读取并检查报文
+func (p *readFilter) Read(b []byte) (n int, err error) {
+	timeout := p.ReadTimeout()
+	var expireTime time.Time
+	if timeout > 0 {
+		expireTime = time.Now().Add(timeout)
+	}
+	//丢弃报文后缩短了读超时，返回前恢复
+	shortened := false
+	defer func() {
+		if shortened {
+			setReadTimeout(p.EndPoint, timeout)
+		}
+	}()
+
+	for {
+		if n, err = p.EndPoint.Read(b); n == 0 {
+			return
+		}
+
+		reason := p.check(b[:n])
+		if reason == nil {
+			return
+		}
+		if p.action == InboundFlag {
+			if err == nil {
+				err = fmt.Errorf("%w: %v: %v", ErrFrameRejected, p.name, reason)
+			}
+			return
+		}
+
+		log.Printf("filter: dropped frame from %v: %v: % x\n", p.name, reason, b[:n])
+		if err != nil {
+			return 0, err
+		}
+
+		//在剩余的读超时内继续读取
+		if timeout > 0 {
+			remainTime := expireTime.Sub(time.Now())
+			if remainTime <= 0 {
+				return 0, &TimeoutError{Op: "filter", Duration: timeout}
+			}
+			if setReadTimeout(p.EndPoint, remainTime) {
+				shortened = true
+			}
+		}
+	}
+}
+
+//修改底层EndPoint的读超时，底层不支持TimeoutSetter时忽略
+func (p *readFilter) SetReadTimeout(d time.Duration) {
+	setReadTimeout(p.EndPoint, d)
+}
+
+//修改底层EndPoint的写超时，底层不支持TimeoutSetter时忽略
+func (p *readFilter) SetWriteTimeout(d time.Duration) {
+	setWriteTimeout(p.EndPoint, d)
+}
+
+//依次执行结构检查，返回第一个不通过的原因
+func (p *readFilter) check(frame []byte) error {
+	for _, check := range p.checks {
+		if err := check(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//收到报文的过滤配置
+type inboundFilter struct {
+	action InboundAction //未通过检查时的处理方式
+	checks []FrameCheck  //结构检查
+}
+
+//设置EndPoint收到报文的结构检查，已打开的EndPoint立即生效，checks为空表示取消
+func (m *Manager) SetReadFilter(name string, action InboundAction, checks ...FrameCheck) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, ok := m.endpoints[name]
+	if !ok {
+		return fmt.Errorf("manager: endpoint %v not found", name)
+	}
+	me.inbound = inboundFilter{action: action, checks: append([]FrameCheck(nil), checks...)}
+	me.wrap()
+
+	return nil
+}
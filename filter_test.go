@@ -0,0 +1,179 @@
+package endpoint
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestFrameFilters(t *testing.T) {
+	pattern, err := MatchPattern("01 03 ?? ?? 00 0A", "01 06 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		filter FrameFilter
+		frame  []byte
+		want   bool
+	}{
+		{"prefix", MatchPrefix([]byte{0x01, 0x03}, []byte("AT")), []byte("AT+CSQ\r"), true},
+		{"prefix second", MatchPrefix([]byte{0x01, 0x03}, []byte("AT")), []byte{0x01, 0x03, 0x00}, true},
+		{"prefix miss", MatchPrefix([]byte{0x01, 0x03}), []byte{0x01, 0x10}, false},
+		{"prefix short frame", MatchPrefix([]byte{0x01, 0x03}), []byte{0x01}, false},
+		{"regexp", MatchRegexp(regexp.MustCompile(`^AT\+(CSQ|CREG)\?\r$`)), []byte("AT+CREG?\r"), true},
+		{"regexp miss", MatchRegexp(regexp.MustCompile(`^AT\+(CSQ|CREG)\?\r$`)), []byte("AT+CFUN=0\r"), false},
+		{"pattern wildcard", pattern, []byte{0x01, 0x03, 0x12, 0x34, 0x00, 0x0a}, true},
+		{"pattern mismatch", pattern, []byte{0x01, 0x03, 0x12, 0x34, 0x00, 0x0b}, false},
+		{"pattern too long", pattern, []byte{0x01, 0x03, 0x12, 0x34, 0x00, 0x0a, 0xff}, false},
+		{"pattern too short", pattern, []byte{0x01, 0x03, 0x12}, false},
+		{"pattern star", pattern, []byte{0x01, 0x06, 0x00, 0x01, 0x00, 0x03, 0x98, 0x0b}, true},
+		{"pattern star empty rest", pattern, []byte{0x01, 0x06}, true},
+		{"pattern star miss", pattern, []byte{0x01, 0x05, 0x00}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter(tt.frame); got != tt.want {
+			t.Errorf("%v: match(% x) = %v, want %v", tt.name, tt.frame, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"01 0", "01 zz", "0103", "01 * 02"} {
+		if _, err := MatchPattern(bad); err == nil {
+			t.Errorf("MatchPattern(%q): err = nil, want invalid pattern", bad)
+		}
+	}
+}
+
+//白名单之外的报文不发送并返回ErrFrameBlocked
+func TestWriteFilter(t *testing.T) {
+	p := newChanEndPoint()
+	if NewWriteFilter(p, "plc") != EndPoint(p) {
+		t.Error("NewWriteFilter without filters did not return the endpoint")
+	}
+	f := NewWriteFilter(p, "plc", MatchPrefix([]byte{0x01, 0x03}), MatchPrefix([]byte{0x01, 0x04}))
+
+	if n, err := f.Write([]byte{0x01, 0x04, 0x00}); n != 3 || err != nil {
+		t.Fatalf("allowed Write = %v, %v, want 3, nil", n, err)
+	}
+	if got := <-p.tx; len(got) != 3 || got[1] != 0x04 {
+		t.Errorf("sent % x, want 01 04 00", got)
+	}
+
+	n, err := f.Write([]byte{0x01, 0x06, 0x00, 0x01})
+	if n != 0 || !errors.Is(err, ErrFrameBlocked) {
+		t.Fatalf("blocked Write = %v, %v, want 0, ErrFrameBlocked", n, err)
+	}
+	select {
+	case got := <-p.tx:
+		t.Errorf("blocked frame was sent: % x", got)
+	default:
+	}
+}
+
+//Manager设置的白名单对已打开的EndPoint立即生效，取消后恢复发送
+func TestManagerSetWriteFilter(t *testing.T) {
+	m := NewManager()
+	if err := m.Add("null", &NullConfig{Address: "null"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Open("null"); err != nil {
+		t.Fatal(err)
+	}
+	defer m.CloseAll()
+
+	if err := m.SetWriteFilter("missing", MatchPrefix([]byte("AT"))); err == nil {
+		t.Error("SetWriteFilter(missing): err = nil")
+	}
+	if err := m.SetWriteFilter("null", MatchPrefix([]byte("AT"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get("null").Write([]byte("AT\r")); err != nil {
+		t.Errorf("allowed Write: %v", err)
+	}
+	if _, err := m.Get("null").Write([]byte("RESET\r")); !errors.Is(err, ErrFrameBlocked) {
+		t.Errorf("blocked Write: err = %v, want ErrFrameBlocked", err)
+	}
+
+	if err := m.SetWriteFilter("null"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get("null").Write([]byte("RESET\r")); err != nil {
+		t.Errorf("Write after removing filter: %v", err)
+	}
+}
+
+func TestFrameChecks(t *testing.T) {
+	tests := []struct {
+		name  string
+		check FrameCheck
+		frame []byte
+		ok    bool
+	}{
+		{"length", CheckLength(2, 4), []byte{1, 2, 3}, true},
+		{"length short", CheckLength(2, 4), []byte{1}, false},
+		{"length long", CheckLength(2, 4), []byte{1, 2, 3, 4, 5}, false},
+		{"length no max", CheckLength(2, 0), make([]byte, 300), true},
+		{"length field", CheckLengthField(1, 1, 2), []byte{0x68, 3, 0, 0, 0}, true},
+		{"length field mismatch", CheckLengthField(1, 1, 2), []byte{0x68, 4, 0, 0, 0}, false},
+		{"length field 2 bytes", CheckLengthField(4, 2, 6), []byte{0, 1, 0, 0, 0, 2, 1, 3}, true},
+		{"length field truncated", CheckLengthField(4, 2, 6), []byte{0, 1, 0, 0, 0}, false},
+		{"forbid", ForbidBytes(1, 0x05, 0x06), []byte{1, 0x03}, true},
+		{"forbid hit", ForbidBytes(1, 0x05, 0x06), []byte{1, 0x06}, false},
+		{"forbid short frame", ForbidBytes(1, 0x05), []byte{1}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.check(tt.frame); (err == nil) != tt.ok {
+			t.Errorf("%v: check(% x) = %v, want ok %v", tt.name, tt.frame, err, tt.ok)
+		}
+	}
+}
+
+//InboundDrop丢弃畸形报文并继续读取，返回前恢复读超时
+func TestReadFilterDrop(t *testing.T) {
+	p := newChanEndPoint()
+	p.timeout = 5 * time.Second
+	f := NewReadFilter(p, "meter", InboundDrop, CheckLength(3, 0))
+
+	go func() {
+		p.rx <- []byte{1}
+		p.rx <- []byte{2}
+		p.rx <- []byte{1, 2, 3}
+	}()
+	b := make([]byte, 16)
+	if n, err := f.Read(b); err != nil || n != 3 {
+		t.Fatalf("Read = % x, %v, want 01 02 03", b[:n], err)
+	}
+	if p.timeout != 5*time.Second {
+		t.Errorf("read timeout %v after Read, want 5s", p.timeout)
+	}
+
+	//只有畸形报文时在原读超时内返回超时错误
+	p.timeout = 30 * time.Millisecond
+	go func() { p.rx <- []byte{1} }()
+	if n, err := f.Read(b); n != 0 || !IsTimeout(err) {
+		t.Fatalf("Read = %v, %v, want timeout", n, err)
+	}
+	if p.timeout != 30*time.Millisecond {
+		t.Errorf("read timeout %v after timed out Read, want 30ms", p.timeout)
+	}
+}
+
+//InboundFlag返回畸形报文和包装ErrFrameRejected的错误
+func TestReadFilterFlag(t *testing.T) {
+	p := newChanEndPoint()
+	f := NewReadFilter(p, "plc", InboundFlag, CheckLength(2, 0), ForbidBytes(1, 0x05))
+
+	go func() {
+		p.rx <- []byte{1, 0x05}
+		p.rx <- []byte{1, 0x03}
+	}()
+	b := make([]byte, 16)
+	n, err := f.Read(b)
+	if n != 2 || !errors.Is(err, ErrFrameRejected) {
+		t.Fatalf("Read = %v, %v, want 2, ErrFrameRejected", n, err)
+	}
+	if n, err = f.Read(b); n != 2 || err != nil {
+		t.Fatalf("Read = %v, %v, want 2, nil", n, err)
+	}
+}
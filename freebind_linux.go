@@ -0,0 +1,29 @@
+package endpoint
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+//允许绑定非本机地址：freeBind设置IP_FREEBIND（地址可尚未配置在接口上），
+//transparent设置IP_TRANSPARENT（可使用任意地址作为源地址，需要CAP_NET_ADMIN和策略路由）
+func setNonLocalBind(fd, family int, freeBind, transparent bool) error {
+	level, optFreeBind, optTransparent := syscall.IPPROTO_IP, unix.IP_FREEBIND, unix.IP_TRANSPARENT
+	if family == syscall.AF_INET6 {
+		level, optFreeBind, optTransparent = syscall.IPPROTO_IPV6, unix.IPV6_FREEBIND, unix.IPV6_TRANSPARENT
+	}
+
+	if freeBind {
+		if err := syscall.SetsockoptInt(fd, level, optFreeBind, 1); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if transparent {
+		if err := syscall.SetsockoptInt(fd, level, optTransparent, 1); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+// +build !linux
+
+package endpoint
+
+import (
+	"fmt"
+)
+
+//当前系统不支持绑定非本机地址
+func setNonLocalBind(fd, family int, freeBind, transparent bool) error {
+	if freeBind || transparent {
+		return fmt.Errorf("binding to non-local address is not supported")
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package endpoint
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//操作被保护且未提供正确的令牌
+var ErrPermissionDenied = errors.New("manager: permission denied")
+
+//受保护的操作
+type GuardOp int
+
+const (
+	GuardWrite GuardOp = 1 << iota //写入
+	GuardClose                     //关闭和移除
+	GuardFlush                     //清理缓冲区
+
+	GuardAll = GuardWrite | GuardClose | GuardFlush
+)
+
+//EndPoint的操作保护
+type operationGuard struct {
+	ops   GuardOp //受保护的操作
+	token string  //解除保护的能力令牌
+}
+
+//检查令牌是否正确
+func (g *operationGuard) allow(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(g.token), []byte(token)) == 1
+}
+
+//受保护的EndPoint，拒绝受保护的操作，其余操作直接转发
+type guardedEndPoint struct {
+	EndPoint
+	name string  //EndPoint名称
+	ops  GuardOp //受保护的操作
+}
+
+//写入，受保护时返回ErrPermissionDenied
+func (p *guardedEndPoint) Write(b []byte) (int, error) {
+	if p.ops&GuardWrite != 0 {
+		return 0, fmt.Errorf("%w: write %v", ErrPermissionDenied, p.name)
+	}
+	return p.EndPoint.Write(b)
+}
+
+//关闭，受保护时返回ErrPermissionDenied
+func (p *guardedEndPoint) Close() error {
+	if p.ops&GuardClose != 0 {
+		return fmt.Errorf("%w: close %v", ErrPermissionDenied, p.name)
+	}
+	return p.EndPoint.Close()
+}
+
+//清理缓冲区，受保护时返回ErrPermissionDenied
+func (p *guardedEndPoint) Flush() error {
+	if p.ops&GuardFlush != 0 {
+		return fmt.Errorf("%w: flush %v", ErrPermissionDenied, p.name)
+	}
+	return p.EndPoint.Flush()
+}
+
+//修改底层EndPoint的读超时，底层不支持TimeoutSetter时忽略
+func (p *guardedEndPoint) SetReadTimeout(d time.Duration) {
+	setReadTimeout(p.EndPoint, d)
+}
+
+//修改底层EndPoint的写超时，底层不支持TimeoutSetter时忽略
+func (p *guardedEndPoint) SetWriteTimeout(d time.Duration) {
+	setWriteTimeout(p.EndPoint, d)
+}
+
+//保护EndPoint的写入、关闭或清理缓冲区操作，使只读的监控组件可以与控制组件共享Manager。
+//保护后Get、Broadcast和QueryAll使用的EndPoint拒绝受保护的操作，Close和Remove需改用
+//CloseAuthorized和RemoveAuthorized；调度器和延迟发送由控制组件配置，不受保护限制。
+//已有保护时需先用原令牌调用Unguard
+func (m *Manager) Guard(name string, ops GuardOp, token string) error {
+	if token == "" {
+		return fmt.Errorf("manager: empty guard token")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, ok := m.endpoints[name]
+	if !ok {
+		return fmt.Errorf("manager: endpoint %v not found", name)
+	}
+	if me.guard != nil {
+		return fmt.Errorf("manager: endpoint %v is already guarded", name)
+	}
+	me.guard = &operationGuard{ops: ops, token: token}
+
+	return nil
+}
+
+//解除保护，令牌不正确时返回ErrPermissionDenied
+func (m *Manager) Unguard(name string, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, err := m.authorize(name, token)
+	if err != nil {
+		return err
+	}
+	me.guard = nil
+
+	return nil
+}
+
+//凭令牌获取不受保护的EndPoint，未打开时返回nil
+func (m *Manager) GetAuthorized(name string, token string) (EndPoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	me, err := m.authorize(name, token)
+	if err != nil {
+		return nil, err
+	}
+	return me.ep, nil
+}
+
+//凭令牌关闭受保护的EndPoint
+func (m *Manager) CloseAuthorized(name string, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, err := m.authorize(name, token)
+	if err != nil {
+		return err
+	}
+	return m.close(me)
+}
+
+//凭令牌关闭并移除受保护的EndPoint
+func (m *Manager) RemoveAuthorized(name string, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, err := m.authorize(name, token)
+	if err != nil {
+		return err
+	}
+	err = m.close(me)
+	delete(m.endpoints, name)
+
+	return err
+}
+
+//检查令牌，未受保护的EndPoint不需要令牌，调用方需持有锁
+func (m *Manager) authorize(name string, token string) (*managedEndPoint, error) {
+	me, ok := m.endpoints[name]
+	if !ok {
+		return nil, fmt.Errorf("manager: endpoint %v not found", name)
+	}
+	if me.guard != nil && !me.guard.allow(token) {
+		return nil, fmt.Errorf("%w: %v", ErrPermissionDenied, name)
+	}
+	return me, nil
+}
+
+//检查操作是否受保护，调用方需持有锁
+func (me *managedEndPoint) guarded(op GuardOp) error {
+	if me.guard != nil && me.guard.ops&op != 0 {
+		return fmt.Errorf("%w: %v", ErrPermissionDenied, me.name)
+	}
+	return nil
+}
+
+//返回对外提供的EndPoint，受保护时包装为拒绝受保护操作的EndPoint，调用方需持有锁
+func (me *managedEndPoint) exposed() EndPoint {
+	if me.ep == nil || me.guard == nil {
+		return me.ep
+	}
+	return &guardedEndPoint{EndPoint: me.ep, name: me.name, ops: me.guard.ops}
+}
@@ -0,0 +1,190 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+//单次交接的最大EndPoint数量
+const maxHandoverEndPoints = 64
+
+//交接报文的最大长度
+const maxHandoverPayload = 64 * 1024
+
+//交接时随文件句柄一起发送的EndPoint描述信息
+type handoverRecord struct {
+	Type         EndPointType  //EndPoint类型
+	Network      string        //网络类型（tcp、udp、unix、serial）
+	Address      string        //已解析的地址或串口路径
+	ReadTimeout  time.Duration //一次完全数据包的收取超时
+	WriteTimeout time.Duration //一次完整数据包的发送超时
+}
+
+//通过UnixSocket把已打开EndPoint的文件句柄（SCM_RIGHTS）及描述信息发送给另一进程，
+//用于不中断连接的程序升级。发送成功后本进程中的eps被释放，串口不会还原终端配置
+func Handover(sock EndPoint, eps ...EndPoint) error {
+	if sock.Type() != EndPointUnix {
+		return fmt.Errorf("handover: socket must be unix, got %v", sock.Type())
+	}
+	if len(eps) == 0 || len(eps) > maxHandoverEndPoints {
+		return fmt.Errorf("handover: invalid endpoint count %v", len(eps))
+	}
+
+	records := make([]handoverRecord, 0, len(eps))
+	fds := make([]int, 0, len(eps))
+	for _, p := range eps {
+		switch p.Type() {
+		case EndPointTCP, EndPointUDP, EndPointUnix, EndPointSerial:
+		default:
+			return fmt.Errorf("handover: unsupported endpoint type %v", p.Type())
+		}
+		if p.Fd() == -1 {
+			return fmt.Errorf("handover: endpoint %v is not open", p.NetAddr())
+		}
+
+		addr := p.NetAddr()
+		records = append(records, handoverRecord{
+			Type:         p.Type(),
+			Network:      addr.Network(),
+			Address:      addr.String(),
+			ReadTimeout:  p.ReadTimeout(),
+			WriteTimeout: p.WriteTimeout(),
+		})
+		fds = append(fds, p.Fd())
+	}
+
+	payload, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("handover: marshal: %v", err)
+	}
+	if len(payload) > maxHandoverPayload {
+		return fmt.Errorf("handover: payload too large: %v", len(payload))
+	}
+
+	if err = syscall.Sendmsg(sock.Fd(), payload, syscall.UnixRights(fds...), nil, 0); err != nil {
+		return fmt.Errorf("handover: sendmsg: %v", err)
+	}
+
+	//文件句柄已复制到对端进程，释放本进程中的EndPoint
+	for _, p := range eps {
+		releaseEndPoint(p)
+	}
+
+	return nil
+}
+
+//从UnixSocket接收另一进程通过Handover交接的EndPoint，恢复为可直接读写的EndPoint
+func Rehydrate(sock EndPoint) ([]EndPoint, error) {
+	if sock.Type() != EndPointUnix {
+		return nil, fmt.Errorf("rehydrate: socket must be unix, got %v", sock.Type())
+	}
+
+	payload := make([]byte, maxHandoverPayload)
+	oob := make([]byte, syscall.CmsgSpace(maxHandoverEndPoints*4))
+	n, oobn, _, _, err := syscall.Recvmsg(sock.Fd(), payload, oob, 0)
+	if err != nil {
+		return nil, fmt.Errorf("rehydrate: recvmsg: %v", err)
+	}
+
+	fds, err := parseUnixRights(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	for _, fd := range fds {
+		syscall.CloseOnExec(fd)
+	}
+
+	var records []handoverRecord
+	if err = json.Unmarshal(payload[:n], &records); err != nil {
+		closeFds(fds)
+		return nil, fmt.Errorf("rehydrate: unmarshal: %v", err)
+	}
+	if len(records) != len(fds) {
+		closeFds(fds)
+		return nil, fmt.Errorf("rehydrate: got %v records but %v fds", len(records), len(fds))
+	}
+
+	eps := make([]EndPoint, 0, len(fds))
+	for i, r := range records {
+		p, err := rehydrateEndPoint(fds[i], &r)
+		if err != nil {
+			for _, p := range eps {
+				p.Close()
+			}
+			closeFds(fds[i:])
+			return nil, err
+		}
+		eps = append(eps, p)
+	}
+
+	return eps, nil
+}
+
+//解析SCM_RIGHTS控制消息中的文件句柄
+func parseUnixRights(oob []byte) (fds []int, err error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, fmt.Errorf("rehydrate: parse control message: %v", err)
+	}
+
+	for i := range msgs {
+		rights, err := syscall.ParseUnixRights(&msgs[i])
+		if err != nil {
+			closeFds(fds)
+			return nil, fmt.Errorf("rehydrate: parse unix rights: %v", err)
+		}
+		fds = append(fds, rights...)
+	}
+
+	return fds, nil
+}
+
+//根据交接信息把文件句柄恢复为EndPoint
+func rehydrateEndPoint(fd int, r *handoverRecord) (EndPoint, error) {
+	switch r.Type {
+	case EndPointTCP:
+		sa, _, addr, err := getTCPSockaddr(r.Network, r.Address)
+		if err != nil {
+			return nil, fmt.Errorf("rehydrate: getTCPSockaddr %v %v: %v", r.Network, r.Address, err)
+		}
+		return &tcp{fd: fd, netAddr: addr, sockAddr: sa, readTimeout: r.ReadTimeout, writeTimeout: r.WriteTimeout}, nil
+	case EndPointUDP:
+		sa, _, addr, err := getUDPSockaddr(r.Network, r.Address)
+		if err != nil {
+			return nil, fmt.Errorf("rehydrate: getUDPSockaddr %v %v: %v", r.Network, r.Address, err)
+		}
+		return &udp{fd: fd, netAddr: addr, sockAddr: sa, readTimeout: r.ReadTimeout, writeTimeout: r.WriteTimeout}, nil
+	case EndPointUnix:
+		sa, _, addr, err := getUnixSockaddr(r.Network, r.Address)
+		if err != nil {
+			return nil, fmt.Errorf("rehydrate: getUnixSockaddr %v %v: %v", r.Network, r.Address, err)
+		}
+		return &unixsocket{fd: fd, netAddr: addr, sockAddr: sa, readTimeout: r.ReadTimeout, writeTimeout: r.WriteTimeout}, nil
+	case EndPointSerial:
+		//终端配置由原进程设置，交接后不再备份和还原
+		return &serial{fd: fd, address: r.Address, readTimeout: r.ReadTimeout, writeTimeout: r.WriteTimeout}, nil
+	default:
+		return nil, fmt.Errorf("rehydrate: unsupported endpoint type %v", r.Type)
+	}
+}
+
+//释放已交接的EndPoint，串口不还原终端配置以免影响对端进程
+func releaseEndPoint(p EndPoint) {
+	switch s := p.(type) {
+	case *serial:
+		syscall.Close(s.fd)
+		s.fd = -1
+		s.oldTermios = nil
+	default:
+		p.Close()
+	}
+}
+
+//关闭文件句柄
+func closeFds(fds []int) {
+	for _, fd := range fds {
+		syscall.Close(fd)
+	}
+}
@@ -0,0 +1,352 @@
+package endpoint
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//串口设备已拔出，等待重新插入
+var ErrDeviceRemoved = errors.New("serial: device removed")
+
+//设备重新插入后，等待udev设置权限的时间
+const hotplugSettleTime = 500 * time.Millisecond
+
+//无法监听netlink时轮询设备文件的周期
+const hotplugPollInterval = time.Second
+
+//热插拔事件
+type HotplugEvent struct {
+	Address string //串口路径
+	Removed bool   //true表示设备拔出，false表示设备重新插入
+	Err     error  //重新打开失败时非nil
+}
+
+//支持热插拔的串口：设备拔出后读写返回ErrDeviceRemoved，重新插入后自动以原配置重新打开
+type HotplugSerial struct {
+	mu     sync.RWMutex
+	config SerialConfig       //打开串口的配置
+	ep     EndPoint           //已打开的串口，设备拔出时为nil
+	notify func(HotplugEvent) //热插拔事件回调
+	done   chan struct{}      //关闭时close
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+//打开支持热插拔的串口，notify可以为nil。
+//通过netlink监听udev事件检测USB转串口的拔出和插入，无权限时退化为轮询设备文件
+func OpenHotplug(c *SerialConfig, notify func(HotplugEvent)) (*HotplugSerial, error) {
+	ep, err := Open(c)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &HotplugSerial{
+		config: *c,
+		ep:     ep,
+		notify: notify,
+		done:   make(chan struct{}),
+	}
+	h.wg.Add(1)
+	if fd, err := openUeventSocket(); err == nil {
+		go h.monitorUevent(fd)
+	} else {
+		go h.monitorPoll()
+	}
+
+	return h, nil
+}
+
+//以新配置重新打开串口
+func (h *HotplugSerial) Open(config EndPointConfig) error {
+	c := config.(*SerialConfig)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.ep != nil {
+		h.ep.Close()
+		h.ep = nil
+	}
+	h.config = *c
+	ep, err := Open(c)
+	if err != nil {
+		return err
+	}
+	h.ep = ep
+
+	return nil
+}
+
+//返回endpoint类型
+func (h *HotplugSerial) Type() EndPointType {
+	return EndPointSerial
+}
+
+//停止监听并关闭串口
+func (h *HotplugSerial) Close() (err error) {
+	h.once.Do(func() {
+		close(h.done)
+		h.wg.Wait()
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ep != nil {
+		err = h.ep.Close()
+		h.ep = nil
+	}
+
+	return
+}
+
+//读取串口，设备已拔出时返回ErrDeviceRemoved
+func (h *HotplugSerial) Read(b []byte) (n int, err error) {
+	ep := h.current()
+	if ep == nil {
+		return 0, ErrDeviceRemoved
+	}
+	n, err = ep.Read(b)
+	h.checkRemoved(ep, err)
+	return
+}
+
+//写串口，设备已拔出时返回ErrDeviceRemoved
+func (h *HotplugSerial) Write(b []byte) (n int, err error) {
+	ep := h.current()
+	if ep == nil {
+		return 0, ErrDeviceRemoved
+	}
+	n, err = ep.Write(b)
+	h.checkRemoved(ep, err)
+	return
+}
+
+//串口文件句柄，设备已拔出时返回-1
+func (h *HotplugSerial) Fd() int {
+	if ep := h.current(); ep != nil {
+		return ep.Fd()
+	}
+	return -1
+}
+
+//清理串口的IO缓冲区
+func (h *HotplugSerial) Flush() error {
+	if ep := h.current(); ep != nil {
+		return ep.Flush()
+	}
+	return ErrDeviceRemoved
+}
+
+//返回串口网络地址
+func (h *HotplugSerial) NetAddr() net.Addr {
+	return &net.UnixAddr{
+		Net:  "serial",
+		Name: h.config.Address,
+	}
+}
+
+//返回串口的socket地址
+func (h *HotplugSerial) SockAddr() syscall.Sockaddr {
+	return nil
+}
+
+//返回读超时
+func (h *HotplugSerial) ReadTimeout() time.Duration {
+	if ep := h.current(); ep != nil {
+		return ep.ReadTimeout()
+	}
+	return h.config.ReadTimeout
+}
+
+//返回写超时
+func (h *HotplugSerial) WriteTimeout() time.Duration {
+	if ep := h.current(); ep != nil {
+		return ep.WriteTimeout()
+	}
+	return h.config.WriteTimeout
+}
+
+//修改读超时，重新打开后仍然有效
+func (h *HotplugSerial) SetReadTimeout(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.config.ReadTimeout = d
+	if h.ep != nil {
+		setReadTimeout(h.ep, d)
+	}
+}
+
+//修改写超时，重新打开后仍然有效
+func (h *HotplugSerial) SetWriteTimeout(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.config.WriteTimeout = d
+	if h.ep != nil {
+		setWriteTimeout(h.ep, d)
+	}
+}
+
+//返回当前打开的串口
+func (h *HotplugSerial) current() EndPoint {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.ep
+}
+
+//读写返回EIO等错误说明设备已拔出
+func (h *HotplugSerial) checkRemoved(ep EndPoint, err error) {
+	if errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ENXIO) || errors.Is(err, syscall.ENODEV) {
+		h.removed(ep)
+	}
+}
+
+//设备拔出，关闭串口并通知
+func (h *HotplugSerial) removed(ep EndPoint) {
+	h.mu.Lock()
+	if h.ep == nil || (ep != nil && h.ep != ep) {
+		h.mu.Unlock()
+		return
+	}
+	h.ep.Close()
+	h.ep = nil
+	h.mu.Unlock()
+
+	h.emit(HotplugEvent{Address: h.config.Address, Removed: true})
+}
+
+//设备插入，重新打开串口并通知
+func (h *HotplugSerial) inserted() {
+	h.mu.Lock()
+	if h.ep != nil {
+		h.mu.Unlock()
+		return
+	}
+	config := h.config
+	ep, err := Open(&config)
+	if err == nil {
+		h.ep = ep
+	}
+	h.mu.Unlock()
+
+	h.emit(HotplugEvent{Address: config.Address, Err: err})
+}
+
+//调用事件回调
+func (h *HotplugSerial) emit(ev HotplugEvent) {
+	if h.notify != nil {
+		h.notify(ev)
+	}
+}
+
+//创建接收内核uevent的netlink套接字
+func openUeventSocket() (int, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return -1, os.NewSyscallError("socket", err)
+	}
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1}
+	if err = syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return -1, os.NewSyscallError("bind", err)
+	}
+	return fd, nil
+}
+
+//监听uevent，匹配串口设备名的拔出和插入事件
+func (h *HotplugSerial) monitorUevent(fd int) {
+	defer h.wg.Done()
+	defer syscall.Close(fd)
+
+	devName := resolveDevName(h.config.Address)
+	b := make([]byte, 8192)
+	for {
+		select {
+		case <-h.done:
+			return
+		default:
+		}
+
+		if err := waitFd(fd, false, hotplugPollInterval); err != nil {
+			continue
+		}
+		n, _, err := syscall.Recvfrom(fd, b, 0)
+		if err != nil || n <= 0 {
+			continue
+		}
+
+		action, env := parseUevent(b[:n])
+		if env["SUBSYSTEM"] != "tty" {
+			continue
+		}
+		switch action {
+		case "remove":
+			if env["DEVNAME"] == devName {
+				h.removed(nil)
+			}
+		case "add":
+			//按路径重新解析，by-id等符号链接可能指向新的设备名
+			time.Sleep(hotplugSettleTime)
+			if name := resolveDevName(h.config.Address); name == env["DEVNAME"] {
+				devName = name
+				h.inserted()
+			}
+		}
+	}
+}
+
+//轮询设备文件是否存在
+func (h *HotplugSerial) monitorPoll() {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(hotplugPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+		}
+
+		_, err := os.Stat(h.config.Address)
+		if err != nil {
+			h.removed(nil)
+		} else if h.current() == nil {
+			h.inserted()
+		}
+	}
+}
+
+//解析uevent消息：ACTION@DEVPATH后跟以NUL分隔的KEY=VALUE
+func parseUevent(b []byte) (action string, env map[string]string) {
+	env = make(map[string]string)
+	fields := bytes.Split(b, []byte{0})
+	if len(fields) > 0 {
+		if i := bytes.IndexByte(fields[0], '@'); i > 0 {
+			action = string(fields[0][:i])
+		}
+	}
+	for _, f := range fields[1:] {
+		if i := bytes.IndexByte(f, '='); i > 0 {
+			env[string(f[:i])] = string(f[i+1:])
+		}
+	}
+	return
+}
+
+//返回串口路径对应的设备名（相对/dev），解析符号链接
+func resolveDevName(address string) string {
+	path, err := filepath.EvalSymlinks(address)
+	if err != nil {
+		path = address
+	}
+	if rel, err := filepath.Rel("/dev", path); err == nil {
+		return rel
+	}
+	return filepath.Base(path)
+}
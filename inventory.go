@@ -0,0 +1,312 @@
+package endpoint
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//CSV清单的列
+var inventoryCSVHeader = []string{"name", "type", "address", "state", "labels", "config", "redacted"}
+
+//配置中的凭据字段，导出清单时不导出，导入时通过SetCredentials设置的函数重新提供
+var credentialFields = map[string]bool{
+	"ProxyPassword": true,
+}
+
+//导入清单时提供被省略的凭据，name为EndPoint名称，field为字段名（比如ProxyPassword）
+type CredentialFunc func(name, field string) (string, error)
+
+//EndPoint清单中的一项，用于在运行时和资产管理系统之间交换设备定义
+type InventoryEntry struct {
+	Name     string            `json:"name"`               //名称
+	Type     string            `json:"type"`               //类型，比如tcp、serial
+	Address  string            `json:"address"`            //地址，仅用于展示，导入时以Config为准
+	Open     bool              `json:"open"`               //是否已打开，导入时打开标记为已打开的EndPoint
+	Labels   map[string]string `json:"labels,omitempty"`   //标签
+	Config   json.RawMessage   `json:"config"`             //配置，键为配置结构的字段名
+	Redacted []string          `json:"redacted,omitempty"` //导出时省略的凭据字段（比如ProxyPassword），导入时通过SetCredentials重新提供
+}
+
+//导出EndPoint清单（按名称排序）。配置中的函数、接口和无法编码为JSON的字段（比如TLS.Config、Resolver）不导出，
+//导入后需重新设置；凭据字段不导出，只在Redacted中列出字段名
+func (m *Manager) Inventory() ([]InventoryEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]InventoryEntry, 0, len(m.endpoints))
+	for _, me := range m.sorted() {
+		config, redacted, err := marshalConfig(me.config)
+		if err != nil {
+			return nil, fmt.Errorf("manager: export %v: %v", me.name, err)
+		}
+		entries = append(entries, InventoryEntry{
+			Name:     me.name,
+			Type:     me.config.Type().String(),
+			Address:  me.config.AddressName(),
+			Open:     me.ep != nil,
+			Labels:   me.copyLabels(),
+			Config:   config,
+			Redacted: redacted,
+		})
+	}
+
+	return entries, nil
+}
+
+//设置导入清单时提供凭据的函数，nil表示不提供，此时导入包含Redacted字段的项返回错误
+func (m *Manager) SetCredentials(f CredentialFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.credentials = f
+}
+
+//导入EndPoint清单，依次添加并打开标记为已打开的EndPoint。
+//名称已存在、配置无效或无法提供被省略的凭据时返回错误，之前的项已导入
+func (m *Manager) Import(entries []InventoryEntry) error {
+	m.mu.RLock()
+	credentials := m.credentials
+	m.mu.RUnlock()
+
+	for _, e := range entries {
+		c, err := unmarshalConfig(e.Type, e.Config)
+		if err != nil {
+			return fmt.Errorf("manager: import %v: %v", e.Name, err)
+		}
+		if err = supplyCredentials(c, e.Name, e.Redacted, credentials); err != nil {
+			return fmt.Errorf("manager: import %v: %v", e.Name, err)
+		}
+		if err = m.Add(e.Name, c, e.Labels); err != nil {
+			return err
+		}
+		if e.Open {
+			if err = m.Open(e.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+//以JSON数组导出EndPoint清单
+func (m *Manager) ExportJSON(w io.Writer) error {
+	entries, err := m.Inventory()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+//导入JSON数组格式的EndPoint清单
+func (m *Manager) ImportJSON(r io.Reader) error {
+	var entries []InventoryEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return fmt.Errorf("manager: import: %v", err)
+	}
+	return m.Import(entries)
+}
+
+//以CSV导出EndPoint清单，列为name、type、address、state（open或closed）、
+//labels（k=v以分号分隔）和config（JSON）
+func (m *Manager) ExportCSV(w io.Writer) error {
+	entries, err := m.Inventory()
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(inventoryCSVHeader)
+	for _, e := range entries {
+		state := "closed"
+		if e.Open {
+			state = "open"
+		}
+		cw.Write([]string{e.Name, e.Type, e.Address, state, formatLabels(e.Labels), string(e.Config), strings.Join(e.Redacted, ";")})
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+//导入CSV格式的EndPoint清单，第一行为列名，列的顺序可以不同，address和redacted列可省略
+func (m *Manager) ImportCSV(r io.Reader) error {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return fmt.Errorf("manager: import: %v", err)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	cols := make(map[string]int)
+	for i, name := range records[0] {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"name", "type", "config"} {
+		if _, ok := cols[name]; !ok {
+			return fmt.Errorf("manager: import: missing column %v", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	entries := make([]InventoryEntry, 0, len(records)-1)
+	for line, record := range records[1:] {
+		labels, err := parseLabels(field(record, "labels"))
+		if err != nil {
+			return fmt.Errorf("manager: import: line %v: %v", line+2, err)
+		}
+		var redacted []string
+		for _, name := range strings.Split(field(record, "redacted"), ";") {
+			if name = strings.TrimSpace(name); name != "" {
+				redacted = append(redacted, name)
+			}
+		}
+		entries = append(entries, InventoryEntry{
+			Name:     field(record, "name"),
+			Type:     field(record, "type"),
+			Address:  field(record, "address"),
+			Open:     field(record, "state") == "open",
+			Labels:   labels,
+			Config:   json.RawMessage(field(record, "config")),
+			Redacted: redacted,
+		})
+	}
+
+	return m.Import(entries)
+}
+
+//编码配置，跳过零值和无法编码的字段，凭据字段不编码，返回被省略的凭据字段名
+func marshalConfig(c EndPointConfig) (json.RawMessage, []string, error) {
+	v := reflect.Indirect(reflect.ValueOf(c))
+	if v.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("unsupported config %T", c)
+	}
+
+	fields := make(map[string]json.RawMessage)
+	var redacted []string
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		if t.Field(i).PkgPath != "" || f.IsZero() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.Func, reflect.Chan, reflect.Interface:
+			continue
+		}
+		if credentialFields[t.Field(i).Name] {
+			redacted = append(redacted, t.Field(i).Name)
+			continue
+		}
+		b, err := json.Marshal(f.Interface())
+		if err != nil {
+			continue
+		}
+		fields[t.Field(i).Name] = b
+	}
+
+	b, err := json.Marshal(fields)
+	return b, redacted, err
+}
+
+//通过f重新提供导出时省略的凭据字段
+func supplyCredentials(c EndPointConfig, name string, redacted []string, f CredentialFunc) error {
+	if len(redacted) == 0 {
+		return nil
+	}
+	if f == nil {
+		return fmt.Errorf("credentials %v must be supplied with SetCredentials", strings.Join(redacted, ", "))
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(c))
+	for _, field := range redacted {
+		fv := v.FieldByName(field)
+		if !credentialFields[field] || !fv.IsValid() || fv.Kind() != reflect.String {
+			return fmt.Errorf("unknown credential field %q", field)
+		}
+		value, err := f(name, field)
+		if err != nil {
+			return fmt.Errorf("credential %v: %v", field, err)
+		}
+		fv.SetString(value)
+	}
+	return nil
+}
+
+//按类型名称解码配置
+func unmarshalConfig(typ string, data json.RawMessage) (EndPointConfig, error) {
+	var c EndPointConfig
+	switch typ {
+	case EndPointTCP.String():
+		c = &TCPConfig{}
+	case EndPointUnix.String():
+		c = &UnixSocketConfig{}
+	case EndPointUDP.String():
+		c = &UDPConfig{}
+	case EndPointSerial.String():
+		c = &SerialConfig{}
+	case EndPointNull.String():
+		c = &NullConfig{}
+	case EndPointFile.String():
+		c = &FileConfig{}
+	case EndPointRFC2217.String():
+		c = &RFC2217Config{}
+	case EndPointModem.String():
+		c = &ModemConfig{}
+	case EndPointTLS.String():
+		c = &TLSConfig{}
+	default:
+		return nil, fmt.Errorf("unsupported endpoint type %q", typ)
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, fmt.Errorf("invalid config: %v", err)
+		}
+	}
+	return c, nil
+}
+
+//按键排序，以k=v;k=v格式编码标签
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ";")
+}
+
+//解析k=v;k=v格式的标签
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ";") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid label %q", pair)
+		}
+		labels[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	return labels, nil
+}
@@ -0,0 +1,201 @@
+package endpoint
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+//凭据字段不应出现在导出的清单中，导入时需重新提供
+func TestInventoryRedactsCredentials(t *testing.T) {
+	const secret = "s3cret-proxy-password"
+	m := NewManager()
+	c := &TCPConfig{Network: "tcp", Address: "192.0.2.1:502", Proxy: "192.0.2.2:3128", ProxyUsername: "gw", ProxyPassword: secret}
+	if err := m.Add("plc", c, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var js, csv bytes.Buffer
+	if err := m.ExportJSON(&js); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ExportCSV(&csv); err != nil {
+		t.Fatal(err)
+	}
+	for name, out := range map[string]string{"json": js.String(), "csv": csv.String()} {
+		if strings.Contains(out, secret) {
+			t.Errorf("%v export contains the proxy password:\n%v", name, out)
+		}
+		if !strings.Contains(out, "ProxyPassword") {
+			t.Errorf("%v export does not list the redacted field:\n%v", name, out)
+		}
+	}
+
+	for name, data := range map[string][]byte{"json": js.Bytes(), "csv": csv.Bytes()} {
+		imported := NewManager()
+		var err error
+		if name == "json" {
+			err = imported.ImportJSON(bytes.NewReader(data))
+		} else {
+			err = imported.ImportCSV(bytes.NewReader(data))
+		}
+		if err == nil {
+			t.Errorf("%v import without credentials succeeded", name)
+		}
+
+		imported = NewManager()
+		imported.SetCredentials(func(ep, field string) (string, error) {
+			return secret, nil
+		})
+		if name == "json" {
+			err = imported.ImportJSON(bytes.NewReader(data))
+		} else {
+			err = imported.ImportCSV(bytes.NewReader(data))
+		}
+		if err != nil {
+			t.Fatalf("%v import: %v", name, err)
+		}
+		got := imported.endpoints["plc"].config.(*TCPConfig)
+		if got.ProxyPassword != secret || got.ProxyUsername != "gw" {
+			t.Errorf("%v import: proxy credentials = %q/%q", name, got.ProxyUsername, got.ProxyPassword)
+		}
+	}
+}
+
+//导出的CSV清单导入后得到相同的清单，已打开的EndPoint导入后打开
+func TestInventoryCSVRoundTrip(t *testing.T) {
+	m := NewManager()
+	if err := m.Add("sim", &NullConfig{Address: "sim,1", ReadData: [][]byte{[]byte("a,\"b\"")}}, map[string]string{"site": "north", "role": "meter"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add("plc", &TCPConfig{Network: "tcp", Address: "192.0.2.1:502"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Open("sim"); err != nil {
+		t.Fatal(err)
+	}
+	defer m.CloseAll()
+
+	var out bytes.Buffer
+	if err := m.ExportCSV(&out); err != nil {
+		t.Fatal(err)
+	}
+	imported := NewManager()
+	if err := imported.ImportCSV(&out); err != nil {
+		t.Fatal(err)
+	}
+	defer imported.CloseAll()
+
+	want, _ := m.Inventory()
+	got, _ := imported.Inventory()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("imported inventory = %+v, want %+v", got, want)
+	}
+}
+
+func TestInventoryImportCSV(t *testing.T) {
+	//列顺序不同，省略address和redacted列，config和labels含有逗号和引号
+	const quoted = "config,name,type,labels\n" +
+		`"{""Address"":""a,b"",""ReadTimeout"":1000000}",sim,null,"site=north;note=x,y"` + "\n"
+
+	tests := []struct {
+		name    string
+		csv     string
+		want    []string //导入后的EndPoint名称
+		wantErr string
+	}{
+		{name: "empty", csv: ""},
+		{name: "header only", csv: "name,type,address,state,labels,config,redacted\n"},
+		{
+			name: "quoted fields",
+			csv:  quoted,
+			want: []string{"sim"},
+		},
+		{
+			name:    "duplicate names",
+			csv:     "name,type,config\nsim,null,{}\nsim,null,{}\n",
+			want:    []string{"sim"},
+			wantErr: "already",
+		},
+		{name: "missing column", csv: "name,type\nsim,null\n", wantErr: "missing column config"},
+		{name: "bad label", csv: "name,type,config,labels\nsim,null,{},site\n", wantErr: "line 2: invalid label"},
+		{name: "bad type", csv: "name,type,config\nsim,fax,{}\n", wantErr: "unsupported endpoint type"},
+		{name: "bad config", csv: "name,type,config\nsim,null,\"{\"\"Address\"\":1}\"\n", wantErr: "invalid config"},
+		{name: "unterminated quote", csv: "name,type,config\n\"sim,null,{}\n", wantErr: "manager: import"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			err := m.ImportCSV(strings.NewReader(tt.csv))
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			} else if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+			}
+			if got := m.Names(); len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("Names = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	m := NewManager()
+	if err := m.ImportCSV(strings.NewReader(quoted)); err != nil {
+		t.Fatal(err)
+	}
+	c := m.endpoints["sim"].config.(*NullConfig)
+	if c.Address != "a,b" || c.ReadTimeout != time.Millisecond {
+		t.Errorf("config = %+v, want Address a,b and ReadTimeout 1ms", c)
+	}
+	if labels := m.Labels("sim"); labels["site"] != "north" || labels["note"] != "x,y" {
+		t.Errorf("labels = %v, want site=north and note=x,y", labels)
+	}
+}
+
+//导入时按EndPoint名称和字段名向CredentialFunc请求凭据，出错时不添加该EndPoint
+func TestInventoryImportCSVCredentials(t *testing.T) {
+	const data = "name,type,config,redacted\n" +
+		`a,tcp,"{""Network"":""tcp"",""Address"":""192.0.2.1:502"",""Proxy"":""192.0.2.9:3128"",""ProxyUsername"":""u""}",ProxyPassword` + "\n" +
+		`b,tcp,"{""Network"":""tcp"",""Address"":""192.0.2.2:502"",""Proxy"":""192.0.2.9:3128"",""ProxyUsername"":""u""}",ProxyPassword` + "\n"
+
+	var asked []string
+	m := NewManager()
+	m.SetCredentials(func(name, field string) (string, error) {
+		asked = append(asked, name+"."+field)
+		return "pw-" + name, nil
+	})
+	if err := m.ImportCSV(strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.ProxyPassword", "b.ProxyPassword"}; !reflect.DeepEqual(asked, want) {
+		t.Errorf("credentials requested for %v, want %v", asked, want)
+	}
+	for _, name := range []string{"a", "b"} {
+		if got := m.endpoints[name].config.(*TCPConfig).ProxyPassword; got != "pw-"+name {
+			t.Errorf("%v ProxyPassword = %q, want %q", name, got, "pw-"+name)
+		}
+	}
+
+	m = NewManager()
+	m.SetCredentials(func(name, field string) (string, error) {
+		if name == "b" {
+			return "", errors.New("vault unavailable")
+		}
+		return "pw", nil
+	})
+	if err := m.ImportCSV(strings.NewReader(data)); err == nil || !strings.Contains(err.Error(), "vault unavailable") {
+		t.Errorf("err = %v, want vault unavailable", err)
+	}
+	if got := m.Names(); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("Names = %v, want [a]", got)
+	}
+
+	//不是凭据的字段不能通过redacted列设置
+	m = NewManager()
+	m.SetCredentials(func(name, field string) (string, error) { return "x", nil })
+	if err := m.ImportCSV(strings.NewReader("name,type,config,redacted\na,tcp,{},Address\n")); err == nil || !strings.Contains(err.Error(), "unknown credential field") {
+		t.Errorf("err = %v, want unknown credential field", err)
+	}
+}
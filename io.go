@@ -0,0 +1,173 @@
+package endpoint
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+//waitFd等待超时
+var errWaitTimeout = errors.New("wait timeout")
+
+//读取恰好len(b)字节，用于定长报文协议。在ReadTimeout内未收齐时返回已收到的字节数和ErrShortRead，
+//ReadTimeout为0时一直等待直到收齐或出错。
+//串口等Read自带超时的EndPoint每次读取的超时被限制为剩余时间，返回前恢复ReadTimeout，整体等待不超过ReadTimeout；
+//未实现TimeoutSetter的EndPoint无法限制单次读取，最后一次读取可能再等待一个ReadTimeout，即最长约2倍ReadTimeout
+func ReadExact(p EndPoint, b []byte) (n int, err error) {
+	var expireTime time.Time
+	timeout := p.ReadTimeout()
+	if timeout > 0 {
+		expireTime = time.Now().Add(timeout)
+		if setReadTimeout(p, timeout) {
+			defer setReadTimeout(p, timeout)
+		}
+	}
+
+	for n < len(b) {
+		var remainTime time.Duration
+		if timeout > 0 {
+			if remainTime = expireTime.Sub(time.Now()); remainTime <= 0 {
+				return n, ErrShortRead
+			}
+			setReadTimeout(p, remainTime)
+		}
+
+		if err = waitReadable(p, remainTime); err == errWaitTimeout {
+			return n, ErrShortRead
+		} else if err != nil {
+			return
+		}
+
+		var m int
+		m, err = p.Read(b[n:])
+		if m > 0 {
+			n += m
+		}
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			continue
+		} else if IsTimeout(err) {
+			return n, ErrShortRead
+		} else if err != nil {
+			return
+		} else if m == 0 { //对端关闭
+			return n, ErrShortRead
+		}
+	}
+
+	return n, nil
+}
+
+//等待EndPoint可读，timeout<=0表示一直等待，超时返回errWaitTimeout。
+//串口、RFC2217、Modem和TLS的Read自带超时，其他EndPoint先等待可读，避免阻塞或EAGAIN
+func waitReadable(p EndPoint, timeout time.Duration) error {
+	switch p.Type() {
+	case EndPointSerial, EndPointRFC2217, EndPointModem, EndPointTLS:
+		return nil
+	}
+	if fd := p.Fd(); fd != -1 {
+		return waitFd(fd, false, timeout)
+	}
+	return nil
+}
+
+//在timeout内读取一次数据，超时或暂无数据时返回0和nil，对端关闭时返回io.EOF。
+//读取期间临时修改EndPoint的读超时，返回前恢复
+func readWithin(p EndPoint, b []byte, timeout time.Duration) (int, error) {
+	readTimeout := p.ReadTimeout()
+	if setReadTimeout(p, timeout) {
+		defer setReadTimeout(p, readTimeout)
+	}
+
+	if err := waitReadable(p, timeout); err == errWaitTimeout {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	n, err := p.Read(b)
+	if err == syscall.EAGAIN || err == syscall.EINTR || IsTimeout(err) {
+		return 0, nil
+	} else if err == nil && n == 0 {
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+//按最大读取长度截取缓冲区，多留1字节用于判断报文是否超长
+func limitReadBuffer(b []byte, max int) []byte {
+	if max > 0 && len(b) > max+1 {
+		return b[:max+1]
+	}
+	return b
+}
+
+//检查读取的报文长度，超长时丢弃数据并返回FrameSizeError
+func checkReadSize(op string, n, max int) (int, error) {
+	if max > 0 && n > max {
+		return 0, &FrameSizeError{Op: op + " read", Size: n, Limit: max}
+	}
+	return n, nil
+}
+
+//检查发送的报文长度，超长时返回FrameSizeError
+func checkWriteSize(op string, n, max int) error {
+	if max > 0 && n > max {
+		return &FrameSizeError{Op: op + " write", Size: n, Limit: max}
+	}
+	return nil
+}
+
+//等待文件句柄可读（write为false）或可写，timeout<=0表示一直等待，超时返回errWaitTimeout
+func waitFd(fd int, write bool, timeout time.Duration) error {
+	events := int16(unix.POLLIN)
+	if write {
+		events = unix.POLLOUT
+	}
+	ready, err := pollFd(fd, events, timeout)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return errWaitTimeout
+	}
+	return nil
+}
+
+//通过poll等待单个文件句柄上的事件，timeout<=0表示一直等待，超时返回false。
+//不使用select，文件句柄不受FD_SETSIZE（1024）限制。出错或挂断时也返回true，由随后的读写返回具体错误
+func pollFd(fd int, events int16, timeout time.Duration) (bool, error) {
+	var expireTime time.Time
+	if timeout > 0 {
+		expireTime = time.Now().Add(timeout)
+	}
+
+	fds := []unix.PollFd{{Fd: int32(fd), Events: events}}
+	for { //如遇到EINTR（Interrupted system call）错误，重试
+		ms := -1
+		if timeout > 0 {
+			remainTime := expireTime.Sub(time.Now())
+			if remainTime <= 0 {
+				return false, nil
+			}
+			ms = int((remainTime + time.Millisecond - 1) / time.Millisecond) //向上取整到毫秒，避免剩余不足1ms时空转
+		}
+
+		n, err := unix.Poll(fds, ms)
+		if err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			return false, os.NewSyscallError("poll", err)
+		}
+		if n == 0 {
+			continue
+		}
+		if fds[0].Revents&unix.POLLNVAL != 0 {
+			return false, os.NewSyscallError("poll", syscall.EBADF)
+		}
+		return true, nil
+	}
+}
@@ -0,0 +1,97 @@
+package endpoint
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+//文件句柄大于FD_SETSIZE（1024）时waitFd仍应正确等待
+func TestWaitFdHighFd(t *testing.T) {
+	const high = 2000
+	defer raiseFdLimit(t, high)()
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+	if err = unix.Dup3(fds[0], high, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(high)
+
+	if err = waitFd(high, false, 20*time.Millisecond); err != errWaitTimeout {
+		t.Fatalf("waitFd on idle fd = %v, want errWaitTimeout", err)
+	}
+	if _, err = syscall.Write(fds[1], []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err = waitFd(high, false, time.Second); err != nil {
+		t.Fatalf("waitFd on readable fd = %v", err)
+	}
+	if err = waitFd(high, true, time.Second); err != nil {
+		t.Fatalf("waitFd on writable fd = %v", err)
+	}
+}
+
+//把RLIMIT_NOFILE提高到可以使用文件句柄high，返回恢复原限制的函数，硬限制不足时跳过测试
+func raiseFdLimit(t *testing.T, high int) func() {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		t.Fatal(err)
+	}
+	if rlim.Cur > uint64(high) {
+		return func() {}
+	}
+	if rlim.Max <= uint64(high) {
+		t.Skipf("RLIMIT_NOFILE hard limit %v too low", rlim.Max)
+	}
+	old := rlim
+	rlim.Cur = rlim.Max
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		t.Skip(err)
+	}
+	return func() { syscall.Setrlimit(syscall.RLIMIT_NOFILE, &old) }
+}
+
+//把文件句柄fd移动到high并关闭原句柄
+func moveFd(t *testing.T, fd, high int) {
+	if err := unix.Dup3(fd, high, unix.O_CLOEXEC); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(fd)
+}
+
+//记录每次Read时读超时的EndPoint
+type timeoutRecorder struct {
+	*chanEndPoint
+	seen []time.Duration
+}
+
+func (p *timeoutRecorder) Read(b []byte) (int, error) {
+	p.seen = append(p.seen, p.timeout)
+	return p.chanEndPoint.Read(b)
+}
+
+//ReadExact每次读取的超时不超过剩余时间，返回前恢复ReadTimeout
+func TestReadExactCapsInnerReads(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	p := &timeoutRecorder{chanEndPoint: newChanEndPoint()}
+	p.timeout = timeout
+	go func() { p.rx <- []byte("a") }()
+
+	b := make([]byte, 4)
+	if n, err := ReadExact(p, b); n != 1 || err != ErrShortRead {
+		t.Fatalf("ReadExact = %v, %v, want 1, ErrShortRead", n, err)
+	}
+	if len(p.seen) != 2 || p.seen[0] > timeout || p.seen[1] >= timeout {
+		t.Errorf("read timeouts %v, want the second below %v", p.seen, timeout)
+	}
+	if p.timeout != timeout {
+		t.Errorf("read timeout %v after ReadExact, want %v", p.timeout, timeout)
+	}
+}
@@ -0,0 +1,387 @@
+package endpoint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//保活脚本，按Interval周期依次执行Steps。脚本格式每行一条语句，#开始的行为注释：
+//
+//	every 30s                 # 执行周期
+//	send "AT\r"               # 发送字符串，支持Go转义
+//	send hex 0d0a             # 发送十六进制数据
+//	expect "OK" within 2s     # 在2s内等待包含OK的应答
+type KeepAliveScript struct {
+	Interval time.Duration   //执行周期
+	Steps    []KeepAliveStep //依次执行的步骤
+}
+
+//保活脚本的一个步骤，Send和Expect只有一个非nil
+type KeepAliveStep struct {
+	Send   []byte        //发送的数据
+	Expect []byte        //期望应答中包含的数据
+	Within time.Duration //等待应答的超时
+}
+
+//解析保活脚本
+func ParseKeepAliveScript(src string) (*KeepAliveScript, error) {
+	s := &KeepAliveScript{}
+
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := stripComment(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := s.parseLine(line); err != nil {
+			return nil, fmt.Errorf("keepalive: line %v: %v", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("keepalive: %v", err)
+	}
+
+	if s.Interval <= 0 {
+		return nil, fmt.Errorf("keepalive: missing every statement")
+	}
+	if len(s.Steps) == 0 {
+		return nil, fmt.Errorf("keepalive: no send or expect statement")
+	}
+
+	return s, nil
+}
+
+//解析一行语句
+func (s *KeepAliveScript) parseLine(line string) (err error) {
+	keyword, rest := splitWord(line)
+	switch keyword {
+	case "every":
+		if s.Interval, err = time.ParseDuration(rest); err != nil {
+			return
+		}
+		if s.Interval <= 0 {
+			return fmt.Errorf("invalid interval %v", s.Interval)
+		}
+	case "send":
+		var data []byte
+		if data, rest, err = parseScriptData(rest); err != nil {
+			return
+		}
+		if rest != "" {
+			return fmt.Errorf("unexpected %q", rest)
+		}
+		s.Steps = append(s.Steps, KeepAliveStep{Send: data})
+	case "expect":
+		var data []byte
+		if data, rest, err = parseScriptData(rest); err != nil {
+			return
+		}
+		if len(data) == 0 {
+			return fmt.Errorf("empty expect")
+		}
+		word, d := splitWord(rest)
+		if word != "within" {
+			return fmt.Errorf("expect requires within")
+		}
+		var within time.Duration
+		if within, err = time.ParseDuration(d); err != nil {
+			return
+		}
+		s.Steps = append(s.Steps, KeepAliveStep{Expect: data, Within: within})
+	default:
+		return fmt.Errorf("unknown statement %q", keyword)
+	}
+
+	return nil
+}
+
+//解析send或expect的数据，返回数据和剩余的文本
+func parseScriptData(s string) (data []byte, rest string, err error) {
+	if strings.HasPrefix(s, "\"") {
+		//查找未转义的结束引号
+		end := -1
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+		var str string
+		if str, err = strconv.Unquote(s[:end+1]); err != nil {
+			return nil, "", err
+		}
+		return []byte(str), strings.TrimSpace(s[end+1:]), nil
+	}
+
+	word, rest := splitWord(s)
+	if word != "hex" {
+		return nil, "", fmt.Errorf("data must be a quoted string or hex")
+	}
+	word, rest = splitWord(rest)
+	if data, err = hex.DecodeString(word); err != nil {
+		return nil, "", err
+	}
+	return data, rest, nil
+}
+
+//拆分第一个单词和剩余的文本
+func splitWord(s string) (word, rest string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
+
+//去除行尾注释，引号内的#不是注释
+func stripComment(s string) string {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == '#':
+			return strings.TrimSpace(s[:i])
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+//保活引擎，包装EndPoint按脚本周期发送心跳。心跳只与业务写互斥，不会插入到业务报文之间；
+//业务读不阻塞心跳，等待应答期间业务读到的数据交给心跳，匹配之后的数据仍返回给业务
+type KeepAlive struct {
+	EndPoint
+	script  *KeepAliveScript //保活脚本
+	onError func(error)      //心跳失败时的回调，可为nil
+	wmu     sync.Mutex       //业务写和心跳发送互斥
+	reading chan struct{}    //容量为1，底层Read进行中时非空，保证同一时刻只有一个读取者
+	mu      sync.Mutex       //保护waiter和pending
+	waiter  *keepAliveWaiter //正在等待的应答，没有时为nil
+	pending []byte           //心跳读到的应答之后的数据，留给业务读
+	done    chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+//心跳等待的应答
+type keepAliveWaiter struct {
+	expect []byte        //期望应答中包含的数据
+	got    []byte        //已收到的数据
+	done   chan struct{} //收到期望的应答时关闭
+}
+
+//创建保活引擎并立即开始按周期执行脚本
+func NewKeepAlive(p EndPoint, s *KeepAliveScript, onError func(error)) *KeepAlive {
+	k := &KeepAlive{
+		EndPoint: p,
+		script:   s,
+		onError:  onError,
+		reading:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	k.wg.Add(1)
+	go k.run()
+
+	return k
+}
+
+//读取数据，心跳等待应答时读到的数据先交给心跳
+func (k *KeepAlive) Read(b []byte) (int, error) {
+	for {
+		k.reading <- struct{}{}
+		k.mu.Lock()
+		if len(k.pending) > 0 {
+			n := copy(b, k.pending)
+			k.pending = k.pending[n:]
+			k.mu.Unlock()
+			<-k.reading
+			return n, nil
+		}
+		k.mu.Unlock()
+
+		n, err := k.EndPoint.Read(b)
+		m, handed := k.handOver(b[:n])
+		<-k.reading
+		//数据全部交给了心跳时继续读取
+		if !handed || m > 0 || n == 0 || err != nil {
+			return m, err
+		}
+	}
+}
+
+//写数据，与心跳发送互斥
+func (k *KeepAlive) Write(b []byte) (int, error) {
+	k.wmu.Lock()
+	defer k.wmu.Unlock()
+
+	return k.EndPoint.Write(b)
+}
+
+//停止心跳并关闭EndPoint
+func (k *KeepAlive) Close() error {
+	k.Stop()
+	return k.EndPoint.Close()
+}
+
+//停止心跳，不关闭EndPoint
+func (k *KeepAlive) Stop() {
+	k.once.Do(func() {
+		close(k.done)
+		k.wg.Wait()
+	})
+}
+
+//修改底层EndPoint的读超时，底层不支持TimeoutSetter时忽略
+func (k *KeepAlive) SetReadTimeout(d time.Duration) {
+	setReadTimeout(k.EndPoint, d)
+}
+
+//修改底层EndPoint的写超时，底层不支持TimeoutSetter时忽略
+func (k *KeepAlive) SetWriteTimeout(d time.Duration) {
+	setWriteTimeout(k.EndPoint, d)
+}
+
+//按周期执行脚本
+func (k *KeepAlive) run() {
+	defer k.wg.Done()
+
+	ticker := time.NewTicker(k.script.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.done:
+			return
+		case <-ticker.C:
+		}
+
+		err := k.execute()
+		select {
+		case <-k.done: //停止时中断的心跳不报告错误
+			return
+		default:
+		}
+		if err != nil && k.onError != nil {
+			k.onError(err)
+		}
+	}
+}
+
+//执行一遍脚本
+func (k *KeepAlive) execute() error {
+	for _, step := range k.script.Steps {
+		if step.Send != nil {
+			k.wmu.Lock()
+			_, err := k.EndPoint.Write(step.Send)
+			k.wmu.Unlock()
+			if err != nil {
+				return fmt.Errorf("keepalive: send %q: %v", step.Send, err)
+			}
+			continue
+		}
+		if err := k.expect(step.Expect, step.Within); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//在within内等待包含expect的应答。业务读进行中时由业务读交来数据，否则自己读取
+func (k *KeepAlive) expect(expect []byte, within time.Duration) error {
+	w := &keepAliveWaiter{expect: expect, done: make(chan struct{})}
+	k.mu.Lock()
+	k.waiter = w
+	k.mu.Unlock()
+	defer func() {
+		k.mu.Lock()
+		if k.waiter == w {
+			k.waiter = nil
+		}
+		k.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(within)
+	defer timer.Stop()
+
+	buf := make([]byte, 256)
+	expireTime := time.Now().Add(within)
+	for {
+		select {
+		case <-w.done:
+			return nil
+		case <-k.done:
+			return fmt.Errorf("keepalive: expect %q: stopped", expect)
+		case <-timer.C:
+			return k.expectTimeout(w, within)
+		case k.reading <- struct{}{}:
+		}
+		remainTime := expireTime.Sub(time.Now())
+		select {
+		case <-w.done:
+			<-k.reading
+			return nil
+		default:
+			if remainTime <= 0 {
+				<-k.reading
+				return k.expectTimeout(w, within)
+			}
+		}
+
+		//没有业务读，在剩余时间内自己读取
+		n, err := readWithin(k.EndPoint, buf, remainTime)
+		if m, _ := k.handOver(buf[:n]); m > 0 {
+			k.mu.Lock()
+			k.pending = append(k.pending, buf[:m]...)
+			k.mu.Unlock()
+		}
+		<-k.reading
+		if err != nil {
+			return fmt.Errorf("keepalive: expect %q: %v", expect, err)
+		}
+	}
+}
+
+//返回等待应答超时的错误，包含已收到的数据
+func (k *KeepAlive) expectTimeout(w *keepAliveWaiter, within time.Duration) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return fmt.Errorf("keepalive: expect %q: got %q: %v", w.expect, w.got,
+		&TimeoutError{Op: "keepalive", Duration: within})
+}
+
+//把读到的数据交给等待应答的心跳，返回移到b开头的、匹配之后留给业务的数据长度。
+//没有心跳等待时不处理，handed为false
+func (k *KeepAlive) handOver(b []byte) (n int, handed bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	w := k.waiter
+	if w == nil {
+		return len(b), false
+	}
+	w.got = append(w.got, b...)
+	i := bytes.Index(w.got, w.expect)
+	if i < 0 {
+		return 0, true
+	}
+	//之前的数据不包含expect，匹配结束于b内，剩余部分是b的后缀
+	rest := w.got[i+len(w.expect):]
+	k.waiter = nil
+	close(w.done)
+	return copy(b, rest), true
+}
@@ -0,0 +1,236 @@
+package endpoint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseKeepAliveScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    []KeepAliveStep
+		wantErr string
+	}{
+		{
+			name: "escapes",
+			src:  "every 30s\nsend \"AT\\r\\n\\x1a\\\"\"",
+			want: []KeepAliveStep{{Send: []byte("AT\r\n\x1a\"")}},
+		},
+		{
+			name: "hex",
+			src:  "every 1m\nsend hex 0d0a\nexpect hex 4f4b within 2s",
+			want: []KeepAliveStep{{Send: []byte{0x0d, 0x0a}}, {Expect: []byte("OK"), Within: 2 * time.Second}},
+		},
+		{
+			name: "comments",
+			src:  "# 心跳\n\nevery 30s # 周期\n  # 缩进的注释\nsend \"AT\" # 发送\nexpect \"OK\" within 2s # 应答",
+			want: []KeepAliveStep{{Send: []byte("AT")}, {Expect: []byte("OK"), Within: 2 * time.Second}},
+		},
+		{
+			name: "hex expect with comment",
+			src:  "every 30s\nexpect hex 41 within 2s # c",
+			want: []KeepAliveStep{{Expect: []byte("A"), Within: 2 * time.Second}},
+		},
+		{
+			name: "hash in quotes",
+			src:  "every 30s\nsend \"#1\\\"#\" # 注释\nexpect \"#OK\" within 1s",
+			want: []KeepAliveStep{{Send: []byte("#1\"#")}, {Expect: []byte("#OK"), Within: time.Second}},
+		},
+		{name: "missing within", src: "every 30s\nexpect \"OK\"", wantErr: "line 2: expect requires within"},
+		{name: "within commented out", src: "every 30s\nexpect \"OK\" # within 2s", wantErr: "line 2: expect requires within"},
+		{name: "missing every", src: "send \"AT\"", wantErr: "missing every"},
+		{name: "no steps", src: "every 30s", wantErr: "no send or expect"},
+		{name: "unterminated", src: "every 30s\nsend \"AT", wantErr: "line 2: unterminated string"},
+		{name: "bad hex", src: "every 30s\nsend hex 0g", wantErr: "line 2:"},
+		{name: "trailing text", src: "every 30s\nsend \"AT\" now", wantErr: "line 2: unexpected"},
+		{name: "empty expect", src: "every 30s\nexpect \"\" within 1s", wantErr: "line 2: empty expect"},
+		{name: "unknown", src: "every 30s\nwait 1s", wantErr: "line 2: unknown statement"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseKeepAliveScript(tt.src)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(s.Steps) != len(tt.want) {
+				t.Fatalf("steps = %+v, want %+v", s.Steps, tt.want)
+			}
+			for i, step := range s.Steps {
+				w := tt.want[i]
+				if !bytes.Equal(step.Send, w.Send) || !bytes.Equal(step.Expect, w.Expect) || step.Within != w.Within {
+					t.Errorf("step %v = %+v, want %+v", i, step, w)
+				}
+			}
+		})
+	}
+}
+
+//通过通道收发数据的EndPoint，其余方法由Null提供
+type chanEndPoint struct {
+	EndPoint
+	rx      chan []byte   //Read返回的数据
+	tx      chan []byte   //Write发送的数据
+	entered chan struct{} //每次进入Read时通知
+	timeout time.Duration //读超时，0表示一直等待
+}
+
+func newChanEndPoint() *chanEndPoint {
+	return &chanEndPoint{
+		EndPoint: newNull(),
+		rx:       make(chan []byte),
+		tx:       make(chan []byte, 16),
+		entered:  make(chan struct{}, 16),
+	}
+}
+
+func (p *chanEndPoint) Read(b []byte) (int, error) {
+	p.entered <- struct{}{}
+	var timeout <-chan time.Time
+	if p.timeout > 0 {
+		timeout = time.After(p.timeout)
+	}
+	select {
+	case data := <-p.rx:
+		return copy(b, data), nil
+	case <-timeout:
+		return 0, &TimeoutError{Op: "chan", Duration: p.timeout}
+	}
+}
+
+func (p *chanEndPoint) Write(b []byte) (int, error) {
+	p.tx <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func (p *chanEndPoint) ReadTimeout() time.Duration {
+	return p.timeout
+}
+
+func (p *chanEndPoint) SetReadTimeout(d time.Duration) {
+	p.timeout = d
+}
+
+func (p *chanEndPoint) SetWriteTimeout(d time.Duration) {}
+
+//创建不会自动触发心跳的保活引擎，测试中直接调用execute执行脚本
+func newTestKeepAlive(p EndPoint, steps ...KeepAliveStep) *KeepAlive {
+	return NewKeepAlive(p, &KeepAliveScript{Interval: time.Hour, Steps: steps}, nil)
+}
+
+//业务读等待数据时，业务写和心跳发送都不应被阻塞
+func TestKeepAliveWriteDuringRead(t *testing.T) {
+	p := newChanEndPoint()
+	k := newTestKeepAlive(p, KeepAliveStep{Send: []byte("AT")})
+	defer k.Stop()
+
+	readDone := make(chan []byte, 1)
+	go func() {
+		b := make([]byte, 16)
+		n, _ := k.Read(b)
+		readDone <- b[:n]
+	}()
+	<-p.entered
+
+	if err := k.execute(); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-p.tx; string(got) != "AT" {
+		t.Errorf("heartbeat sent %q, want \"AT\"", got)
+	}
+	if _, err := k.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-p.tx; string(got) != "data" {
+		t.Errorf("Write sent %q, want \"data\"", got)
+	}
+	select {
+	case b := <-readDone:
+		t.Fatalf("Read returned %q before any data arrived", b)
+	default:
+	}
+
+	p.rx <- []byte("x")
+	if b := <-readDone; string(b) != "x" {
+		t.Errorf("Read = %q, want \"x\"", b)
+	}
+}
+
+//心跳等待应答时，业务读到的应答交给心跳，应答之后的数据仍返回给业务
+func TestKeepAliveExpectHandOver(t *testing.T) {
+	p := newChanEndPoint()
+	k := newTestKeepAlive(p, KeepAliveStep{Expect: []byte("OK"), Within: 5 * time.Second})
+	defer k.Stop()
+
+	readDone := make(chan []byte, 1)
+	go func() {
+		b := make([]byte, 16)
+		n, _ := k.Read(b)
+		readDone <- b[:n]
+	}()
+	<-p.entered
+
+	errc := make(chan error, 1)
+	go func() { errc <- k.execute() }()
+	//等待心跳登记应答，此时业务读占用着底层Read
+	for {
+		k.mu.Lock()
+		w := k.waiter
+		k.mu.Unlock()
+		if w != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	//应答分两次到达，第一次的数据全部交给心跳，业务读继续等待
+	p.rx <- []byte("xO")
+	<-p.entered
+	p.rx <- []byte("Kyz")
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if b := <-readDone; string(b) != "yz" {
+		t.Errorf("Read = %q, want \"yz\"", b)
+	}
+}
+
+//没有业务读时心跳自己读取应答，应答之后的数据留给下一次业务读
+func TestKeepAliveExpectPending(t *testing.T) {
+	p := newChanEndPoint()
+	k := newTestKeepAlive(p, KeepAliveStep{Expect: []byte("OK"), Within: 5 * time.Second})
+	defer k.Stop()
+
+	errc := make(chan error, 1)
+	go func() { errc <- k.execute() }()
+	<-p.entered
+	p.rx <- []byte("OKrest")
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 16)
+	if n, err := k.Read(b); err != nil || string(b[:n]) != "rest" {
+		t.Errorf("Read = %q, %v, want \"rest\", nil", b[:n], err)
+	}
+}
+
+//within内没有收到期望的应答时返回超时错误
+func TestKeepAliveExpectTimeout(t *testing.T) {
+	p := newChanEndPoint()
+	k := newTestKeepAlive(p, KeepAliveStep{Expect: []byte("OK"), Within: 20 * time.Millisecond})
+	defer k.Stop()
+
+	err := k.execute()
+	if err == nil || !strings.Contains(err.Error(), "expect \"OK\"") || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("err = %v, want expect timeout", err)
+	}
+}
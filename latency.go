@@ -0,0 +1,185 @@
+package endpoint
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+//响应延迟分布类型
+type LatencyKind int
+
+const (
+	LatencyFixed     LatencyKind = iota //固定延迟Delay
+	LatencyUniform                      //[Min, Max)内均匀分布
+	LatencyNormal                       //均值Delay、标准差StdDev的正态分布，截断到[Min, Max]
+	LatencyHistogram                    //按录制的直方图Buckets分布
+)
+
+//直方图的一个桶，延迟在上一个桶的Upper（第一个桶为0）和本桶的Upper之间均匀分布
+type LatencyBucket struct {
+	Upper time.Duration //桶的上界
+	Count int           //落在桶内的样本数，作为抽样权重
+}
+
+//模拟设备的响应延迟，用于Null和File等模拟EndPoint，使负载测试反映真实设备的应答时序
+type LatencyProfile struct {
+	Kind    LatencyKind     //分布类型
+	Delay   time.Duration   //固定延迟或正态分布的均值
+	StdDev  time.Duration   //正态分布的标准差
+	Min     time.Duration   //均匀分布的下界，正态分布截断的下界
+	Max     time.Duration   //均匀分布的上界，正态分布截断的上界，0表示不截断
+	Buckets []LatencyBucket //直方图的桶，Upper须递增
+	Seed    int64           //随机种子，相同种子和名称的EndPoint延迟序列相同
+}
+
+//由录制的响应延迟样本生成直方图分布，buckets为桶数，样本在最小值和最大值之间等宽分桶
+func RecordedLatency(samples []time.Duration, buckets int) (*LatencyProfile, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("latency: no samples")
+	}
+	if buckets <= 0 {
+		return nil, fmt.Errorf("latency: invalid bucket count %v", buckets)
+	}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	min, max := sorted[0], sorted[len(sorted)-1]
+	width := (max - min) / time.Duration(buckets)
+	if width <= 0 {
+		return &LatencyProfile{Kind: LatencyFixed, Delay: min}, nil
+	}
+
+	l := &LatencyProfile{Kind: LatencyHistogram}
+	first := 0
+	if min > 0 {
+		//空桶占位，使第一个等宽桶从min开始
+		l.Buckets = append(l.Buckets, LatencyBucket{Upper: min})
+		first = 1
+	}
+	for i := 1; i <= buckets; i++ {
+		l.Buckets = append(l.Buckets, LatencyBucket{Upper: min + width*time.Duration(i)})
+	}
+	l.Buckets[len(l.Buckets)-1].Upper = max
+	for _, d := range sorted {
+		i := int((d - min) / width)
+		if i >= buckets {
+			i = buckets - 1
+		}
+		l.Buckets[first+i].Count++
+	}
+
+	return l, nil
+}
+
+//检查分布参数
+func (l *LatencyProfile) validate() error {
+	switch l.Kind {
+	case LatencyFixed:
+		if l.Delay < 0 {
+			return fmt.Errorf("latency: invalid delay %v", l.Delay)
+		}
+	case LatencyUniform:
+		if l.Min < 0 || l.Max < l.Min {
+			return fmt.Errorf("latency: invalid range [%v, %v)", l.Min, l.Max)
+		}
+	case LatencyNormal:
+		if l.Delay < 0 || l.StdDev < 0 || l.Min < 0 || (l.Max > 0 && l.Max < l.Min) {
+			return fmt.Errorf("latency: invalid normal distribution %v±%v", l.Delay, l.StdDev)
+		}
+	case LatencyHistogram:
+		total := 0
+		for i, b := range l.Buckets {
+			if b.Count < 0 || b.Upper < 0 || (i > 0 && b.Upper < l.Buckets[i-1].Upper) {
+				return fmt.Errorf("latency: invalid bucket %v", i)
+			}
+			total += b.Count
+		}
+		if total == 0 {
+			return fmt.Errorf("latency: empty histogram")
+		}
+	default:
+		return fmt.Errorf("latency: unknown kind %v", l.Kind)
+	}
+
+	return nil
+}
+
+//按分布抽样响应延迟，nil时延迟为0
+type latencySampler struct {
+	profile LatencyProfile //延迟分布
+	total   int            //直方图的样本总数
+	mu      sync.Mutex     //保护rnd
+	rnd     *rand.Rand     //随机数发生器
+}
+
+//创建抽样器，随机种子由配置种子和名称共同决定，l为nil时返回nil
+func newLatencySampler(l *LatencyProfile, name string) (*latencySampler, error) {
+	if l == nil {
+		return nil, nil
+	}
+	if err := l.validate(); err != nil {
+		return nil, err
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(name))
+
+	s := &latencySampler{
+		profile: *l,
+		rnd:     rand.New(rand.NewSource(l.Seed ^ int64(h.Sum64()))),
+	}
+	s.profile.Buckets = append([]LatencyBucket(nil), l.Buckets...)
+	for _, b := range s.profile.Buckets {
+		s.total += b.Count
+	}
+
+	return s, nil
+}
+
+//抽样下一次响应的延迟
+func (s *latencySampler) next() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := &s.profile
+	switch l.Kind {
+	case LatencyUniform:
+		if l.Max == l.Min {
+			return l.Min
+		}
+		return l.Min + time.Duration(s.rnd.Int63n(int64(l.Max-l.Min)))
+	case LatencyNormal:
+		d := l.Delay + time.Duration(s.rnd.NormFloat64()*float64(l.StdDev))
+		if d < l.Min {
+			d = l.Min
+		}
+		if l.Max > 0 && d > l.Max {
+			d = l.Max
+		}
+		return d
+	case LatencyHistogram:
+		n := s.rnd.Intn(s.total)
+		var lower time.Duration
+		for _, b := range l.Buckets {
+			if n < b.Count {
+				if b.Upper == lower {
+					return lower
+				}
+				return lower + time.Duration(s.rnd.Int63n(int64(b.Upper-lower)))
+			}
+			n -= b.Count
+			lower = b.Upper
+		}
+		return lower
+	default:
+		return l.Delay
+	}
+}
@@ -0,0 +1,220 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//监听队列的默认长度
+const listenBacklog = 128
+
+//监听已关闭
+var ErrListenerClosed = errors.New("listener: closed")
+
+//监听器，Accept返回的连接为EndPoint，可用于设备模拟器和由设备主动连接的协议
+type Listener interface {
+	Accept() (EndPoint, error) //等待并接受一个连接
+	Close() error              //停止监听，唤醒等待中的Accept
+	Addr() net.Addr            //返回监听地址，端口为0时返回系统分配的端口
+	Fd() int                   //返回监听套接字的文件句柄
+}
+
+//TCP监听配置，Accept返回的连接使用其中的连接选项
+type TCPListenerConfig struct {
+	Network       string        //TCP网络类型（tcp、tcp4、tcp6）
+	Address       string        //监听地址，比如:502、192.168.1.1:8080
+	Backlog       int           //监听队列长度，0表示128
+	ReuseAddr     bool          //设置SO_REUSEADDR，重启后可立即绑定处于TIME_WAIT的端口
+	Interface     string        //绑定的网络接口，为空时监听所有接口
+	FreeBind      bool          //允许监听尚未配置在本机接口上的地址（IP_FREEBIND）
+	Transparent   bool          //透明代理（IP_TRANSPARENT），可接受发往非本机地址的连接，需要CAP_NET_ADMIN和TPROXY规则
+	AcceptTimeout time.Duration //Accept等待连接的超时，0表示一直等待
+	KeepAlive     time.Duration //连接的TCP保活周期，如果不启用则配0
+	NoDelay       TCPSocketOpt  //连接的TCP数据延迟发送，默认no delay
+	ReadTimeout   time.Duration //连接的一次完全数据包的收取超时
+	WriteTimeout  time.Duration //连接的一次完整数据包的发送超时
+	MaxReadSize   int           //连接单次读取的最大报文长度，0表示不限制
+	MaxWriteSize  int           //连接单次发送的最大报文长度，0表示不限制
+}
+
+//tcpListener实现Listener接口
+type tcpListener struct {
+	mu     sync.Mutex
+	fd     int               //监听套接字文件描述符
+	addr   *net.TCPAddr      //监听地址
+	config TCPListenerConfig //监听配置
+	closed bool              //是否已关闭
+}
+
+//创建TCP监听
+func Listen(c *TCPListenerConfig) (Listener, error) {
+	sa, family, _, err := getTCPSockaddr(c.Network, c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("listener: getTCPSockaddr %v %v: %v", c.Network, c.Address, err)
+	}
+
+	fd, err := sysSocket(family, syscall.SOCK_STREAM, syscall.IPPROTO_TCP)
+	if err != nil {
+		return nil, fmt.Errorf("listener: sysSocket: %v", err)
+	}
+
+	if c.ReuseAddr {
+		if err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+			syscall.Close(fd)
+			return nil, fmt.Errorf("listener: %v", os.NewSyscallError("setsockopt", err))
+		}
+	}
+	if c.Interface != "" {
+		if err = bindToDevice(fd, family, c.Interface); err != nil {
+			syscall.Close(fd)
+			return nil, fmt.Errorf("listener: bind to %v: %v", c.Interface, err)
+		}
+	}
+	if err = setNonLocalBind(fd, family, c.FreeBind, c.Transparent); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("listener: setNonLocalBind: %v", err)
+	}
+	if err = syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("listener: %v", os.NewSyscallError("bind", err))
+	}
+
+	backlog := c.Backlog
+	if backlog <= 0 {
+		backlog = listenBacklog
+	}
+	if err = syscall.Listen(fd, backlog); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("listener: %v", os.NewSyscallError("listen", err))
+	}
+	if err = syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("listener: SetNonblock: %v", err)
+	}
+
+	l := &tcpListener{fd: fd, config: *c}
+	if lsa, err := syscall.Getsockname(fd); err == nil {
+		l.addr = sockaddrToTCPAddr(lsa)
+	}
+
+	return l, nil
+}
+
+//等待并接受一个连接，超过AcceptTimeout返回TimeoutError，监听关闭后返回ErrListenerClosed
+func (l *tcpListener) Accept() (EndPoint, error) {
+	var nfd int
+	var rsa syscall.Sockaddr
+	for {
+		if err := waitFd(l.fd, false, l.config.AcceptTimeout); err == errWaitTimeout {
+			return nil, &TimeoutError{Op: "accept", Duration: l.config.AcceptTimeout}
+		} else if err != nil {
+			return nil, l.acceptError(err)
+		}
+
+		var err error
+		syscall.ForkLock.RLock()
+		nfd, rsa, err = syscall.Accept(l.fd)
+		if err == nil {
+			syscall.CloseOnExec(nfd)
+		}
+		syscall.ForkLock.RUnlock()
+		if err == nil {
+			break
+		}
+		switch err {
+		case syscall.EAGAIN, syscall.EINTR, syscall.ECONNABORTED:
+			//连接在接受前被对端重置，继续等待
+		default:
+			return nil, l.acceptError(os.NewSyscallError("accept", err))
+		}
+	}
+
+	p := &tcp{fd: nfd, sockAddr: rsa, netAddr: sockaddrToTCPAddr(rsa)}
+	if err := l.setup(p); err != nil {
+		syscall.Close(nfd)
+		return nil, fmt.Errorf("listener: %v", err)
+	}
+
+	return p, nil
+}
+
+//设置连接选项
+func (l *tcpListener) setup(p *tcp) error {
+	c := &l.config
+	if err := setNoDelay(p.fd, c.NoDelay); err != nil {
+		return fmt.Errorf("setNoDelay: %v", err)
+	}
+	if err := setKeepAlive(p.fd, c.KeepAlive, c.KeepAlive, 0); err != nil {
+		return fmt.Errorf("setKeepAlive: %v", err)
+	}
+	if err := syscall.SetNonblock(p.fd, true); err != nil {
+		return fmt.Errorf("SetNonblock: %v", err)
+	}
+
+	p.readTimeout, p.writeTimeout = defaultTimeouts(EndPointTCP, c.ReadTimeout, c.WriteTimeout)
+	p.maxReadSize = c.MaxReadSize
+	p.maxWriteSize = c.MaxWriteSize
+
+	return nil
+}
+
+//监听关闭后返回ErrListenerClosed
+func (l *tcpListener) acceptError(err error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrListenerClosed
+	}
+	return fmt.Errorf("listener: %v", err)
+}
+
+//停止监听，已接受的连接不受影响
+func (l *tcpListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+
+	//shutdown唤醒阻塞在select中的Accept
+	syscall.Shutdown(l.fd, syscall.SHUT_RDWR)
+	return os.NewSyscallError("close", syscall.Close(l.fd))
+}
+
+//返回监听地址
+func (l *tcpListener) Addr() net.Addr {
+	if l.addr == nil {
+		return nil
+	}
+	return l.addr
+}
+
+//返回监听套接字的文件句柄
+func (l *tcpListener) Fd() int {
+	return l.fd
+}
+
+//socket地址转换为TCP地址
+func sockaddrToTCPAddr(sa syscall.Sockaddr) *net.TCPAddr {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return &net.TCPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port}
+	case *syscall.SockaddrInet6:
+		addr := &net.TCPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port}
+		if sa.ZoneId != 0 {
+			if iface, err := net.InterfaceByIndex(int(sa.ZoneId)); err == nil {
+				addr.Zone = iface.Name
+			}
+		}
+		return addr
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package endpoint
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+//串口锁文件目录（UUCP风格，LCK..ttyX）
+const serialLockDir = "/var/lock"
+
+//创建串口锁文件，锁已被存活进程持有时返回错误，持有进程已退出时清理残留锁
+func lockSerial(address string) (path string, err error) {
+	path = filepath.Join(serialLockDir, "LCK.."+filepath.Base(address))
+
+	for i := 0; i < 2; i++ {
+		var f *os.File
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			//HDB UUCP格式：10位右对齐的进程号
+			_, err = fmt.Fprintf(f, "%10d\n", os.Getpid())
+			f.Close()
+			if err != nil {
+				os.Remove(path)
+				return "", fmt.Errorf("serial: write lock file %v: %v", path, err)
+			}
+			return path, nil
+		}
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("serial: create lock file %v: %v", path, err)
+		}
+
+		pid, e := readLockPid(path)
+		if e == nil && syscall.Kill(pid, 0) != syscall.ESRCH {
+			return "", fmt.Errorf("serial: %v is locked by pid %v", address, pid)
+		}
+		//锁文件无法解析或持有进程已退出，视为残留锁
+		os.Remove(path)
+	}
+
+	return "", fmt.Errorf("serial: create lock file %v: %v", path, err)
+}
+
+//删除串口锁文件
+func unlockSerial(path string) {
+	if path != "" {
+		os.Remove(path)
+	}
+}
+
+//读取锁文件中的进程号
+func readLockPid(path string) (int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
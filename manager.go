@@ -0,0 +1,347 @@
+package endpoint
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+//EndPoint管理器，按名称统一管理多个串口或网口
+type Manager struct {
+	mu        sync.RWMutex
+	endpoints map[string]*managedEndPoint //名称到被管理EndPoint的映射
+	chaos     *ChaosConfig                //混沌测试配置，nil表示未开启
+	taps      tapSet                      //旁路订阅者
+
+	schedulerDone chan struct{}  //调度器停止时close，nil表示调度器未启动
+	schedulerWg   sync.WaitGroup //等待调度器协程退出
+
+	batch     *BatchConfig   //延迟发送配置，nil表示未开启
+	batchDone chan struct{}  //延迟发送停止时close
+	batchWg   sync.WaitGroup //等待延迟发送协程退出
+
+	credentials CredentialFunc //导入清单时提供被省略的凭据
+}
+
+//被管理的EndPoint
+type managedEndPoint struct {
+	name       string            //名称
+	config     EndPointConfig    //打开时使用的配置
+	labels     map[string]string //标签，用于按条件筛选
+	ep         EndPoint          //对外提供的EndPoint（raw加上各层包装），未打开时为nil
+	raw        EndPoint          //Open返回的原始EndPoint，未打开时为nil
+	chaos      EndPoint          //注入故障的raw，未开启混沌测试时为nil
+	sla        slaTracker        //可用性统计
+	schedule   []ScheduleWindow  //自动打开的时间窗口，为空表示不调度
+	deferred   [][]byte          //等待唤醒时发送的报文
+	cellular   *AT               //所用蜂窝模块的AT命令助手，打开前检查注册状态，nil表示不检查
+	cellStatus *CellularStatus   //蜂窝模块最近一次查询的状态
+	guard      *operationGuard   //操作保护，nil表示不保护
+	readOnly   ReadOnlyMode      //只读模式
+	allow      []FrameFilter     //写入白名单，为空表示不过滤
+	inbound    inboundFilter     //收到报文的结构检查
+	taps       *tapSet           //Manager的旁路订阅者
+	stage      ShutdownStage     //Shutdown中的关闭阶段
+	busy       inflight          //进行中的批量操作
+	opening    chan struct{}     //正在打开时非nil，打开完成后close
+	abortOpen  bool              //打开期间被关闭，打开完成后立即关闭
+}
+
+//EndPoint筛选条件
+type Selector func(name string, labels map[string]string) bool
+
+//按标签筛选，EndPoint需包含所有指定的标签和取值
+func MatchLabels(labels map[string]string) Selector {
+	return func(name string, l map[string]string) bool {
+		for k, v := range labels {
+			if l[k] != v {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+//按名称筛选
+func MatchNames(names ...string) Selector {
+	return func(name string, l map[string]string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//创建管理器
+func NewManager() *Manager {
+	return &Manager{endpoints: make(map[string]*managedEndPoint)}
+}
+
+//添加EndPoint配置，添加后需调用Open打开
+func (m *Manager) Add(name string, c EndPointConfig, labels map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.endpoints[name]; ok {
+		return fmt.Errorf("manager: endpoint %v already exists", name)
+	}
+
+	l := make(map[string]string, len(labels))
+	for k, v := range labels {
+		l[k] = v
+	}
+	me := &managedEndPoint{name: name, config: c, labels: l, taps: &m.taps}
+	me.sla.reset(time.Now())
+	m.endpoints[name] = me
+
+	return nil
+}
+
+//关闭并移除EndPoint
+func (m *Manager) Remove(name string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, ok := m.endpoints[name]
+	if !ok {
+		return fmt.Errorf("manager: endpoint %v not found", name)
+	}
+	if err = me.guarded(GuardClose); err != nil {
+		return
+	}
+	if me.ep != nil {
+		err = me.ep.Close()
+	}
+	delete(m.endpoints, name)
+
+	return
+}
+
+//打开指定EndPoint，已打开则直接返回。连接和重试在锁外进行，不阻塞对其他EndPoint的操作
+func (m *Manager) Open(name string) error {
+	m.mu.RLock()
+	me, ok := m.endpoints[name]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("manager: endpoint %v not found", name)
+	}
+
+	return m.open(me)
+}
+
+//依次打开所有EndPoint，部分失败时返回*MultiError，其中按名称记录各自的错误
+func (m *Manager) OpenAll() error {
+	m.mu.RLock()
+	list := m.sorted()
+	m.mu.RUnlock()
+
+	var errs MultiError
+	for _, me := range list {
+		errs.add(me.name, m.open(me))
+	}
+
+	return errs.err()
+}
+
+//关闭指定EndPoint，保留其配置以便再次打开
+func (m *Manager) Close(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, ok := m.endpoints[name]
+	if !ok {
+		return fmt.Errorf("manager: endpoint %v not found", name)
+	}
+	if err := me.guarded(GuardClose); err != nil {
+		return err
+	}
+
+	return m.close(me)
+}
+
+//关闭所有EndPoint，部分失败时返回*MultiError，保护了关闭操作的EndPoint不关闭并记录ErrPermissionDenied
+func (m *Manager) CloseAll() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs MultiError
+	for _, me := range m.sorted() {
+		err := me.guarded(GuardClose)
+		if err == nil {
+			err = m.close(me)
+		}
+		errs.add(me.name, err)
+	}
+
+	return errs.err()
+}
+
+//返回已打开的EndPoint，不存在或未打开时返回nil。
+//受保护的EndPoint拒绝受保护的操作，且不能类型断言为SerialEndPoint等扩展接口。
+//Shutdown不等待在返回的EndPoint上直接进行的读写
+func (m *Manager) Get(name string) EndPoint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if me, ok := m.endpoints[name]; ok {
+		return me.exposed()
+	}
+
+	return nil
+}
+
+//返回EndPoint的标签
+func (m *Manager) Labels(name string) map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	me, ok := m.endpoints[name]
+	if !ok {
+		return nil
+	}
+
+	return me.copyLabels()
+}
+
+//返回所有EndPoint名称（按名称排序）
+func (m *Manager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0, len(m.endpoints))
+	for name := range m.endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+//打开EndPoint，调用方不能持有锁。连接（包括重试的退避等待）在锁外进行，期间EndPoint标记为正在打开，
+//同时打开同一EndPoint时等待前一次完成；打开期间被关闭或移除时，连接成功后立即关闭并返回错误
+func (m *Manager) open(me *managedEndPoint) error {
+	m.mu.Lock()
+	for me.opening != nil {
+		done := me.opening
+		m.mu.Unlock()
+		<-done
+		m.mu.Lock()
+	}
+	if me.ep != nil {
+		m.mu.Unlock()
+		return nil
+	}
+	if m.endpoints[me.name] != me {
+		m.mu.Unlock()
+		return fmt.Errorf("manager: endpoint %v not found", me.name)
+	}
+
+	done := make(chan struct{})
+	me.opening, me.abortOpen = done, false
+	config, at := me.config, me.cellular
+	m.mu.Unlock()
+
+	//蜂窝模块未注册时不建立数据会话
+	status, err := checkCellular(at)
+	var p EndPoint
+	if err == nil {
+		p, err = Open(config)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	me.opening = nil
+	close(done)
+	if status != nil && me.cellular == at {
+		me.cellStatus = status
+	}
+	if err == nil && (me.abortOpen || m.endpoints[me.name] != me) {
+		p.Close()
+		err = fmt.Errorf("closed while opening")
+	}
+	me.sla.opened(err, time.Now())
+	if err != nil {
+		return fmt.Errorf("manager: open %v: %w", me.name, err)
+	}
+	me.raw = p
+	if m.chaos != nil {
+		me.chaos = newChaos(p, m.chaos, me.name)
+	}
+	me.wrap()
+
+	return nil
+}
+
+//关闭EndPoint，正在打开时打开完成后立即关闭，调用方需持有写锁
+func (m *Manager) close(me *managedEndPoint) (err error) {
+	if me.opening != nil {
+		me.abortOpen = true
+	}
+	if me.ep == nil {
+		return nil
+	}
+	if err = me.ep.Close(); err != nil {
+		err = fmt.Errorf("manager: close %v: %v", me.name, err)
+	}
+	me.ep, me.raw, me.chaos = nil, nil, nil
+	me.sla.closed(time.Now())
+
+	return
+}
+
+//在原始EndPoint上依次包装混沌测试、旁路、只读模式、写入白名单和收到报文的检查，生成对外提供的EndPoint，
+//包装配置变化后调用，调用方需持有写锁
+func (me *managedEndPoint) wrap() {
+	if me.raw == nil {
+		me.ep = nil
+		return
+	}
+
+	p := me.raw
+	if me.chaos != nil {
+		p = me.chaos
+	}
+	if len(me.taps.load()) > 0 {
+		p = &tapEndPoint{EndPoint: p, name: me.name, address: me.config.AddressName(), set: me.taps}
+	}
+	p = NewReadOnly(p, me.name, me.readOnly)
+	p = NewWriteFilter(p, me.name, me.allow...)
+	p = NewReadFilter(p, me.name, me.inbound.action, me.inbound.checks...)
+	me.ep = p
+}
+
+//返回标签的副本
+func (me *managedEndPoint) copyLabels() map[string]string {
+	l := make(map[string]string, len(me.labels))
+	for k, v := range me.labels {
+		l[k] = v
+	}
+
+	return l
+}
+
+//按名称排序返回符合筛选条件的EndPoint，sel为nil时返回全部，调用方需持有锁
+func (m *Manager) selected(sel Selector) []*managedEndPoint {
+	var list []*managedEndPoint
+	for _, me := range m.sorted() {
+		if sel == nil || sel(me.name, me.labels) {
+			list = append(list, me)
+		}
+	}
+
+	return list
+}
+
+//按名称排序返回所有被管理的EndPoint，调用方需持有锁
+func (m *Manager) sorted() []*managedEndPoint {
+	list := make([]*managedEndPoint, 0, len(m.endpoints))
+	for _, me := range m.endpoints {
+		list = append(list, me)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+
+	return list
+}
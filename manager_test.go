@@ -0,0 +1,177 @@
+package endpoint
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+//返回本机上没有监听的TCP地址，连接时立即被拒绝
+func refusedTCPAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+//打开过程中（解析、连接、重试退避）不应阻塞对其他EndPoint的操作
+func TestManagerOpenDoesNotHoldLock(t *testing.T) {
+	m := NewManager()
+	r := newGateResolver()
+	_, port, _ := net.SplitHostPort(refusedTCPAddress(t))
+	c := &TCPConfig{Network: "tcp", Address: net.JoinHostPort("device.test", port), Resolver: r}
+	if err := m.Add("down", c, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add("null", &NullConfig{Address: "null"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- m.Open("down") }()
+	<-r.entered
+
+	//Open(down)停在域名解析中，直到下面的调用全部返回才放行
+	if err := m.Open("null"); err != nil {
+		t.Fatal(err)
+	}
+	if m.Get("null") == nil {
+		t.Fatal("Get(null) = nil after Open")
+	}
+	m.Names()
+	select {
+	case err := <-done:
+		t.Fatalf("Open(down) returned %v before the resolver was released", err)
+	default:
+	}
+
+	close(r.release)
+	if err := <-done; err == nil {
+		t.Error("Open(down) succeeded, want connection refused")
+	}
+	m.CloseAll()
+}
+
+//打开期间被关闭时，连接成功后应立即关闭，EndPoint保持关闭状态
+func TestManagerCloseWhileOpening(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	m := NewManager()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	r := newGateResolver()
+	c := &TCPConfig{Network: "tcp", Address: net.JoinHostPort("device.test", port), Resolver: r}
+	if err = m.Add("slow", c, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- m.Open("slow") }()
+	<-r.entered
+	if err = m.Close("slow"); err != nil {
+		t.Fatal(err)
+	}
+	close(r.release)
+
+	if err = <-done; err == nil {
+		t.Error("Open succeeded although Close was called while opening")
+	}
+	if m.Get("slow") != nil {
+		t.Error("endpoint is open after Close during Open")
+	}
+}
+
+//在解析时阻塞直到release被关闭的解析器，随后解析为127.0.0.1，用于让Open停在连接过程中
+type gateResolver struct {
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func newGateResolver() *gateResolver {
+	return &gateResolver{entered: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (r *gateResolver) LookupIP(host string) ([]net.IP, error) {
+	r.once.Do(func() { close(r.entered) })
+	<-r.release
+	return []net.IP{net.IPv4(127, 0, 0, 1)}, nil
+}
+
+//在第一个发送的报文上阻塞的旁路，用于让写入停在锁外
+type blockingTap struct {
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (t *blockingTap) OnFrame(f *TapFrame) {
+	if f.Direction != DirTX {
+		return
+	}
+	t.once.Do(func() {
+		close(t.entered)
+		<-t.release
+	})
+}
+
+//放行阻塞的写入，可重复调用
+func (t *blockingTap) close() {
+	select {
+	case <-t.release:
+	default:
+		close(t.release)
+	}
+}
+
+//唤醒发送期间不应持有Manager的锁，期间缓存的报文留到下次唤醒
+func TestManagerWakeDoesNotHoldLock(t *testing.T) {
+	m := NewManager()
+	if err := m.Add("null", &NullConfig{Address: "null"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.EnableBatching(&BatchConfig{Interval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	defer m.DisableBatching()
+	tap := &blockingTap{entered: make(chan struct{}), release: make(chan struct{})}
+	defer tap.close()
+	cancel := m.Subscribe(tap)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		if err := m.WriteDeferred("null", []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan []FlushResult, 1)
+	go func() { done <- m.Wake() }()
+	<-tap.entered
+
+	//写入阻塞期间其他操作应正常完成
+	if m.Get("null") == nil {
+		t.Fatal("Get(null) = nil during Wake")
+	}
+	m.Names()
+	if err := m.WriteDeferred("null", []byte{2}); err != nil {
+		t.Fatal(err)
+	}
+	tap.close()
+
+	r := <-done
+	if len(r) != 1 || r[0].Err != nil || r[0].Frames != 2 {
+		t.Fatalf("Wake() = %+v, want 2 frames sent", r)
+	}
+	if n := m.Deferred("null"); n != 1 {
+		t.Errorf("Deferred(null) = %v after Wake, want 1", n)
+	}
+	m.CloseAll()
+}
@@ -0,0 +1,209 @@
+package endpoint
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//拨号等待CONNECT的默认超时
+const modemDialTimeout = 60 * time.Second
+
+//初始化命令等待OK的超时
+const modemCommandTimeout = 5 * time.Second
+
+//命令阶段判断应答结束的帧间隔
+const modemResponseGap = 50 * time.Millisecond
+
+//挂断时DTR保持无效的时长
+const modemHangupTime = 500 * time.Millisecond
+
+//默认初始化命令：复位、关闭回显、文字结果码
+var defaultModemInit = []string{"ATZ", "ATE0V1"}
+
+//调制解调器的最终结果码，其余行（回显、RING等）被忽略
+var modemFinalResults = []string{
+	"OK", "CONNECT", "ERROR", "BUSY", "NO CARRIER", "NO DIALTONE",
+	"NO DIAL TONE", "NO ANSWER", "DELAYED", "BLACKLISTED",
+}
+
+//拨号调制解调器配置，通过串口上的Hayes AT命令拨号，连接后作为EndPoint收发数据
+type ModemConfig struct {
+	Serial      SerialConfig  //调制解调器所在串口的配置，开启CarrierDetect时连接后检测载波
+	Number      string        //电话号码
+	Init        []string      //拨号前依次发送的初始化命令，为空时使用ATZ、ATE0V1
+	Pulse       bool          //脉冲拨号（ATDP），默认音频拨号（ATDT）
+	DialTimeout time.Duration //等待CONNECT的超时，默认60s
+}
+
+func (c *ModemConfig) Type() EndPointType {
+	return EndPointModem
+}
+
+func (c *ModemConfig) AddressName() string {
+	return c.Serial.Address
+}
+
+//调制解调器扩展接口，可通过类型断言从Modem EndPoint获取
+type ModemEndPoint interface {
+	SerialEndPoint
+	ConnectResult() string //返回拨号成功时的CONNECT结果，比如CONNECT 9600
+}
+
+//modem实现EndPoint接口，拨号成功后在串口上收发数据
+type modem struct {
+	*serial
+	pending []byte //拨号阶段收到的、尚未返回给Read的数据
+	connect string //拨号成功时的CONNECT结果
+}
+
+//创建modem对象
+func newModem() EndPoint {
+	return &modem{serial: &serial{fd: -1}}
+}
+
+//打开串口，发送初始化命令并拨号，收到CONNECT后进入数据阶段
+func (p *modem) Open(config EndPointConfig) (err error) {
+	c := config.(*ModemConfig)
+	if c.Number == "" {
+		return fmt.Errorf("modem: empty phone number")
+	}
+
+	//拨号阶段没有载波，连接后再按配置检测载波
+	sc := c.Serial
+	sc.CarrierDetect = false
+	if err = p.serial.Open(&sc); err != nil {
+		return
+	}
+	p.pending = nil
+	p.connect = ""
+
+	cmds := c.Init
+	if len(cmds) == 0 {
+		cmds = defaultModemInit
+	}
+	for _, cmd := range cmds {
+		var result string
+		if result, err = p.command(cmd, modemCommandTimeout); err != nil {
+			p.serial.Close()
+			return
+		}
+		if result != "OK" {
+			p.serial.Close()
+			return fmt.Errorf("modem: %v: %v", cmd, result)
+		}
+	}
+
+	dial := "ATDT"
+	if c.Pulse {
+		dial = "ATDP"
+	}
+	timeout := c.DialTimeout
+	if timeout <= 0 {
+		timeout = modemDialTimeout
+	}
+	result, err := p.command(dial+c.Number, timeout)
+	if err != nil {
+		p.hangup()
+		return
+	}
+	if !strings.HasPrefix(result, "CONNECT") {
+		p.hangup()
+		return fmt.Errorf("modem: dial %v: %v", c.Number, result)
+	}
+	p.connect = result
+
+	if c.Serial.CarrierDetect {
+		if err = p.serial.SetConfig(&c.Serial); err != nil {
+			p.hangup()
+			return
+		}
+	}
+
+	return
+}
+
+//返回endpoint类型
+func (p *modem) Type() EndPointType {
+	return EndPointModem
+}
+
+//挂断并关闭串口
+func (p *modem) Close() error {
+	if p.fd == -1 {
+		return nil
+	}
+	return p.hangup()
+}
+
+//读取数据，先返回拨号阶段已收到的数据
+func (p *modem) Read(b []byte) (int, error) {
+	if len(p.pending) > 0 {
+		n := copy(b, p.pending)
+		p.pending = p.pending[n:]
+		return n, nil
+	}
+	return p.serial.Read(b)
+}
+
+//返回拨号成功时的CONNECT结果
+func (p *modem) ConnectResult() string {
+	return p.connect
+}
+
+//发送AT命令，在timeout内等待最终结果码
+func (p *modem) command(cmd string, timeout time.Duration) (string, error) {
+	if _, err := p.serial.Write([]byte(cmd + "\r")); err != nil {
+		return "", fmt.Errorf("modem: %v: %v", cmd, err)
+	}
+
+	//按剩余时间读取，线路静默即处理应答，结束后恢复读超时和帧间隔
+	readTimeout, frameGap := p.readTimeout, p.frameGap
+	defer func() {
+		p.readTimeout, p.frameGap = readTimeout, frameGap
+	}()
+	if p.frameGap <= 0 {
+		p.frameGap = modemResponseGap
+	}
+
+	buf := make([]byte, 256)
+	expireTime := time.Now().Add(timeout)
+	for {
+		for {
+			i := bytes.IndexByte(p.pending, '\n')
+			if i < 0 {
+				break
+			}
+			line := strings.TrimSpace(string(p.pending[:i]))
+			p.pending = p.pending[i+1:]
+			for _, r := range modemFinalResults {
+				if strings.HasPrefix(line, r) {
+					return line, nil
+				}
+			}
+		}
+
+		remainTime := expireTime.Sub(time.Now())
+		if remainTime <= 0 {
+			return "", fmt.Errorf("modem: %v: %v", cmd, &TimeoutError{Op: "modem", Duration: timeout})
+		}
+		p.readTimeout = remainTime
+
+		n, err := p.serial.Read(buf)
+		if err != nil && !IsTimeout(err) {
+			return "", fmt.Errorf("modem: %v: %v", cmd, err)
+		}
+		p.pending = append(p.pending, buf[:n]...)
+	}
+}
+
+//拉低DTR挂断后关闭串口
+func (p *modem) hangup() error {
+	if err := setModemLine(p.fd, LineDTR, false); err == nil {
+		time.Sleep(modemHangupTime)
+	}
+	p.pending = nil
+	p.connect = ""
+	return p.serial.Close()
+}
@@ -0,0 +1,159 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//null实现EndPoint接口，不连接任何设备
+type null struct {
+	mu           sync.Mutex      //保护readData、partial和closed
+	address      string          //名称
+	readData     [][]byte        //待返回的预设数据
+	partial      bool            //readData[0]已返回部分数据
+	latency      *latencySampler //模拟响应延迟
+	closed       chan struct{}   //关闭时close，用于唤醒等待中的Read
+	readTimeout  time.Duration   //一次完全数据包的收取超时
+	writeTimeout time.Duration   //一次完整数据包的发送超时
+}
+
+//创建null对象
+func newNull() EndPoint {
+	return &null{}
+}
+
+//打开Null
+func (p *null) Open(config EndPointConfig) (err error) {
+	c := config.(*NullConfig)
+
+	if p.latency, err = newLatencySampler(c.Latency, c.Address); err != nil {
+		return fmt.Errorf("null: %v", err)
+	}
+	p.address = c.Address
+	p.readData = append([][]byte(nil), c.ReadData...)
+	p.partial = false
+	p.closed = make(chan struct{})
+	p.readTimeout, p.writeTimeout = defaultTimeouts(EndPointNull, c.ReadTimeout, c.WriteTimeout)
+
+	return
+}
+
+//返回endpoint类型
+func (p *null) Type() EndPointType {
+	return EndPointNull
+}
+
+//关闭Null，唤醒等待中的Read
+func (p *null) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed == nil { //未打开
+		return nil
+	}
+	select {
+	case <-p.closed:
+	default:
+		close(p.closed)
+	}
+
+	return nil
+}
+
+//读取预设数据，每个预设数据按模拟响应延迟返回，预设数据读完后等待至超时或关闭
+func (p *null) Read(b []byte) (n int, err error) {
+	p.mu.Lock()
+	if len(p.readData) > 0 && !p.partial {
+		delay := p.latency.next()
+		p.mu.Unlock()
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-p.closed:
+				return 0, errors.New("null: endpoint closed")
+			case <-timer.C:
+			}
+		}
+		p.mu.Lock()
+	}
+	if len(p.readData) > 0 {
+		n = copy(b, p.readData[0])
+		if n < len(p.readData[0]) {
+			p.readData[0] = p.readData[0][n:]
+			p.partial = true
+		} else {
+			p.readData = p.readData[1:]
+			p.partial = false
+		}
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+
+	var expire <-chan time.Time
+	if p.readTimeout > 0 {
+		timer := time.NewTimer(p.readTimeout)
+		defer timer.Stop()
+		expire = timer.C
+	}
+
+	select {
+	case <-p.closed:
+		return 0, errors.New("null: endpoint closed")
+	case <-expire:
+		return 0, &TimeoutError{Op: "null", Duration: p.readTimeout}
+	}
+}
+
+//丢弃写入的数据
+func (p *null) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+//Null没有文件句柄
+func (p *null) Fd() int {
+	return -1
+}
+
+//Null没有缓冲区
+func (p *null) Flush() error {
+	return nil
+}
+
+//返回Null网络地址
+func (p *null) NetAddr() net.Addr {
+	return &net.UnixAddr{
+		Net:  "null",
+		Name: p.address,
+	}
+}
+
+//Null没有socket地址
+func (p *null) SockAddr() syscall.Sockaddr {
+	return nil
+}
+
+//返回读超时
+func (p *null) ReadTimeout() time.Duration {
+	return p.readTimeout
+}
+
+//返回写超时
+func (p *null) WriteTimeout() time.Duration {
+	return p.writeTimeout
+}
+
+//修改读超时
+func (p *null) SetReadTimeout(d time.Duration) {
+	p.readTimeout = d
+}
+
+//修改写超时
+func (p *null) SetWriteTimeout(d time.Duration) {
+	p.writeTimeout = d
+}
@@ -0,0 +1,132 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+//定时发送队列已满
+var ErrPacerFull = errors.New("pacer: queue full")
+
+//睡眠精度不足时，最后这段时间改为忙等
+const pacerSpinThreshold = 2 * time.Millisecond
+
+//定时发送配置
+type PacerConfig struct {
+	Interval  time.Duration //发送周期，比如100ms
+	Tolerance time.Duration //允许的发送时刻偏差，超出时放弃该时隙，默认1ms
+	Queue     int           //待发送队列长度，默认16
+	OnError   func(error)   //发送失败或错过时隙时的回调
+}
+
+//定时发送：按固定周期在时隙起点发送队列中的报文，用于有时隙要求的协议
+type Pacer struct {
+	p      EndPoint
+	config PacerConfig
+	frames chan []byte   //待发送报文
+	done   chan struct{} //停止时close
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+//创建并启动定时发送，第一个时隙在一个周期后
+func NewPacer(p EndPoint, c *PacerConfig) (*Pacer, error) {
+	if c.Interval <= 0 {
+		return nil, fmt.Errorf("pacer: invalid interval %v", c.Interval)
+	}
+	cfg := *c
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = time.Millisecond
+	}
+	if cfg.Queue <= 0 {
+		cfg.Queue = 16
+	}
+
+	s := &Pacer{
+		p:      p,
+		config: cfg,
+		frames: make(chan []byte, cfg.Queue),
+		done:   make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.run()
+
+	return s, nil
+}
+
+//提交报文，在下一个空闲时隙发送，队列已满时返回ErrPacerFull
+func (s *Pacer) Submit(frame []byte) error {
+	select {
+	case s.frames <- frame:
+		return nil
+	default:
+		return ErrPacerFull
+	}
+}
+
+//停止定时发送，队列中未发送的报文被丢弃
+func (s *Pacer) Stop() {
+	s.once.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+	})
+}
+
+//按时隙发送
+func (s *Pacer) run() {
+	defer s.wg.Done()
+
+	next := time.Now()
+	for {
+		next = next.Add(s.config.Interval)
+		if !s.sleepUntil(next) {
+			return
+		}
+
+		if late := time.Since(next); late > s.config.Tolerance {
+			s.report(fmt.Errorf("pacer: missed slot by %v", late))
+			continue
+		}
+
+		select {
+		case frame := <-s.frames:
+			if _, err := s.p.Write(frame); err != nil {
+				s.report(err)
+			}
+		default: //没有待发送的报文，空出该时隙
+		}
+	}
+}
+
+//睡眠到指定时刻，先粗略睡眠再忙等以提高精度，停止时返回false
+func (s *Pacer) sleepUntil(t time.Time) bool {
+	if d := time.Until(t) - pacerSpinThreshold; d > 0 {
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-s.done:
+			timer.Stop()
+			return false
+		}
+	}
+	for time.Now().Before(t) {
+		runtime.Gosched()
+	}
+
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+//调用错误回调
+func (s *Pacer) report(err error) {
+	if s.config.OnError != nil {
+		s.config.OnError(err)
+	}
+}
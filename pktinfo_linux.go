@@ -0,0 +1,90 @@
+package endpoint
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+//控制消息缓冲区大小，足以容纳PKTINFO和TTL
+const pktInfoOOBSize = 128
+
+//开启接收报文的PKTINFO和TTL控制消息，IPv6套接字同时开启IPv4映射报文的控制消息
+func setReceivePacketInfo(fd, family int) error {
+	opts := [][2]int{
+		{syscall.IPPROTO_IP, syscall.IP_PKTINFO},
+		{syscall.IPPROTO_IP, syscall.IP_RECVTTL},
+	}
+	if family == syscall.AF_INET6 {
+		opts = [][2]int{
+			{syscall.IPPROTO_IPV6, syscall.IPV6_RECVPKTINFO},
+			{syscall.IPPROTO_IPV6, syscall.IPV6_RECVHOPLIMIT},
+		}
+		syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_PKTINFO, 1)
+		syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_RECVTTL, 1)
+	}
+	for _, opt := range opts {
+		if err := syscall.SetsockoptInt(fd, opt[0], opt[1], 1); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	return nil
+}
+
+//读取一个报文及其目的地址、接收接口和TTL，需开启UDPConfig.ReceivePacketInfo。
+//与Read相同，超过b或MaxDatagramSize的部分被截断，返回的FrameSizeError中Size为报文的实际长度
+func (p *udp) ReadMsg(b []byte) (int, *PacketInfo, error) {
+	oob := make([]byte, pktInfoOOBSize)
+	var (
+		n, oobn int
+		from    syscall.Sockaddr
+		err     error
+	)
+	buf := b
+	if size := p.datagramSize(); len(buf) > size {
+		buf = buf[:size]
+	}
+	for {
+		if err = p.wait(false); err != nil {
+			return 0, nil, err
+		}
+		//MSG_TRUNC使返回值为报文的实际长度
+		n, oobn, _, from, err = syscall.Recvmsg(p.fd, buf, oob, syscall.MSG_TRUNC)
+		if err = p.queuedError(err); err != syscall.EAGAIN && err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	info := &PacketInfo{Src: sockaddrToUDPAddr(from), TTL: -1}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return n, info, os.NewSyscallError("parse control message", err)
+	}
+	for _, m := range msgs {
+		parsePacketInfo(info, &m)
+	}
+
+	n, err = checkDatagramSize(n, len(buf), p.maxReadSize)
+	return n, info, err
+}
+
+//解析单个控制消息
+func parsePacketInfo(info *PacketInfo, m *syscall.SocketControlMessage) {
+	switch {
+	case m.Header.Level == syscall.IPPROTO_IP && m.Header.Type == syscall.IP_PKTINFO && len(m.Data) >= syscall.SizeofInet4Pktinfo:
+		pi := (*syscall.Inet4Pktinfo)(unsafe.Pointer(&m.Data[0]))
+		info.Dst = append(net.IP(nil), pi.Addr[:]...)
+		info.IfIndex = int(pi.Ifindex)
+	case m.Header.Level == syscall.IPPROTO_IPV6 && m.Header.Type == syscall.IPV6_PKTINFO && len(m.Data) >= syscall.SizeofInet6Pktinfo:
+		pi := (*syscall.Inet6Pktinfo)(unsafe.Pointer(&m.Data[0]))
+		info.Dst = append(net.IP(nil), pi.Addr[:]...)
+		info.IfIndex = int(pi.Ifindex)
+	case m.Header.Level == syscall.IPPROTO_IP && m.Header.Type == syscall.IP_TTL && len(m.Data) >= 4,
+		m.Header.Level == syscall.IPPROTO_IPV6 && m.Header.Type == syscall.IPV6_HOPLIMIT && len(m.Data) >= 4:
+		info.TTL = int(*(*int32)(unsafe.Pointer(&m.Data[0])))
+	}
+}
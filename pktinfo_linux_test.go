@@ -0,0 +1,54 @@
+package endpoint
+
+import (
+	"bytes"
+	"testing"
+)
+
+//ReadMsg与Read相同地按缓冲区、MaxDatagramSize和MaxReadSize截断或丢弃报文
+func TestUDPReadMsgTruncated(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxSize   int
+		maxRead   int
+		bufLen    int
+		sent      int
+		wantN     int
+		wantLimit int
+	}{
+		{"buffer", 0, 0, 10, 100, 10, 10},
+		{"MaxDatagramSize", 32, 0, 64, 50, 32, 32},
+		{"MaxReadSize", 0, 16, 64, 50, 0, 16},
+		{"fits", 32, 0, 64, 20, 20, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, peer, addr := openUDPPair(t, &UDPConfig{MaxDatagramSize: tt.maxSize, MaxReadSize: tt.maxRead, ReceivePacketInfo: true})
+			defer p.Close()
+			defer peer.Close()
+
+			data := bytes.Repeat([]byte{'x'}, tt.sent)
+			if _, err := peer.WriteTo(data, addr); err != nil {
+				t.Fatal(err)
+			}
+			b := make([]byte, tt.bufLen)
+			n, info, err := p.ReadMsg(b)
+			if n != tt.wantN {
+				t.Errorf("n = %v, want %v", n, tt.wantN)
+			}
+			if info == nil || info.Src == nil || info.Src.String() != peer.LocalAddr().String() {
+				t.Errorf("info = %+v, want Src %v", info, peer.LocalAddr())
+			}
+			if tt.wantLimit == 0 {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+				return
+			}
+			fe, ok := err.(*FrameSizeError)
+			if !ok || fe.Size != tt.sent || fe.Limit != tt.wantLimit {
+				t.Errorf("err = %#v, want FrameSizeError{Size: %v, Limit: %v}", err, tt.sent, tt.wantLimit)
+			}
+		})
+	}
+}
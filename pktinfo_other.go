@@ -0,0 +1,21 @@
+// +build !linux
+
+package endpoint
+
+import (
+	"fmt"
+)
+
+//当前系统不支持接收报文的PKTINFO和TTL控制消息
+func setReceivePacketInfo(fd, family int) error {
+	return fmt.Errorf("receiving packet info is not supported")
+}
+
+//当前系统只返回报文的来源地址，目的地址和接收接口未知
+func (p *udp) ReadMsg(b []byte) (int, *PacketInfo, error) {
+	n, from, err := p.recvfrom(b)
+	if from == nil {
+		return n, nil, err
+	}
+	return n, &PacketInfo{Src: sockaddrToUDPAddr(from), TTL: -1}, err
+}
@@ -0,0 +1,54 @@
+package endpoint
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+//设置路径MTU发现模式，PMTUDefault时不设置
+func setPMTUDiscovery(fd, family int, mode PMTUDiscovery) error {
+	var v int
+	switch mode {
+	case PMTUDefault:
+		return nil
+	case PMTUDont:
+		v = unix.IP_PMTUDISC_DONT
+	case PMTUWant:
+		v = unix.IP_PMTUDISC_WANT
+	case PMTUDo:
+		v = unix.IP_PMTUDISC_DO
+	case PMTUProbe:
+		v = unix.IP_PMTUDISC_PROBE
+	default:
+		return fmt.Errorf("invalid pmtu discovery mode %v", mode)
+	}
+
+	//IPv6的取值与IPv4相同
+	if family == syscall.AF_INET6 {
+		return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, v))
+	}
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, unix.IP_MTU_DISCOVER, v))
+}
+
+//返回内核当前已知的到目标地址的路径MTU（IP_MTU/IPV6_MTU），需开启UDPConfig.Connected
+func (p *udp) MTU() (int, error) {
+	if p.fd == -1 {
+		return 0, fmt.Errorf("udp: not open")
+	}
+	if !p.connected {
+		return 0, fmt.Errorf("udp: path mtu requires a connected socket")
+	}
+
+	level, opt := syscall.IPPROTO_IP, unix.IP_MTU
+	if p.family == syscall.AF_INET6 {
+		level, opt = syscall.IPPROTO_IPV6, unix.IPV6_MTU
+	}
+	mtu, err := syscall.GetsockoptInt(p.fd, level, opt)
+	if err != nil {
+		return 0, fmt.Errorf("udp: %v", os.NewSyscallError("getsockopt", err))
+	}
+	return mtu, nil
+}
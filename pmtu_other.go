@@ -0,0 +1,23 @@
+// +build !linux
+
+package endpoint
+
+import (
+	"fmt"
+)
+
+//当前系统只支持系统默认的路径MTU发现模式
+func setPMTUDiscovery(fd, family int, mode PMTUDiscovery) error {
+	if mode != PMTUDefault {
+		return fmt.Errorf("pmtu discovery mode %v is not supported", mode)
+	}
+	return nil
+}
+
+//当前系统不支持查询路径MTU
+func (p *udp) MTU() (int, error) {
+	if p.fd == -1 {
+		return 0, fmt.Errorf("udp: not open")
+	}
+	return 0, fmt.Errorf("udp: path mtu is not supported")
+}
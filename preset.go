@@ -0,0 +1,141 @@
+package endpoint
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+//预设配置的生成函数，address为串口路径或主机地址，每次调用返回新的配置
+type PresetFunc func(address string) EndPointConfig
+
+var (
+	presetsMu sync.RWMutex
+	presets   = map[string]PresetFunc{
+		"modbus-rtu-9600-8E1":   modbusRTUPreset(9600, PARITY_EVEN, 1),
+		"modbus-rtu-9600-8N2":   modbusRTUPreset(9600, PARITY_NONE, 2),
+		"modbus-rtu-19200-8E1":  modbusRTUPreset(19200, PARITY_EVEN, 1),
+		"modbus-rtu-38400-8E1":  modbusRTUPreset(38400, PARITY_EVEN, 1),
+		"modbus-rtu-115200-8E1": modbusRTUPreset(115200, PARITY_EVEN, 1),
+		"modbus-tcp":            tcpPreset("502", time.Second, 260),
+		"nmea-4800":             nmeaPreset(4800),
+		"nmea-38400":            nmeaPreset(38400),
+		"dnp3-serial-9600":      dnp3SerialPreset(9600),
+		"dnp3-tcp":              tcpPreset("20000", 5*time.Second, 0),
+		"iec104":                tcpPreset("2404", 15*time.Second, 0),
+	}
+)
+
+//注册或替换指定名称的预设配置
+func RegisterPreset(name string, f PresetFunc) {
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+
+	presets[name] = f
+}
+
+//按名称生成预设配置，返回的配置可继续修改后传给Open
+func Preset(name, address string) (EndPointConfig, error) {
+	presetsMu.RLock()
+	f, ok := presets[name]
+	presetsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("endpoint: unknown preset %q", name)
+	}
+	return f(address), nil
+}
+
+//返回所有预设配置的名称，按字母排序
+func Presets() []string {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//按波特率计算n个字符（11位：起始位、8位数据、校验位或第二停止位、停止位）的传输时间
+func charTime(baudRate int, n float64) time.Duration {
+	return time.Duration(n * 11 * float64(time.Second) / float64(baudRate))
+}
+
+//Modbus RTU：帧间隔T3.5，波特率高于19200时固定为1.75ms；无校验时使用2位停止位
+func modbusRTUPreset(baudRate int, parity ParityMode, stopBits int) PresetFunc {
+	return func(address string) EndPointConfig {
+		gap := charTime(baudRate, 3.5)
+		if baudRate > 19200 {
+			gap = 1750 * time.Microsecond
+		}
+		return &SerialConfig{
+			Address:       address,
+			BaudRate:      baudRate,
+			DataBits:      8,
+			StopBits:      stopBits,
+			Parity:        parity,
+			InterFrameGap: gap,
+			ReadTimeout:   time.Second,
+			WriteTimeout:  time.Second,
+			MaxReadSize:   256,
+			MaxWriteSize:  256,
+		}
+	}
+}
+
+//NMEA 0183：8N1，按行（CR LF结尾）收取语句
+func nmeaPreset(baudRate int) PresetFunc {
+	return func(address string) EndPointConfig {
+		return &SerialConfig{
+			Address:      address,
+			BaudRate:     baudRate,
+			DataBits:     8,
+			StopBits:     1,
+			Parity:       PARITY_NONE,
+			Canonical:    true,
+			ReadTimeout:  2 * time.Second,
+			WriteTimeout: time.Second,
+		}
+	}
+}
+
+//DNP3串口：8N1，主站等待应答的超时较长
+func dnp3SerialPreset(baudRate int) PresetFunc {
+	return func(address string) EndPointConfig {
+		return &SerialConfig{
+			Address:      address,
+			BaudRate:     baudRate,
+			DataBits:     8,
+			StopBits:     1,
+			Parity:       PARITY_NONE,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: time.Second,
+		}
+	}
+}
+
+//基于TCP的工控协议：address未带端口时使用协议的默认端口，开启保活和no delay，
+//maxSize为单帧最大长度，一次可能收到多帧的协议配0
+func tcpPreset(port string, readTimeout time.Duration, maxSize int) PresetFunc {
+	return func(address string) EndPointConfig {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, port)
+		}
+		return &TCPConfig{
+			Network:      "tcp",
+			Address:      address,
+			DialTimeout:  5 * time.Second,
+			KeepAlive:    30 * time.Second,
+			NoDelay:      TCPNoDelay,
+			ReadTimeout:  readTimeout,
+			WriteTimeout: time.Second,
+			MaxReadSize:  maxSize,
+			MaxWriteSize: maxSize,
+		}
+	}
+}
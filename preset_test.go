@@ -0,0 +1,131 @@
+package endpoint
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPresetSerial(t *testing.T) {
+	tests := []struct {
+		name     string
+		baudRate int
+		parity   ParityMode
+		stopBits int
+		gap      time.Duration
+	}{
+		//T3.5 = 3.5 * 11位 / 9600 ≈ 4.01ms
+		{"modbus-rtu-9600-8E1", 9600, PARITY_EVEN, 1, 4010416 * time.Nanosecond},
+		{"modbus-rtu-9600-8N2", 9600, PARITY_NONE, 2, 4010416 * time.Nanosecond},
+		{"modbus-rtu-19200-8E1", 19200, PARITY_EVEN, 1, 2005208 * time.Nanosecond},
+		//高于19200时固定为1.75ms
+		{"modbus-rtu-38400-8E1", 38400, PARITY_EVEN, 1, 1750 * time.Microsecond},
+		{"modbus-rtu-115200-8E1", 115200, PARITY_EVEN, 1, 1750 * time.Microsecond},
+		{"nmea-4800", 4800, PARITY_NONE, 1, 0},
+		{"dnp3-serial-9600", 9600, PARITY_NONE, 1, 0},
+	}
+	for _, tt := range tests {
+		cfg, err := Preset(tt.name, "/dev/ttyS1")
+		if err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+		c, ok := cfg.(*SerialConfig)
+		if !ok {
+			t.Fatalf("%v: config %T, want *SerialConfig", tt.name, cfg)
+		}
+		if c.Address != "/dev/ttyS1" || c.BaudRate != tt.baudRate || c.DataBits != 8 || c.Parity != tt.parity || c.StopBits != tt.stopBits {
+			t.Errorf("%v: %v %v %v %v %v", tt.name, c.Address, c.BaudRate, c.DataBits, c.Parity, c.StopBits)
+		}
+		if c.InterFrameGap != tt.gap {
+			t.Errorf("%v: InterFrameGap = %v, want %v", tt.name, c.InterFrameGap, tt.gap)
+		}
+		if c.ReadTimeout <= 0 || c.WriteTimeout <= 0 {
+			t.Errorf("%v: timeouts %v/%v, want positive", tt.name, c.ReadTimeout, c.WriteTimeout)
+		}
+	}
+
+	cfg, _ := Preset("nmea-38400", "/dev/ttyUSB0")
+	if c := cfg.(*SerialConfig); !c.Canonical {
+		t.Error("nmea-38400: Canonical = false, want line mode")
+	}
+}
+
+func TestPresetTCP(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    string
+		maxSize int
+	}{
+		{"modbus-tcp", "192.168.1.10", "192.168.1.10:502", 260},
+		{"modbus-tcp", "192.168.1.10:5020", "192.168.1.10:5020", 260},
+		{"modbus-tcp", "fe80::1", "[fe80::1]:502", 260},
+		{"modbus-tcp", "[fe80::1]:1502", "[fe80::1]:1502", 260},
+		{"dnp3-tcp", "rtu.local", "rtu.local:20000", 0},
+		{"iec104", "10.0.0.1", "10.0.0.1:2404", 0},
+	}
+	for _, tt := range tests {
+		cfg, err := Preset(tt.name, tt.address)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+		c, ok := cfg.(*TCPConfig)
+		if !ok {
+			t.Fatalf("%v: config %T, want *TCPConfig", tt.name, cfg)
+		}
+		if c.Address != tt.want || c.Network != "tcp" {
+			t.Errorf("%v(%q): %v %v, want tcp %v", tt.name, tt.address, c.Network, c.Address, tt.want)
+		}
+		if c.MaxReadSize != tt.maxSize || c.MaxWriteSize != tt.maxSize {
+			t.Errorf("%v: max size %v/%v, want %v", tt.name, c.MaxReadSize, c.MaxWriteSize, tt.maxSize)
+		}
+		if c.NoDelay != TCPNoDelay || c.KeepAlive <= 0 {
+			t.Errorf("%v: NoDelay %v, KeepAlive %v", tt.name, c.NoDelay, c.KeepAlive)
+		}
+	}
+}
+
+//每次调用返回新的配置，修改一份不影响下一次
+func TestPresetFresh(t *testing.T) {
+	a, _ := Preset("modbus-rtu-9600-8E1", "/dev/ttyS0")
+	a.(*SerialConfig).BaudRate = 1200
+	b, _ := Preset("modbus-rtu-9600-8E1", "/dev/ttyS0")
+	if b.(*SerialConfig).BaudRate != 9600 {
+		t.Errorf("BaudRate = %v after modifying an earlier preset, want 9600", b.(*SerialConfig).BaudRate)
+	}
+}
+
+func TestRegisterPreset(t *testing.T) {
+	if _, err := Preset("test-custom", "x"); err == nil {
+		t.Fatal("unknown preset: err = nil")
+	}
+
+	RegisterPreset("test-custom", func(address string) EndPointConfig {
+		return &NullConfig{Address: address}
+	})
+	defer func() {
+		presetsMu.Lock()
+		delete(presets, "test-custom")
+		presetsMu.Unlock()
+	}()
+
+	cfg, err := Preset("test-custom", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := cfg.(*NullConfig); !ok || c.Address != "x" {
+		t.Errorf("Preset = %+v, want NullConfig x", cfg)
+	}
+
+	names := Presets()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("Presets not sorted: %v", names)
+	}
+	found := false
+	for _, name := range names {
+		found = found || name == "test-custom"
+	}
+	if !found || len(names) != 12 {
+		t.Errorf("Presets = %v, want 11 builtin and test-custom", names)
+	}
+}
@@ -0,0 +1,93 @@
+package endpoint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+//代理应答头的最大长度
+const proxyMaxHeader = 8192
+
+//通过HTTP代理建立到target的隧道（CONNECT方法），fd为已连接到代理的非阻塞套接字。
+//只读取到应答头结束，隧道中紧随其后的数据留在套接字中
+func httpConnect(fd int, target string, c *TCPConfig, timeout time.Duration) error {
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "CONNECT %v HTTP/1.1\r\nHost: %v\r\n", target, target)
+	if c.ProxyUsername != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(c.ProxyUsername + ":" + c.ProxyPassword))
+		fmt.Fprintf(&req, "Proxy-Authorization: Basic %v\r\n", auth)
+	}
+	for k, v := range c.ProxyHeader {
+		fmt.Fprintf(&req, "%v: %v\r\n", k, v)
+	}
+	req.WriteString("\r\n")
+
+	var expireTime time.Time
+	if timeout > 0 {
+		expireTime = time.Now().Add(timeout)
+	}
+	remain := func() time.Duration {
+		if timeout <= 0 {
+			return 0
+		}
+		if d := expireTime.Sub(time.Now()); d > 0 {
+			return d
+		}
+		return time.Nanosecond
+	}
+
+	//发送CONNECT请求
+	for b := req.Bytes(); len(b) > 0; {
+		if err := waitFd(fd, true, remain()); err == errWaitTimeout {
+			return &TimeoutError{Op: "proxy", Duration: timeout}
+		} else if err != nil {
+			return err
+		}
+		n, err := syscall.Write(fd, b)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+
+	//逐字节读取应答头，避免读走隧道中的数据
+	var head []byte
+	buf := make([]byte, 1)
+	for !bytes.HasSuffix(head, []byte("\r\n\r\n")) {
+		if len(head) >= proxyMaxHeader {
+			return fmt.Errorf("response header too long")
+		}
+		if err := waitFd(fd, false, remain()); err == errWaitTimeout {
+			return &TimeoutError{Op: "proxy", Duration: timeout}
+		} else if err != nil {
+			return err
+		}
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("connection closed by proxy")
+		}
+		head = append(head, buf[0])
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(head)), &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%v", resp.Status)
+	}
+
+	return nil
+}
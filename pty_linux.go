@@ -0,0 +1,60 @@
+package endpoint
+
+import (
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+//伪终端主设备路径
+const ptmxPath = "/dev/ptmx"
+
+//打开伪终端对，返回主端和从端，两端均为串口EndPoint，
+//用于在没有硬件时测试串口协议代码，读写仍经过终端配置路径。
+//从端按c设置终端参数，c.Address、c.LockFile和c.RS485被忽略；主端设置为相同的参数，但始终为原始模式
+func OpenPTY(c *SerialConfig) (master, slave EndPoint, err error) {
+	fd, err := syscall.Open(ptmxPath, syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pty: open %v: %v", ptmxPath, err)
+	}
+
+	//解锁从端并获取从端编号
+	if err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		syscall.Close(fd)
+		return nil, nil, fmt.Errorf("pty: unlock: %v", err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, nil, fmt.Errorf("pty: get slave number: %v", err)
+	}
+
+	m := &serial{fd: fd, address: ptmxPath}
+	mc := *c
+	mc.Canonical = false
+	termios, err := newTermios(&mc)
+	if err != nil {
+		m.Close()
+		return nil, nil, err
+	}
+	if err = m.setTermios(termios); err != nil {
+		m.Close()
+		return nil, nil, err
+	}
+	m.readTimeout, m.writeTimeout = defaultTimeouts(EndPointSerial, c.ReadTimeout, c.WriteTimeout)
+	m.maxReadSize = c.MaxReadSize
+	m.maxWriteSize = c.MaxWriteSize
+
+	sc := *c
+	sc.Address = fmt.Sprintf("/dev/pts/%d", n)
+	sc.LockFile = false
+	sc.RS485 = RS485Config{}
+	s := newSerial()
+	if err = s.Open(&sc); err != nil {
+		m.Close()
+		return nil, nil, err
+	}
+
+	return m, s, nil
+}
@@ -0,0 +1,81 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+//只读模式下拒绝写入
+var ErrReadOnly = errors.New("readonly: write rejected")
+
+//只读模式，用于新部署时只观察现场总线，不发出任何命令
+type ReadOnlyMode int
+
+const (
+	ReadOnlyOff    ReadOnlyMode = iota //正常读写
+	ReadOnlyDrop                       //丢弃写入并记录日志，Write返回成功，上层协议按无应答处理
+	ReadOnlyReject                     //拒绝写入，Write返回ErrReadOnly
+)
+
+//readOnly拦截EndPoint的写入
+type readOnly struct {
+	EndPoint
+	name string       //EndPoint名称
+	mode ReadOnlyMode //只读模式
+}
+
+//创建只读的EndPoint，写入按mode丢弃或拒绝，读取和其他操作直接转发。mode为ReadOnlyOff时返回p
+func NewReadOnly(p EndPoint, name string, mode ReadOnlyMode) EndPoint {
+	if mode == ReadOnlyOff {
+		return p
+	}
+	return &readOnly{EndPoint: p, name: name, mode: mode}
+}
+
+//丢弃或拒绝写入
+func (p *readOnly) Write(b []byte) (int, error) {
+	if p.mode == ReadOnlyReject {
+		return 0, fmt.Errorf("%w: %v", ErrReadOnly, p.name)
+	}
+
+	log.Printf("readonly: dropped write of %v bytes to %v: % x\n", len(b), p.name, b)
+	return len(b), nil
+}
+
+//修改底层EndPoint的读超时，底层不支持TimeoutSetter时忽略
+func (p *readOnly) SetReadTimeout(d time.Duration) {
+	setReadTimeout(p.EndPoint, d)
+}
+
+//修改底层EndPoint的写超时，底层不支持TimeoutSetter时忽略
+func (p *readOnly) SetWriteTimeout(d time.Duration) {
+	setWriteTimeout(p.EndPoint, d)
+}
+
+//设置EndPoint的只读模式，已打开的EndPoint立即生效
+func (m *Manager) SetReadOnly(name string, mode ReadOnlyMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, ok := m.endpoints[name]
+	if !ok {
+		return fmt.Errorf("manager: endpoint %v not found", name)
+	}
+	me.readOnly = mode
+	me.wrap()
+
+	return nil
+}
+
+//返回EndPoint的只读模式
+func (m *Manager) ReadOnly(name string) ReadOnlyMode {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if me, ok := m.endpoints[name]; ok {
+		return me.readOnly
+	}
+	return ReadOnlyOff
+}
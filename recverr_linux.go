@@ -0,0 +1,108 @@
+package endpoint
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+//错误队列控制消息缓冲区大小，足以容纳sock_extended_err和出错节点地址
+const errQueueOOBSize = 128
+
+//sock_extended_err的长度
+const sizeofSockExtendedErr = int(unsafe.Sizeof(unix.SockExtendedErr{}))
+
+//开启接收ICMP差错，IPv6套接字同时开启IPv4映射报文的差错
+func setReceiveErrors(fd, family int) error {
+	if family == syscall.AF_INET6 {
+		syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, unix.IP_RECVERR, 1)
+		return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, unix.IPV6_RECVERR, 1))
+	}
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, unix.IP_RECVERR, 1))
+}
+
+//从错误队列读取一个差错，不等待，队列为空时返回nil, nil。需开启UDPConfig.ReceiveErrors
+func (p *udp) ReadError() (*ICMPError, error) {
+	if p.fd == -1 {
+		return nil, fmt.Errorf("udp: not open")
+	}
+	if !p.recvErr {
+		return nil, fmt.Errorf("udp: receive errors not enabled")
+	}
+
+	oob := make([]byte, errQueueOOBSize)
+	var (
+		oobn int
+		from syscall.Sockaddr
+		err  error
+	)
+	for {
+		if _, oobn, _, from, err = syscall.Recvmsg(p.fd, nil, oob, unix.MSG_ERRQUEUE|syscall.MSG_DONTWAIT); err != syscall.EINTR {
+			break
+		}
+	}
+	if err == syscall.EAGAIN {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("udp: %v", os.NewSyscallError("recvmsg", err))
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, fmt.Errorf("udp: %v", os.NewSyscallError("parse control message", err))
+	}
+	for _, m := range msgs {
+		if e := parseExtendedErr(&m); e != nil {
+			if from != nil {
+				e.Addr = sockaddrToUDPAddr(from)
+			}
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("udp: missing extended error in error queue message")
+}
+
+//开启ReceiveErrors时，收发失败或没有数据可读时优先返回错误队列中的差错。
+//ICMP差错会使select返回可读，不读取错误队列时等待读取的循环无法进入等待
+func (p *udp) queuedError(err error) error {
+	if !p.recvErr || err == nil || err == syscall.EINTR {
+		return err
+	}
+	if e, _ := p.ReadError(); e != nil {
+		return e
+	}
+	return err
+}
+
+//解析IP_RECVERR/IPV6_RECVERR控制消息，其他控制消息返回nil
+func parseExtendedErr(m *syscall.SocketControlMessage) *ICMPError {
+	if !(m.Header.Level == syscall.IPPROTO_IP && m.Header.Type == unix.IP_RECVERR) &&
+		!(m.Header.Level == syscall.IPPROTO_IPV6 && m.Header.Type == unix.IPV6_RECVERR) {
+		return nil
+	}
+	if len(m.Data) < sizeofSockExtendedErr {
+		return nil
+	}
+
+	ee := (*unix.SockExtendedErr)(unsafe.Pointer(&m.Data[0]))
+	e := &ICMPError{
+		Err:    syscall.Errno(ee.Errno),
+		Origin: int(ee.Origin),
+		Type:   int(ee.Type),
+		Code:   int(ee.Code),
+		Info:   int(ee.Info),
+	}
+
+	//出错节点地址紧跟在sock_extended_err之后（SO_EE_OFFENDER）
+	if e.Origin == ErrOriginICMP || e.Origin == ErrOriginICMP6 {
+		var raw syscall.RawSockaddrAny
+		copy((*[syscall.SizeofSockaddrAny]byte)(unsafe.Pointer(&raw))[:], m.Data[sizeofSockExtendedErr:])
+		if a := rawToUDPAddr(&raw); a != nil {
+			e.Offender = a.IP
+		}
+	}
+	return e
+}
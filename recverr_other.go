@@ -0,0 +1,25 @@
+// +build !linux
+
+package endpoint
+
+import (
+	"fmt"
+)
+
+//当前系统不支持从错误队列接收ICMP差错
+func setReceiveErrors(fd, family int) error {
+	return fmt.Errorf("receiving icmp errors is not supported")
+}
+
+//当前系统不支持ReceiveErrors
+func (p *udp) ReadError() (*ICMPError, error) {
+	if p.fd == -1 {
+		return nil, fmt.Errorf("udp: not open")
+	}
+	return nil, fmt.Errorf("udp: receive errors not enabled")
+}
+
+//当前系统没有错误队列，原样返回错误
+func (p *udp) queuedError(err error) error {
+	return err
+}
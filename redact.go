@@ -0,0 +1,68 @@
+package endpoint
+
+import (
+	"bytes"
+	"regexp"
+)
+
+//脱敏后用于替换敏感数据的字节
+const redactMask = '*'
+
+//脱敏规则，返回脱敏后的数据，可以就地修改b
+type Redactor interface {
+	Redact(b []byte) []byte
+}
+
+//函数形式的脱敏规则
+type RedactorFunc func(b []byte) []byte
+
+func (f RedactorFunc) Redact(b []byte) []byte {
+	return f(b)
+}
+
+//按位置脱敏：把[offset, offset+length)范围内的字节替换为'*'，超出数据长度的部分忽略
+func RedactRange(offset, length int) Redactor {
+	return RedactorFunc(func(b []byte) []byte {
+		for i := offset; i < offset+length && i < len(b); i++ {
+			if i >= 0 {
+				b[i] = redactMask
+			}
+		}
+		return b
+	})
+}
+
+//按正则脱敏：有分组时替换第一个分组，否则替换整个匹配，替换后长度不变
+func RedactRegexp(re *regexp.Regexp) Redactor {
+	return RedactorFunc(func(b []byte) []byte {
+		for _, m := range re.FindAllSubmatchIndex(b, -1) {
+			start, end := m[0], m[1]
+			if len(m) >= 4 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			copy(b[start:end], bytes.Repeat([]byte{redactMask}, end-start))
+		}
+		return b
+	})
+}
+
+//脱敏的采集输出，记录在写入下游前按规则脱敏，原始数据不受影响
+type redactingSink struct {
+	sink      CaptureSink //下游输出
+	redactors []Redactor  //脱敏规则，按顺序执行
+}
+
+//创建脱敏的采集输出，保证凭据等敏感数据不会写入采集文件或日志
+func NewRedactingSink(sink CaptureSink, redactors ...Redactor) CaptureSink {
+	return &redactingSink{sink: sink, redactors: redactors}
+}
+
+//脱敏后写入采集记录
+func (s *redactingSink) WriteRecord(r *CaptureRecord) error {
+	rr := *r
+	rr.Data = append([]byte(nil), r.Data...)
+	for _, redactor := range s.redactors {
+		rr.Data = redactor.Redact(rr.Data)
+	}
+	return s.sink.WriteRecord(&rr)
+}
@@ -0,0 +1,162 @@
+package endpoint
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+//多地址依次连接时单个地址的最短连接时间
+const dialMinAttempt = 2 * time.Second
+
+//主机名解析接口，可替换为自定义DNS、静态主机表或带缓存的解析器
+type Resolver interface {
+	LookupIP(host string) ([]net.IP, error) //返回主机的全部地址，按连接的优先顺序排列
+}
+
+//系统解析器
+type systemResolver struct{}
+
+//使用net.LookupIP解析
+func (systemResolver) LookupIP(host string) ([]net.IP, error) {
+	return net.LookupIP(host)
+}
+
+//系统解析器，使用/etc/hosts和系统DNS配置
+var DefaultResolver Resolver = systemResolver{}
+
+//解析结果缓存项
+type resolverEntry struct {
+	ips    []net.IP  //解析结果
+	expire time.Time //过期时间
+}
+
+//带缓存的解析器，用于每秒都重新连接的设备，避免每次打开都查询DNS。
+//缓存过期后解析失败时继续使用过期的结果，DNS短暂不可用时不影响重连
+type CachingResolver struct {
+	resolver Resolver                  //实际解析器
+	ttl      time.Duration             //缓存有效期
+	mu       sync.Mutex                //保护entries
+	entries  map[string]*resolverEntry //按主机名缓存的结果
+}
+
+//创建带缓存的解析器，r为nil时使用DefaultResolver
+func NewCachingResolver(r Resolver, ttl time.Duration) *CachingResolver {
+	if r == nil {
+		r = DefaultResolver
+	}
+	return &CachingResolver{
+		resolver: r,
+		ttl:      ttl,
+		entries:  make(map[string]*resolverEntry),
+	}
+}
+
+//返回缓存的解析结果，过期或未缓存时重新解析
+func (r *CachingResolver) LookupIP(host string) ([]net.IP, error) {
+	r.mu.Lock()
+	e, ok := r.entries[host]
+	r.mu.Unlock()
+	if ok && time.Now().Before(e.expire) {
+		return e.ips, nil
+	}
+
+	ips, err := r.resolver.LookupIP(host)
+	if err != nil {
+		if ok {
+			return e.ips, nil
+		}
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.entries[host] = &resolverEntry{ips: ips, expire: time.Now().Add(r.ttl)}
+	r.mu.Unlock()
+
+	return ips, nil
+}
+
+//清除缓存，host为空时清除全部
+func (r *CachingResolver) Flush(host string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if host == "" {
+		r.entries = make(map[string]*resolverEntry)
+	} else {
+		delete(r.entries, host)
+	}
+}
+
+//解析TCP地址，返回符合网络类型的全部地址，r为nil时使用DefaultResolver
+func resolveTCPAddrs(network, address string, r Resolver) ([]*net.TCPAddr, error) {
+	host, service, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := net.LookupPort(network, service)
+	if err != nil {
+		return nil, err
+	}
+
+	//IP地址和空主机名无需解析
+	if host == "" {
+		return []*net.TCPAddr{{Port: port}}, nil
+	}
+	if ip, zone := splitZone(host); net.ParseIP(ip) != nil {
+		return []*net.TCPAddr{{IP: net.ParseIP(ip), Port: port, Zone: zone}}, nil
+	}
+
+	if r == nil {
+		r = DefaultResolver
+	}
+	ips, err := r.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []*net.TCPAddr
+	for _, ip := range ips {
+		is4 := ip.To4() != nil
+		if (network == "tcp4" && !is4) || (network == "tcp6" && is4) {
+			continue
+		}
+		addrs = append(addrs, &net.TCPAddr{IP: ip, Port: port})
+	}
+	if len(addrs) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+
+	return addrs, nil
+}
+
+//分离IPv6地址的区域，比如fe80::1%eth0
+func splitZone(host string) (string, string) {
+	for i := len(host) - 1; i >= 0; i-- {
+		if host[i] == '%' {
+			return host[:i], host[i+1:]
+		}
+	}
+	return host, ""
+}
+
+//计算剩余remaining个地址时本次连接的超时，在剩余地址间平分剩余时间，但不少于2s。
+//deadline为零值时不限制，已超过deadline时返回false
+func dialAttemptTimeout(deadline time.Time, remaining int) (time.Duration, bool) {
+	if deadline.IsZero() {
+		return 0, true
+	}
+	left := deadline.Sub(time.Now())
+	if left <= 0 {
+		return 0, false
+	}
+
+	timeout := left / time.Duration(remaining)
+	if timeout < dialMinAttempt {
+		timeout = dialMinAttempt
+		if left < timeout {
+			timeout = left
+		}
+	}
+	return timeout, true
+}
@@ -0,0 +1,70 @@
+package endpoint
+
+import (
+	"errors"
+	"math/rand"
+	"syscall"
+	"time"
+)
+
+//Open重试的退避间隔上限
+const maxRetryBackoff = 30 * time.Second
+
+//支持Open失败重试的配置
+type retryConfig interface {
+	retryPolicy() (count int, backoff time.Duration)
+}
+
+func (c *TCPConfig) retryPolicy() (int, time.Duration) {
+	return c.RetryCount, c.RetryBackoff
+}
+
+func (c *TLSConfig) retryPolicy() (int, time.Duration) {
+	return c.RetryCount, c.RetryBackoff
+}
+
+func (c *UnixSocketConfig) retryPolicy() (int, time.Duration) {
+	return c.RetryCount, c.RetryBackoff
+}
+
+func (c *RFC2217Config) retryPolicy() (int, time.Duration) {
+	return c.RetryCount, c.RetryBackoff
+}
+
+//第attempt次（从0开始）重试前的等待时间：backoff按2的指数增长，不超过maxRetryBackoff，
+//并在[d/2, d]内随机抖动，避免大量EndPoint同时重连
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	d := backoff
+	for i := 0; i < attempt && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	if half := int64(d / 2); half > 0 {
+		d = time.Duration(half + rand.Int63n(half+1))
+	}
+	return d
+}
+
+//判断连接错误是否是暂时的，值得重试
+func isTransientDialError(err error) bool {
+	var te *TimeoutError
+	if errors.As(err, &te) {
+		return true
+	}
+	for _, errno := range []syscall.Errno{
+		syscall.ECONNREFUSED,
+		syscall.ECONNRESET,
+		syscall.EHOSTUNREACH,
+		syscall.ENETUNREACH,
+		syscall.ETIMEDOUT,
+		syscall.EAGAIN,
+		syscall.ENOENT, //UnixSocket服务端尚未创建套接字文件
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,585 @@
+package endpoint
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+//telnet命令
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+)
+
+//telnet选项
+const (
+	telnetOptBinary  = 0
+	telnetOptSGA     = 3
+	telnetOptComPort = 44
+)
+
+//RFC2217 COM-PORT-OPTION子命令，服务端应答为子命令加100
+const (
+	comPortSetBaudRate      = 1
+	comPortSetDataSize      = 2
+	comPortSetParity        = 3
+	comPortSetStopSize      = 4
+	comPortSetControl       = 5
+	comPortNotifyModemState = 7
+	comPortPurgeData        = 12
+	comPortServerOffset     = 100
+)
+
+//SET-CONTROL取值
+const (
+	comPortDTROn    = 8
+	comPortDTROff   = 9
+	comPortRTSOn    = 11
+	comPortRTSOff   = 12
+	comPortBreakOn  = 5
+	comPortBreakOff = 6
+)
+
+//SendBreak未指定时长时的BREAK时长
+const rfc2217BreakTime = 250 * time.Millisecond
+
+//RFC2217默认TCP保活周期
+const rfc2217KeepAlive = 30 * time.Second
+
+//telnet协议解析状态
+const (
+	telnetStateData = iota
+	telnetStateIAC
+	telnetStateOption
+	telnetStateSB
+	telnetStateSBIAC
+)
+
+//RFC2217扩展接口，可通过类型断言从RFC2217 EndPoint获取
+type RFC2217EndPoint interface {
+	EndPoint
+	SetConfig(c *SerialConfig) error            //重新设置远端串口的波特率、数据位、停止位和校验位
+	SetModemLine(line ModemLine, on bool) error //设置远端串口的DTR或RTS
+	ModemStatus() (ModemLine, error)            //返回远端串口最近一次通知的控制线状态
+	SendBreak(d time.Duration) error            //在远端串口上发送持续d的BREAK信号，d<=0时为250ms
+}
+
+//RFC2217配置，通过TCP连接ser2net等RFC2217服务端，远程设置串口参数
+type RFC2217Config struct {
+	Network       string        //TCP网络类型（tcp、tcp4、tcp6）
+	Address       string        //服务端地址，比如192.168.1.1:2217
+	KeepAlive     time.Duration //TCP保活周期，默认30s
+	RetryCount    int           //TCP连接暂时失败时Open的重试次数，0表示不重试
+	RetryBackoff  time.Duration //第一次重试前的等待时间，之后每次加倍（上限30s）并随机抖动
+	BaudRate      int           //波特率，默认值9600
+	DataBits      int           //数据位长度（5、6、7、8），默认8
+	StopBits      int           //停止位长度（1、2、STOPBITS_1_5），默认1
+	Parity        ParityMode    //校验模式
+	AssertLines   ModemLine     //打开后置为有效的控制线（LineDTR、LineRTS）
+	DeassertLines ModemLine     //打开后置为无效的控制线（LineDTR、LineRTS）
+	ReadTimeout   time.Duration //一次完全数据包的收取超时，也用于等待服务端协商
+	WriteTimeout  time.Duration //一次完整数据包的发送超时
+	MaxReadSize   int           //单次读取的最大报文长度，超过时返回FrameSizeError，0表示不限制
+	MaxWriteSize  int           //单次发送的最大报文长度，超过时返回FrameSizeError，0表示不限制
+}
+
+func (c *RFC2217Config) Type() EndPointType {
+	return EndPointRFC2217
+}
+
+func (c *RFC2217Config) AddressName() string {
+	return c.Address
+}
+
+//rfc2217实现EndPoint接口，在TCP连接上处理telnet协商和IAC转义
+type rfc2217 struct {
+	conn       *tcp      //底层TCP连接，不直接暴露，避免绕过telnet转义
+	state      int       //telnet协议解析状态
+	verb       byte      //正在解析的WILL/WONT/DO/DONT
+	sb         []byte    //正在解析的子协商数据
+	comPort    bool      //服务端已接受COM-PORT-OPTION
+	refused    bool      //服务端拒绝COM-PORT-OPTION
+	modemState ModemLine //服务端最近一次通知的控制线状态
+	rawBuf     []byte    //原始数据接收缓冲区
+	raw        []byte    //已接收但未解析的原始数据
+}
+
+//创建rfc2217对象
+func newRFC2217() EndPoint {
+	return &rfc2217{conn: &tcp{fd: -1}}
+}
+
+//连接服务端，协商COM-PORT-OPTION并设置串口参数
+func (p *rfc2217) Open(config EndPointConfig) (err error) {
+	c := config.(*RFC2217Config)
+
+	tc := &TCPConfig{
+		Network:      c.Network,
+		Address:      c.Address,
+		KeepAlive:    c.KeepAlive,
+		NoDelay:      TCPNoDelay,
+		ReadTimeout:  c.ReadTimeout,
+		WriteTimeout: c.WriteTimeout,
+		MaxReadSize:  c.MaxReadSize,
+		MaxWriteSize: c.MaxWriteSize,
+	}
+	if tc.KeepAlive <= 0 {
+		tc.KeepAlive = rfc2217KeepAlive
+	}
+	if tc.Network == "" {
+		tc.Network = "tcp"
+	}
+	if err = p.conn.Open(tc); err != nil {
+		return fmt.Errorf("rfc2217: %w", err)
+	}
+	p.conn.readTimeout, p.conn.writeTimeout = defaultTimeouts(EndPointRFC2217, c.ReadTimeout, c.WriteTimeout)
+	p.state = telnetStateData
+	p.comPort, p.refused = false, false
+	p.modemState = 0
+	p.rawBuf = make([]byte, 1024)
+	p.raw = nil
+
+	//协商二进制传输、禁止GA和COM-PORT-OPTION
+	if err = p.sendRaw([]byte{
+		telnetIAC, telnetWILL, telnetOptBinary,
+		telnetIAC, telnetDO, telnetOptBinary,
+		telnetIAC, telnetWILL, telnetOptSGA,
+		telnetIAC, telnetDO, telnetOptSGA,
+		telnetIAC, telnetWILL, telnetOptComPort,
+	}); err != nil {
+		p.Close()
+		return
+	}
+	if err = p.waitComPort(); err != nil {
+		p.Close()
+		return
+	}
+
+	if err = p.SetConfig(&SerialConfig{BaudRate: c.BaudRate, DataBits: c.DataBits, StopBits: c.StopBits, Parity: c.Parity}); err != nil {
+		p.Close()
+		return
+	}
+	for _, line := range []ModemLine{LineDTR, LineRTS} {
+		if c.AssertLines&line != 0 {
+			err = p.SetModemLine(line, true)
+		} else if c.DeassertLines&line != 0 {
+			err = p.SetModemLine(line, false)
+		}
+		if err != nil {
+			p.Close()
+			return
+		}
+	}
+
+	return
+}
+
+//返回endpoint类型
+func (p *rfc2217) Type() EndPointType {
+	return EndPointRFC2217
+}
+
+//读取串口数据，去除telnet命令并还原转义的0xFF
+func (p *rfc2217) Read(b []byte) (n int, err error) {
+	b = limitReadBuffer(b, p.conn.maxReadSize)
+	expireTime := time.Now().Add(p.conn.readTimeout)
+
+	for n == 0 {
+		if err = p.fill(expireTime, p.conn.readTimeout); err != nil {
+			return
+		}
+		if n, err = p.decode(b); err != nil {
+			return
+		}
+	}
+
+	return checkReadSize("rfc2217", n, p.conn.maxReadSize)
+}
+
+//写串口数据，数据中的0xFF转义为IAC IAC
+func (p *rfc2217) Write(b []byte) (int, error) {
+	if err := checkWriteSize("rfc2217", len(b), p.conn.maxWriteSize); err != nil {
+		return 0, err
+	}
+
+	if err := p.sendRaw(escapeIAC(make([]byte, 0, len(b)+8), b)); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+//清理远端串口的收发缓冲区
+func (p *rfc2217) Flush() error {
+	return p.sendComPort(comPortPurgeData, 3)
+}
+
+//断开与服务端的连接
+func (p *rfc2217) Close() error {
+	p.raw = nil
+	return p.conn.Close()
+}
+
+//TCP文件句柄，直接读写会绕过telnet转义
+func (p *rfc2217) Fd() int {
+	return p.conn.Fd()
+}
+
+//返回服务端网络地址
+func (p *rfc2217) NetAddr() net.Addr {
+	return p.conn.NetAddr()
+}
+
+//返回服务端的socket地址
+func (p *rfc2217) SockAddr() syscall.Sockaddr {
+	return p.conn.SockAddr()
+}
+
+//返回读超时
+func (p *rfc2217) ReadTimeout() time.Duration {
+	return p.conn.ReadTimeout()
+}
+
+//返回写超时
+func (p *rfc2217) WriteTimeout() time.Duration {
+	return p.conn.WriteTimeout()
+}
+
+//修改读超时
+func (p *rfc2217) SetReadTimeout(d time.Duration) {
+	p.conn.SetReadTimeout(d)
+}
+
+//修改写超时
+func (p *rfc2217) SetWriteTimeout(d time.Duration) {
+	p.conn.SetWriteTimeout(d)
+}
+
+//重新设置远端串口的波特率、数据位、停止位和校验位
+func (p *rfc2217) SetConfig(c *SerialConfig) (err error) {
+	baud := c.BaudRate
+	if baud == 0 {
+		baud = 9600
+	}
+	dataBits := c.DataBits
+	if dataBits == 0 {
+		dataBits = 8
+	}
+	if _, ok := charSizes[dataBits]; !ok {
+		return fmt.Errorf("rfc2217: unsupported character size %v", dataBits)
+	}
+
+	var stopSize byte
+	switch c.StopBits {
+	case 0, 1:
+		stopSize = 1
+	case 2:
+		stopSize = 2
+	case STOPBITS_1_5:
+		stopSize = 3
+	default:
+		return fmt.Errorf("rfc2217: unsupported stop bits %v", c.StopBits)
+	}
+
+	var parity byte
+	switch c.Parity {
+	case PARITY_NONE:
+		parity = 1
+	case PARITY_ODD:
+		parity = 2
+	case PARITY_EVEN:
+		parity = 3
+	case PARITY_MARK:
+		parity = 4
+	case PARITY_SPACE:
+		parity = 5
+	default:
+		return fmt.Errorf("rfc2217: unsupported parity %v", c.Parity)
+	}
+
+	rate := make([]byte, 4)
+	binary.BigEndian.PutUint32(rate, uint32(baud))
+	if err = p.sendComPort(comPortSetBaudRate, rate...); err != nil {
+		return
+	}
+	if err = p.sendComPort(comPortSetDataSize, byte(dataBits)); err != nil {
+		return
+	}
+	if err = p.sendComPort(comPortSetParity, parity); err != nil {
+		return
+	}
+	return p.sendComPort(comPortSetStopSize, stopSize)
+}
+
+//设置远端串口的DTR或RTS
+func (p *rfc2217) SetModemLine(line ModemLine, on bool) error {
+	var value byte
+	switch {
+	case line == LineDTR && on:
+		value = comPortDTROn
+	case line == LineDTR:
+		value = comPortDTROff
+	case line == LineRTS && on:
+		value = comPortRTSOn
+	case line == LineRTS:
+		value = comPortRTSOff
+	default:
+		return fmt.Errorf("rfc2217: unsupported modem line %v", line)
+	}
+
+	return p.sendComPort(comPortSetControl, value)
+}
+
+//在远端串口上发送持续d的BREAK信号，时长受网络延迟影响，d<=0时为250ms
+func (p *rfc2217) SendBreak(d time.Duration) error {
+	if d <= 0 {
+		d = rfc2217BreakTime
+	}
+	if err := p.sendComPort(comPortSetControl, comPortBreakOn); err != nil {
+		return err
+	}
+	time.Sleep(d)
+	return p.sendComPort(comPortSetControl, comPortBreakOff)
+}
+
+//返回远端串口最近一次通知的控制线状态，状态随Read处理服务端通知而更新
+func (p *rfc2217) ModemStatus() (ModemLine, error) {
+	if p.conn.fd == -1 {
+		return 0, fmt.Errorf("rfc2217: not open")
+	}
+	return p.modemState, nil
+}
+
+//等待服务端接受COM-PORT-OPTION
+func (p *rfc2217) waitComPort() error {
+	timeout := p.conn.readTimeout
+	if timeout <= 0 {
+		timeout = 5000 * time.Millisecond
+	}
+	expireTime := time.Now().Add(timeout)
+
+	for !p.comPort {
+		if p.refused {
+			return fmt.Errorf("rfc2217: server refused com port option")
+		}
+		if err := p.fill(expireTime, timeout); err != nil {
+			return fmt.Errorf("rfc2217: negotiate com port option: %w", err)
+		}
+		//协商完成前收到的串口数据直接丢弃
+		discard := make([]byte, len(p.rawBuf))
+		if _, err := p.decode(discard); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//没有未解析的原始数据时，等待套接字可读并读取，timeout<=0表示一直等待
+func (p *rfc2217) fill(expireTime time.Time, timeout time.Duration) error {
+	if len(p.raw) > 0 {
+		return nil
+	}
+
+	var remainTime time.Duration
+	if timeout > 0 {
+		if remainTime = expireTime.Sub(time.Now()); remainTime <= 0 {
+			return &TimeoutError{Op: "rfc2217", Duration: timeout}
+		}
+	}
+	if err := waitFd(p.conn.fd, false, remainTime); err == errWaitTimeout {
+		return &TimeoutError{Op: "rfc2217", Duration: timeout}
+	} else if err != nil {
+		return fmt.Errorf("rfc2217: could not select: %v", err)
+	}
+
+	n, err := syscall.Read(p.conn.fd, p.rawBuf)
+	if err == syscall.EAGAIN || err == syscall.EINTR {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("rfc2217: could not read: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("rfc2217: connection closed by server")
+	}
+	p.raw = p.rawBuf[:n]
+
+	return nil
+}
+
+//解析缓冲的原始数据，串口数据写入b，处理telnet命令，返回写入b的字节数。
+//b写满时剩余原始数据保留到下次解析
+func (p *rfc2217) decode(b []byte) (n int, err error) {
+	i := 0
+loop:
+	for ; i < len(p.raw) && n < len(b); i++ {
+		c := p.raw[i]
+		switch p.state {
+		case telnetStateData:
+			if c == telnetIAC {
+				p.state = telnetStateIAC
+			} else {
+				b[n] = c
+				n++
+			}
+		case telnetStateIAC:
+			switch c {
+			case telnetIAC:
+				b[n] = c
+				n++
+				p.state = telnetStateData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				p.verb = c
+				p.state = telnetStateOption
+			case telnetSB:
+				p.sb = p.sb[:0]
+				p.state = telnetStateSB
+			default: //NOP、GA等无参数命令
+				p.state = telnetStateData
+			}
+		case telnetStateOption:
+			p.state = telnetStateData
+			if err = p.negotiate(p.verb, c); err != nil {
+				p.raw = p.raw[i+1:]
+				return
+			}
+			//服务端接受COM-PORT-OPTION后的数据留给Read，不在协商阶段丢弃
+			if p.verb == telnetDO && c == telnetOptComPort {
+				i++
+				break loop
+			}
+		case telnetStateSB:
+			if c == telnetIAC {
+				p.state = telnetStateSBIAC
+			} else {
+				p.sb = append(p.sb, c)
+			}
+		case telnetStateSBIAC:
+			switch c {
+			case telnetSE:
+				p.subnegotiate(p.sb)
+				p.state = telnetStateData
+			case telnetIAC:
+				p.sb = append(p.sb, c)
+				p.state = telnetStateSB
+			default: //子协商未正常结束，按新命令处理
+				p.state = telnetStateIAC
+				i--
+			}
+		}
+	}
+	p.raw = p.raw[i:]
+
+	return
+}
+
+//应答服务端的选项协商，只接受二进制传输、禁止GA和COM-PORT-OPTION
+func (p *rfc2217) negotiate(verb, opt byte) error {
+	supported := opt == telnetOptBinary || opt == telnetOptSGA || opt == telnetOptComPort
+
+	switch verb {
+	case telnetDO:
+		if opt == telnetOptComPort {
+			p.comPort = true
+		}
+		if !supported {
+			return p.sendRaw([]byte{telnetIAC, telnetWONT, opt})
+		}
+	case telnetDONT:
+		if opt == telnetOptComPort {
+			p.refused = true
+		}
+	case telnetWILL:
+		if !supported || opt == telnetOptComPort {
+			return p.sendRaw([]byte{telnetIAC, telnetDONT, opt})
+		}
+	}
+
+	return nil
+}
+
+//处理服务端的COM-PORT-OPTION子协商，目前只记录控制线状态通知
+func (p *rfc2217) subnegotiate(sb []byte) {
+	if len(sb) < 3 || sb[0] != telnetOptComPort {
+		return
+	}
+
+	if sb[1] == comPortServerOffset+comPortNotifyModemState {
+		var line ModemLine
+		state := sb[2]
+		if state&0x10 != 0 {
+			line |= LineCTS
+		}
+		if state&0x20 != 0 {
+			line |= LineDSR
+		}
+		if state&0x40 != 0 {
+			line |= LineRI
+		}
+		if state&0x80 != 0 {
+			line |= LineDCD
+		}
+		p.modemState = line
+	}
+}
+
+//发送COM-PORT-OPTION子协商，参数中的0xFF转义为IAC IAC
+func (p *rfc2217) sendComPort(cmd byte, args ...byte) error {
+	if p.conn.fd == -1 {
+		return fmt.Errorf("rfc2217: not open")
+	}
+
+	buf := escapeIAC([]byte{telnetIAC, telnetSB, telnetOptComPort, cmd}, args)
+	buf = append(buf, telnetIAC, telnetSE)
+
+	return p.sendRaw(buf)
+}
+
+//在写超时内发送全部原始数据
+func (p *rfc2217) sendRaw(b []byte) error {
+	var remainTime time.Duration
+	expireTime := time.Now().Add(p.conn.writeTimeout)
+
+	for len(b) > 0 {
+		n, err := syscall.Write(p.conn.fd, b)
+		if n > 0 {
+			b = b[n:]
+		}
+		if err == nil || err == syscall.EINTR {
+			continue
+		} else if err != syscall.EAGAIN {
+			return fmt.Errorf("rfc2217: could not write: %w", err)
+		}
+
+		if p.conn.writeTimeout > 0 {
+			if remainTime = expireTime.Sub(time.Now()); remainTime <= 0 {
+				return &TimeoutError{Op: "rfc2217", Duration: p.conn.writeTimeout}
+			}
+		}
+		if err = waitFd(p.conn.fd, true, remainTime); err == errWaitTimeout {
+			return &TimeoutError{Op: "rfc2217", Duration: p.conn.writeTimeout}
+		} else if err != nil {
+			return fmt.Errorf("rfc2217: could not select: %v", err)
+		}
+	}
+
+	return nil
+}
+
+//把b追加到buf，其中的0xFF转义为IAC IAC
+func escapeIAC(buf, b []byte) []byte {
+	for _, c := range b {
+		if c == telnetIAC {
+			buf = append(buf, telnetIAC)
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
@@ -0,0 +1,203 @@
+package endpoint
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+)
+
+//返回连接到socketpair一端的rfc2217对象，另一端模拟服务端
+func newRFC2217Pair(t *testing.T) (*rfc2217, int) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fd := range fds {
+		if err = syscall.SetNonblock(fd, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := newRFC2217().(*rfc2217)
+	p.conn.fd = fds[0]
+	p.state = telnetStateData
+	p.rawBuf = make([]byte, 1024)
+	return p, fds[1]
+}
+
+//读出服务端收到的全部数据
+func readPeer(t *testing.T, fd int) []byte {
+	var out []byte
+	buf := make([]byte, 256)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EAGAIN {
+			return out
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, buf[:n]...)
+	}
+}
+
+//服务端的选项协商：只接受二进制传输、禁止GA和COM-PORT-OPTION，其余选项拒绝
+func TestRFC2217Negotiate(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          []byte
+		wantReply   []byte
+		wantComPort bool
+		wantRefused bool
+	}{
+		{"DO BINARY", []byte{telnetIAC, telnetDO, telnetOptBinary}, nil, false, false},
+		{"DO SGA", []byte{telnetIAC, telnetDO, telnetOptSGA}, nil, false, false},
+		{"DO COM-PORT", []byte{telnetIAC, telnetDO, telnetOptComPort}, nil, true, false},
+		{"DO TTYPE", []byte{telnetIAC, telnetDO, 24}, []byte{telnetIAC, telnetWONT, 24}, false, false},
+		{"DONT COM-PORT", []byte{telnetIAC, telnetDONT, telnetOptComPort}, nil, false, true},
+		{"DONT BINARY", []byte{telnetIAC, telnetDONT, telnetOptBinary}, nil, false, false},
+		{"WILL BINARY", []byte{telnetIAC, telnetWILL, telnetOptBinary}, nil, false, false},
+		{"WILL COM-PORT", []byte{telnetIAC, telnetWILL, telnetOptComPort}, []byte{telnetIAC, telnetDONT, telnetOptComPort}, false, false},
+		{"WILL ECHO", []byte{telnetIAC, telnetWILL, 1}, []byte{telnetIAC, telnetDONT, 1}, false, false},
+		{"WONT ECHO", []byte{telnetIAC, telnetWONT, 1}, nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, peer := newRFC2217Pair(t)
+			defer p.Close()
+			defer syscall.Close(peer)
+
+			p.raw = tt.in
+			b := make([]byte, 16)
+			if n, err := p.decode(b); err != nil || n != 0 {
+				t.Fatalf("decode = %v, %v, want 0, nil", n, err)
+			}
+			if reply := readPeer(t, peer); !bytes.Equal(reply, tt.wantReply) {
+				t.Errorf("reply = % x, want % x", reply, tt.wantReply)
+			}
+			if p.comPort != tt.wantComPort || p.refused != tt.wantRefused {
+				t.Errorf("comPort, refused = %v, %v, want %v, %v", p.comPort, p.refused, tt.wantComPort, tt.wantRefused)
+			}
+			if p.state != telnetStateData {
+				t.Errorf("state = %v, want telnetStateData", p.state)
+			}
+		})
+	}
+}
+
+//去除telnet命令、还原转义的0xFF并处理控制线状态通知，逐字节输入时结果相同
+func TestRFC2217Decode(t *testing.T) {
+	notify := func(state ...byte) []byte {
+		b := []byte{telnetIAC, telnetSB, telnetOptComPort, comPortServerOffset + comPortNotifyModemState}
+		b = append(b, state...)
+		return append(b, telnetIAC, telnetSE)
+	}
+	cat := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	tests := []struct {
+		name      string
+		in        []byte
+		want      []byte
+		wantModem ModemLine
+	}{
+		{"plain", []byte("abc"), []byte("abc"), 0},
+		{"escaped IAC", []byte{'a', telnetIAC, telnetIAC, 'b'}, []byte{'a', telnetIAC, 'b'}, 0},
+		{"NOP", []byte{'a', telnetIAC, 241, 'b'}, []byte("ab"), 0},
+		{"option", cat([]byte("a"), []byte{telnetIAC, telnetWONT, 1}, []byte("b")), []byte("ab"), 0},
+		{"modem state", cat([]byte("a"), notify(0x90), []byte("b")), []byte("ab"), LineCTS | LineDCD},
+		{"modem state IAC", notify(telnetIAC, telnetIAC), nil, LineCTS | LineDSR | LineRI | LineDCD},
+		{"other subnegotiation", cat([]byte{telnetIAC, telnetSB, 24, 0, 'x', telnetIAC, telnetSE}, []byte("y")), []byte("y"), 0},
+		{"unterminated subnegotiation", cat([]byte{telnetIAC, telnetSB, 24, 0}, []byte{telnetIAC, 241}, []byte("z")), []byte("z"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, split := range []bool{false, true} {
+				p, peer := newRFC2217Pair(t)
+
+				var got []byte
+				b := make([]byte, 16)
+				feed := [][]byte{tt.in}
+				if split {
+					feed = nil
+					for i := range tt.in {
+						feed = append(feed, tt.in[i:i+1])
+					}
+				}
+				for _, raw := range feed {
+					p.raw = raw
+					n, err := p.decode(b)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got = append(got, b[:n]...)
+				}
+				if !bytes.Equal(got, tt.want) {
+					t.Errorf("split=%v: data = % x, want % x", split, got, tt.want)
+				}
+				if p.modemState != tt.wantModem {
+					t.Errorf("split=%v: modem state = %v, want %v", split, p.modemState, tt.wantModem)
+				}
+				p.Close()
+				syscall.Close(peer)
+			}
+		})
+	}
+}
+
+//b写满或服务端接受COM-PORT-OPTION时，剩余的原始数据保留到下次解析
+func TestRFC2217DecodeKeepsRemainder(t *testing.T) {
+	p, peer := newRFC2217Pair(t)
+	defer p.Close()
+	defer syscall.Close(peer)
+
+	p.raw = []byte("abc")
+	b := make([]byte, 2)
+	if n, _ := p.decode(b); n != 2 || string(b) != "ab" || string(p.raw) != "c" {
+		t.Errorf("decode = %q, raw %q, want \"ab\", raw \"c\"", b[:n], p.raw)
+	}
+
+	p.raw = []byte{telnetIAC, telnetDO, telnetOptComPort, 'x'}
+	b = make([]byte, 16)
+	if n, _ := p.decode(b); n != 0 || !p.comPort || string(p.raw) != "x" {
+		t.Errorf("decode = %v, comPort %v, raw %q, want 0, true, raw \"x\"", n, p.comPort, p.raw)
+	}
+	if n, _ := p.decode(b); n != 1 || b[0] != 'x' {
+		t.Errorf("decode after COM-PORT-OPTION = %q, want \"x\"", b[:n])
+	}
+}
+
+//发送的数据和子协商参数中的0xFF转义为IAC IAC
+func TestRFC2217Escape(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want []byte
+	}{
+		{nil, nil},
+		{[]byte("abc"), []byte("abc")},
+		{[]byte{telnetIAC}, []byte{telnetIAC, telnetIAC}},
+		{[]byte{1, telnetIAC, telnetIAC, 2}, []byte{1, telnetIAC, telnetIAC, telnetIAC, telnetIAC, 2}},
+	}
+	for _, tt := range tests {
+		if got := escapeIAC(nil, tt.in); !bytes.Equal(got, tt.want) {
+			t.Errorf("escapeIAC(% x) = % x, want % x", tt.in, got, tt.want)
+		}
+	}
+
+	p, peer := newRFC2217Pair(t)
+	defer p.Close()
+	defer syscall.Close(peer)
+
+	if n, err := p.Write([]byte{1, telnetIAC, 2}); n != 3 || err != nil {
+		t.Fatalf("Write = %v, %v, want 3, nil", n, err)
+	}
+	if got, want := readPeer(t, peer), []byte{1, telnetIAC, telnetIAC, 2}; !bytes.Equal(got, want) {
+		t.Errorf("sent % x, want % x", got, want)
+	}
+	if err := p.SetConfig(&SerialConfig{BaudRate: 0xff}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{telnetIAC, telnetSB, telnetOptComPort, comPortSetBaudRate, 0, 0, 0, telnetIAC, telnetIAC, telnetIAC, telnetSE}
+	if got := readPeer(t, peer); !bytes.HasPrefix(got, want) {
+		t.Errorf("SET-BAUDRATE = % x, want prefix % x", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package endpoint
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+//调度器检查时间窗口的默认周期
+const scheduleInterval = time.Minute
+
+//每天的时间窗口（本地时间），用于按日历自动打开、关闭EndPoint，比如只在白天轮询电池供电的设备
+type ScheduleWindow struct {
+	Start    time.Duration  //开始时间（距零点），比如8*time.Hour
+	End      time.Duration  //结束时间（距零点），小于Start时跨越午夜，等于Start时表示全天
+	Weekdays []time.Weekday //生效的星期，跨越午夜时按开始的那天计算，为空表示每天
+}
+
+//解析HH:MM-HH:MM格式的时间窗口，比如08:00-18:00
+func ParseScheduleWindow(s string) (ScheduleWindow, error) {
+	var w ScheduleWindow
+
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 2 {
+		return w, fmt.Errorf("schedule: invalid window %q", s)
+	}
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return w, fmt.Errorf("schedule: invalid window %q: %v", s, err)
+		}
+		d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		if i == 0 {
+			w.Start = d
+		} else {
+			w.End = d
+		}
+	}
+
+	return w, nil
+}
+
+//判断t是否在时间窗口内
+func (w ScheduleWindow) Contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+
+	day := t.Weekday()
+	switch {
+	case w.Start == w.End:
+	case w.Start < w.End:
+		if offset < w.Start || offset >= w.End {
+			return false
+		}
+	case offset >= w.Start:
+	case offset < w.End:
+		//跨越午夜的后半段属于前一天的窗口
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range w.Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+//设置EndPoint的时间窗口，在任一窗口内时由调度器打开，否则关闭，windows为空表示取消调度
+func (m *Manager) SetSchedule(name string, windows ...ScheduleWindow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, ok := m.endpoints[name]
+	if !ok {
+		return fmt.Errorf("manager: endpoint %v not found", name)
+	}
+	me.schedule = append([]ScheduleWindow(nil), windows...)
+
+	return nil
+}
+
+//启动调度器，立即并按interval周期（默认1分钟）根据时间窗口打开或关闭EndPoint。
+//onError在打开或关闭失败时调用，可为nil
+func (m *Manager) StartScheduler(interval time.Duration, onError func(name string, err error)) error {
+	if interval <= 0 {
+		interval = scheduleInterval
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.schedulerDone != nil {
+		return fmt.Errorf("manager: scheduler already started")
+	}
+	done := make(chan struct{})
+	m.schedulerDone = done
+	m.schedulerWg.Add(1)
+
+	go func() {
+		defer m.schedulerWg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			m.applySchedule(time.Now(), onError)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return nil
+}
+
+//停止调度器，不改变EndPoint当前的打开状态
+func (m *Manager) StopScheduler() {
+	m.mu.Lock()
+	done := m.schedulerDone
+	m.schedulerDone = nil
+	m.mu.Unlock()
+
+	if done != nil {
+		close(done)
+		m.schedulerWg.Wait()
+	}
+}
+
+//按时间窗口打开或关闭EndPoint
+func (m *Manager) applySchedule(now time.Time, onError func(name string, err error)) {
+	type failure struct {
+		name string
+		err  error
+	}
+	var failures []failure
+
+	//关闭在锁内进行，打开在锁外进行，连接较慢时不阻塞其他操作
+	var opens []*managedEndPoint
+	m.mu.Lock()
+	for _, me := range m.sorted() {
+		if len(me.schedule) == 0 {
+			continue
+		}
+
+		if inWindows(me.schedule, now) {
+			opens = append(opens, me)
+		} else if err := m.close(me); err != nil {
+			failures = append(failures, failure{me.name, err})
+		}
+	}
+	m.mu.Unlock()
+
+	for _, me := range opens {
+		if err := m.open(me); err != nil {
+			failures = append(failures, failure{me.name, err})
+		}
+	}
+
+	if onError != nil {
+		for _, f := range failures {
+			onError(f.name, f.err)
+		}
+	}
+}
+
+//判断now是否在任一时间窗口内，windows为空时返回true
+func inWindows(windows []ScheduleWindow, now time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
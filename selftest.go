@@ -0,0 +1,57 @@
+package endpoint
+
+import (
+	"bytes"
+	"fmt"
+)
+
+//自检默认报文，覆盖全0、全1和交替比特
+var DefaultSelfTestPattern = []byte{0x55, 0xAA, 0x00, 0xFF, 0x01, 0x80, 0x7E, 0x81}
+
+//环回自检配置
+type SelfTestConfig struct {
+	Pattern          []byte //写入并期望读回的报文，为空则使用DefaultSelfTestPattern
+	InternalLoopback bool   //开启UART内部环回（TIOCM_LOOP），无需外接环回头，部分驱动不支持
+}
+
+//环回自检：写入报文并在ReadTimeout内读回比对，用于现场诊断串口。
+//未开启内部环回时需插入硬件环回头（TX接RX）
+func SelfTest(p EndPoint, c *SelfTestConfig) (err error) {
+	if c == nil {
+		c = &SelfTestConfig{}
+	}
+	pattern := c.Pattern
+	if len(pattern) == 0 {
+		pattern = DefaultSelfTestPattern
+	}
+
+	if sp, ok := p.(SerialEndPoint); ok {
+		if c.InternalLoopback {
+			if err = setModemLine(p.Fd(), lineLoop, true); err != nil {
+				return fmt.Errorf("selftest: enable internal loopback: %v", err)
+			}
+			defer setModemLine(p.Fd(), lineLoop, false)
+		}
+		//丢弃残留数据，避免影响比对
+		if err = sp.FlushInput(); err != nil {
+			return fmt.Errorf("selftest: %v", err)
+		}
+	} else if c.InternalLoopback {
+		return fmt.Errorf("selftest: internal loopback requires a serial endpoint")
+	}
+
+	if _, err = p.Write(pattern); err != nil {
+		return fmt.Errorf("selftest: write: %v", err)
+	}
+
+	b := make([]byte, len(pattern))
+	n, err := ReadExact(p, b)
+	if err != nil {
+		return fmt.Errorf("selftest: read %v of %v bytes: %v", n, len(pattern), err)
+	}
+	if !bytes.Equal(b, pattern) {
+		return fmt.Errorf("selftest: pattern mismatch: wrote % x, read % x", pattern, b)
+	}
+
+	return nil
+}
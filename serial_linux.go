@@ -1,106 +1,140 @@
 package endpoint
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"syscall"
-	"unsafe"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 var baudRates = map[int]uint32{
-	0:       syscall.B9600,
-	50:      syscall.B50,
-	75:      syscall.B75,
-	110:     syscall.B110,
-	134:     syscall.B134,
-	150:     syscall.B150,
-	200:     syscall.B200,
-	300:     syscall.B300,
-	600:     syscall.B600,
-	1200:    syscall.B1200,
-	1800:    syscall.B1800,
-	2400:    syscall.B2400,
-	4800:    syscall.B4800,
-	9600:    syscall.B9600,
-	19200:   syscall.B19200,
-	38400:   syscall.B38400,
-	57600:   syscall.B57600,
-	115200:  syscall.B115200,
-	230400:  syscall.B230400,
-	460800:  syscall.B460800,
-	500000:  syscall.B500000,
-	576000:  syscall.B576000,
-	921600:  syscall.B921600,
-	1000000: syscall.B1000000,
-	1152000: syscall.B1152000,
-	1500000: syscall.B1500000,
-	2000000: syscall.B2000000,
-	2500000: syscall.B2500000,
-	3000000: syscall.B3000000,
-	3500000: syscall.B3500000,
-	4000000: syscall.B4000000,
+	0:       unix.B9600,
+	50:      unix.B50,
+	75:      unix.B75,
+	110:     unix.B110,
+	134:     unix.B134,
+	150:     unix.B150,
+	200:     unix.B200,
+	300:     unix.B300,
+	600:     unix.B600,
+	1200:    unix.B1200,
+	1800:    unix.B1800,
+	2400:    unix.B2400,
+	4800:    unix.B4800,
+	9600:    unix.B9600,
+	19200:   unix.B19200,
+	38400:   unix.B38400,
+	57600:   unix.B57600,
+	115200:  unix.B115200,
+	230400:  unix.B230400,
+	460800:  unix.B460800,
+	500000:  unix.B500000,
+	576000:  unix.B576000,
+	921600:  unix.B921600,
+	1000000: unix.B1000000,
+	1152000: unix.B1152000,
+	1500000: unix.B1500000,
+	2000000: unix.B2000000,
+	2500000: unix.B2500000,
+	3000000: unix.B3000000,
+	3500000: unix.B3500000,
+	4000000: unix.B4000000,
 }
 
 var charSizes = map[int]uint32{
-	0: syscall.CS8,
-	5: syscall.CS5,
-	6: syscall.CS6,
-	7: syscall.CS7,
-	8: syscall.CS8,
+	0: unix.CS8,
+	5: unix.CS5,
+	6: unix.CS6,
+	7: unix.CS7,
+	8: unix.CS8,
 }
 
-// tcsetattr sets terminal file descriptor parameters.
+// tcsetattr sets terminal file descriptor parameters. The termios layout
+// and the TCSETS request number are taken from x/sys/unix because both
+// differ across architectures (e.g. mips, powerpc).
 // See man tcsetattr(3).
-func tcsetattr(fd int, termios *syscall.Termios) (err error) {
-	r, _, errno := syscall.Syscall(uintptr(syscall.SYS_IOCTL),
-		uintptr(fd), uintptr(syscall.TCSETS), uintptr(unsafe.Pointer(termios)))
-	if errno != 0 {
-		err = errno
-		return
-	}
-	if r != 0 {
-		err = fmt.Errorf("tcsetattr failed %v", r)
-	}
-	return
+func tcsetattr(fd int, termios *unix.Termios) error {
+	return unix.IoctlSetTermios(fd, unix.TCSETS, termios)
 }
 
 // tcgetattr gets terminal file descriptor parameters.
 // See man tcgetattr(3).
-func tcgetattr(fd int, termios *syscall.Termios) (err error) {
+func tcgetattr(fd int, termios *unix.Termios) error {
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	*termios = *t
+	return nil
+}
+
+// tcflush discards data received but not read and/or written but not
+// transmitted, depending on queue (TCIFLUSH, TCOFLUSH or TCIOFLUSH).
+// See man tcflush(3).
+func tcflush(fd int, queue int) error {
 	r, _, errno := syscall.Syscall(uintptr(syscall.SYS_IOCTL),
-		uintptr(fd), uintptr(syscall.TCGETS), uintptr(unsafe.Pointer(termios)))
+		uintptr(fd), uintptr(unix.TCFLSH), uintptr(queue))
 	if errno != 0 {
-		err = errno
-		return
+		return os.NewSyscallError("SYS_IOCTL (TCFLSH)", errno)
 	}
 	if r != 0 {
-		err = fmt.Errorf("tcgetattr failed %v", r)
-		return
+		return errors.New("serial: unknown error from SYS_IOCTL (TCFLSH)")
 	}
-	return
+	return nil
 }
 
-// fdget returns index and offset of fd in fds.
-func fdget(fd int, fds *syscall.FdSet) (index, offset int) {
-	index = fd / (syscall.FD_SETSIZE / len(fds.Bits)) % len(fds.Bits)
-	offset = fd % (syscall.FD_SETSIZE / len(fds.Bits))
+// tcdrain waits until all output written to fd has been transmitted.
+// See man tcdrain(3).
+func tcdrain(fd int) (err error) {
+	for {
+		err = unix.IoctlSetInt(fd, unix.TCSBRK, 1)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("serial: could not drain: %v", err)
+	}
 	return
 }
 
-// fdset implements FD_SET macro.
-func fdset(fd int, fds *syscall.FdSet) {
-	idx, pos := fdget(fd, fds)
-	fds.Bits[idx] |= 1 << uint(pos)
-}
+// sendBreak transmits a continuous stream of zero bits for duration d using
+// TIOCSBRK/TIOCCBRK. If d <= 0 it falls back to tcsendbreak(3) semantics
+// (TCSBRK with arg 0), which sends a break of 0.25-0.5 seconds.
+func sendBreak(fd int, d time.Duration) (err error) {
+	if d <= 0 {
+		if err = unix.IoctlSetInt(fd, unix.TCSBRK, 0); err != nil {
+			err = fmt.Errorf("serial: could not send break: %v", err)
+		}
+		return
+	}
 
-// fdisset implements FD_ISSET macro.
-func fdisset(fd int, fds *syscall.FdSet) bool {
-	idx, pos := fdget(fd, fds)
-	return fds.Bits[idx]&(1<<uint(pos)) != 0
+	if err = unix.IoctlSetInt(fd, unix.TIOCSBRK, 0); err != nil {
+		return fmt.Errorf("serial: could not start break: %v", err)
+	}
+	time.Sleep(d)
+	if err = unix.IoctlSetInt(fd, unix.TIOCCBRK, 0); err != nil {
+		err = fmt.Errorf("serial: could not stop break: %v", err)
+	}
+	return
 }
 
-// fdzero implements FD_ZERO macro.
-func fdzero(fds *syscall.FdSet) {
-	for i := 0; i < len(fds.Bits); i++ {
-		fds.Bits[i] = 0
+// lineLoop is TIOCM_LOOP, which puts the UART into internal loopback mode
+// on drivers that support it.
+const lineLoop ModemLine = 0x8000
+
+// setModemLine asserts or clears the given modem control line.
+// See man tty_ioctl(4) TIOCMBIS/TIOCMBIC.
+func setModemLine(fd int, line ModemLine, on bool) (err error) {
+	req := uint(unix.TIOCMBIC)
+	if on {
+		req = unix.TIOCMBIS
+	}
+	if err = unix.IoctlSetPointerInt(fd, req, int(line)); err != nil {
+		err = fmt.Errorf("serial: could not set modem line %#x: %v", int(line), err)
 	}
+	return
 }
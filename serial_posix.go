@@ -3,11 +3,13 @@
 package endpoint
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"sync"
 	"syscall"
 	"time"
 	"unsafe"
@@ -17,11 +19,25 @@ import (
 
 //serial实现EndPoint接口
 type serial struct {
-	fd           int              //串口文件描述符
-	address      string           //串口文件路径
-	oldTermios   *syscall.Termios //终端配置（波特率、数据位、停止位、校验位等）
-	readTimeout  time.Duration    //一次完全数据包的收取超时
-	writeTimeout time.Duration    //一次完整数据包的发送超时
+	fd            int           //串口文件描述符
+	address       string        //串口文件路径
+	oldTermios    *unix.Termios //终端配置（波特率、数据位、停止位、校验位等）
+	rs485         RS485Config   //RS485配置
+	lockPath      string        //串口锁文件路径，未加锁时为空
+	markParity    bool          //是否解码PARMRK标记
+	parityMarks   []byte        //上次读取末尾不完整的PARMRK标记
+	parityErrors  uint64        //累计的校验和帧错误字节数
+	readTimeout   time.Duration //一次完全数据包的收取超时
+	writeTimeout  time.Duration //一次完整数据包的发送超时
+	maxReadSize   int           //单次读取的最大报文长度
+	maxWriteSize  int           //单次发送的最大报文长度
+	frameGap      time.Duration //帧间隔，收到数据后线路静默该时长即返回
+	carrierDetect bool          //是否检测载波
+	verifyEcho    bool          //是否在写后读回本地回显比对
+
+	lineMu   sync.Mutex    //保护lineWake和lineErr
+	lineWake chan struct{} //控制线变化或串口关闭时close，后台没有等待TIOCMIWAIT的协程时为nil
+	lineErr  error         //后台协程等待TIOCMIWAIT失败的原因
 }
 
 //RS485相关常量
@@ -30,9 +46,14 @@ const (
 	rs485RTSOnSend    = 1 << 1
 	rs485RTSAfterSend = 1 << 2
 	rs485RXDuringTX   = 1 << 4
-	rs485Tiocs        = 0x542f
 )
 
+//等待载波时查询DCD的间隔
+const carrierPollInterval = 100 * time.Millisecond
+
+//有IO事件但读不到数据，开启载波检测时表示对端挂断
+var errReadNoData = errors.New("serial: read no data")
+
 //RS485驱动配置
 type rs485_ioctl_opts struct {
 	flags                 uint32
@@ -41,6 +62,15 @@ type rs485_ioctl_opts struct {
 	padding               [5]uint32
 }
 
+//驱动统计的串口计数（serial_icounter_struct），前四项为控制线的变化次数
+type serial_icounter struct {
+	cts, dsr, rng, dcd          int32
+	rx, tx                      int32
+	frame, overrun, parity, brk int32
+	buf_overrun                 int32
+	reserved                    [9]int32
+}
+
 //创建serial
 func newSerial() EndPoint {
 	return &serial{fd: -1}
@@ -59,8 +89,7 @@ func (p *serial) Open(config EndPointConfig) (err error) {
 	case nil:
 	case syscall.EINTR:
 		// Recurse because this is a recoverable error.
-		p.Open(config)
-		return
+		return p.Open(config)
 	case syscall.ENFILE, syscall.EMFILE:
 		err = fmt.Errorf("serial: open serial %v: %v (too many file opened)", c.Address, err)
 		return
@@ -69,38 +98,91 @@ func (p *serial) Open(config EndPointConfig) (err error) {
 		return
 	}
 
+	//串口互斥
+	if c.LockFile {
+		if p.lockPath, err = lockSerial(c.Address); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			return
+		}
+	}
+	if c.Exclusive {
+		if err = unix.IoctlSetInt(p.fd, unix.TIOCEXCL, 0); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			unlockSerial(p.lockPath)
+			p.lockPath = ""
+			err = fmt.Errorf("serial: could not set exclusive mode on %v: %v", c.Address, err)
+			return
+		}
+	}
+
 	termios, err := newTermios(c)
 	if err != nil {
+		syscall.Close(p.fd)
+		p.fd = -1
+		unlockSerial(p.lockPath)
+		p.lockPath = ""
 		return
 	}
 
 	//备份终端配置，使得关闭时可还原配置
 	p.backupTermios()
-	if err = p.setTermios(termios); err != nil {
+	if err = p.setTermios(termios); err == nil {
+		//回读确认原始模式或行模式已生效，避免沿用上一个使用者的加工模式破坏二进制协议
+		err = p.verifyTermios(termios)
+	}
+	if err != nil {
 		//设置失败，无需还原终端配置
 		syscall.Close(p.fd)
 		p.fd = -1
 		p.oldTermios = nil
+		unlockSerial(p.lockPath)
+		p.lockPath = ""
 		return err
 	}
 
 	//设置RS485配置
-	if err = enableRS485(p.fd, &c.RS485); err != nil {
+	p.rs485 = c.RS485
+	if c.RS485.Enabled && c.RS485.SoftwareRTS {
+		//软件控制方向，空闲时RTS处于发送后的电平
+		err = setModemLine(p.fd, LineRTS, c.RS485.RtsHighAfterSend)
+	} else if err = enableRS485(p.fd, &c.RS485); err == nil && c.RS485.Enabled {
+		//回读驱动实际接受的配置，部分驱动会静默忽略不支持的标志
+		var rs485 RS485Config
+		if rs485, err = p.RS485(); err == nil {
+			if rs485 != c.RS485 {
+				log.Printf("serial: rs485 settings partially applied on %v: requested %+v, effective %+v\n",
+					c.Address, c.RS485, rs485)
+			}
+			p.rs485 = rs485
+		}
+	}
+	if err != nil {
 		p.Close()
 		return err
 	}
 
-	//设置读写超时
-	if c.ReadTimeout > 0 {
-		p.readTimeout = c.ReadTimeout
-	} else {
-		p.readTimeout = 5000 * time.Millisecond //默认读超时5000ms
-	}
-	if c.WriteTimeout > 0 {
-		p.writeTimeout = c.WriteTimeout
-	} else {
-		p.writeTimeout = 1000 * time.Millisecond //默认写超时1000ms
+	//等待调制解调器建立载波
+	p.carrierDetect = c.CarrierDetect
+	if c.CarrierDetect {
+		if err = p.waitCarrier(c.CarrierTimeout); err != nil {
+			p.Close()
+			return err
+		}
 	}
+
+	//设置读写超时，未配置时使用默认值
+	p.readTimeout, p.writeTimeout = defaultTimeouts(EndPointSerial, c.ReadTimeout, c.WriteTimeout)
+
+	//设置报文长度限制
+	p.maxReadSize = c.MaxReadSize
+	p.maxWriteSize = c.MaxWriteSize
+
+	p.markParity = c.MarkParity && c.Parity != PARITY_NONE
+	p.parityMarks = nil
+	p.frameGap = c.InterFrameGap
+	p.verifyEcho = c.VerifyEcho
 	return
 }
 
@@ -115,66 +197,213 @@ func (p *serial) Close() (err error) {
 		return
 	}
 	p.restoreTermios() //还原终端配置
+	p.lineMu.Lock()
+	if p.lineWake != nil { //唤醒WaitForLineChange，后台协程在下一次控制线变化时退出
+		close(p.lineWake)
+		p.lineWake = nil
+	}
+	p.lineErr = nil
 	err = syscall.Close(p.fd)
 	p.fd = -1
+	p.lineMu.Unlock()
 	p.oldTermios = nil
+	unlockSerial(p.lockPath)
+	p.lockPath = ""
 	return
 }
 
-//读取串口，直到所有数据收完或者超时
+//读取串口，报文超过长度限制时返回FrameSizeError，开启MarkParity且收到错误字节时返回ParityError
 func (p *serial) Read(b []byte) (n int, err error) {
-	var rfds syscall.FdSet
-	var readLen, nFd int
+	b = limitReadBuffer(b, p.maxReadSize)
+	if n, err = p.read(b); err != nil {
+		err = p.checkCarrier(err)
+		return
+	}
+
+	var offsets []int
+	if p.markParity {
+		n, offsets = p.decodeParityMarks(b, n)
+	}
+	if n, err = checkReadSize("serial", n, p.maxReadSize); err == nil && len(offsets) > 0 {
+		p.parityErrors += uint64(len(offsets))
+		err = &ParityError{Offsets: offsets}
+	}
+	return
+}
+
+//返回累计的校验和帧错误字节数
+func (p *serial) ParityErrors() uint64 {
+	return p.parityErrors
+}
+
+//就地解码PARMRK标记：0xFF 0xFF表示数据0xFF，0xFF 0x00 X表示X有校验或帧错误。
+//末尾不完整的标记保留到下次读取，返回解码后的长度和错误字节的位置
+func (p *serial) decodeParityMarks(b []byte, n int) (out int, offsets []int) {
+	src := make([]byte, 0, len(p.parityMarks)+n)
+	src = append(append(src, p.parityMarks...), b[:n]...)
+	p.parityMarks = nil
+
+	for i := 0; i < len(src); {
+		if src[i] != 0xFF {
+			b[out] = src[i]
+			out++
+			i++
+			continue
+		}
+
+		if i+1 >= len(src) { //标记不完整
+			p.parityMarks = append(p.parityMarks, src[i:]...)
+			return
+		}
+		switch src[i+1] {
+		case 0xFF: //数据0xFF
+			b[out] = 0xFF
+			out++
+			i += 2
+		case 0x00: //错误字节
+			if i+2 >= len(src) { //标记不完整
+				p.parityMarks = append(p.parityMarks, src[i:]...)
+				return
+			}
+			offsets = append(offsets, out)
+			b[out] = src[i+2]
+			out++
+			i += 3
+		default: //非法标记，按错误字节处理
+			offsets = append(offsets, out)
+			b[out] = src[i+1]
+			out++
+			i += 2
+		}
+	}
+
+	return
+}
+
+//读取串口，直到所有数据收完或者超时
+func (p *serial) read(b []byte) (n int, err error) {
+	var readLen int
 	var hasData bool
 
 	fd := p.fd
 	expireTime := time.Now().Add(p.readTimeout)
 
 	for { //如遇到EINTR（Interrupted system call）错误，重试
+		if readLen == len(b) { //缓冲区已满
+			return readLen, nil
+		}
+
 		remainTime := expireTime.Sub(time.Now())
 		if remainTime <= 0 { //超时
-			err = fmt.Errorf("serial: select timeout: %v", p.readTimeout)
+			err = &TimeoutError{Op: "serial", Duration: p.readTimeout}
 			return
 		}
 
-		fdzero(&rfds)
-		fdset(fd, &rfds)
-		timeout := syscall.NsecToTimeval(remainTime.Nanoseconds()) //设置select超时时间
-		nFd, err = syscall.Select(fd+1, &rfds, nil, nil, &timeout)
-		if err == nil {
-			if nFd == 0 || !fdisset(fd, &rfds) {
-				if hasData { //之前读到数据，此处无法判断数据包是否完整，交给上层判断
-					return readLen, nil
-				} else { //超时
-					err = fmt.Errorf("serial: select timeout: %v", p.readTimeout)
-					return
-				}
+		//收到数据后只等待一个帧间隔，线路静默即认为帧结束
+		if hasData && p.frameGap > 0 && p.frameGap < remainTime {
+			remainTime = p.frameGap
+		}
+
+		//使用poll等待，文件句柄不受FD_SETSIZE限制
+		if err = waitFd(fd, false, remainTime); err == errWaitTimeout {
+			if hasData { //之前读到数据，此处无法判断数据包是否完整，交给上层判断
+				return readLen, nil
 			}
+			err = &TimeoutError{Op: "serial", Duration: p.readTimeout}
+			return
+		} else if err != nil { //监听串口失败
+			err = fmt.Errorf("serial: could not poll: %v", err)
+			return
+		}
 
-			n, err = syscall.Read(fd, b[readLen:])
-			if err == nil {
-				if n > 0 { //读取数据，继续监听串口，是否还有后续数据
-					hasData = true
-					readLen += n
-				} else { //有IO事件但读不到数据，异常
-					err = fmt.Errorf("serial: read no data")
-					return
-				}
-			} else if err != syscall.EINTR { //读失败
-				err = fmt.Errorf("serial: could not read: %v", err)
+		n, err = syscall.Read(fd, b[readLen:])
+		if err == nil {
+			if n > 0 { //读取数据，继续监听串口，是否还有后续数据
+				hasData = true
+				readLen += n
+			} else { //有IO事件但读不到数据，异常
+				err = errReadNoData
 				return
 			}
-		} else if err != syscall.EINTR { //监听串口失败
-			err = fmt.Errorf("serial: could not select: %v", err)
+		} else if err != syscall.EINTR { //读失败
+			err = fmt.Errorf("serial: could not read: %w", err)
 			return
 		}
 	}
 }
 
-//写串口，直到所有数据发完或者超时
+//写串口，报文超过长度限制时返回FrameSizeError，开启VerifyEcho时读回本地回显，不一致时返回ErrCollision
 func (p *serial) Write(b []byte) (n int, err error) {
-	var writeLen, nFd int
-	var wfds syscall.FdSet
+	defer func() {
+		err = p.checkCarrier(err)
+	}()
+
+	if err = checkWriteSize("serial", len(b), p.maxWriteSize); err != nil {
+		return
+	}
+	if n, err = p.writeFrame(b); err == nil && p.verifyEcho {
+		err = p.checkEcho(b[:n])
+	}
+	return
+}
+
+//发送一帧，软件控制RS485方向时在发送前后切换RTS
+func (p *serial) writeFrame(b []byte) (int, error) {
+	return p.sendWindow(func() (int, error) {
+		return p.write(b)
+	})
+}
+
+//在一个发送窗口内执行send，软件控制RS485方向时在窗口前后切换RTS
+func (p *serial) sendWindow(send func() (int, error)) (n int, err error) {
+	if !p.rs485.Enabled || !p.rs485.SoftwareRTS {
+		return send()
+	}
+
+	//发送前切换RTS并等待收发器稳定
+	if err = setModemLine(p.fd, LineRTS, p.rs485.RtsHighDuringSend); err != nil {
+		return
+	}
+	time.Sleep(time.Duration(p.rs485.DelayRtsBeforeSend) * time.Millisecond)
+
+	n, err = send()
+	if err == nil {
+		//等待数据全部移出UART后再切回接收
+		err = tcdrain(p.fd)
+	}
+	time.Sleep(time.Duration(p.rs485.DelayRtsAfterSend) * time.Millisecond)
+
+	if e := setModemLine(p.fd, LineRTS, p.rs485.RtsHighAfterSend); e != nil && err == nil {
+		err = e
+	}
+	return
+}
+
+//在写超时内读回本地回显（2线RS485需开启RxDuringTx）并与发送的数据比对，
+//回显缺失或不一致说明总线上发生了冲突
+func (p *serial) checkEcho(sent []byte) error {
+	readTimeout, frameGap := p.readTimeout, p.frameGap
+	p.readTimeout, p.frameGap = p.writeTimeout, 0
+	defer func() {
+		p.readTimeout, p.frameGap = readTimeout, frameGap
+	}()
+
+	echo := make([]byte, len(sent))
+	n, err := p.read(echo)
+	if IsTimeout(err) {
+		return fmt.Errorf("%w: echo %v of %v bytes", ErrCollision, n, len(sent))
+	} else if err != nil {
+		return err
+	}
+	if !bytes.Equal(echo[:n], sent) {
+		return fmt.Errorf("%w: wrote % x, echo % x", ErrCollision, sent, echo[:n])
+	}
+	return nil
+}
+
+//写串口，直到所有数据发完或者超时
+func (p *serial) write(b []byte) (n int, err error) {
+	var writeLen int
 
 	expireTime := time.Now().Add(p.writeTimeout)
 	bLen := len(b)
@@ -191,31 +420,21 @@ func (p *serial) Write(b []byte) (n int, err error) {
 				return
 			}
 
-			for { //没发完数据，等IO可写，继续发送
-				remainTime := expireTime.Sub(time.Now())
-				if remainTime <= 0 { //超时
-					err = fmt.Errorf("serial: select timeout: %v", p.writeTimeout)
-					return
-				}
-
-				fdzero(&wfds)
-				fdset(fd, &wfds)
-				timeout := syscall.NsecToTimeval(remainTime.Nanoseconds()) //设置select超时时间
-				nFd, err = syscall.Select(fd+1, nil, &wfds, nil, &timeout)
-				if err == nil {
-					if nFd == 0 || !fdisset(fd, &wfds) { //超时
-						err = fmt.Errorf("serial: select timeout: %v", p.writeTimeout)
-						return
-					}
-
-					break //发送后续数据
-				} else if err != syscall.EINTR { //监听串口失败
-					err = fmt.Errorf("serial: could not select: %v", err)
-					return
-				}
+			//没发完数据，等IO可写，继续发送
+			remainTime := expireTime.Sub(time.Now())
+			if remainTime <= 0 { //超时
+				err = &TimeoutError{Op: "serial", Duration: p.writeTimeout}
+				return
+			}
+			if err = waitFd(fd, true, remainTime); err == errWaitTimeout {
+				err = &TimeoutError{Op: "serial", Duration: p.writeTimeout}
+				return
+			} else if err != nil { //监听串口失败
+				err = fmt.Errorf("serial: could not poll: %v", err)
+				return
 			}
 		} else { //写失败
-			err = fmt.Errorf("serial: could not write: %v", err)
+			err = fmt.Errorf("serial: could not write: %w", err)
 			return
 		}
 	}
@@ -228,16 +447,40 @@ func (p *serial) Fd() int {
 
 //清理串口的IO缓冲区
 func (p *serial) Flush() error {
-	const TCFLSH = 0x540B
-	r, _, errno := syscall.Syscall(uintptr(syscall.SYS_IOCTL),
-		uintptr(p.fd), uintptr(TCFLSH), uintptr(syscall.TCIOFLUSH))
-	if errno != 0 {
-		return os.NewSyscallError("SYS_IOCTL (TCFLSH)", errno)
+	return tcflush(p.fd, unix.TCIOFLUSH)
+}
+
+//丢弃已收到但未读取的数据，保留待发送的数据
+func (p *serial) FlushInput() error {
+	return tcflush(p.fd, unix.TCIFLUSH)
+}
+
+//丢弃已写入但未发送的数据，保留已收到的数据
+func (p *serial) FlushOutput() error {
+	return tcflush(p.fd, unix.TCOFLUSH)
+}
+
+//阻塞直到已写入的数据全部从UART发出
+func (p *serial) Drain() error {
+	return tcdrain(p.fd)
+}
+
+//返回输入缓冲区中已收到但未读取的字节数
+func (p *serial) InputWaiting() (int, error) {
+	n, err := unix.IoctlGetInt(p.fd, unix.TIOCINQ)
+	if err != nil {
+		return 0, fmt.Errorf("serial: could not get input queue size: %v", err)
 	}
-	if r != 0 {
-		return errors.New("serial: unknown error from SYS_IOCTL (TCFLSH)")
+	return n, nil
+}
+
+//返回输出缓冲区中已写入但未发送的字节数
+func (p *serial) OutputPending() (int, error) {
+	n, err := unix.IoctlGetInt(p.fd, unix.TIOCOUTQ)
+	if err != nil {
+		return 0, fmt.Errorf("serial: could not get output queue size: %v", err)
 	}
-	return nil
+	return n, nil
 }
 
 //返回串口网络地址
@@ -263,17 +506,308 @@ func (p *serial) WriteTimeout() time.Duration {
 	return p.writeTimeout
 }
 
+//修改读超时
+func (p *serial) SetReadTimeout(d time.Duration) {
+	p.readTimeout = d
+}
+
+//修改写超时
+func (p *serial) SetWriteTimeout(d time.Duration) {
+	p.writeTimeout = d
+}
+
+//返回调制解调器控制线状态
+func (p *serial) ModemStatus() (ModemLine, error) {
+	v, err := unix.IoctlGetInt(p.fd, unix.TIOCMGET)
+	if err != nil {
+		return 0, fmt.Errorf("serial: could not get modem status: %v", err)
+	}
+	return ModemLine(v), nil
+}
+
+//阻塞直到mask中任一控制线（DCD、CTS、DSR、RI）发生变化，返回变化后的控制线状态。
+//timeout为0表示一直等待，超时返回TimeoutError。由后台协程阻塞在TIOCMIWAIT中等待变化，
+//唤醒后通过驱动的变化计数（TIOCGICOUNT）判断变化的是否为mask中的控制线，驱动不支持计数时比较控制线状态
+func (p *serial) WaitForLineChange(mask ModemLine, timeout time.Duration) (ModemLine, error) {
+	var expire <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expire = timer.C
+	}
+
+	for {
+		wake, err := p.lineWaiter()
+		if err != nil {
+			return 0, fmt.Errorf("serial: could not wait line change: %v", err)
+		}
+		count, err := getICount(p.fd)
+		var status ModemLine
+		if err != nil {
+			if status, err = p.ModemStatus(); err != nil {
+				return 0, fmt.Errorf("serial: could not wait line change: %v", err)
+			}
+		}
+
+		select {
+		case <-wake:
+		case <-expire:
+			return 0, &TimeoutError{Op: "serial", Duration: timeout}
+		}
+
+		if count != nil {
+			if c, err := getICount(p.fd); err == nil && !count.changed(c, mask) {
+				continue
+			}
+			return p.ModemStatus()
+		}
+		s, err := p.ModemStatus()
+		if err != nil {
+			return 0, fmt.Errorf("serial: could not wait line change: %v", err)
+		}
+		if (s^status)&mask != 0 {
+			return s, nil
+		}
+	}
+}
+
+//返回控制线下一次变化时关闭的通道，需要时启动等待TIOCMIWAIT的后台协程。
+//TIOCMIWAIT无法取消，每个串口最多只有一个这样的协程，超时返回的调用不会遗留协程，之后的调用继续使用它
+func (p *serial) lineWaiter() (<-chan struct{}, error) {
+	p.lineMu.Lock()
+	defer p.lineMu.Unlock()
+
+	if err := p.lineErr; err != nil {
+		p.lineErr = nil
+		return nil, err
+	}
+	if p.fd == -1 {
+		return nil, fmt.Errorf("%v is not open", p.address)
+	}
+	if p.lineWake == nil {
+		p.lineWake = make(chan struct{})
+		go p.waitLines(p.fd, p.lineWake)
+	}
+	return p.lineWake, nil
+}
+
+//在后台等待任一控制线变化并通知等待者。串口关闭后在下一次变化时退出，不再使用fd
+func (p *serial) waitLines(fd int, wake chan struct{}) {
+	for {
+		err := unix.IoctlSetInt(fd, unix.TIOCMIWAIT, int(LineDCD|LineCTS|LineDSR|LineRI))
+		if err == syscall.EINTR {
+			continue
+		}
+
+		p.lineMu.Lock()
+		if p.lineWake != wake { //串口已关闭，Close已通知等待者
+			p.lineMu.Unlock()
+			return
+		}
+		close(wake)
+		if err != nil {
+			p.lineWake, p.lineErr = nil, os.NewSyscallError("SYS_IOCTL (MIWAIT)", err)
+			p.lineMu.Unlock()
+			return
+		}
+		wake = make(chan struct{})
+		p.lineWake = wake
+		p.lineMu.Unlock()
+	}
+}
+
+//判断mask中的控制线在c中的变化计数是否与old不同
+func (old *serial_icounter) changed(c *serial_icounter, mask ModemLine) bool {
+	return (mask&LineCTS != 0 && c.cts != old.cts) ||
+		(mask&LineDSR != 0 && c.dsr != old.dsr) ||
+		(mask&LineRI != 0 && c.rng != old.rng) ||
+		(mask&LineDCD != 0 && c.dcd != old.dcd)
+}
+
+//返回驱动实际生效的RS485配置，软件控制方向时返回打开时的配置
+func (p *serial) RS485() (RS485Config, error) {
+	if p.rs485.SoftwareRTS || !p.rs485.Enabled {
+		return p.rs485, nil
+	}
+
+	c, err := getRS485(p.fd)
+	if err != nil {
+		return RS485Config{}, err
+	}
+	return *c, nil
+}
+
+//在已打开的串口上重新设置波特率、数据位、停止位、校验位和读写超时，缓冲区中的数据不会丢失。
+//串口路径、RS485和独占配置不会重新设置，需要修改时应重新打开串口
+func (p *serial) SetConfig(c *SerialConfig) error {
+	if p.fd == -1 {
+		return fmt.Errorf("serial: %v is not open", p.address)
+	}
+
+	termios, err := newTermios(c)
+	if err != nil {
+		return err
+	}
+	if err = p.setTermios(termios); err != nil {
+		return err
+	}
+	if err = p.verifyTermios(termios); err != nil {
+		return err
+	}
+
+	if c.ReadTimeout > 0 {
+		p.readTimeout = c.ReadTimeout
+	}
+	if c.WriteTimeout > 0 {
+		p.writeTimeout = c.WriteTimeout
+	}
+	p.maxReadSize = c.MaxReadSize
+	p.maxWriteSize = c.MaxWriteSize
+	p.markParity = c.MarkParity && c.Parity != PARITY_NONE
+	p.parityMarks = nil
+	p.frameGap = c.InterFrameGap
+	p.verifyEcho = c.VerifyEcho
+	p.carrierDetect = c.CarrierDetect
+
+	return nil
+}
+
+//多机通信（9位模式）：地址字节以MARK校验发送，数据以SPACE校验发送，从机据此区分地址和数据。
+//地址和数据在同一个发送窗口内发出，RTS只切换一次，长度检查和回显校验针对整帧各做一次。
+//发送完成后恢复原校验配置，返回发送的数据字节数（不含地址）
+func (p *serial) WriteAddressed(addr byte, data []byte) (n int, err error) {
+	defer func() {
+		err = p.checkCarrier(err)
+	}()
+
+	if err = checkWriteSize("serial", 1+len(data), p.maxWriteSize); err != nil {
+		return
+	}
+
+	termios := &unix.Termios{}
+	if err = tcgetattr(p.fd, termios); err != nil {
+		return 0, fmt.Errorf("serial: could not get setting: %v", err)
+	}
+	saved := *termios
+	defer func() {
+		if e := p.setTermios(&saved); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	n, err = p.sendWindow(func() (int, error) {
+		//地址字节：MARK校验
+		termios.Cflag |= unix.PARENB | unix.PARODD | unix.CMSPAR
+		if err := p.setTermios(termios); err != nil {
+			return 0, err
+		}
+		if _, err := p.write([]byte{addr}); err != nil {
+			return 0, err
+		}
+		//切换校验前须等待地址字节发完
+		if err := tcdrain(p.fd); err != nil {
+			return 0, err
+		}
+
+		//数据字节：SPACE校验，恢复校验配置前须等待数据发完
+		termios.Cflag &^= unix.PARODD
+		if err := p.setTermios(termios); err != nil {
+			return 0, err
+		}
+		n, err := p.write(data)
+		if err != nil {
+			return n, err
+		}
+		return n, tcdrain(p.fd)
+	})
+	if err == nil && p.verifyEcho {
+		err = p.checkEcho(append([]byte{addr}, data[:n]...))
+	}
+	return
+}
+
+//发送持续d的BREAK信号，发送前等待已写入的数据发出，d<=0时使用系统默认时长
+func (p *serial) SendBreak(d time.Duration) error {
+	if p.fd == -1 {
+		return fmt.Errorf("serial: not open")
+	}
+	if err := tcdrain(p.fd); err != nil {
+		return err
+	}
+	return sendBreak(p.fd, d)
+}
+
+//等待DCD有效，timeout<=0表示一直等待
+func (p *serial) waitCarrier(timeout time.Duration) error {
+	expireTime := time.Now().Add(timeout)
+	for {
+		status, err := p.ModemStatus()
+		if err != nil {
+			return err
+		}
+		if status&LineDCD != 0 {
+			return nil
+		}
+		if timeout > 0 && time.Now().After(expireTime) {
+			return fmt.Errorf("serial: wait carrier on %v timeout: %v", p.address, timeout)
+		}
+		time.Sleep(carrierPollInterval)
+	}
+}
+
+//开启载波检测时，把挂断导致的EIO和读不到数据转换为ErrCarrierLost
+func (p *serial) checkCarrier(err error) error {
+	if !p.carrierDetect || err == nil {
+		return err
+	}
+	if err == errReadNoData || errors.Is(err, syscall.EIO) {
+		return ErrCarrierLost
+	}
+	return err
+}
+
 //设置终端配置
-func (p *serial) setTermios(termios *syscall.Termios) (err error) {
+func (p *serial) setTermios(termios *unix.Termios) (err error) {
 	if err = tcsetattr(p.fd, termios); err != nil {
 		err = fmt.Errorf("serial: could not set setting: %v", err)
 	}
 	return
 }
 
+//切换行模式和原始模式，不影响波特率等其他配置
+func (p *serial) SetCanonical(on bool) error {
+	if p.fd == -1 {
+		return fmt.Errorf("serial: %v is not open", p.address)
+	}
+
+	termios := &unix.Termios{}
+	if err := tcgetattr(p.fd, termios); err != nil {
+		return fmt.Errorf("serial: could not get setting: %v", err)
+	}
+	setLineMode(termios, on)
+	if err := p.setTermios(termios); err != nil {
+		return err
+	}
+	return p.verifyTermios(termios)
+}
+
+//回读终端配置，确认输出处理和行模式相关的标志与设置的一致
+func (p *serial) verifyTermios(want *unix.Termios) error {
+	got := &unix.Termios{}
+	if err := tcgetattr(p.fd, got); err != nil {
+		return fmt.Errorf("serial: could not get setting: %v", err)
+	}
+
+	const lflags = unix.ICANON | unix.ECHO | unix.ISIG
+	if got.Oflag&unix.OPOST != want.Oflag&unix.OPOST || got.Lflag&lflags != want.Lflag&lflags {
+		return fmt.Errorf("serial: %v did not apply line mode: oflag %#o lflag %#o", p.address, got.Oflag, got.Lflag)
+	}
+	return nil
+}
+
 //备份终端配置
 func (p *serial) backupTermios() {
-	oldTermios := &syscall.Termios{}
+	oldTermios := &unix.Termios{}
 	if err := tcgetattr(p.fd, oldTermios); err != nil {
 		// Warning only.
 		log.Printf("serial: could not get setting: %v\n", err)
@@ -297,11 +831,14 @@ func (p *serial) restoreTermios() {
 }
 
 //创建终端配置
-func newTermios(c *SerialConfig) (termios *syscall.Termios, err error) {
+func newTermios(c *SerialConfig) (termios *unix.Termios, err error) {
 	var ok bool
-	termios = &syscall.Termios{}
+	termios = &unix.Termios{}
 	flag := termios.Cflag
 
+	//原始模式或行模式
+	setLineMode(termios, c.Canonical)
+
 	//波特率
 	flag, ok = baudRates[c.BaudRate]
 	if !ok {
@@ -320,17 +857,26 @@ func newTermios(c *SerialConfig) (termios *syscall.Termios, err error) {
 		err = fmt.Errorf("serial: unsupported character size %v", c.DataBits)
 		return
 	}
-	termios.Cflag &^= syscall.CSIZE
+	termios.Cflag &^= unix.CSIZE
 	termios.Cflag |= flag
 
 	//停止位
 	switch c.StopBits {
 	case 0, 1:
 		// Default is one stop bit.
-		termios.Cflag &^= syscall.CSTOPB
+		termios.Cflag &^= unix.CSTOPB
 	case 2:
 		// CSTOPB: Set two stop bits.
-		termios.Cflag |= syscall.CSTOPB
+		termios.Cflag |= unix.CSTOPB
+	case STOPBITS_1_5:
+		// UARTs derived from the 16550 send 1.5 stop bits when CSTOPB
+		// is combined with a 5 bit character size; with any other size
+		// the hardware would silently send 2 stop bits instead.
+		if c.DataBits != 5 {
+			err = fmt.Errorf("serial: 1.5 stop bits require 5 data bits, got %v", c.DataBits)
+			return
+		}
+		termios.Cflag |= unix.CSTOPB
 	default:
 		err = fmt.Errorf("serial: unsupported stop bits %v", c.StopBits)
 		return
@@ -339,45 +885,87 @@ func newTermios(c *SerialConfig) (termios *syscall.Termios, err error) {
 	//校验位
 	switch c.Parity {
 	case PARITY_NONE:
-		termios.Cflag &^= syscall.PARENB
-		termios.Iflag &^= syscall.INPCK
+		termios.Cflag &^= unix.PARENB
+		termios.Iflag &^= unix.INPCK
 	case PARITY_ODD:
-		termios.Cflag |= syscall.PARENB
-		termios.Cflag |= syscall.PARODD
+		termios.Cflag |= unix.PARENB
+		termios.Cflag |= unix.PARODD
 		termios.Cflag &^= unix.CMSPAR
-		termios.Iflag |= syscall.INPCK
+		termios.Iflag |= unix.INPCK
 	case PARITY_EVEN:
-		termios.Cflag |= syscall.PARENB
-		termios.Cflag &^= syscall.PARODD
+		termios.Cflag |= unix.PARENB
+		termios.Cflag &^= unix.PARODD
 		termios.Cflag &^= unix.CMSPAR
-		termios.Iflag |= syscall.INPCK
+		termios.Iflag |= unix.INPCK
 	case PARITY_MARK:
-		termios.Cflag |= syscall.PARENB
-		termios.Cflag |= syscall.PARODD
+		termios.Cflag |= unix.PARENB
+		termios.Cflag |= unix.PARODD
 		termios.Cflag |= unix.CMSPAR
-		termios.Iflag |= syscall.INPCK
+		termios.Iflag |= unix.INPCK
 	case PARITY_SPACE:
-		termios.Cflag |= syscall.PARENB
-		termios.Cflag &^= syscall.PARODD
+		termios.Cflag |= unix.PARENB
+		termios.Cflag &^= unix.PARODD
 		termios.Cflag |= unix.CMSPAR
-		termios.Iflag |= syscall.INPCK
+		termios.Iflag |= unix.INPCK
 	default:
 		err = fmt.Errorf("serial: unsupported parity %v", c.Parity)
 		return
 	}
 
+	//标记校验错误
+	// PARMRK: Prefix bytes with parity or framing errors with \377 \0.
+	// ISTRIP must be off so that a valid \377 is read as \377 \377.
+	if c.MarkParity && c.Parity != PARITY_NONE {
+		termios.Iflag |= unix.PARMRK
+		termios.Iflag &^= unix.IGNPAR | unix.ISTRIP
+	}
+
 	// Control modes.
 	// CREAD: Enable receiver.
 	// CLOCAL: Ignore control lines.
-	termios.Cflag |= syscall.CREAD | syscall.CLOCAL
+	// HUPCL: Lower modem control lines (hang up) on last close.
+	termios.Cflag |= unix.CREAD
+	if c.CarrierDetect {
+		termios.Cflag |= unix.HUPCL
+	} else {
+		termios.Cflag |= unix.CLOCAL
+	}
 
 	// Special characters.
 	// VMIN: Minimum number of characters for noncanonical read.
 	// VTIME: Time in deciseconds for noncanonical read.
 	// Both are unused as NDELAY is we utilized when opening device.
+
+	//附加修改标志，在标准配置之后应用，可覆盖以上设置
+	termios.Iflag = c.RawIFlag.apply(termios.Iflag)
+	termios.Oflag = c.RawOFlag.apply(termios.Oflag)
+	termios.Cflag = c.RawCFlag.apply(termios.Cflag)
+	termios.Lflag = c.RawLFlag.apply(termios.Lflag)
 	return
 }
 
+//设置原始模式，canonical为true时设置为行模式。
+//两种模式都关闭输出处理、回显、信号字符和软件流控，不沿用串口上一个使用者留下的设置
+func setLineMode(termios *unix.Termios, canonical bool) {
+	// Input modes.
+	// Clear break handling, CR/NL translation and software flow control.
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.ISTRIP | unix.IXON | unix.IXOFF | unix.IXANY
+	// Output modes.
+	// OPOST: Implementation-defined output processing, e.g. NL to CR-NL.
+	termios.Oflag &^= unix.OPOST
+	// Local modes.
+	// ICANON: Line editing; ECHO*: Echo input; ISIG: Generate signals on INTR/QUIT/SUSP.
+	termios.Lflag &^= unix.ICANON | unix.ECHO | unix.ECHOE | unix.ECHOK | unix.ECHONL | unix.ISIG | unix.IEXTEN
+
+	if canonical {
+		// ICRNL: Translate CR to NL so CR-terminated lines are delivered.
+		termios.Iflag |= unix.ICRNL
+		termios.Lflag |= unix.ICANON
+		termios.Cc[unix.VEOF] = 0x04
+		termios.Cc[unix.VEOL] = 0
+	}
+}
+
 //配置RS485
 func enableRS485(fd int, config *RS485Config) error {
 	if !config.Enabled {
@@ -404,7 +992,7 @@ func enableRS485(fd int, config *RS485Config) error {
 	r, _, errno := syscall.Syscall(
 		syscall.SYS_IOCTL,
 		uintptr(fd),
-		uintptr(rs485Tiocs),
+		uintptr(unix.TIOCSRS485),
 		uintptr(unsafe.Pointer(&rs485)))
 	if errno != 0 {
 		return os.NewSyscallError("SYS_IOCTL (RS485)", errno)
@@ -414,3 +1002,44 @@ func enableRS485(fd int, config *RS485Config) error {
 	}
 	return nil
 }
+
+//读取驱动的线路状态变化计数（TIOCGICOUNT）
+func getICount(fd int) (*serial_icounter, error) {
+	var c serial_icounter
+
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		uintptr(fd),
+		uintptr(unix.TIOCGICOUNT),
+		uintptr(unsafe.Pointer(&c)))
+	if errno != 0 {
+		return nil, os.NewSyscallError("SYS_IOCTL (ICOUNT)", errno)
+	}
+	return &c, nil
+}
+
+//读取驱动的RS485配置
+func getRS485(fd int) (*RS485Config, error) {
+	var rs485 rs485_ioctl_opts
+
+	r, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		uintptr(fd),
+		uintptr(unix.TIOCGRS485),
+		uintptr(unsafe.Pointer(&rs485)))
+	if errno != 0 {
+		return nil, os.NewSyscallError("SYS_IOCTL (RS485)", errno)
+	}
+	if r != 0 {
+		return nil, errors.New("serial: unknown error from SYS_IOCTL (RS485)")
+	}
+
+	return &RS485Config{
+		Enabled:            rs485.flags&rs485Enabled != 0,
+		DelayRtsBeforeSend: rs485.delay_rts_before_send,
+		DelayRtsAfterSend:  rs485.delay_rts_after_send,
+		RtsHighDuringSend:  rs485.flags&rs485RTSOnSend != 0,
+		RtsHighAfterSend:   rs485.flags&rs485RTSAfterSend != 0,
+		RxDuringTx:         rs485.flags&rs485RXDuringTX != 0,
+	}, nil
+}
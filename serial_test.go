@@ -0,0 +1,254 @@
+package endpoint
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+//等待控制线变化超时应返回TimeoutError，多次超时共用一个等待TIOCMIWAIT的协程，关闭串口时唤醒等待者。
+//伪终端不支持控制线时跳过
+func TestWaitForLineChangeTimeout(t *testing.T) {
+	master, slave, err := OpenPTY(&SerialConfig{BaudRate: 115200})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+	s := slave.(SerialEndPoint)
+	if _, err = s.ModemStatus(); err != nil {
+		t.Skip(err)
+	}
+
+	const lines = LineCTS | LineDSR | LineDCD | LineRI
+	if _, err = s.WaitForLineChange(lines, 10*time.Millisecond); !IsTimeout(err) {
+		t.Fatalf("WaitForLineChange: got %v, want timeout", err)
+	}
+	before := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		_, err = s.WaitForLineChange(lines, 10*time.Millisecond)
+		if _, ok := err.(*TimeoutError); !ok {
+			t.Fatalf("WaitForLineChange: got %v, want *TimeoutError", err)
+		}
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("goroutines: %v before, %v after", before, after)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.WaitForLineChange(lines, 0)
+		done <- err
+	}()
+	slave.Close()
+	if err = <-done; err == nil {
+		t.Error("WaitForLineChange returned nil after Close")
+	}
+}
+
+//驱动不支持TIOCMIWAIT时返回错误，后台协程随之退出
+func TestWaitForLineChangeUnsupported(t *testing.T) {
+	master, slave, err := OpenPTY(&SerialConfig{BaudRate: 115200})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+	p := slave.(*serial)
+
+	wake, err := p.lineWaiter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-wake
+	if _, err = p.lineWaiter(); err == nil {
+		t.Skip("pty supports TIOCMIWAIT")
+	}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		if _, err = p.WaitForLineChange(LineCTS, 0); err == nil {
+			t.Fatal("WaitForLineChange on pty returned nil error")
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if wake, err = p.lineWaiter(); err == nil {
+			<-wake
+		}
+	}
+	//等待最后一个后台协程返回
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("goroutines: %v before, %v after", before, after)
+	}
+}
+
+//终端残留输出处理、行模式和回显等配置时，打开串口后应切换为原始模式
+func TestSerialOpenClearsLineMode(t *testing.T) {
+	master, slave, err := OpenPTY(&SerialConfig{BaudRate: 115200})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer master.Close()
+	path := slave.(*serial).address
+	slave.Close()
+
+	//模拟其他程序留下的配置
+	fd, err := syscall.Open(path, syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	termios := &unix.Termios{}
+	if err = tcgetattr(fd, termios); err != nil {
+		t.Fatal(err)
+	}
+	termios.Oflag |= unix.OPOST
+	termios.Lflag |= unix.ICANON | unix.ECHO | unix.ISIG
+	if err = tcsetattr(fd, termios); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newSerial()
+	if err = p.Open(&SerialConfig{Address: path, BaudRate: 115200}); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	got := &unix.Termios{}
+	if err = tcgetattr(fd, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Oflag&unix.OPOST != 0 {
+		t.Errorf("OPOST set after Open: oflag %#o", got.Oflag)
+	}
+	for _, f := range []struct {
+		name string
+		flag uint32
+	}{{"ICANON", unix.ICANON}, {"ECHO", unix.ECHO}, {"ISIG", unix.ISIG}} {
+		if got.Lflag&f.flag != 0 {
+			t.Errorf("%v set after Open: lflag %#o", f.name, got.Lflag)
+		}
+	}
+}
+
+//串口读写在文件句柄大于FD_SETSIZE（1024）时仍应正确等待
+func TestSerialHighFd(t *testing.T) {
+	const high = 2002
+	defer raiseFdLimit(t, high)()
+
+	master, slave, err := OpenPTY(&SerialConfig{BaudRate: 115200, ReadTimeout: 30 * time.Millisecond})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+	p := slave.(*serial)
+	moveFd(t, p.fd, high)
+	p.fd = high
+
+	b := make([]byte, 4)
+	if _, err = p.Read(b); !IsTimeout(err) {
+		t.Fatalf("Read on idle port = %v, want timeout", err)
+	}
+	if _, err = master.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := p.Read(b); err != nil || string(b[:n]) != "ping" {
+		t.Fatalf("Read = %q, %v, want ping", b[:n], err)
+	}
+	if _, err = p.Write([]byte("pong")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := master.Read(b); err != nil || string(b[:n]) != "pong" {
+		t.Fatalf("master Read = %q, %v, want pong", b[:n], err)
+	}
+}
+
+//地址和数据作为一帧检查长度并校验回显
+func TestSerialWriteAddressed(t *testing.T) {
+	master, slave, err := OpenPTY(&SerialConfig{BaudRate: 115200, WriteTimeout: time.Second, MaxWriteSize: 4})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+	p := slave.(*serial)
+
+	var fe *FrameSizeError
+	if _, err = p.WriteAddressed(0x81, []byte("abcd")); !errors.As(err, &fe) || fe.Size != 5 {
+		t.Fatalf("WriteAddressed with 1+4 bytes = %v, want FrameSizeError of 5 bytes", err)
+	}
+
+	//对端收到整帧后才回显，地址和数据分开校验回显时会超时
+	p.verifyEcho = true
+	echoed := make(chan []byte, 1)
+	go func() {
+		var got []byte
+		b := make([]byte, 4)
+		for len(got) < 4 {
+			n, err := master.Read(b)
+			if err != nil && !IsTimeout(err) {
+				break
+			}
+			got = append(got, b[:n]...)
+		}
+		master.Write(got)
+		echoed <- got
+	}()
+	if n, err := p.WriteAddressed(0x81, []byte("abc")); n != 3 || err != nil {
+		t.Fatalf("WriteAddressed = %v, %v, want 3, nil", n, err)
+	}
+	if got := <-echoed; string(got) != "\x81abc" {
+		t.Errorf("peer received % x, want 81 61 62 63", got)
+	}
+}
+
+//PARMRK标记的解码，标记被拆分到多次读取时结果不变
+func TestDecodeParityMarks(t *testing.T) {
+	type read struct {
+		in      string //本次从驱动读到的原始数据
+		want    string //解码后的数据
+		offsets []int  //错误字节的位置
+	}
+	tests := []struct {
+		name  string
+		reads []read
+	}{
+		{"plain", []read{{"abc", "abc", nil}}},
+		{"escaped 0xFF", []read{{"a\xff\xffb", "a\xffb", nil}}},
+		{"error byte", []read{{"a\xff\x00xb", "axb", []int{1}}}},
+		{"error zero", []read{{"\xff\x00\x00\xff\x00\xff", "\x00\xff", []int{0, 1}}}},
+		{"trailing 0xFF", []read{{"ab\xff", "ab", nil}, {"\xffc", "\xffc", nil}}},
+		{"trailing 0xFF error", []read{{"ab\xff", "ab", nil}, {"\x00xc", "xc", []int{0}}}},
+		{"trailing 0xFF 0x00", []read{{"ab\xff\x00", "ab", nil}, {"xc", "xc", []int{0}}}},
+		{"marker alone", []read{{"\xff", "", nil}, {"\x00", "", nil}, {"x", "x", []int{0}}}},
+		{"invalid marker", []read{{"a\xffbc", "abc", []int{1}}}},
+		{"escaped then error", []read{{"\xff\xff\xff\x00\xff", "\xff\xff", []int{1}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &serial{}
+			for i, r := range tt.reads {
+				b := append([]byte(r.in), make([]byte, 4)...)
+				n, offsets := p.decodeParityMarks(b, len(r.in))
+				if string(b[:n]) != r.want {
+					t.Errorf("read %v: data = %q, want %q", i, b[:n], r.want)
+				}
+				if len(offsets) != len(r.offsets) || (len(offsets) > 0 && !reflect.DeepEqual(offsets, r.offsets)) {
+					t.Errorf("read %v: offsets = %v, want %v", i, offsets, r.offsets)
+				}
+			}
+			if len(p.parityMarks) != 0 {
+				t.Errorf("incomplete marker % x left after last read", p.parityMarks)
+			}
+		})
+	}
+}
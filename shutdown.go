@@ -0,0 +1,169 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+//Shutdown的关闭阶段，先关闭数据通道，再关闭控制通道
+type ShutdownStage int
+
+const (
+	ShutdownData    ShutdownStage = iota //数据通道，默认阶段
+	ShutdownControl                      //控制通道，在所有数据通道关闭后关闭
+)
+
+//Shutdown的结果
+type ShutdownReport struct {
+	Closed     []string       //按关闭顺序排列的EndPoint名称
+	Pending    map[string]int //截止时仍未完成、被强制中断的操作数，按EndPoint名称
+	LeakedFds  map[string]int //关闭后文件描述符仍然有效的EndPoint及其描述符
+	Goroutines int            //截止时仍未退出的后台协程数（调度器、延迟发送和未完成的批量操作）
+}
+
+//进行中的操作计数，用于Shutdown等待Broadcast、QueryAll等批量操作完成
+type inflight struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} //计数归零时close
+}
+
+func (f *inflight) begin() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.n == 0 {
+		f.idle = make(chan struct{})
+	}
+	f.n++
+}
+
+func (f *inflight) end() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.n--; f.n == 0 {
+		close(f.idle)
+	}
+}
+
+//等待计数归零，ctx结束时返回仍在进行的操作数
+func (f *inflight) wait(ctx context.Context) int {
+	f.mu.Lock()
+	if f.n == 0 {
+		f.mu.Unlock()
+		return 0
+	}
+	idle := f.idle
+	f.mu.Unlock()
+
+	select {
+	case <-idle:
+		return 0
+	case <-ctx.Done():
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.n
+	}
+}
+
+//设置EndPoint在Shutdown中的关闭阶段
+func (m *Manager) SetShutdownStage(name string, stage ShutdownStage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, ok := m.endpoints[name]
+	if !ok {
+		return fmt.Errorf("manager: endpoint %v not found", name)
+	}
+	me.stage = stage
+
+	return nil
+}
+
+//有序关闭所有EndPoint：停止调度器和延迟发送（缓存的报文被丢弃，需要保留时先调用Wake），
+//不持有锁等待所有EndPoint上进行中的Broadcast、QueryAll操作完成，再按阶段（同一阶段内按名称）依次关闭。
+//ctx结束后不再等待，直接关闭并在报告中记录被中断的操作；正在打开的EndPoint在打开完成后立即关闭。
+//不跟踪通过Get取得的EndPoint上直接进行的读写，调用方需在Shutdown前停止这些读写，否则读写返回关闭错误。
+//关闭失败、被中断或受保护而未关闭的EndPoint以*MultiError返回，配置仍保留
+func (m *Manager) Shutdown(ctx context.Context) (*ShutdownReport, error) {
+	report := &ShutdownReport{
+		Pending:   make(map[string]int),
+		LeakedFds: make(map[string]int),
+	}
+
+	//停止后台协程，超过期限时不再等待
+	stopped := make(chan struct{})
+	go func() {
+		m.StopScheduler()
+		m.DisableBatching()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		report.Goroutines++
+	}
+
+	//等待时不持有锁，所有EndPoint共用同一期限，期限到达后其余等待立即返回
+	m.mu.RLock()
+	list := m.sorted()
+	m.mu.RUnlock()
+	pending := make(map[*managedEndPoint]int)
+	for _, me := range list {
+		if n := me.busy.wait(ctx); n > 0 {
+			pending[me] = n
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list = m.sorted()
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].stage < list[j].stage
+	})
+
+	var errs MultiError
+	for _, me := range list {
+		if me.ep == nil && me.opening == nil {
+			continue
+		}
+		if err := me.guarded(GuardClose); err != nil {
+			errs.add(me.name, err)
+			continue
+		}
+		if me.ep == nil {
+			m.close(me) //正在打开，打开完成后关闭
+			continue
+		}
+
+		if n := pending[me]; n > 0 {
+			report.Pending[me.name] = n
+			report.Goroutines += n
+			errs.add(me.name, fmt.Errorf("manager: %v operations on %v interrupted: %w", n, me.name, ctx.Err()))
+		}
+
+		fd := me.raw.Fd()
+		if err := m.close(me); err != nil {
+			errs.add(me.name, err)
+			continue
+		}
+		report.Closed = append(report.Closed, me.name)
+		if fd >= 0 && fdValid(fd) {
+			report.LeakedFds[me.name] = fd
+		}
+	}
+
+	return report, errs.err()
+}
+
+//判断文件描述符是否仍然有效。关闭后描述符可能被其他打开操作复用，结果仅供诊断
+func fdValid(fd int) bool {
+	_, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0)
+	return err == nil
+}
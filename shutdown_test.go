@@ -0,0 +1,83 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+)
+
+//等待进行中的操作时不应持有Manager的锁，且所有EndPoint共用同一期限
+func TestManagerShutdownWaitsOutsideLock(t *testing.T) {
+	m := NewManager()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := m.Add(name, &NullConfig{Address: name}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Open(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//模拟每个EndPoint上都有未完成的批量操作
+	busy := make(map[string]*inflight)
+	m.mu.RLock()
+	for name, me := range m.endpoints {
+		me.busy.begin()
+		busy[name] = &me.busy
+	}
+	m.mu.RUnlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nc := &notifyContext{Context: ctx, done: make(chan struct{}, 16)}
+	type result struct {
+		report *ShutdownReport
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		report, err := m.Shutdown(nc)
+		done <- result{report, err}
+	}()
+
+	//第一次取Done是等待后台协程停止，第二次是开始等待a上的操作
+	<-nc.done
+	<-nc.done
+	m.Names()
+	if m.Get("a") == nil {
+		t.Error("Get(a) = nil while Shutdown is waiting")
+	}
+
+	//a上的操作完成后转而等待b，期限到达后b和c都不再等待
+	busy["a"].end()
+	<-nc.done
+	select {
+	case r := <-done:
+		t.Fatalf("Shutdown returned %v before the deadline", r.err)
+	default:
+	}
+	cancel()
+
+	r := <-done
+	if r.err == nil {
+		t.Error("Shutdown returned nil error with interrupted operations")
+	}
+	for name, want := range map[string]int{"a": 0, "b": 1, "c": 1} {
+		if r.report.Pending[name] != want {
+			t.Errorf("Pending[%v] = %v, want %v", name, r.report.Pending[name], want)
+		}
+		if m.Get(name) != nil {
+			t.Errorf("%v is open after Shutdown", name)
+		}
+	}
+}
+
+//每次取Done时通知测试，用于确认Shutdown已进入等待
+type notifyContext struct {
+	context.Context
+	done chan struct{}
+}
+
+func (c *notifyContext) Done() <-chan struct{} {
+	c.done <- struct{}{}
+	return c.Context.Done()
+}
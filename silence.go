@@ -0,0 +1,128 @@
+package endpoint
+
+import (
+	"sync"
+	"time"
+)
+
+//静默事件，超过设定时长没有收到数据时触发，之后再次收到数据时以Resumed为true再触发一次
+type SilenceEvent struct {
+	Endpoint string        //EndPoint名称
+	LastData time.Time     //最后一次收到数据的时间，未收到过数据时为开始监视的时间
+	Silence  time.Duration //设定的静默时长
+	Resumed  bool          //是否已恢复收到数据
+	Time     time.Time     //触发时间
+}
+
+//静默监视，包装EndPoint统计收到数据的时间。对主动上报的表计，长时间收不到数据是主要的故障信号
+type SilenceMonitor struct {
+	EndPoint
+	name      string             //EndPoint名称
+	silence   time.Duration      //静默时长
+	onSilence func(SilenceEvent) //事件回调，静默事件在定时器协程中调用，恢复事件在读取的协程中调用
+	mu        sync.Mutex
+	timer     *time.Timer //静默定时器
+	lastData  time.Time   //最后一次收到数据的时间
+	silent    bool        //是否处于静默状态
+	stopped   bool        //是否已停止监视
+}
+
+//创建静默监视并立即开始计时，name用于事件中标识EndPoint
+func NewSilenceMonitor(p EndPoint, name string, silence time.Duration, onSilence func(SilenceEvent)) *SilenceMonitor {
+	m := &SilenceMonitor{
+		EndPoint:  p,
+		name:      name,
+		silence:   silence,
+		onSilence: onSilence,
+		lastData:  time.Now(),
+	}
+	m.timer = time.AfterFunc(silence, m.expire)
+
+	return m
+}
+
+//读取数据，收到数据时重新计时
+func (m *SilenceMonitor) Read(b []byte) (n int, err error) {
+	n, err = m.EndPoint.Read(b)
+	if n > 0 {
+		m.received()
+	}
+	return
+}
+
+//返回最后一次收到数据的时间
+func (m *SilenceMonitor) LastData() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.lastData
+}
+
+//停止监视并关闭EndPoint
+func (m *SilenceMonitor) Close() error {
+	m.Stop()
+	return m.EndPoint.Close()
+}
+
+//停止监视，不关闭EndPoint
+func (m *SilenceMonitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stopped = true
+	m.timer.Stop()
+}
+
+//修改底层EndPoint的读超时，底层不支持TimeoutSetter时忽略
+func (m *SilenceMonitor) SetReadTimeout(d time.Duration) {
+	setReadTimeout(m.EndPoint, d)
+}
+
+//修改底层EndPoint的写超时，底层不支持TimeoutSetter时忽略
+func (m *SilenceMonitor) SetWriteTimeout(d time.Duration) {
+	setWriteTimeout(m.EndPoint, d)
+}
+
+//收到数据，恢复时触发事件
+func (m *SilenceMonitor) received() {
+	now := time.Now()
+
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return
+	}
+	resumed := m.silent
+	m.silent = false
+	m.lastData = now
+	m.timer.Reset(m.silence)
+	m.mu.Unlock()
+
+	if resumed {
+		m.emit(SilenceEvent{Endpoint: m.name, LastData: now, Silence: m.silence, Resumed: true, Time: now})
+	}
+}
+
+//定时器到期，期间没有收到数据时触发静默事件
+func (m *SilenceMonitor) expire() {
+	now := time.Now()
+
+	m.mu.Lock()
+	//到期的同时收到数据时定时器已被重置
+	if m.stopped || m.silent || now.Sub(m.lastData) < m.silence {
+		m.mu.Unlock()
+		return
+	}
+	m.silent = true
+	lastData := m.lastData
+	m.mu.Unlock()
+
+	m.emit(SilenceEvent{Endpoint: m.name, LastData: lastData, Silence: m.silence, Time: now})
+}
+
+//调用事件回调
+func (m *SilenceMonitor) emit(ev SilenceEvent) {
+	if m.onSilence != nil {
+		m.onSilence(ev)
+	}
+}
@@ -0,0 +1,256 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+//EndPoint的可用性状态
+type AvailabilityState int
+
+const (
+	AvailabilityClosed AvailabilityState = iota //未打开或已正常关闭，不计入统计
+	AvailabilityUp                              //已打开且未报告故障
+	AvailabilityDown                            //打开失败或已报告故障，直到再次打开成功
+)
+
+func (s AvailabilityState) String() string {
+	switch s {
+	case AvailabilityClosed:
+		return "closed"
+	case AvailabilityUp:
+		return "up"
+	case AvailabilityDown:
+		return "down"
+	default:
+		return "unknown"
+	}
+}
+
+//可用性统计，由Manager根据打开、关闭和故障事件累计
+type Availability struct {
+	Name       string            //EndPoint名称
+	State      AvailabilityState //当前状态
+	Since      time.Time         //统计周期开始时间
+	Uptime     time.Duration     //可用时长
+	Downtime   time.Duration     //故障时长，正常关闭的时间不计入
+	Failures   int               //故障次数（可用转为故障）
+	Recoveries int               //恢复次数（故障后再次打开成功）
+	LastError  string            //最近一次故障的原因
+}
+
+//返回可用率（百分比），没有统计时长时返回100
+func (a *Availability) Percent() float64 {
+	total := a.Uptime + a.Downtime
+	if total <= 0 {
+		return 100
+	}
+	return float64(a.Uptime) * 100 / float64(total)
+}
+
+//返回平均故障间隔时间（MTBF），没有故障时返回0
+func (a *Availability) MTBF() time.Duration {
+	if a.Failures == 0 {
+		return 0
+	}
+	return a.Uptime / time.Duration(a.Failures)
+}
+
+//返回平均修复时间（MTTR），没有恢复时返回0
+func (a *Availability) MTTR() time.Duration {
+	if a.Recoveries == 0 {
+		return 0
+	}
+	return a.Downtime / time.Duration(a.Recoveries)
+}
+
+//可用性报表中的一项，时长以秒为单位
+type availabilityRecord struct {
+	Name       string    `json:"name"`
+	State      string    `json:"state"`
+	Since      time.Time `json:"since"`
+	Until      time.Time `json:"until"`
+	Uptime     float64   `json:"uptime_seconds"`
+	Downtime   float64   `json:"downtime_seconds"`
+	Failures   int       `json:"failures"`
+	Recoveries int       `json:"recoveries"`
+	Percent    float64   `json:"availability_percent"`
+	MTBF       float64   `json:"mtbf_seconds"`
+	MTTR       float64   `json:"mttr_seconds"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+//EndPoint的可用性累计状态
+type slaTracker struct {
+	state      AvailabilityState //当前状态
+	since      time.Time         //统计周期开始时间
+	changed    time.Time         //进入当前状态的时间
+	uptime     time.Duration     //已累计的可用时长，不含当前状态
+	downtime   time.Duration     //已累计的故障时长，不含当前状态
+	failures   int               //故障次数
+	recoveries int               //恢复次数
+	lastError  string            //最近一次故障的原因
+}
+
+//开始新的统计周期，保留当前状态
+func (t *slaTracker) reset(now time.Time) {
+	*t = slaTracker{state: t.state, since: now, changed: now}
+}
+
+//累计当前状态的时长并切换到新状态
+func (t *slaTracker) transition(state AvailabilityState, now time.Time) {
+	t.accumulate(now)
+	switch {
+	case t.state == AvailabilityUp && state == AvailabilityDown:
+		t.failures++
+	case t.state == AvailabilityDown && state == AvailabilityUp:
+		t.recoveries++
+	}
+	t.state = state
+}
+
+//把当前状态持续的时长计入统计
+func (t *slaTracker) accumulate(now time.Time) {
+	d := now.Sub(t.changed)
+	switch t.state {
+	case AvailabilityUp:
+		t.uptime += d
+	case AvailabilityDown:
+		t.downtime += d
+	}
+	t.changed = now
+}
+
+//记录打开结果
+func (t *slaTracker) opened(err error, now time.Time) {
+	if err == nil {
+		t.transition(AvailabilityUp, now)
+		return
+	}
+
+	//未打开时打开失败同样算作一次故障
+	if t.state == AvailabilityClosed {
+		t.failures++
+	}
+	t.transition(AvailabilityDown, now)
+	t.lastError = err.Error()
+}
+
+//记录关闭，故障状态下关闭仍视为故障，直到再次打开成功
+func (t *slaTracker) closed(now time.Time) {
+	if t.state == AvailabilityUp {
+		t.transition(AvailabilityClosed, now)
+	}
+}
+
+//返回截至now的统计
+func (t *slaTracker) snapshot(name string, now time.Time) Availability {
+	a := Availability{
+		Name:       name,
+		State:      t.state,
+		Since:      t.since,
+		Uptime:     t.uptime,
+		Downtime:   t.downtime,
+		Failures:   t.failures,
+		Recoveries: t.recoveries,
+		LastError:  t.lastError,
+	}
+	switch t.state {
+	case AvailabilityUp:
+		a.Uptime += now.Sub(t.changed)
+	case AvailabilityDown:
+		a.Downtime += now.Sub(t.changed)
+	}
+
+	return a
+}
+
+//报告EndPoint发生故障（比如读写出错、设备无应答），EndPoint转为故障状态，
+//直到关闭后再次打开成功时记为恢复
+func (m *Manager) ReportFailure(name string, err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, ok := m.endpoints[name]
+	if !ok {
+		return fmt.Errorf("manager: endpoint %v not found", name)
+	}
+	if me.sla.state == AvailabilityUp {
+		me.sla.transition(AvailabilityDown, time.Now())
+	}
+	if err != nil {
+		me.sla.lastError = err.Error()
+	}
+
+	return nil
+}
+
+//返回指定EndPoint的可用性统计
+func (m *Manager) Availability(name string) (Availability, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	me, ok := m.endpoints[name]
+	if !ok {
+		return Availability{}, fmt.Errorf("manager: endpoint %v not found", name)
+	}
+
+	return me.sla.snapshot(name, time.Now()), nil
+}
+
+//按名称排序返回符合筛选条件的EndPoint的可用性统计，sel为nil时返回全部
+func (m *Manager) AvailabilityAll(sel Selector) []Availability {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var list []Availability
+	for _, me := range m.selected(sel) {
+		list = append(list, me.sla.snapshot(me.name, now))
+	}
+
+	return list
+}
+
+//清零符合筛选条件的EndPoint的可用性统计，开始新的统计周期（比如每月初）
+func (m *Manager) ResetAvailability(sel Selector) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, me := range m.selected(sel) {
+		me.sla.reset(now)
+	}
+}
+
+//导出符合筛选条件的EndPoint的可用性报表（JSON），时长以秒为单位
+func (m *Manager) AvailabilityReport(sel Selector) ([]byte, error) {
+	now := time.Now()
+	list := m.AvailabilityAll(sel)
+
+	records := make([]availabilityRecord, 0, len(list))
+	for _, a := range list {
+		records = append(records, availabilityRecord{
+			Name:       a.Name,
+			State:      a.State.String(),
+			Since:      a.Since,
+			Until:      now,
+			Uptime:     a.Uptime.Seconds(),
+			Downtime:   a.Downtime.Seconds(),
+			Failures:   a.Failures,
+			Recoveries: a.Recoveries,
+			Percent:    a.Percent(),
+			MTBF:       a.MTBF().Seconds(),
+			MTTR:       a.MTTR().Seconds(),
+			LastError:  a.LastError,
+		})
+	}
+
+	b, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("manager: marshal availability: %v", err)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,118 @@
+package endpoint
+
+import (
+	"sync"
+	"time"
+)
+
+//数据方向
+type Direction int
+
+const (
+	DirRX Direction = iota //接收方向（设备到主站）
+	DirTX                  //发送方向（主站到设备）
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirRX:
+		return "RX"
+	case DirTX:
+		return "TX"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+//嗅探事件
+type SniffEvent struct {
+	Time      time.Time //收到数据的时间
+	Direction Direction //数据方向
+	Data      []byte    //收到的数据
+	Err       error     //读取出错时非nil，该方向随后停止监听
+}
+
+//串口嗅探器，用两个只接收的串口分别监听总线的两个方向
+type Sniffer struct {
+	tx     EndPoint        //监听发送方向的串口
+	rx     EndPoint        //监听接收方向的串口
+	events chan SniffEvent //合并后的事件流
+	done   chan struct{}   //关闭时close
+	wg     sync.WaitGroup  //等待监听协程退出
+	once   sync.Once       //保证只关闭一次
+}
+
+//打开两个串口分别监听发送和接收方向，合并为带时间戳和方向标记的事件流，用于被动协议分析
+func Sniff(tx, rx *SerialConfig) (*Sniffer, error) {
+	s := &Sniffer{
+		events: make(chan SniffEvent, 256),
+		done:   make(chan struct{}),
+	}
+
+	var err error
+	if s.tx, err = Open(tx); err != nil {
+		return nil, err
+	}
+	if s.rx, err = Open(rx); err != nil {
+		s.tx.Close()
+		return nil, err
+	}
+
+	s.wg.Add(2)
+	go s.tap(s.tx, DirTX)
+	go s.tap(s.rx, DirRX)
+
+	return s, nil
+}
+
+//返回事件流，嗅探器关闭后事件流被关闭
+func (s *Sniffer) Events() <-chan SniffEvent {
+	return s.events
+}
+
+//停止嗅探并关闭串口
+func (s *Sniffer) Close() (err error) {
+	s.once.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+		err = s.tx.Close()
+		if e := s.rx.Close(); e != nil && err == nil {
+			err = e
+		}
+		close(s.events)
+	})
+	return
+}
+
+//监听一个方向的数据，空闲超时不视为错误
+func (s *Sniffer) tap(p EndPoint, dir Direction) {
+	defer s.wg.Done()
+
+	b := make([]byte, 4096)
+	for {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		n, err := p.Read(b)
+		if IsTimeout(err) {
+			continue
+		}
+
+		ev := SniffEvent{Time: time.Now(), Direction: dir, Err: err}
+		if n > 0 {
+			ev.Data = append([]byte(nil), b[:n]...)
+		}
+
+		select {
+		case s.events <- ev:
+		case <-s.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package endpoint
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+//浸泡测试结束后等待协程退出的最长时间
+const soakSettleTime = 500 * time.Millisecond
+
+//浸泡测试的迭代次数
+const soakIterations = 50
+
+//浸泡测试结果
+type soakReport struct {
+	iterations       int //打开关闭的次数
+	openFailures     int //打开失败的次数
+	fdsBefore        int //测试前进程打开的文件句柄数
+	fdsAfter         int //测试后进程打开的文件句柄数
+	goroutinesBefore int //测试前的协程数
+	goroutinesAfter  int //测试后的协程数
+}
+
+//浸泡测试：按配置反复打开、关闭EndPoint，检查文件句柄和协程是否泄漏。
+//打开失败的情况同样计入，用于覆盖错误路径上的泄漏。存在泄漏时返回错误
+func soak(c EndPointConfig, iterations int) (*soakReport, error) {
+	r := &soakReport{iterations: iterations}
+
+	fds, err := countFds()
+	if err != nil {
+		return nil, err
+	}
+	r.fdsBefore = fds
+	r.goroutinesBefore = runtime.NumGoroutine()
+
+	for i := 0; i < iterations; i++ {
+		p, err := Open(c)
+		if err != nil {
+			r.openFailures++
+			if p == nil {
+				continue
+			}
+		}
+		p.Close()
+		//重复关闭不应关闭其他对象复用的文件句柄
+		p.Close()
+	}
+
+	//等待后台协程退出
+	deadline := time.Now().Add(soakSettleTime)
+	for runtime.NumGoroutine() > r.goroutinesBefore && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if r.fdsAfter, err = countFds(); err != nil {
+		return nil, err
+	}
+	r.goroutinesAfter = runtime.NumGoroutine()
+
+	leakedFds, leakedGoroutines := r.fdsAfter-r.fdsBefore, r.goroutinesAfter-r.goroutinesBefore
+	if leakedFds > 0 || leakedGoroutines > 0 {
+		return r, fmt.Errorf("soak: leaked %v fds and %v goroutines in %v iterations",
+			leakedFds, leakedGoroutines, iterations)
+	}
+
+	return r, nil
+}
+
+//返回当前进程打开的文件句柄数
+func countFds() (int, error) {
+	files, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, fmt.Errorf("soak: read fd dir: %v", err)
+	}
+	return len(files), nil
+}
+
+func TestSoakPTY(t *testing.T) {
+	master, slave, err := OpenPTY(&SerialConfig{BaudRate: 115200})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer master.Close()
+	path := slave.(*serial).address
+	slave.Close()
+
+	r, err := soak(&SerialConfig{Address: path, BaudRate: 115200}, soakIterations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.openFailures != 0 {
+		t.Errorf("%v of %v opens failed", r.openFailures, r.iterations)
+	}
+}
+
+func TestSoakUDP(t *testing.T) {
+	r, err := soak(&UDPConfig{Network: "udp", Address: "127.0.0.1:9", Connected: true}, soakIterations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.openFailures != 0 {
+		t.Errorf("%v of %v opens failed", r.openFailures, r.iterations)
+	}
+}
+
+func TestSoakTCPLoopback(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	//对端立即关闭连接，测试前后不持有额外的文件句柄
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	r, err := soak(&TCPConfig{Network: "tcp", Address: l.Addr().String()}, soakIterations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.openFailures != 0 {
+		t.Errorf("%v of %v opens failed", r.openFailures, r.iterations)
+	}
+}
+
+//打开失败的错误路径同样不应泄漏
+func TestSoakOpenFailure(t *testing.T) {
+	r, err := soak(&TCPConfig{Network: "tcp", Address: refusedTCPAddress(t)}, soakIterations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.openFailures != r.iterations {
+		t.Errorf("%v of %v opens failed, want all", r.openFailures, r.iterations)
+	}
+}
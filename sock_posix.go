@@ -3,8 +3,10 @@
 package endpoint
 
 import (
+	"fmt"
 	"os"
 	"syscall"
+	"time"
 )
 
 func sysSocket(family, sotype, proto int) (int, error) {
@@ -36,3 +38,94 @@ func sysSocket(family, sotype, proto int) (int, error) {
 
 	return s, nil
 }
+
+//连接socket地址，timeout>0时以非阻塞方式连接并等待可写，
+//超过timeout返回TimeoutError，连接失败时返回SO_ERROR中的错误
+func connectTimeout(fd int, sa syscall.Sockaddr, timeout time.Duration) error {
+	if timeout <= 0 {
+		return os.NewSyscallError("connect", syscall.Connect(fd, sa))
+	}
+
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		return os.NewSyscallError("setnonblock", err)
+	}
+	switch err := syscall.Connect(fd, sa); err {
+	case nil, syscall.EISCONN:
+		return nil
+	case syscall.EINPROGRESS, syscall.EALREADY, syscall.EINTR:
+	default:
+		return os.NewSyscallError("connect", err)
+	}
+
+	return waitConnect(fd, timeout)
+}
+
+//等待非阻塞连接完成，timeout<=0表示一直等待，连接失败时返回SO_ERROR中的错误
+func waitConnect(fd int, timeout time.Duration) error {
+	if err := waitFd(fd, true, timeout); err == errWaitTimeout {
+		return &TimeoutError{Op: "connect", Duration: timeout}
+	} else if err != nil {
+		return os.NewSyscallError("select", err)
+	}
+
+	soErr, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_ERROR)
+	if err != nil {
+		return os.NewSyscallError("getsockopt", err)
+	}
+	if soErr != 0 {
+		return os.NewSyscallError("connect", syscall.Errno(soErr))
+	}
+
+	return nil
+}
+
+//设置套接字收发缓冲区大小（SO_RCVBUF/SO_SNDBUF），为0时保持系统默认值。
+//Linux实际分配的大小为设置值的两倍，且受net.core.rmem_max/wmem_max限制
+func setBufferSizes(fd, recv, send int) error {
+	if recv > 0 {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, recv); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if send > 0 {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_SNDBUF, send); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	return nil
+}
+
+//设置DSCP标记（IP_TOS/IPV6_TCLASS的高6位），dscp为0时保持系统默认值
+func setDSCP(fd, family, dscp int) error {
+	if dscp == 0 {
+		return nil
+	}
+	if dscp < 0 || dscp > 63 {
+		return fmt.Errorf("invalid dscp %v", dscp)
+	}
+
+	if family == syscall.AF_INET6 {
+		return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, dscp<<2))
+	}
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_TOS, dscp<<2))
+}
+
+//设置单播和组播报文的TTL（IP_TTL、IP_MULTICAST_TTL）或跳数限制（IPV6_UNICAST_HOPS、IPV6_MULTICAST_HOPS），
+//ttl为0时保持系统默认值
+func setTTL(fd, family, ttl int) error {
+	if ttl == 0 {
+		return nil
+	}
+	if ttl < 0 || ttl > 255 {
+		return fmt.Errorf("invalid ttl %v", ttl)
+	}
+
+	level, unicast, multicast := syscall.IPPROTO_IP, syscall.IP_TTL, syscall.IP_MULTICAST_TTL
+	if family == syscall.AF_INET6 {
+		level, unicast, multicast = syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, syscall.IPV6_MULTICAST_HOPS
+	}
+	if err := syscall.SetsockoptInt(fd, level, unicast, ttl); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, level, multicast, ttl))
+}
@@ -0,0 +1,102 @@
+package endpoint
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+//SysRq使用的BREAK时长
+const sysrqBreakTime = 250 * time.Millisecond
+
+//BREAK之后发送SysRq命令字符前的间隔，内核要求在5秒内收到命令字符
+const sysrqCommandDelay = 100 * time.Millisecond
+
+//中断自动启动时重复发送按键的间隔
+const autobootKeyInterval = 100 * time.Millisecond
+
+//可以发送BREAK信号的EndPoint，串口、调制解调器和RFC2217均支持
+type Breaker interface {
+	SendBreak(d time.Duration) error
+}
+
+//BREAK序列的一个步骤，依次发送BREAK、发送数据、等待，字段为零值时跳过该动作
+type BreakStep struct {
+	Break time.Duration //BREAK时长
+	Send  []byte        //BREAK之后发送的数据
+	Wait  time.Duration //步骤结束后的等待时间
+}
+
+//依次执行BREAK序列，用于bootloader等需要定时BREAK和字符组合的场景
+func SendBreakSequence(p EndPoint, steps []BreakStep) error {
+	b, ok := p.(Breaker)
+	if !ok {
+		return fmt.Errorf("sysrq: %v endpoint does not support break", p.Type())
+	}
+
+	for i, step := range steps {
+		if step.Break > 0 {
+			if err := b.SendBreak(step.Break); err != nil {
+				return fmt.Errorf("sysrq: step %v: %v", i, err)
+			}
+		}
+		if len(step.Send) > 0 {
+			if _, err := p.Write(step.Send); err != nil {
+				return fmt.Errorf("sysrq: step %v: write: %v", i, err)
+			}
+		}
+		if step.Wait > 0 {
+			time.Sleep(step.Wait)
+		}
+	}
+
+	return nil
+}
+
+//通过串口控制台发送Magic SysRq命令（BREAK后跟命令字符），比如'b'重启、's'同步、'u'只读重挂载。
+//目标内核需开启CONFIG_MAGIC_SYSRQ和串口控制台
+func SendSysRq(p EndPoint, cmds ...byte) error {
+	for _, cmd := range cmds {
+		err := SendBreakSequence(p, []BreakStep{
+			{Break: sysrqBreakTime, Wait: sysrqCommandDelay},
+			{Send: []byte{cmd}, Wait: sysrqCommandDelay},
+		})
+		if err != nil {
+			return fmt.Errorf("sysrq: %q: %v", cmd, err)
+		}
+	}
+
+	return nil
+}
+
+//在timeout内每隔100ms发送key，直到收到prompt，用于在倒计时内中断U-Boot等bootloader的自动启动。
+//返回截至prompt（含prompt）收到的数据
+func InterruptAutoboot(p EndPoint, key []byte, prompt *regexp.Regexp, timeout time.Duration) ([]byte, error) {
+	e := NewExpecter(p)
+	expireTime := time.Now().Add(timeout)
+	for {
+		if err := e.SendBytes(key); err != nil {
+			return nil, fmt.Errorf("sysrq: %v", err)
+		}
+
+		wait := expireTime.Sub(time.Now())
+		if wait <= 0 {
+			return nil, fmt.Errorf("sysrq: no prompt: %w", &TimeoutError{Op: "sysrq", Duration: timeout})
+		}
+		if wait > autobootKeyInterval {
+			wait = autobootKeyInterval
+		}
+
+		_, out, err := e.expect(wait, func(data []byte) (int, int) {
+			if loc := prompt.FindIndex(data); loc != nil {
+				return 0, loc[1]
+			}
+			return -1, 0
+		})
+		if err == nil {
+			return out, nil
+		} else if !IsTimeout(err) {
+			return nil, fmt.Errorf("sysrq: %v", err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package endpoint
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//旁路观察到的一个报文
+type TapFrame struct {
+	Endpoint  string       //EndPoint名称
+	Type      EndPointType //EndPoint类型
+	Address   string       //EndPoint地址
+	Direction Direction    //数据方向，Read为RX，Write为TX
+	Time      time.Time    //读写完成的时间
+	Data      []byte       //报文，直接引用读写缓冲区，只在OnFrame调用期间有效，不得修改
+}
+
+//旁路接口，供入侵检测等安全监控模块订阅所有EndPoint实际收发的报文。
+//OnFrame在读写的调用中同步执行，需尽快返回，耗时的分析应使用TapChannel
+type Tap interface {
+	OnFrame(f *TapFrame)
+}
+
+//把报文复制到有缓冲通道的旁路，通道满时丢弃报文并计数，不阻塞读写
+type TapChannel struct {
+	C       chan TapFrame //报文通道
+	dropped uint64        //通道满时丢弃的报文数
+}
+
+//创建缓冲size个报文的旁路通道
+func NewTapChannel(size int) *TapChannel {
+	return &TapChannel{C: make(chan TapFrame, size)}
+}
+
+//复制报文并放入通道，通道满时丢弃
+func (t *TapChannel) OnFrame(f *TapFrame) {
+	c := *f
+	c.Data = append([]byte(nil), f.Data...)
+	select {
+	case t.C <- c:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+//返回通道满时丢弃的报文数
+func (t *TapChannel) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+//旁路订阅者
+type tapEntry struct {
+	tap Tap
+}
+
+//旁路订阅者集合，读写时无锁读取
+type tapSet struct {
+	mu   sync.Mutex   //保护订阅和取消订阅
+	taps atomic.Value //[]*tapEntry
+}
+
+//返回当前订阅者
+func (s *tapSet) load() []*tapEntry {
+	taps, _ := s.taps.Load().([]*tapEntry)
+	return taps
+}
+
+//tapEndPoint把读写的报文交给订阅者
+type tapEndPoint struct {
+	EndPoint
+	name    string  //EndPoint名称
+	address string  //EndPoint地址
+	set     *tapSet //订阅者
+}
+
+//读取数据并交给订阅者
+func (p *tapEndPoint) Read(b []byte) (n int, err error) {
+	if n, err = p.EndPoint.Read(b); n > 0 {
+		p.publish(DirRX, b[:n])
+	}
+	return
+}
+
+//写数据并把实际发出的部分交给订阅者
+func (p *tapEndPoint) Write(b []byte) (n int, err error) {
+	if n, err = p.EndPoint.Write(b); n > 0 {
+		p.publish(DirTX, b[:n])
+	}
+	return
+}
+
+//修改底层EndPoint的读超时，底层不支持TimeoutSetter时忽略
+func (p *tapEndPoint) SetReadTimeout(d time.Duration) {
+	setReadTimeout(p.EndPoint, d)
+}
+
+//修改底层EndPoint的写超时，底层不支持TimeoutSetter时忽略
+func (p *tapEndPoint) SetWriteTimeout(d time.Duration) {
+	setWriteTimeout(p.EndPoint, d)
+}
+
+//依次调用订阅者
+func (p *tapEndPoint) publish(dir Direction, b []byte) {
+	taps := p.set.load()
+	if len(taps) == 0 {
+		return
+	}
+
+	f := &TapFrame{
+		Endpoint:  p.name,
+		Type:      p.Type(),
+		Address:   p.address,
+		Direction: dir,
+		Time:      time.Now(),
+		Data:      b,
+	}
+	for _, e := range taps {
+		e.tap.OnFrame(f)
+	}
+}
+
+//订阅所有EndPoint实际收发的报文（经过只读、白名单等处理后真正读写的数据），
+//包括之后打开的EndPoint，返回取消订阅的函数
+func (m *Manager) Subscribe(t Tap) (cancel func()) {
+	entry := &tapEntry{tap: t}
+	m.taps.mu.Lock()
+	m.taps.taps.Store(append(append([]*tapEntry(nil), m.taps.load()...), entry))
+	m.taps.mu.Unlock()
+	m.rewrap()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.taps.mu.Lock()
+			var rest []*tapEntry
+			for _, e := range m.taps.load() {
+				if e != entry {
+					rest = append(rest, e)
+				}
+			}
+			m.taps.taps.Store(rest)
+			m.taps.mu.Unlock()
+			m.rewrap()
+		})
+	}
+}
+
+//订阅者变化后重新包装所有已打开的EndPoint
+func (m *Manager) rewrap() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, me := range m.endpoints {
+		me.wrap()
+	}
+}
@@ -6,8 +6,13 @@ import (
 	"os"
 	"syscall"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
+//DetectStale查询探测报文确认状态的间隔
+const staleProbeInterval = 5 * time.Millisecond
+
 //tcp实现EndPoint接口
 type tcp struct {
 	fd           int              //套接字文件描述符
@@ -15,6 +20,14 @@ type tcp struct {
 	sockAddr     syscall.Sockaddr //目标TCP的socket地址
 	readTimeout  time.Duration    //一次完全数据包的收取超时
 	writeTimeout time.Duration    //一次完整数据包的发送超时
+	maxReadSize  int              //单次读取的最大报文长度
+	maxWriteSize int              //单次发送的最大报文长度
+	fastOpen     bool             //尚未连接，第一次Write时以TCP Fast Open方式连接
+	dialTimeout  time.Duration    //连接超时，TCP Fast Open时在第一次Write中使用
+	quickAck     bool             //每次读取后重新设置TCP_QUICKACK
+	oobInline    bool             //紧急数据留在普通数据流中
+	onDisconnect func(err error)  //连接被内核断开时的回调
+	watch        *tcpWatch        //等待连接断开的后台监视，未配置回调时为nil
 }
 
 //创建tcp对象
@@ -30,12 +43,97 @@ func (p *tcp) Open(config EndPointConfig) (err error) {
 
 	c := config.(*TCPConfig)
 
-	//解析目标TCP地址
-	if p.sockAddr, family, p.netAddr, err = getTCPSockaddr(c.Network, c.Address); err != nil {
-		err = fmt.Errorf("tcp: getTCPSockaddr %v %v: %v", c.Network, c.Address)
+	//解析目标TCP地址，使用代理时连接代理，NetAddr和SockAddr为代理地址
+	address := c.Address
+	if c.Proxy != "" {
+		if c.FastOpen {
+			err = fmt.Errorf("tcp: fast open is not supported through proxy")
+			return
+		}
+		address = c.Proxy
+	}
+	var addrs []*net.TCPAddr
+	if addrs, err = resolveTCPAddrs(c.Network, address, c.Resolver); err != nil {
+		err = fmt.Errorf("tcp: resolve %v %v: %v", c.Network, address, err)
 		return
 	}
 
+	//依次尝试解析出的每个地址，直到连接成功，返回第一个地址的错误
+	var deadline time.Time
+	if c.DialTimeout > 0 {
+		deadline = time.Now().Add(c.DialTimeout)
+	}
+	var firstErr error
+	for i, addr := range addrs {
+		timeout, ok := dialAttemptTimeout(deadline, len(addrs)-i)
+		if !ok {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("tcp: Connect: %w", &TimeoutError{Op: "connect", Duration: c.DialTimeout})
+			}
+			err = firstErr
+			break
+		}
+		if p.sockAddr, family, p.netAddr, err = getTCPSockaddr(c.Network, addr.String()); err != nil {
+			err = fmt.Errorf("tcp: getTCPSockaddr %v %v: %v", c.Network, addr, err)
+		} else if err = p.dial(c, family, timeout); err == nil {
+			break
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err != nil {
+		err = firstErr
+		return
+	}
+
+	//设置读写超时，未配置时使用默认值
+	p.readTimeout, p.writeTimeout = defaultTimeouts(EndPointTCP, c.ReadTimeout, c.WriteTimeout)
+
+	//通过代理建立隧道，在DialTimeout内完成，未配置DialTimeout时使用读超时
+	if c.Proxy != "" {
+		timeout := c.DialTimeout
+		if timeout <= 0 {
+			timeout = p.readTimeout
+		}
+		if err = httpConnect(p.fd, c.Address, c, timeout); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			err = fmt.Errorf("tcp: proxy CONNECT %v via %v: %w", c.Address, c.Proxy, err)
+			return
+		}
+	}
+
+	//设置报文长度限制
+	p.maxReadSize = c.MaxReadSize
+	p.maxWriteSize = c.MaxWriteSize
+
+	//监视连接断开，TCP Fast Open时在第一次Write连接后开始
+	p.onDisconnect = c.OnDisconnect
+	if !p.fastOpen {
+		if err = p.startWatch(); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			return
+		}
+	}
+
+	return
+}
+
+//配置了OnDisconnect时启动后台监视
+func (p *tcp) startWatch() (err error) {
+	if p.onDisconnect == nil {
+		return nil
+	}
+	if p.watch, err = startTCPWatch(p.fd, p.onDisconnect); err != nil {
+		return fmt.Errorf("tcp: startTCPWatch: %v", err)
+	}
+	return nil
+}
+
+//创建套接字、设置选项并在timeout内连接到p.sockAddr，失败时关闭套接字
+func (p *tcp) dial(c *TCPConfig, family int, timeout time.Duration) (err error) {
 	//创建客户端套接字
 	if p.fd, err = sysSocket(family, syscall.SOCK_STREAM, syscall.IPPROTO_TCP); err != nil {
 		err = fmt.Errorf("tcp: sysSocket: %v", err)
@@ -45,38 +143,129 @@ func (p *tcp) Open(config EndPointConfig) (err error) {
 	//设置NoDelay和KeepAlive选项
 	if err = setNoDelay(p.fd, c.NoDelay); err != nil {
 		syscall.Close(p.fd)
+		p.fd = -1
 		err = fmt.Errorf("tcp: setNoDelay: %v", err)
 		return
 	}
-	if err = setKeepAlive(p.fd, c.KeepAlive); err != nil {
+	idle, interval := c.KeepAliveIdle, c.KeepAliveInterval
+	if idle <= 0 {
+		idle = c.KeepAlive
+	}
+	if interval <= 0 {
+		interval = c.KeepAlive
+	}
+	if err = setKeepAlive(p.fd, idle, interval, c.KeepAliveCount); err != nil {
 		syscall.Close(p.fd)
+		p.fd = -1
 		err = fmt.Errorf("tcp: setKeepAlive: %v", err)
 		return
 	}
+	if err = setUserTimeout(p.fd, c.UserTimeout); err != nil {
+		syscall.Close(p.fd)
+		p.fd = -1
+		err = fmt.Errorf("tcp: setUserTimeout: %v", err)
+		return
+	}
+
+	//紧急数据留在普通数据流中
+	p.oobInline = c.OOBInline
+	if c.OOBInline {
+		if err = syscall.SetsockoptInt(p.fd, syscall.SOL_SOCKET, syscall.SO_OOBINLINE, 1); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			err = fmt.Errorf("tcp: setOOBInline: %v", os.NewSyscallError("setsockopt", err))
+			return
+		}
+	}
+
+	//设置收发缓冲区，需在连接前设置才能影响TCP窗口扩大因子
+	if err = setBufferSizes(p.fd, c.ReceiveBufferSize, c.SendBufferSize); err != nil {
+		syscall.Close(p.fd)
+		p.fd = -1
+		err = fmt.Errorf("tcp: setBufferSizes: %v", err)
+		return
+	}
 
-	//连接TCP地址
-	if err = syscall.Connect(p.fd, p.sockAddr); err != nil {
+	//设置DSCP标记，SYN报文也带有该标记
+	if err = setDSCP(p.fd, family, c.DSCP); err != nil {
 		syscall.Close(p.fd)
-		err = fmt.Errorf("tcp: Connect: %v", os.NewSyscallError("connect", err))
+		p.fd = -1
+		err = fmt.Errorf("tcp: setDSCP: %v", err)
 		return
 	}
 
+	//设置TTL
+	if err = setTTL(p.fd, family, c.TTL); err != nil {
+		syscall.Close(p.fd)
+		p.fd = -1
+		err = fmt.Errorf("tcp: setTTL: %v", err)
+		return
+	}
+
+	//允许绑定非本机地址，透明代理时以设备的源地址发起连接
+	if err = setNonLocalBind(p.fd, family, c.FreeBind, c.Transparent); err != nil {
+		syscall.Close(p.fd)
+		p.fd = -1
+		err = fmt.Errorf("tcp: setNonLocalBind: %v", err)
+		return
+	}
+
+	//绑定网络接口，不同接口上存在重叠的私网网段时从指定接口发送
+	if c.Interface != "" {
+		if err = bindToDevice(p.fd, family, c.Interface); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			err = fmt.Errorf("tcp: bind to %v: %v", c.Interface, err)
+			return
+		}
+	}
+
+	//绑定本地地址，多网卡时从指定的源IP发起连接
+	if c.LocalAddress != "" {
+		if err = bindTCPLocal(p.fd, family, c.Network, c.LocalAddress); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			err = fmt.Errorf("tcp: bind %v: %v", c.LocalAddress, err)
+			return
+		}
+	}
+
+	//连接TCP地址，配置了DialTimeout时在超时内返回；TCP Fast Open时推迟到第一次Write
+	p.fastOpen, p.dialTimeout = c.FastOpen, c.DialTimeout
+	if !p.fastOpen {
+		if err = connectTimeout(p.fd, p.sockAddr, timeout); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			err = fmt.Errorf("tcp: Connect: %w", err)
+			return
+		}
+	}
+
 	//如果在sysSocket设置非阻塞，则Connect会返回	EINPROGRESS错误
 	if err = syscall.SetNonblock(p.fd, true); err != nil {
 		syscall.Close(p.fd)
+		p.fd = -1
 		err = fmt.Errorf("tcp: SetNonblock: %v", err)
 		return
 	}
 
-	//设置读写超时
-	if c.ReadTimeout > 0 {
-		p.readTimeout = c.ReadTimeout
-	}
-	if c.WriteTimeout > 0 {
-		p.writeTimeout = c.WriteTimeout
+	return
+}
+
+//关闭发送方向，对端读到EOF，仍可继续读取
+func (p *tcp) CloseWrite() error {
+	if p.fd == -1 {
+		return fmt.Errorf("tcp: not open")
 	}
+	return os.NewSyscallError("shutdown", syscall.Shutdown(p.fd, syscall.SHUT_WR))
+}
 
-	return
+//关闭接收方向，仍可继续发送
+func (p *tcp) CloseRead() error {
+	if p.fd == -1 {
+		return fmt.Errorf("tcp: not open")
+	}
+	return os.NewSyscallError("shutdown", syscall.Shutdown(p.fd, syscall.SHUT_RD))
 }
 
 //返回endpoint类型
@@ -86,21 +275,232 @@ func (p *tcp) Type() EndPointType {
 
 //释放TCP套接字
 func (p *tcp) Close() error {
+	if p.watch != nil {
+		p.watch.Stop()
+		p.watch = nil
+	}
 	if p.fd != -1 {
 		syscall.Close(p.fd)
+		p.fd = -1
 	}
 
 	return nil
 }
 
-//读取TCP数据
-func (p *tcp) Read(b []byte) (int, error) {
-	return syscall.Read(p.fd, b)
+//读取TCP数据，ReadTimeout内没有数据时返回TimeoutError
+func (p *tcp) Read(b []byte) (n int, err error) {
+	//在读超时内等待数据，对端失效时不会一直阻塞
+	for {
+		if err = waitFd(p.fd, false, p.readTimeout); err == errWaitTimeout {
+			return 0, &TimeoutError{Op: "tcp", Duration: p.readTimeout}
+		} else if err != nil {
+			return
+		}
+		if n, err = syscall.Read(p.fd, limitReadBuffer(b, p.maxReadSize)); err != syscall.EAGAIN && err != syscall.EINTR {
+			break
+		}
+	}
+	if err == nil {
+		n, err = checkReadSize("tcp", n, p.maxReadSize)
+	}
+	//内核在延迟确认后会退出quickack模式，每次读取后重新设置
+	if p.quickAck && n > 0 {
+		setQuickAck(p.fd, true)
+	}
+	return
+}
+
+//开启或关闭TCP_QUICKACK，开启后每次读取后重新设置
+func (p *tcp) SetQuickAck(on bool) error {
+	if p.fd == -1 {
+		return fmt.Errorf("tcp: not open")
+	}
+	if err := setQuickAck(p.fd, on); err != nil {
+		return fmt.Errorf("tcp: %v", err)
+	}
+	p.quickAck = on
+	return nil
 }
 
-//写TCP数据
+//写TCP数据，WriteTimeout内未能全部发送时返回已发送的字节数和TimeoutError
 func (p *tcp) Write(b []byte) (int, error) {
-	return syscall.Write(p.fd, b)
+	if err := checkWriteSize("tcp", len(b), p.maxWriteSize); err != nil {
+		return 0, err
+	}
+	n := 0
+	if p.fastOpen {
+		//随SYN只能发出部分数据或没有cookie时，剩余数据在连接完成后按普通方式发送
+		p.fastOpen = false
+		m, err := connectFastOpen(p.fd, p.sockAddr, b, p.dialTimeout)
+		if err != nil {
+			return 0, fmt.Errorf("tcp: fast open: %w", err)
+		}
+		n = m
+		if err = p.startWatch(); err != nil {
+			return n, err
+		}
+	}
+
+	//发送缓冲区满时在写超时内等待可写，直到全部发送
+	var expireTime time.Time
+	if p.writeTimeout > 0 {
+		expireTime = time.Now().Add(p.writeTimeout)
+	}
+	for n < len(b) {
+		m, err := syscall.Write(p.fd, b[n:])
+		if m > 0 {
+			n += m
+		}
+		if err == nil || err == syscall.EINTR {
+			continue
+		} else if err != syscall.EAGAIN {
+			return n, err
+		}
+
+		var remainTime time.Duration
+		if p.writeTimeout > 0 {
+			if remainTime = expireTime.Sub(time.Now()); remainTime <= 0 {
+				return n, &TimeoutError{Op: "tcp", Duration: p.writeTimeout}
+			}
+		}
+		if err = waitFd(p.fd, true, remainTime); err == errWaitTimeout {
+			return n, &TimeoutError{Op: "tcp", Duration: p.writeTimeout}
+		} else if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+//返回连接的内核统计（TCP_INFO）
+func (p *tcp) Info() (*TCPInfo, error) {
+	if p.fd == -1 {
+		return nil, fmt.Errorf("tcp: not open")
+	}
+	info, err := getTCPInfo(p.fd)
+	if err != nil {
+		return nil, fmt.Errorf("tcp: getTCPInfo: %v", err)
+	}
+	return parseTCPInfo(info), nil
+}
+
+//以紧急数据发送，对端的紧急指针指向最后一个字节，用于老式终端服务器协议的中断信号
+func (p *tcp) WriteOOB(b []byte) (int, error) {
+	if p.fd == -1 {
+		return 0, fmt.Errorf("tcp: not open")
+	}
+	if err := waitFd(p.fd, true, p.writeTimeout); err == errWaitTimeout {
+		return 0, &TimeoutError{Op: "tcp", Duration: p.writeTimeout}
+	} else if err != nil {
+		return 0, err
+	}
+
+	n, err := syscall.SendmsgN(p.fd, b, nil, nil, syscall.MSG_OOB)
+	if err != nil {
+		return n, os.NewSyscallError("sendmsg", err)
+	}
+	return n, nil
+}
+
+//在读超时内等待并读取紧急字节，紧急字节之前的普通数据仍需通过Read读取
+func (p *tcp) ReadOOB() (byte, error) {
+	if p.fd == -1 {
+		return 0, fmt.Errorf("tcp: not open")
+	}
+	if p.oobInline {
+		return 0, fmt.Errorf("tcp: urgent data is inline")
+	}
+
+	var expireTime time.Time
+	if p.readTimeout > 0 {
+		expireTime = time.Now().Add(p.readTimeout)
+	}
+	b := make([]byte, 1)
+	for {
+		n, _, err := syscall.Recvfrom(p.fd, b, syscall.MSG_OOB|syscall.MSG_DONTWAIT)
+		if err == nil && n == 1 {
+			return b[0], nil
+		} else if err == nil {
+			return 0, fmt.Errorf("tcp: connection closed")
+		} else if err != syscall.EINVAL && err != syscall.EAGAIN && err != syscall.EINTR {
+			return 0, os.NewSyscallError("recvfrom", err)
+		}
+
+		//没有紧急数据时返回EINVAL，等待紧急数据到达（POLLPRI）
+		var remainTime time.Duration
+		if p.readTimeout > 0 {
+			if remainTime = expireTime.Sub(time.Now()); remainTime <= 0 {
+				return 0, &TimeoutError{Op: "tcp", Duration: p.readTimeout}
+			}
+		}
+		if _, err = pollFd(p.fd, unix.POLLPRI, remainTime); err != nil {
+			return 0, err
+		}
+	}
+}
+
+//判断读位置是否在紧急数据标记处
+func (p *tcp) AtMark() (bool, error) {
+	if p.fd == -1 {
+		return false, fmt.Errorf("tcp: not open")
+	}
+	return atMark(p.fd)
+}
+
+//检查长时间空闲的连接是否失效，用于发送正式命令前避免在失效的NAT映射上等待完整超时。
+//先检查对端关闭和内核重传状态；probe非空时再发送协议无害的空操作报文，
+//在timeout内等待对端TCP确认，未确认视为失效
+func (p *tcp) DetectStale(probe []byte, timeout time.Duration) error {
+	if p.fd == -1 {
+		return fmt.Errorf("tcp: not open")
+	}
+
+	//对端关闭或连接出错时MSG_PEEK立即返回
+	buf := make([]byte, 1)
+	n, _, err := syscall.Recvfrom(p.fd, buf, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+	switch {
+	case err == nil && n == 0:
+		return fmt.Errorf("%w: closed by peer", ErrStale)
+	case err == nil: //有未读取的数据，连接可用
+		return nil
+	case err != syscall.EAGAIN && err != syscall.EINTR:
+		return fmt.Errorf("%w: %v", ErrStale, err)
+	}
+
+	info, err := getTCPInfo(p.fd)
+	if err != nil {
+		return fmt.Errorf("tcp: getTCPInfo: %v", err)
+	}
+	if info.State != tcpEstablished {
+		return fmt.Errorf("%w: state %v", ErrStale, info.State)
+	}
+	if info.Unacked > 0 && (info.Retransmits > 0 || info.Probes > 0) {
+		return fmt.Errorf("%w: %v unacked segments after %v retransmits", ErrStale, info.Unacked, info.Retransmits)
+	}
+	if len(probe) == 0 {
+		return nil
+	}
+
+	//发送探测报文，等待对端TCP确认，无需等待应用层应答
+	if _, err = p.Write(probe); err != nil {
+		return fmt.Errorf("%w: write probe: %v", ErrStale, err)
+	}
+	expireTime := time.Now().Add(timeout)
+	for {
+		if info, err = getTCPInfo(p.fd); err != nil {
+			return fmt.Errorf("tcp: getTCPInfo: %v", err)
+		}
+		if info.State != tcpEstablished {
+			return fmt.Errorf("%w: state %v", ErrStale, info.State)
+		}
+		if info.Unacked == 0 {
+			return nil
+		}
+		if time.Now().After(expireTime) {
+			return fmt.Errorf("%w: probe not acknowledged within %v", ErrStale, timeout)
+		}
+		time.Sleep(staleProbeInterval)
+	}
 }
 
 //TCP文件句柄
@@ -128,6 +528,16 @@ func (p *tcp) WriteTimeout() time.Duration {
 	return p.writeTimeout
 }
 
+//修改读超时
+func (p *tcp) SetReadTimeout(d time.Duration) {
+	p.readTimeout = d
+}
+
+//修改写超时
+func (p *tcp) SetWriteTimeout(d time.Duration) {
+	p.writeTimeout = d
+}
+
 //返回TCP的socket地址
 func (p *tcp) SockAddr() syscall.Sockaddr {
 	return p.sockAddr
@@ -185,6 +595,23 @@ func getTCPSockaddr(proto, addr string) (sa syscall.Sockaddr, family int, tcpAdd
 	return
 }
 
+//绑定本地地址，addr未指定端口时由系统分配端口，地址族需与目标地址一致
+func bindTCPLocal(fd, family int, network, addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "0")
+	}
+
+	sa, localFamily, _, err := getTCPSockaddr(network, addr)
+	if err != nil {
+		return err
+	}
+	if localFamily != family {
+		return fmt.Errorf("address family does not match remote address")
+	}
+
+	return os.NewSyscallError("bind", syscall.Bind(fd, sa))
+}
+
 //判断输入的TCP协议类型是否正确
 func determineTCPProto(proto string, addr *net.TCPAddr) (string, error) {
 	if addr.IP.To4() != nil {
@@ -0,0 +1,69 @@
+package endpoint
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+//DialTimeout在第一个地址之前耗尽时Open应返回超时错误，而不是返回成功和无效的fd
+func TestTCPOpenDialTimeoutExpired(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	p, err := Open(&TCPConfig{Network: "tcp", Address: l.Addr().String(), DialTimeout: time.Nanosecond})
+	if err == nil {
+		p.Close()
+		t.Fatalf("Open succeeded with fd %v, want timeout error", p.Fd())
+	}
+	if !IsTimeout(err) {
+		t.Errorf("Open error = %v, want timeout", err)
+	}
+}
+
+//TCP Fast Open的第一次Write应发送全部数据，随SYN未发出的部分在连接后继续发送
+func TestTCPFastOpenWriteAll(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer c.Close()
+		b, _ := ioutil.ReadAll(c)
+		received <- b
+	}()
+
+	p, err := Open(&TCPConfig{Network: "tcp", Address: l.Addr().String(), FastOpen: true, DialTimeout: time.Second, WriteTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	n, err := p.Write(data)
+	if err != nil || n != len(data) {
+		p.Close()
+		t.Fatalf("Write = %v, %v, want %v, nil", n, err, len(data))
+	}
+	p.Close()
+
+	select {
+	case b := <-received:
+		if !bytes.Equal(b, data) {
+			t.Errorf("server received %v bytes, want %v", len(b), len(data))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not receive data")
+	}
+}
@@ -0,0 +1,33 @@
+package endpoint
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+//以TCP Fast Open方式连接并发送第一个报文（MSG_FASTOPEN），返回随SYN发出的字节数。已有服务端的TFO cookie时报文随SYN发出；
+//否则内核只发送SYN请求cookie，此时在timeout内等待连接完成后返回0，未发送的数据由调用方继续发送
+func connectFastOpen(fd int, sa syscall.Sockaddr, b []byte, timeout time.Duration) (int, error) {
+	var to unix.Sockaddr
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		to = &unix.SockaddrInet4{Port: sa.Port, Addr: sa.Addr}
+	case *syscall.SockaddrInet6:
+		to = &unix.SockaddrInet6{Port: sa.Port, ZoneId: sa.ZoneId, Addr: sa.Addr}
+	}
+
+	n, err := unix.SendmsgN(fd, b, nil, to, unix.MSG_FASTOPEN)
+	if err == nil {
+		return n, nil
+	} else if err != unix.EINPROGRESS {
+		return 0, os.NewSyscallError("sendmsg", err)
+	}
+
+	if err = waitConnect(fd, timeout); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
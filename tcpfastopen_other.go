@@ -0,0 +1,14 @@
+// +build !linux
+
+package endpoint
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+//当前系统不支持TCP Fast Open
+func connectFastOpen(fd int, sa syscall.Sockaddr, b []byte, timeout time.Duration) (int, error) {
+	return 0, fmt.Errorf("TCP Fast Open is not supported")
+}
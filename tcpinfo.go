@@ -0,0 +1,52 @@
+package endpoint
+
+import (
+	"fmt"
+	"time"
+)
+
+//TCP连接状态，取值与内核TCP_ESTABLISHED等一致
+type TCPState int
+
+//TCP连接状态名称
+var tcpStateNames = []string{
+	1:  "ESTABLISHED",
+	2:  "SYN_SENT",
+	3:  "SYN_RECV",
+	4:  "FIN_WAIT1",
+	5:  "FIN_WAIT2",
+	6:  "TIME_WAIT",
+	7:  "CLOSE",
+	8:  "CLOSE_WAIT",
+	9:  "LAST_ACK",
+	10: "LISTEN",
+	11: "CLOSING",
+}
+
+//返回状态名称，比如ESTABLISHED
+func (s TCPState) String() string {
+	if s > 0 && int(s) < len(tcpStateNames) {
+		return tcpStateNames[s]
+	}
+	return fmt.Sprintf("TCPState(%d)", int(s))
+}
+
+//TCP连接的内核统计（TCP_INFO），用于链路质量监控
+type TCPInfo struct {
+	State        TCPState      //连接状态
+	RTT          time.Duration //平滑往返时间
+	RTTVar       time.Duration //往返时间的偏差
+	RTO          time.Duration //重传超时
+	Retransmits  int           //当前未确认报文的连续重传次数
+	TotalRetrans int           //连接建立以来的累计重传报文数
+	Lost         int           //估计丢失的报文数
+	Unacked      int           //已发送未确认的报文数
+	SndCwnd      int           //拥塞窗口（报文数）
+	SndSsthresh  int           //慢启动阈值（报文数）
+	SndMSS       int           //发送MSS
+	RcvMSS       int           //接收MSS
+	PMTU         int           //路径MTU
+	LastDataSent time.Duration //距最近一次发送数据的时间
+	LastDataRecv time.Duration //距最近一次收到数据的时间
+	LastAckRecv  time.Duration //距最近一次收到确认的时间
+}
@@ -0,0 +1,37 @@
+package endpoint
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+//TCP_INFO中的连接状态，取值与内核TCP_ESTABLISHED一致
+const tcpEstablished = 1
+
+//读取TCP连接的内核状态（TCP_INFO）
+func getTCPInfo(fd int) (*unix.TCPInfo, error) {
+	return unix.GetsockoptTCPInfo(fd, unix.IPPROTO_TCP, unix.TCP_INFO)
+}
+
+//转换内核的TCP_INFO，时间单位为微秒或毫秒
+func parseTCPInfo(i *unix.TCPInfo) *TCPInfo {
+	return &TCPInfo{
+		State:        TCPState(i.State),
+		RTT:          time.Duration(i.Rtt) * time.Microsecond,
+		RTTVar:       time.Duration(i.Rttvar) * time.Microsecond,
+		RTO:          time.Duration(i.Rto) * time.Microsecond,
+		Retransmits:  int(i.Retransmits),
+		TotalRetrans: int(i.Total_retrans),
+		Lost:         int(i.Lost),
+		Unacked:      int(i.Unacked),
+		SndCwnd:      int(i.Snd_cwnd),
+		SndSsthresh:  int(i.Snd_ssthresh),
+		SndMSS:       int(i.Snd_mss),
+		RcvMSS:       int(i.Rcv_mss),
+		PMTU:         int(i.Pmtu),
+		LastDataSent: time.Duration(i.Last_data_sent) * time.Millisecond,
+		LastDataRecv: time.Duration(i.Last_data_recv) * time.Millisecond,
+		LastAckRecv:  time.Duration(i.Last_ack_recv) * time.Millisecond,
+	}
+}
@@ -0,0 +1,27 @@
+// +build !linux
+
+package endpoint
+
+import (
+	"fmt"
+)
+
+//TCP_INFO中的连接状态，取值与Linux内核TCP_ESTABLISHED一致
+const tcpEstablished = 1
+
+//当前系统不支持TCP_INFO，只保留检查连接时使用的字段
+type kernelTCPInfo struct {
+	State       uint8
+	Retransmits uint8
+	Probes      uint8
+	Unacked     uint32
+}
+
+//当前系统不支持读取TCP_INFO
+func getTCPInfo(fd int) (*kernelTCPInfo, error) {
+	return nil, fmt.Errorf("TCP_INFO is not supported")
+}
+
+func parseTCPInfo(i *kernelTCPInfo) *TCPInfo {
+	return &TCPInfo{State: TCPState(i.State)}
+}
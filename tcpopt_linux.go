@@ -0,0 +1,40 @@
+package endpoint
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+//设置TCP_QUICKACK，开启时立即确认收到的数据而不是延迟确认。
+//该选项不是永久的，内核可能在之后的收发中退出quickack模式
+func setQuickAck(fd int, on bool) error {
+	v := 0
+	if on {
+		v = 1
+	}
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_QUICKACK, v))
+}
+
+//判断读位置是否在紧急数据标记处（SIOCATMARK）
+func atMark(fd int) (bool, error) {
+	v, err := unix.IoctlGetInt(fd, unix.SIOCATMARK)
+	if err != nil {
+		return false, os.NewSyscallError("ioctl", err)
+	}
+	return v != 0, nil
+}
+
+//设置TCP_USER_TIMEOUT，已发送的数据超过d仍未被确认时内核断开连接，d<=0时不设置
+func setUserTimeout(fd int, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	ms := int(d / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, unix.TCP_USER_TIMEOUT, ms))
+}
@@ -0,0 +1,26 @@
+// +build !linux
+
+package endpoint
+
+import (
+	"fmt"
+	"time"
+)
+
+//当前系统不支持TCP_QUICKACK
+func setQuickAck(fd int, on bool) error {
+	return fmt.Errorf("TCP_QUICKACK is not supported")
+}
+
+//当前系统不支持判断紧急数据标记
+func atMark(fd int) (bool, error) {
+	return false, fmt.Errorf("SIOCATMARK is not supported")
+}
+
+//当前系统不支持TCP_USER_TIMEOUT，d<=0时不设置
+func setUserTimeout(fd int, d time.Duration) error {
+	if d > 0 {
+		return fmt.Errorf("TCP_USER_TIMEOUT is not supported")
+	}
+	return nil
+}
@@ -3,22 +3,42 @@
 package endpoint
 
 import (
-	"errors"
 	"os"
 	"syscall"
 	"time"
 )
 
-func setKeepAlive(fd int, d time.Duration) error {
-	if d <= 0 {
-		return errors.New("invalid time duration")
+//设置TCP保活参数：空闲idle后开始探测，每隔interval探测一次，连续count次无应答断开连接。
+//参数为0时使用系统默认值，全部为0表示不启用保活
+func setKeepAlive(fd int, idle, interval time.Duration, count int) error {
+	if idle <= 0 && interval <= 0 && count <= 0 {
+		return nil
 	}
-	secs := int(d / time.Second)
+
 	if err := os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1)); err != nil {
 		return err
 	}
-	if err := os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, secs)); err != nil {
-		return err
+	if interval > 0 {
+		if err := os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, keepAliveSecs(interval))); err != nil {
+			return err
+		}
+	}
+	if idle > 0 {
+		if err := os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, keepAliveSecs(idle))); err != nil {
+			return err
+		}
+	}
+	if count > 0 {
+		return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, count))
+	}
+	return nil
+}
+
+//保活时间按秒设置，不足1秒按1秒计
+func keepAliveSecs(d time.Duration) int {
+	secs := int(d / time.Second)
+	if secs < 1 {
+		secs = 1
 	}
-	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, secs))
+	return secs
 }
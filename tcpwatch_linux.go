@@ -0,0 +1,68 @@
+package endpoint
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+//tcpWatch在后台等待连接被内核断开（保活或TCP_USER_TIMEOUT超时、收到RST），断开时回调OnDisconnect
+type tcpWatch struct {
+	stop [2]int        //通知后台退出的管道
+	done chan struct{} //后台退出后关闭，之后才能关闭套接字，避免文件描述符被复用
+}
+
+//启动后台监视，onDisconnect在监视的goroutine中调用，最多调用一次
+func startTCPWatch(fd int, onDisconnect func(error)) (*tcpWatch, error) {
+	w := &tcpWatch{done: make(chan struct{})}
+	if err := syscall.Pipe2(w.stop[:], syscall.O_CLOEXEC); err != nil {
+		return nil, os.NewSyscallError("pipe2", err)
+	}
+	go w.run(fd, onDisconnect)
+	return w, nil
+}
+
+//只等待错误和挂断事件（events为0），不消耗套接字中的数据
+func (w *tcpWatch) run(fd int, onDisconnect func(error)) {
+	fds := []unix.PollFd{
+		{Fd: int32(fd)},
+		{Fd: int32(w.stop[0]), Events: unix.POLLIN},
+	}
+	for {
+		fds[0].Revents, fds[1].Revents = 0, 0
+		if _, err := unix.Poll(fds, -1); err == unix.EINTR {
+			continue
+		} else if err != nil || fds[1].Revents != 0 {
+			close(w.done)
+			return
+		}
+		if fds[0].Revents&(unix.POLLERR|unix.POLLHUP) != 0 {
+			//先取得错误再通知退出，回调中可以直接Close
+			err := disconnectError(fd)
+			close(w.done)
+			onDisconnect(err)
+			return
+		}
+	}
+}
+
+//停止后台监视并等待其退出
+func (w *tcpWatch) Stop() {
+	syscall.Close(w.stop[1])
+	<-w.done
+	syscall.Close(w.stop[0])
+}
+
+//取得断开连接的原因（SO_ERROR），比如保活或TCP_USER_TIMEOUT超时时为ETIMEDOUT
+func disconnectError(fd int) error {
+	v, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_ERROR)
+	if err != nil {
+		return fmt.Errorf("tcp: connection lost: %v", os.NewSyscallError("getsockopt", err))
+	}
+	if v == 0 {
+		return fmt.Errorf("tcp: connection closed")
+	}
+	return fmt.Errorf("tcp: connection lost: %w", syscall.Errno(v))
+}
@@ -0,0 +1,16 @@
+// +build !linux
+
+package endpoint
+
+import (
+	"fmt"
+)
+
+//当前系统不支持在后台监视连接断开
+type tcpWatch struct{}
+
+func startTCPWatch(fd int, onDisconnect func(error)) (*tcpWatch, error) {
+	return nil, fmt.Errorf("watching for disconnect is not supported")
+}
+
+func (w *tcpWatch) Stop() {}
@@ -1,15 +1,13 @@
-// +build !mips,!mipsle,!mips64,!mips64le
-
 package endpoint
 
 import (
-	"syscall"
+	"golang.org/x/sys/unix"
 )
 
-func cfSetIspeed(termios *syscall.Termios, speed uint32) {
+func cfSetIspeed(termios *unix.Termios, speed uint32) {
 	termios.Ispeed = speed
 }
 
-func cfSetOspeed(termios *syscall.Termios, speed uint32) {
+func cfSetOspeed(termios *unix.Termios, speed uint32) {
 	termios.Ospeed = speed
 }
@@ -0,0 +1,368 @@
+package endpoint
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"syscall"
+	"time"
+)
+
+//TLS握手的默认超时
+const tlsHandshakeTimeout = 10 * time.Second
+
+//证书链校验后的附加校验函数，返回错误时握手失败，可用于证书指纹绑定等。
+//参数含义同tls.Config.VerifyPeerCertificate
+type VerifyPeerFunc func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+
+//TLS配置，在TCP连接上进行TLS握手
+type TLSConfig struct {
+	Network               string            //TCP网络类型（tcp、tcp4、tcp6）
+	Address               string            //主机地址，比如192.168.1.1:802
+	Proxy                 string            //HTTP代理地址，配置时通过CONNECT方法建立到Address的隧道
+	ProxyUsername         string            //代理认证用户名
+	ProxyPassword         string            //代理认证密码
+	ProxyHeader           map[string]string //CONNECT请求附加的头部
+	Resolver              Resolver          //主机名解析器，为nil时使用DefaultResolver
+	LocalAddress          string            //本地绑定地址，为空时由系统选择源地址
+	Interface             string            //绑定的网络接口，为空时按路由表选择
+	FreeBind              bool              //允许LocalAddress尚未配置在本机接口上（IP_FREEBIND）
+	Transparent           bool              //透明代理（IP_TRANSPARENT），LocalAddress可为任意地址
+	TLS                   *tls.Config       //TLS配置，ServerName为空时使用Address中的主机名
+	Policy                string            //TLS策略名称（比如fips、legacy-device），覆盖TLS中的协议版本和密码套件，为空时使用DefaultTLSPolicy
+	CertFile              string            //客户端证书文件（PEM），与KeyFile同时配置时启用双向认证
+	KeyFile               string            //客户端私钥文件（PEM）
+	CAFile                string            //校验服务端证书的CA文件（PEM），为空时使用TLS.RootCAs或系统CA
+	ServerName            string            //校验服务端证书时使用的主机名，非空时覆盖TLS.ServerName
+	VerifyPeerCertificate VerifyPeerFunc    //证书链校验后的附加校验，可为nil
+	DialTimeout           time.Duration     //连接超时，0表示由系统决定
+	RetryCount            int               //连接暂时失败（ECONNREFUSED、超时等）时Open的重试次数，0表示不重试，证书校验失败不重试
+	RetryBackoff          time.Duration     //第一次重试前的等待时间，之后每次加倍（上限30s）并随机抖动
+	HandshakeTimeout      time.Duration     //握手超时，默认10s
+	KeepAlive             time.Duration     //TCP保活周期，如果不启用则配0
+	KeepAliveIdle         time.Duration     //开始发送保活探测前的空闲时间，0表示使用KeepAlive
+	KeepAliveInterval     time.Duration     //保活探测的间隔，0表示使用KeepAlive
+	KeepAliveCount        int               //连续多少次探测无应答后断开连接，0表示使用系统默认值
+	UserTimeout           time.Duration     //已发送数据超过该时间未被确认时断开连接，0表示使用系统默认值
+	OnDisconnect          func(err error)   //连接被保活、TCP_USER_TIMEOUT或RST断开时立即回调，可为nil
+	NoDelay               TCPSocketOpt      //TCP数据延迟发送，默认no delay
+	ReceiveBufferSize     int               //套接字接收缓冲区大小，0表示系统默认值
+	SendBufferSize        int               //套接字发送缓冲区大小，0表示系统默认值
+	DSCP                  int               //DSCP标记（0～63），0表示不设置
+	TTL                   int               //报文TTL或IPv6跳数限制（1～255），0表示系统默认值
+	ReadTimeout           time.Duration     //一次完全数据包的收取超时
+	WriteTimeout          time.Duration     //一次完整数据包的发送超时
+	MaxReadSize           int               //单次读取的最大报文长度，超过时返回FrameSizeError，0表示不限制
+	MaxWriteSize          int               //单次发送的最大报文长度，超过时返回FrameSizeError，0表示不限制
+}
+
+func (c *TLSConfig) Type() EndPointType {
+	return EndPointTLS
+}
+
+func (c *TLSConfig) AddressName() string {
+	return c.Address
+}
+
+//合并TLS配置和证书文件等便捷配置，生成客户端使用的tls.Config
+func (c *TLSConfig) clientConfig() (*tls.Config, error) {
+	var cfg *tls.Config
+	if c.TLS != nil {
+		cfg = c.TLS.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: load client certificate: %v", err)
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificate found in %v", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	//按策略限定协议版本和密码套件
+	if err := applyTLSPolicy(cfg, c.Policy); err != nil {
+		return nil, err
+	}
+
+	if c.VerifyPeerCertificate != nil {
+		cfg.VerifyPeerCertificate = c.VerifyPeerCertificate
+	}
+
+	//未指定ServerName时按地址中的主机名校验证书
+	if c.ServerName != "" {
+		cfg.ServerName = c.ServerName
+	}
+	if cfg.ServerName == "" && !cfg.InsecureSkipVerify {
+		if host, _, err := net.SplitHostPort(c.Address); err == nil {
+			cfg.ServerName = host
+		}
+	}
+
+	return cfg, nil
+}
+
+//TLS扩展接口，可通过类型断言从TLS EndPoint获取
+type TLSEndPoint interface {
+	EndPoint
+	HalfCloser
+	ConnectionState() tls.ConnectionState //返回握手后的TLS连接状态
+}
+
+//tlsEndPoint实现EndPoint接口，在tcp之上收发TLS记录
+type tlsEndPoint struct {
+	*tcp
+	conn *tls.Conn //TLS连接
+}
+
+//创建tls对象
+func newTLS() EndPoint {
+	return &tlsEndPoint{tcp: &tcp{fd: -1}}
+}
+
+//建立TCP连接并完成TLS握手
+func (p *tlsEndPoint) Open(config EndPointConfig) (err error) {
+	c := config.(*TLSConfig)
+
+	tc := &TCPConfig{
+		Network:           c.Network,
+		Address:           c.Address,
+		Proxy:             c.Proxy,
+		ProxyUsername:     c.ProxyUsername,
+		ProxyPassword:     c.ProxyPassword,
+		ProxyHeader:       c.ProxyHeader,
+		Resolver:          c.Resolver,
+		LocalAddress:      c.LocalAddress,
+		Interface:         c.Interface,
+		FreeBind:          c.FreeBind,
+		Transparent:       c.Transparent,
+		DialTimeout:       c.DialTimeout,
+		KeepAlive:         c.KeepAlive,
+		KeepAliveIdle:     c.KeepAliveIdle,
+		KeepAliveInterval: c.KeepAliveInterval,
+		KeepAliveCount:    c.KeepAliveCount,
+		UserTimeout:       c.UserTimeout,
+		OnDisconnect:      c.OnDisconnect,
+		NoDelay:           c.NoDelay,
+		ReceiveBufferSize: c.ReceiveBufferSize,
+		SendBufferSize:    c.SendBufferSize,
+		DSCP:              c.DSCP,
+		TTL:               c.TTL,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		MaxReadSize:       c.MaxReadSize,
+		MaxWriteSize:      c.MaxWriteSize,
+	}
+	if err = p.tcp.Open(tc); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	p.readTimeout, p.writeTimeout = defaultTimeouts(EndPointTLS, c.ReadTimeout, c.WriteTimeout)
+
+	cfg, err := c.clientConfig()
+	if err != nil {
+		p.tcp.Close()
+		return
+	}
+
+	timeout := c.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = tlsHandshakeTimeout
+	}
+	fc := &fdConn{p: p.tcp}
+	fc.SetDeadline(time.Now().Add(timeout))
+	p.conn = tls.Client(fc, cfg)
+	if err = p.conn.Handshake(); err != nil {
+		p.conn = nil
+		p.tcp.Close()
+		return fmt.Errorf("tls: handshake with %v: %w", c.Address, err)
+	}
+	fc.SetDeadline(time.Time{})
+
+	return nil
+}
+
+//返回endpoint类型
+func (p *tlsEndPoint) Type() EndPointType {
+	return EndPointTLS
+}
+
+//发送close_notify并关闭连接
+func (p *tlsEndPoint) Close() error {
+	if p.conn == nil {
+		return p.tcp.Close()
+	}
+
+	p.conn.SetWriteDeadline(deadline(p.writeTimeout))
+	err := p.conn.Close()
+	p.conn = nil
+	p.tcp.Close()
+
+	return err
+}
+
+//发送close_notify并关闭发送方向
+func (p *tlsEndPoint) CloseWrite() error {
+	if p.conn == nil {
+		return fmt.Errorf("tls: not open")
+	}
+
+	p.conn.SetWriteDeadline(deadline(p.writeTimeout))
+	if err := p.conn.CloseWrite(); err != nil {
+		return fmt.Errorf("tls: %v", err)
+	}
+	return p.tcp.CloseWrite()
+}
+
+//读取解密后的数据
+func (p *tlsEndPoint) Read(b []byte) (n int, err error) {
+	if p.conn == nil {
+		return 0, fmt.Errorf("tls: not open")
+	}
+
+	p.conn.SetReadDeadline(deadline(p.readTimeout))
+	if n, err = p.conn.Read(limitReadBuffer(b, p.maxReadSize)); err == nil {
+		n, err = checkReadSize("tls", n, p.maxReadSize)
+	}
+	return
+}
+
+//加密并发送数据
+func (p *tlsEndPoint) Write(b []byte) (int, error) {
+	if p.conn == nil {
+		return 0, fmt.Errorf("tls: not open")
+	}
+	if err := checkWriteSize("tls", len(b), p.maxWriteSize); err != nil {
+		return 0, err
+	}
+
+	p.conn.SetWriteDeadline(deadline(p.writeTimeout))
+	return p.conn.Write(b)
+}
+
+//返回握手后的TLS连接状态
+func (p *tlsEndPoint) ConnectionState() tls.ConnectionState {
+	if p.conn == nil {
+		return tls.ConnectionState{}
+	}
+	return p.conn.ConnectionState()
+}
+
+//按超时计算截止时间，timeout<=0表示不限制
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+//fdConn把非阻塞的tcp套接字适配为net.Conn，供crypto/tls使用，
+//EAGAIN时按截止时间等待套接字可读或可写
+type fdConn struct {
+	p             *tcp
+	readDeadline  time.Time //读截止时间，零值表示不限制
+	writeDeadline time.Time //写截止时间，零值表示不限制
+}
+
+func (c *fdConn) Read(b []byte) (int, error) {
+	for {
+		n, err := syscall.Read(c.p.fd, b)
+		switch {
+		case err == nil && n == 0:
+			return 0, io.EOF
+		case err == nil:
+			return n, nil
+		case err == syscall.EINTR:
+			continue
+		case err != syscall.EAGAIN:
+			return 0, err
+		}
+		if err = c.wait(false, c.readDeadline, c.p.readTimeout); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (c *fdConn) Write(b []byte) (n int, err error) {
+	for n < len(b) {
+		var m int
+		m, err = syscall.Write(c.p.fd, b[n:])
+		if m > 0 {
+			n += m
+		}
+		if err == nil || err == syscall.EINTR {
+			continue
+		} else if err != syscall.EAGAIN {
+			return
+		}
+		if err = c.wait(true, c.writeDeadline, c.p.writeTimeout); err != nil {
+			return
+		}
+	}
+	return n, nil
+}
+
+//等待套接字可读或可写，超过截止时间t返回TimeoutError，d为错误中报告的超时时间
+func (c *fdConn) wait(write bool, t time.Time, d time.Duration) error {
+	var timeout time.Duration
+	if !t.IsZero() {
+		if timeout = t.Sub(time.Now()); timeout <= 0 {
+			return &TimeoutError{Op: "tls", Duration: d}
+		}
+	}
+	if err := waitFd(c.p.fd, write, timeout); err == errWaitTimeout {
+		return &TimeoutError{Op: "tls", Duration: d}
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *fdConn) Close() error {
+	return c.p.Close()
+}
+
+func (c *fdConn) LocalAddr() net.Addr {
+	sa, err := syscall.Getsockname(c.p.fd)
+	if err != nil {
+		return nil
+	}
+	if addr := sockaddrToTCPAddr(sa); addr != nil {
+		return addr
+	}
+	return nil
+}
+
+func (c *fdConn) RemoteAddr() net.Addr {
+	return c.p.netAddr
+}
+
+func (c *fdConn) SetDeadline(t time.Time) error {
+	c.readDeadline, c.writeDeadline = t, t
+	return nil
+}
+
+func (c *fdConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline = t
+	return nil
+}
+
+func (c *fdConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline = t
+	return nil
+}
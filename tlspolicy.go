@@ -0,0 +1,126 @@
+package endpoint
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+)
+
+//TLS安全策略，集中限定协议版本、密码套件和椭圆曲线，打开TLS EndPoint时覆盖TLSConfig.TLS中的对应项
+type TLSPolicy struct {
+	MinVersion       uint16        //最低协议版本，比如tls.VersionTLS12，0表示不限定
+	MaxVersion       uint16        //最高协议版本，0表示不限定
+	CipherSuites     []uint16      //允许的TLS 1.2及以下密码套件，nil表示不限定（TLS 1.3的套件不可配置）
+	CurvePreferences []tls.CurveID //允许的椭圆曲线，nil表示不限定
+}
+
+//内置的策略名称
+const (
+	TLSPolicyFIPS   = "fips"          //FIPS 140-2认可的算法：TLS 1.2，ECDHE+AES-GCM，P-256/P-384
+	TLSPolicyModern = "modern"        //仅TLS 1.3
+	TLSPolicyLegacy = "legacy-device" //兼容老旧设备：TLS 1.0起，允许CBC和RSA密钥交换
+)
+
+var (
+	tlsPoliciesMu sync.RWMutex
+	tlsPolicies   = map[string]TLSPolicy{
+		TLSPolicyFIPS: {
+			MinVersion: tls.VersionTLS12,
+			MaxVersion: tls.VersionTLS12, //TLS 1.3的套件不可配置，其中ChaCha20不是FIPS认可的算法
+			CipherSuites: []uint16{
+				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			},
+			CurvePreferences: []tls.CurveID{tls.CurveP384, tls.CurveP256},
+		},
+		TLSPolicyModern: {
+			MinVersion: tls.VersionTLS13,
+		},
+		TLSPolicyLegacy: {
+			MinVersion: tls.VersionTLS10,
+			MaxVersion: tls.VersionTLS12,
+			CipherSuites: []uint16{
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+				tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+				tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+				tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+			},
+		},
+	}
+	defaultTLSPolicy string //TLSConfig未指定Policy时使用的策略，为空表示不限定
+)
+
+//注册或替换指定名称的TLS策略，只影响之后打开的EndPoint
+func RegisterTLSPolicy(name string, p TLSPolicy) {
+	tlsPoliciesMu.Lock()
+	defer tlsPoliciesMu.Unlock()
+
+	tlsPolicies[name] = p
+}
+
+//返回指定名称的TLS策略
+func GetTLSPolicy(name string) (TLSPolicy, bool) {
+	tlsPoliciesMu.RLock()
+	defer tlsPoliciesMu.RUnlock()
+
+	p, ok := tlsPolicies[name]
+	return p, ok
+}
+
+//设置TLSConfig未指定Policy时使用的策略，为空表示不限定，策略不存在时返回错误
+func SetDefaultTLSPolicy(name string) error {
+	tlsPoliciesMu.Lock()
+	defer tlsPoliciesMu.Unlock()
+
+	if _, ok := tlsPolicies[name]; name != "" && !ok {
+		return fmt.Errorf("tls: unknown policy %q", name)
+	}
+	defaultTLSPolicy = name
+	return nil
+}
+
+//返回TLSConfig未指定Policy时使用的策略名称
+func DefaultTLSPolicy() string {
+	tlsPoliciesMu.RLock()
+	defer tlsPoliciesMu.RUnlock()
+
+	return defaultTLSPolicy
+}
+
+//按名称应用TLS策略，name为空时使用默认策略，都为空时不修改cfg
+func applyTLSPolicy(cfg *tls.Config, name string) error {
+	if name == "" {
+		if name = DefaultTLSPolicy(); name == "" {
+			return nil
+		}
+	}
+	p, ok := GetTLSPolicy(name)
+	if !ok {
+		return fmt.Errorf("tls: unknown policy %q", name)
+	}
+
+	if p.MinVersion != 0 {
+		cfg.MinVersion = p.MinVersion
+	}
+	if p.MaxVersion != 0 {
+		cfg.MaxVersion = p.MaxVersion
+	}
+	if p.CipherSuites != nil {
+		cfg.CipherSuites = append([]uint16(nil), p.CipherSuites...)
+	}
+	if p.CurvePreferences != nil {
+		cfg.CurvePreferences = append([]tls.CurveID(nil), p.CurvePreferences...)
+	}
+	return nil
+}
@@ -3,17 +3,88 @@ package endpoint
 import (
 	"fmt"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+//UDP报文的默认最大长度
+const defaultDatagramSize = 65535
+
+//路径MTU发现模式（IP_MTU_DISCOVER/IPV6_MTU_DISCOVER）
+type PMTUDiscovery int
+
+const (
+	PMTUDefault PMTUDiscovery = iota //使用系统默认值（net.ipv4.ip_no_pmtu_disc）
+	PMTUDont                         //不设置DF位，超过MTU时由内核分片
+	PMTUWant                         //按路由缓存的路径MTU决定，报文超过路径MTU时分片
+	PMTUDo                           //始终设置DF位，超过路径MTU的报文发送失败（EMSGSIZE），不分片
+	PMTUProbe                        //设置DF位但忽略路径MTU，用于探测路径MTU
+)
+
+//收到报文的附加信息，来自IP_PKTINFO/IPV6_PKTINFO和IP_TTL/IPV6_HOPLIMIT控制消息
+type PacketInfo struct {
+	Src     *net.UDPAddr //来源地址
+	Dst     net.IP       //报文的目的地址，多地址主机上应以该地址作为应答的源地址，未开启ReceivePacketInfo时为nil
+	IfIndex int          //接收报文的网络接口序号，0表示未知
+	TTL     int          //报文的TTL或IPv6跳数限制，-1表示未知
+}
+
+//批量收发的单个报文
+type Datagram struct {
+	Data []byte   //报文数据，读取时为接收缓冲区，nil时分配MaxDatagramSize长度的缓冲区，返回后截取为实际收到的长度
+	Addr net.Addr //读取时为来源地址；写入时为目标地址，nil表示发往配置的Address
+}
+
+//错误来源（sock_extended_err.ee_origin），取值与内核SO_EE_ORIGIN_*一致
+const (
+	ErrOriginLocal = 1 //本机产生的错误，比如超过路径MTU
+	ErrOriginICMP  = 2 //收到ICMP差错报文
+	ErrOriginICMP6 = 3 //收到ICMPv6差错报文
+)
+
+//从套接字错误队列读取的差错（IP_RECVERR/IPV6_RECVERR），比如端口不可达、TTL超时
+type ICMPError struct {
+	Err      syscall.Errno //对应的错误码，端口不可达为ECONNREFUSED，TTL超时为EHOSTUNREACH
+	Origin   int           //错误来源，ErrOriginLocal、ErrOriginICMP或ErrOriginICMP6
+	Type     int           //ICMP类型，比如3为目的不可达，11为TTL超时
+	Code     int           //ICMP代码，比如3为端口不可达
+	Info     int           //附加信息，需要分片时为下一跳MTU
+	Addr     *net.UDPAddr  //出错报文的目的地址
+	Offender net.IP        //发出ICMP差错报文的节点，本机错误时为nil
+}
+
+func (e *ICMPError) Error() string {
+	if e.Origin == ErrOriginLocal {
+		return fmt.Sprintf("udp: local error for %v: %v", e.Addr, e.Err)
+	}
+	return fmt.Sprintf("udp: icmp error from %v (type %v code %v) for %v: %v", e.Offender, e.Type, e.Code, e.Addr, e.Err)
+}
+
+//支持errors.Is(err, syscall.ECONNREFUSED)
+func (e *ICMPError) Unwrap() error {
+	return e.Err
+}
+
 //udp实现EndPoint接口
 type udp struct {
 	fd           int              //套接字文件描述符
 	netAddr      *net.UDPAddr     //目标UDP的网络地址
 	sockAddr     syscall.Sockaddr //目标UDP的socket地址
+	family       int              //套接字地址族（AF_INET、AF_INET6）
+	connected    bool             //已连接到目标地址
+	recvErr      bool             //已开启IP_RECVERR，读写错误时读取错误队列
 	readTimeout  time.Duration    //一次完全数据包的收取超时
 	writeTimeout time.Duration    //一次完整数据包的发送超时
+	maxReadSize  int              //单次读取的最大报文长度
+	maxWriteSize int              //单次发送的最大报文长度
+
+	shut            int32      //UDPServer关闭时置1（原子操作），shutdown后poll始终返回可读，等待时返回ErrListenerClosed
+	maxDatagramSize int        //内部接收缓冲区的大小，0表示65535
+	rmu             sync.Mutex //保护rbuf
+	rbuf            []byte     //Read、ReadFrom使用的内部接收缓冲区，首次读取时分配
 }
 
 //创建udp对象
@@ -31,7 +102,7 @@ func (p *udp) Open(config EndPointConfig) (err error) {
 
 	//解析目标UDP地址
 	if p.sockAddr, family, p.netAddr, err = getUDPSockaddr(c.Network, c.Address); err != nil {
-		err = fmt.Errorf("udp: getUDPSockaddr %v %v: %v", c.Network, c.Address)
+		err = fmt.Errorf("udp: getUDPSockaddr %v %v: %v", c.Network, c.Address, err)
 		return
 	}
 
@@ -40,15 +111,118 @@ func (p *udp) Open(config EndPointConfig) (err error) {
 		err = fmt.Errorf("udp: sysSocket: %v", err)
 		return
 	}
+	p.family = family
+
+	//允许发送广播报文
+	if c.Broadcast {
+		if err = syscall.SetsockoptInt(p.fd, syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			err = fmt.Errorf("udp: setBroadcast: %v", os.NewSyscallError("setsockopt", err))
+			return
+		}
+	}
 
-	//设置读写超时
-	if c.ReadTimeout > 0 {
-		p.readTimeout = c.ReadTimeout
+	//设置收发缓冲区
+	if err = setBufferSizes(p.fd, c.ReceiveBufferSize, c.SendBufferSize); err != nil {
+		syscall.Close(p.fd)
+		p.fd = -1
+		err = fmt.Errorf("udp: setBufferSizes: %v", err)
+		return
 	}
-	if c.WriteTimeout > 0 {
-		p.writeTimeout = c.WriteTimeout
+
+	//设置DSCP标记
+	if err = setDSCP(p.fd, family, c.DSCP); err != nil {
+		syscall.Close(p.fd)
+		p.fd = -1
+		err = fmt.Errorf("udp: setDSCP: %v", err)
+		return
 	}
 
+	//设置TTL
+	if err = setTTL(p.fd, family, c.TTL); err != nil {
+		syscall.Close(p.fd)
+		p.fd = -1
+		err = fmt.Errorf("udp: setTTL: %v", err)
+		return
+	}
+
+	//绑定网络接口，不同接口上存在重叠的私网网段时从指定接口发送
+	if c.Interface != "" {
+		if err = bindToDevice(p.fd, family, c.Interface); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			err = fmt.Errorf("udp: bind to %v: %v", c.Interface, err)
+			return
+		}
+	}
+
+	//接收报文的目的地址等控制消息
+	if c.ReceivePacketInfo {
+		if err = setReceivePacketInfo(p.fd, family); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			err = fmt.Errorf("udp: setReceivePacketInfo: %v", err)
+			return
+		}
+	}
+
+	//接收ICMP差错
+	p.recvErr = c.ReceiveErrors
+	if c.ReceiveErrors {
+		if err = setReceiveErrors(p.fd, family); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			err = fmt.Errorf("udp: setReceiveErrors: %v", err)
+			return
+		}
+	}
+
+	//绑定本地地址，从固定的源IP和端口发送
+	if c.LocalAddress != "" {
+		if err = bindUDPLocal(p.fd, family, c.Network, c.LocalAddress); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			err = fmt.Errorf("udp: bind %v: %v", c.LocalAddress, err)
+			return
+		}
+	}
+
+	//设置路径MTU发现模式
+	if err = setPMTUDiscovery(p.fd, family, c.PMTUDiscovery); err != nil {
+		syscall.Close(p.fd)
+		p.fd = -1
+		err = fmt.Errorf("udp: setPMTUDiscovery: %v", err)
+		return
+	}
+
+	//连接目标地址，在LocalAddress绑定之后
+	p.connected = c.Connected
+	if c.Connected {
+		if err = syscall.Connect(p.fd, p.sockAddr); err != nil {
+			syscall.Close(p.fd)
+			p.fd = -1
+			err = fmt.Errorf("udp: Connect: %w", os.NewSyscallError("connect", err))
+			return
+		}
+	}
+
+	//非阻塞收发，由select等待读写超时
+	if err = syscall.SetNonblock(p.fd, true); err != nil {
+		syscall.Close(p.fd)
+		p.fd = -1
+		err = fmt.Errorf("udp: SetNonblock: %v", err)
+		return
+	}
+
+	//设置读写超时，未配置时使用默认值
+	p.readTimeout, p.writeTimeout = defaultTimeouts(EndPointUDP, c.ReadTimeout, c.WriteTimeout)
+
+	//设置报文长度限制
+	p.maxReadSize = c.MaxReadSize
+	p.maxWriteSize = c.MaxWriteSize
+	p.maxDatagramSize = c.MaxDatagramSize
+
 	return
 }
 
@@ -61,20 +235,143 @@ func (p *udp) Type() EndPointType {
 func (p *udp) Close() error {
 	if p.fd != -1 {
 		syscall.Close(p.fd)
+		p.fd = -1
 	}
 
 	return nil
 }
 
-//读取UDP数据
+//读取UDP数据，ReadTimeout内没有报文时返回TimeoutError
 func (p *udp) Read(b []byte) (n int, err error) {
-	n, _, err = syscall.Recvfrom(p.fd, b, 0)
+	n, _, err = p.recvfrom(b)
 	return
 }
 
-//写UDP数据
+//写UDP数据，发送缓冲区满时在WriteTimeout内等待，超时返回TimeoutError
 func (p *udp) Write(b []byte) (int, error) {
-	return len(b), syscall.Sendto(p.fd, b, 0, p.sockAddr)
+	if err := checkWriteSize("udp", len(b), p.maxWriteSize); err != nil {
+		return 0, err
+	}
+	return p.sendto(b, p.sockAddr)
+}
+
+//读取UDP报文并返回来源地址
+func (p *udp) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, from, err := p.recvfrom(b)
+	if from == nil {
+		return n, nil, err
+	}
+	var addr net.Addr
+	if a := sockaddrToUDPAddr(from); a != nil {
+		addr = a
+	}
+	return n, addr, err
+}
+
+//向指定地址发送UDP报文
+func (p *udp) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if err := checkWriteSize("udp", len(b), p.maxWriteSize); err != nil {
+		return 0, err
+	}
+	ua, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("udp: unsupported address %v", addr)
+	}
+	sa, err := udpAddrToSockaddr(ua, p.family)
+	if err != nil {
+		return 0, fmt.Errorf("udp: %v", err)
+	}
+	return p.sendto(b, sa)
+}
+
+//在读超时内等待并读取一个报文。报文先收到内部缓冲区再复制到b，
+//超过b或MaxDatagramSize的部分被截断，返回的FrameSizeError中Size为报文的实际长度
+func (p *udp) recvfrom(b []byte) (n int, from syscall.Sockaddr, err error) {
+	size := p.datagramSize()
+	for {
+		if err = p.wait(false); err != nil {
+			return
+		}
+		p.rmu.Lock()
+		if len(p.rbuf) < size {
+			p.rbuf = make([]byte, size)
+		}
+		//MSG_TRUNC使返回值为报文的实际长度
+		n, from, err = syscall.Recvfrom(p.fd, p.rbuf[:size], syscall.MSG_TRUNC)
+		if err == nil && n > 0 {
+			if n < size {
+				copy(b, p.rbuf[:n])
+			} else {
+				copy(b, p.rbuf[:size])
+			}
+		}
+		p.rmu.Unlock()
+		if err = p.queuedError(err); err != syscall.EAGAIN && err != syscall.EINTR {
+			break
+		}
+	}
+	if err == nil {
+		if len(b) < size {
+			size = len(b)
+		}
+		n, err = checkDatagramSize(n, size, p.maxReadSize)
+	}
+	return
+}
+
+//内部接收缓冲区的长度，未设置MaxDatagramSize时为65535，设置了MaxReadSize时不超过MaxReadSize+1以便判断超长
+func (p *udp) datagramSize() int {
+	size := p.maxDatagramSize
+	if size <= 0 {
+		size = defaultDatagramSize
+	}
+	if p.maxReadSize > 0 && p.maxReadSize+1 < size {
+		size = p.maxReadSize + 1
+	}
+	return size
+}
+
+//检查收到的报文长度，n为报文的实际长度。超过MaxReadSize时丢弃数据，
+//超过缓冲区长度size时返回截断的数据长度和FrameSizeError，其中Size为实际长度，Limit为缓冲区长度
+func checkDatagramSize(n, size, max int) (int, error) {
+	if _, err := checkReadSize("udp", n, max); err != nil {
+		return 0, err
+	}
+	if n > size {
+		return size, &FrameSizeError{Op: "udp read", Size: n, Limit: size}
+	}
+	return n, nil
+}
+
+//发送一个报文，发送缓冲区满时在写超时内等待
+func (p *udp) sendto(b []byte, sa syscall.Sockaddr) (int, error) {
+	for {
+		err := p.queuedError(syscall.Sendto(p.fd, b, 0, sa))
+		if err == nil {
+			return len(b), nil
+		} else if err != syscall.EAGAIN && err != syscall.EINTR {
+			return 0, err
+		}
+		if err = p.wait(true); err != nil {
+			return 0, err
+		}
+	}
+}
+
+//在读超时内等待可读（write为false）或在写超时内等待可写，超时返回TimeoutError
+func (p *udp) wait(write bool) error {
+	timeout := p.readTimeout
+	if write {
+		timeout = p.writeTimeout
+	}
+	err := waitFd(p.fd, write, timeout)
+	if atomic.LoadInt32(&p.shut) != 0 {
+		return ErrListenerClosed
+	}
+	if err == errWaitTimeout {
+		return &TimeoutError{Op: "udp", Duration: timeout}
+	}
+	return err
 }
 
 //UDP文件句柄
@@ -107,6 +404,16 @@ func (p *udp) WriteTimeout() time.Duration {
 	return p.writeTimeout
 }
 
+//修改读超时
+func (p *udp) SetReadTimeout(d time.Duration) {
+	p.readTimeout = d
+}
+
+//修改写超时
+func (p *udp) SetWriteTimeout(d time.Duration) {
+	p.writeTimeout = d
+}
+
 //解析UDP地址
 func getUDPSockaddr(proto, addr string) (sa syscall.Sockaddr, family int, udpAddr *net.UDPAddr, err error) {
 	var udpVersion string
@@ -159,6 +466,69 @@ func getUDPSockaddr(proto, addr string) (sa syscall.Sockaddr, family int, udpAdd
 	return
 }
 
+//绑定本地UDP地址，地址族须与目标地址一致；只给出IP时由系统选择端口
+func bindUDPLocal(fd, family int, network, addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "0")
+	}
+
+	sa, localFamily, _, err := getUDPSockaddr(network, addr)
+	if err != nil {
+		return err
+	}
+	if localFamily != family {
+		//IPv6套接字可绑定未指定地址（比如:5000）
+		if family != syscall.AF_INET6 {
+			return fmt.Errorf("address family does not match remote address")
+		}
+		sa4, ok := sa.(*syscall.SockaddrInet4)
+		if !ok || sa4.Addr != [4]byte{} {
+			return fmt.Errorf("address family does not match remote address")
+		}
+		sa = &syscall.SockaddrInet6{Port: sa4.Port}
+	}
+
+	return os.NewSyscallError("bind", syscall.Bind(fd, sa))
+}
+
+//转换socket地址为UDP网络地址
+func sockaddrToUDPAddr(sa syscall.Sockaddr) *net.UDPAddr {
+	if a := sockaddrToTCPAddr(sa); a != nil {
+		return &net.UDPAddr{IP: a.IP, Port: a.Port, Zone: a.Zone}
+	}
+	return nil
+}
+
+//按套接字地址族转换UDP网络地址为socket地址，IPv6套接字可发送到IPv4映射地址
+func udpAddrToSockaddr(addr *net.UDPAddr, family int) (syscall.Sockaddr, error) {
+	switch family {
+	case syscall.AF_INET:
+		ip := addr.IP.To4()
+		if ip == nil {
+			return nil, fmt.Errorf("address %v is not IPv4", addr)
+		}
+		sa := &syscall.SockaddrInet4{Port: addr.Port}
+		copy(sa.Addr[:], ip)
+		return sa, nil
+	case syscall.AF_INET6:
+		ip := addr.IP.To16()
+		if ip == nil {
+			return nil, fmt.Errorf("address %v is not IPv6", addr)
+		}
+		sa := &syscall.SockaddrInet6{Port: addr.Port}
+		copy(sa.Addr[:], ip)
+		if addr.Zone != "" {
+			iface, err := net.InterfaceByName(addr.Zone)
+			if err != nil {
+				return nil, err
+			}
+			sa.ZoneId = uint32(iface.Index)
+		}
+		return sa, nil
+	}
+	return nil, fmt.Errorf("unsupported address family %v", family)
+}
+
 //判断输入的UDP协议类型是否正确
 func determineUDPProto(proto string, addr *net.UDPAddr) (string, error) {
 	if addr.IP.To4() != nil {
@@ -0,0 +1,148 @@
+package endpoint
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+//UDP读超时在文件句柄大于FD_SETSIZE（1024）时仍应生效，收到报文后正常返回
+func TestUDPReadTimeoutHighFd(t *testing.T) {
+	const high = 2001
+	defer raiseFdLimit(t, high)()
+
+	peer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	ep, err := Open(&UDPConfig{Network: "udp", Address: peer.LocalAddr().String(), ReadTimeout: 30 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+	p := ep.(*udp)
+	moveFd(t, p.fd, high)
+	p.fd = high
+
+	b := make([]byte, 16)
+	if _, err = p.Read(b); !IsTimeout(err) {
+		t.Fatalf("Read on idle socket = %v, want timeout", err)
+	}
+
+	if _, err = p.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	_, from, err := peer.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = peer.WriteTo([]byte("pong"), from); err != nil {
+		t.Fatal(err)
+	}
+	n, err := p.Read(b)
+	if err != nil || string(b[:n]) != "pong" {
+		t.Fatalf("Read = %q, %v, want pong", b[:n], err)
+	}
+}
+
+//打开连接到本地对端的UDP EndPoint，返回对端用于发送报文
+func openUDPPair(t *testing.T, c *UDPConfig) (*udp, net.PacketConn, net.Addr) {
+	peer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Network, c.Address = "udp", peer.LocalAddr().String()
+	if c.ReadTimeout == 0 {
+		c.ReadTimeout = time.Second
+	}
+	ep, err := Open(c)
+	if err != nil {
+		peer.Close()
+		t.Fatal(err)
+	}
+	p := ep.(*udp)
+	if _, err = p.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 16)
+	_, from, err := peer.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, peer, from
+}
+
+//缓冲区小于报文时返回截断的数据和报文的实际长度
+func TestUDPReadTruncated(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxSize   int
+		bufLen    int
+		sent      int
+		wantN     int
+		wantLimit int
+	}{
+		{"buffer", 0, 10, 100, 10, 10},
+		{"MaxDatagramSize", 32, 64, 50, 32, 32},
+		{"fits", 32, 64, 20, 20, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, peer, addr := openUDPPair(t, &UDPConfig{MaxDatagramSize: tt.maxSize})
+			defer p.Close()
+			defer peer.Close()
+
+			data := bytes.Repeat([]byte{'x'}, tt.sent)
+			if _, err := peer.WriteTo(data, addr); err != nil {
+				t.Fatal(err)
+			}
+			b := make([]byte, tt.bufLen)
+			n, err := p.Read(b)
+			if n != tt.wantN {
+				t.Errorf("n = %v, want %v", n, tt.wantN)
+			}
+			if tt.wantLimit == 0 {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+				return
+			}
+			fe, ok := err.(*FrameSizeError)
+			if !ok || fe.Size != tt.sent || fe.Limit != tt.wantLimit {
+				t.Errorf("err = %#v, want FrameSizeError{Size: %v, Limit: %v}", err, tt.sent, tt.wantLimit)
+			}
+		})
+	}
+}
+
+//ReadBatch为Data为nil的报文分配MaxDatagramSize长度的缓冲区
+func TestUDPReadBatchAllocates(t *testing.T) {
+	p, peer, addr := openUDPPair(t, &UDPConfig{MaxDatagramSize: 8})
+	defer p.Close()
+	defer peer.Close()
+
+	for _, s := range []string{"abc", "0123456789"} {
+		if _, err := peer.WriteTo([]byte(s), addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	msgs := make([]Datagram, 2)
+	n, err := p.ReadBatch(msgs)
+	if n != 2 {
+		t.Fatalf("ReadBatch = %v, %v, want 2 datagrams", n, err)
+	}
+	if string(msgs[0].Data) != "abc" {
+		t.Errorf("msgs[0] = %q, want abc", msgs[0].Data)
+	}
+	if string(msgs[1].Data) != "01234567" {
+		t.Errorf("msgs[1] = %q, want truncated 01234567", msgs[1].Data)
+	}
+	if fe, ok := err.(*FrameSizeError); !ok || fe.Size != 10 || fe.Limit != 8 {
+		t.Errorf("err = %v, want FrameSizeError{Size: 10, Limit: 8}", err)
+	}
+}
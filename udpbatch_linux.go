@@ -0,0 +1,174 @@
+package endpoint
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+//recvmmsg/sendmmsg使用的报文头
+type mmsghdr struct {
+	hdr unix.Msghdr
+	len uint32
+}
+
+//一次系统调用读取多个报文，在读超时内至少等到一个报文，之后只取已到达的报文，返回读取的报文数。
+//报文超过缓冲区或MaxDatagramSize时被截断并返回FrameSizeError，超过MaxReadSize时Data为空
+func (p *udp) ReadBatch(msgs []Datagram) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	hdrs := make([]mmsghdr, len(msgs))
+	iovs := make([]unix.Iovec, len(msgs))
+	names := make([]syscall.RawSockaddrAny, len(msgs))
+	sizes := make([]int, len(msgs))
+	size := p.datagramSize()
+	for i := range msgs {
+		//Data为nil时分配MaxDatagramSize长度的接收缓冲区
+		if msgs[i].Data == nil {
+			msgs[i].Data = make([]byte, size)
+		}
+		b := msgs[i].Data
+		if len(b) > size {
+			b = b[:size]
+		}
+		sizes[i] = len(b)
+		if len(b) > 0 {
+			iovs[i].Base = &b[0]
+		}
+		iovs[i].SetLen(len(b))
+		hdrs[i].hdr.Iov = &iovs[i]
+		hdrs[i].hdr.SetIovlen(1)
+		hdrs[i].hdr.Name = (*byte)(unsafe.Pointer(&names[i]))
+		hdrs[i].hdr.Namelen = uint32(syscall.SizeofSockaddrAny)
+	}
+
+	var n uintptr
+	for {
+		if err := p.wait(false); err != nil {
+			return 0, err
+		}
+		var errno syscall.Errno
+		n, _, errno = syscall.Syscall6(unix.SYS_RECVMMSG, uintptr(p.fd), uintptr(unsafe.Pointer(&hdrs[0])), uintptr(len(hdrs)), unix.MSG_WAITFORONE|unix.MSG_TRUNC, 0, 0)
+		if errno == 0 {
+			break
+		} else if e, ok := p.queuedError(errno).(*ICMPError); ok {
+			return 0, e
+		} else if errno != syscall.EAGAIN && errno != syscall.EINTR {
+			return 0, os.NewSyscallError("recvmmsg", errno)
+		}
+	}
+
+	var err error
+	for i := 0; i < int(n); i++ {
+		//MSG_TRUNC使len为报文的实际长度，截断时Data为缓冲区中的部分
+		size, e := checkDatagramSize(int(hdrs[i].len), sizes[i], p.maxReadSize)
+		if e != nil && err == nil {
+			err = e
+		}
+		msgs[i].Data = msgs[i].Data[:size]
+		msgs[i].Addr = nil
+		if a := rawToUDPAddr(&names[i]); a != nil {
+			msgs[i].Addr = a
+		}
+	}
+	return int(n), err
+}
+
+//一次系统调用发送多个报文，返回发送的报文数，出错时之前的报文已发送
+func (p *udp) WriteBatch(msgs []Datagram) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	hdrs := make([]mmsghdr, len(msgs))
+	iovs := make([]unix.Iovec, len(msgs))
+	names := make([]syscall.RawSockaddrInet6, len(msgs)) //足以容纳IPv4和IPv6地址
+	for i, m := range msgs {
+		if err := checkWriteSize("udp", len(m.Data), p.maxWriteSize); err != nil {
+			return 0, err
+		}
+		if len(m.Data) > 0 {
+			iovs[i].Base = &m.Data[0]
+		}
+		iovs[i].SetLen(len(m.Data))
+		hdrs[i].hdr.Iov = &iovs[i]
+		hdrs[i].hdr.SetIovlen(1)
+
+		sa := p.sockAddr
+		if m.Addr != nil {
+			ua, ok := m.Addr.(*net.UDPAddr)
+			if !ok {
+				return 0, fmt.Errorf("udp: unsupported address %v", m.Addr)
+			}
+			var err error
+			if sa, err = udpAddrToSockaddr(ua, p.family); err != nil {
+				return 0, fmt.Errorf("udp: %v", err)
+			}
+		}
+		namelen, err := sockaddrToRaw(sa, unsafe.Pointer(&names[i]))
+		if err != nil {
+			return 0, fmt.Errorf("udp: %v", err)
+		}
+		hdrs[i].hdr.Name = (*byte)(unsafe.Pointer(&names[i]))
+		hdrs[i].hdr.Namelen = namelen
+	}
+
+	for {
+		n, _, errno := syscall.Syscall6(unix.SYS_SENDMMSG, uintptr(p.fd), uintptr(unsafe.Pointer(&hdrs[0])), uintptr(len(hdrs)), 0, 0, 0)
+		if errno == 0 {
+			return int(n), nil
+		} else if e, ok := p.queuedError(errno).(*ICMPError); ok {
+			return 0, e
+		} else if errno != syscall.EAGAIN && errno != syscall.EINTR {
+			return 0, os.NewSyscallError("sendmmsg", errno)
+		}
+		if err := p.wait(true); err != nil {
+			return 0, err
+		}
+	}
+}
+
+//把IPv4或IPv6 socket地址写入to指向的原始地址结构，返回地址长度
+func sockaddrToRaw(sa syscall.Sockaddr, to unsafe.Pointer) (uint32, error) {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		raw := (*syscall.RawSockaddrInet4)(to)
+		raw.Family = syscall.AF_INET
+		port := (*[2]byte)(unsafe.Pointer(&raw.Port))
+		port[0], port[1] = byte(sa.Port>>8), byte(sa.Port)
+		raw.Addr = sa.Addr
+		return syscall.SizeofSockaddrInet4, nil
+	case *syscall.SockaddrInet6:
+		raw := (*syscall.RawSockaddrInet6)(to)
+		raw.Family = syscall.AF_INET6
+		port := (*[2]byte)(unsafe.Pointer(&raw.Port))
+		port[0], port[1] = byte(sa.Port>>8), byte(sa.Port)
+		raw.Scope_id = sa.ZoneId
+		raw.Addr = sa.Addr
+		return syscall.SizeofSockaddrInet6, nil
+	}
+	return 0, fmt.Errorf("unsupported address %v", sa)
+}
+
+//转换原始地址结构为UDP网络地址，不是IPv4或IPv6地址时返回nil
+func rawToUDPAddr(raw *syscall.RawSockaddrAny) *net.UDPAddr {
+	switch raw.Addr.Family {
+	case syscall.AF_INET:
+		r := (*syscall.RawSockaddrInet4)(unsafe.Pointer(raw))
+		port := (*[2]byte)(unsafe.Pointer(&r.Port))
+		sa := &syscall.SockaddrInet4{Port: int(port[0])<<8 | int(port[1]), Addr: r.Addr}
+		return sockaddrToUDPAddr(sa)
+	case syscall.AF_INET6:
+		r := (*syscall.RawSockaddrInet6)(unsafe.Pointer(raw))
+		port := (*[2]byte)(unsafe.Pointer(&r.Port))
+		sa := &syscall.SockaddrInet6{Port: int(port[0])<<8 | int(port[1]), ZoneId: r.Scope_id, Addr: r.Addr}
+		return sockaddrToUDPAddr(sa)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+// +build !linux
+
+package endpoint
+
+import (
+	"fmt"
+)
+
+//当前系统不支持recvmmsg，需逐个调用ReadFrom
+func (p *udp) ReadBatch(msgs []Datagram) (int, error) {
+	if p.fd == -1 {
+		return 0, fmt.Errorf("udp: not open")
+	}
+	return 0, fmt.Errorf("udp: batch read is not supported")
+}
+
+//当前系统不支持sendmmsg，需逐个调用WriteTo
+func (p *udp) WriteBatch(msgs []Datagram) (int, error) {
+	if p.fd == -1 {
+		return 0, fmt.Errorf("udp: not open")
+	}
+	return 0, fmt.Errorf("udp: batch write is not supported")
+}
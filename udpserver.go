@@ -0,0 +1,257 @@
+package endpoint
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+//UDP服务端配置，绑定本地端口，接收任意来源的报文
+type UDPServerConfig struct {
+	Network           string        //UDP网络类型（udp、udp4、udp6）
+	Address           string        //监听地址，比如:514、192.168.1.1:5683
+	ReuseAddr         bool          //设置SO_REUSEADDR
+	Interface         string        //绑定的网络接口，为空时监听所有接口
+	Broadcast         bool          //允许接收和发送广播报文（SO_BROADCAST）
+	ReceivePacketInfo bool          //接收报文的目的地址、接口和TTL，通过EndPoint().ReadMsg获取
+	ReceiveErrors     bool          //接收发送应答产生的ICMP差错（IP_RECVERR），通过EndPoint().ReadError读取
+	MaxDatagramSize   int           //Serve接收缓冲区的大小，超过的报文被截断后丢弃，0表示65535
+	ReceiveBufferSize int           //套接字接收缓冲区大小（SO_RCVBUF），0表示系统默认值
+	SendBufferSize    int           //套接字发送缓冲区大小（SO_SNDBUF），0表示系统默认值
+	ReadTimeout       time.Duration //Serve等待报文的间隔，0表示一直等待
+	WriteTimeout      time.Duration //发送应答的超时
+	MaxReadSize       int           //单个报文的最大长度，超过时丢弃，0表示不限制
+	MaxWriteSize      int           //单个应答的最大长度，0表示不限制
+}
+
+//处理收到的报文，data只在调用期间有效，需要保留时应复制
+type DatagramHandler func(data []byte, from net.Addr)
+
+//UDP服务端，可用于设备模拟器和syslog等接收端
+type UDPServer struct {
+	mu       sync.Mutex
+	ep       *udp          //绑定本地地址、没有对端的UDP EndPoint
+	size     int           //Serve接收缓冲区的大小
+	fd       int           //套接字文件描述符
+	addr     *net.UDPAddr  //监听地址
+	closed   bool          //是否已关闭
+	serving  int           //正在运行的Serve数，全部返回后才关闭套接字，避免Serve读到复用该描述符的其他套接字
+	handling int           //正在执行处理函数的Serve数
+	done     chan struct{} //套接字关闭后close
+	closeErr error         //关闭套接字的结果
+}
+
+//绑定本地地址创建UDP服务端
+func ListenUDP(c *UDPServerConfig) (*UDPServer, error) {
+	sa, family, _, err := getUDPSockaddr(c.Network, c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("udpserver: getUDPSockaddr %v %v: %v", c.Network, c.Address, err)
+	}
+
+	fd, err := sysSocket(family, syscall.SOCK_DGRAM, syscall.IPPROTO_UDP)
+	if err != nil {
+		return nil, fmt.Errorf("udpserver: sysSocket: %v", err)
+	}
+	if err = setupUDPServer(fd, family, c); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("udpserver: %v", err)
+	}
+	if err = syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("udpserver: %v", os.NewSyscallError("bind", err))
+	}
+	if err = syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("udpserver: SetNonblock: %v", err)
+	}
+
+	s := &UDPServer{fd: fd, size: c.MaxDatagramSize, done: make(chan struct{})}
+	if s.size <= 0 {
+		s.size = defaultDatagramSize
+	}
+	if lsa, err := syscall.Getsockname(fd); err == nil {
+		s.addr = sockaddrToUDPAddr(lsa)
+	}
+	s.ep = &udp{
+		fd:           fd,
+		netAddr:      s.addr,
+		family:       family,
+		readTimeout:  c.ReadTimeout,
+		writeTimeout: c.WriteTimeout,
+		maxReadSize:  c.MaxReadSize,
+		maxWriteSize: c.MaxWriteSize,
+		recvErr:      c.ReceiveErrors,
+
+		maxDatagramSize: s.size,
+	}
+
+	return s, nil
+}
+
+//设置绑定前的套接字选项
+func setupUDPServer(fd, family int, c *UDPServerConfig) error {
+	if c.ReuseAddr {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if c.Broadcast {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if c.ReceivePacketInfo {
+		if err := setReceivePacketInfo(fd, family); err != nil {
+			return fmt.Errorf("setReceivePacketInfo: %v", err)
+		}
+	}
+	if c.ReceiveErrors {
+		if err := setReceiveErrors(fd, family); err != nil {
+			return fmt.Errorf("setReceiveErrors: %v", err)
+		}
+	}
+	if err := setBufferSizes(fd, c.ReceiveBufferSize, c.SendBufferSize); err != nil {
+		return fmt.Errorf("setBufferSizes: %v", err)
+	}
+	if c.Interface != "" {
+		if err := bindToDevice(fd, family, c.Interface); err != nil {
+			return fmt.Errorf("bind to %v: %v", c.Interface, err)
+		}
+	}
+	return nil
+}
+
+//依次接收报文并调用h，直到Close后返回ErrListenerClosed。
+//读超时、超过MaxReadSize或MaxDatagramSize的报文、ICMP差错被忽略，其他读取错误时返回
+func (s *UDPServer) Serve(h DatagramHandler) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrListenerClosed
+	}
+	s.serving++
+	s.mu.Unlock()
+	defer s.leave()
+
+	buf := make([]byte, s.size)
+	for {
+		n, from, err := s.ep.ReadFrom(buf)
+		if s.isClosed() {
+			return ErrListenerClosed
+		}
+		if err != nil {
+			if _, ok := err.(*FrameSizeError); ok || IsTimeout(err) {
+				continue
+			}
+			if _, ok := err.(*ICMPError); ok {
+				continue
+			}
+			return fmt.Errorf("udpserver: %v", err)
+		}
+		s.handle(h, buf[:n], from)
+	}
+}
+
+//调用处理函数，期间在处理函数中调用Close时不等待Serve返回
+func (s *UDPServer) handle(h DatagramHandler, data []byte, from net.Addr) {
+	s.mu.Lock()
+	s.handling++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.handling--
+		s.mu.Unlock()
+	}()
+
+	h(data, from)
+}
+
+//Serve返回，关闭后最后一个返回的Serve关闭套接字
+func (s *UDPServer) leave() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.serving--; s.serving == 0 && s.closed {
+		s.closeFd()
+	}
+}
+
+//关闭套接字，调用方需持有锁
+func (s *UDPServer) closeFd() {
+	s.closeErr = os.NewSyscallError("close", syscall.Close(s.fd))
+	s.ep.fd = -1
+	close(s.done)
+}
+
+//向指定地址发送应答
+func (s *UDPServer) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return s.ep.WriteTo(b, addr)
+}
+
+//返回底层的UDP EndPoint，用于ReadMsg、ReadBatch等；没有对端地址，Write返回错误。
+//套接字属于服务端，EndPoint的Close等同于关闭服务端
+func (s *UDPServer) EndPoint() PacketEndPoint {
+	return &serverEndPoint{udp: s.ep, server: s}
+}
+
+//UDPServer.EndPoint返回的EndPoint，关闭时关闭服务端，避免重复关闭套接字
+type serverEndPoint struct {
+	*udp
+	server *UDPServer
+}
+
+func (p *serverEndPoint) Close() error {
+	return p.server.Close()
+}
+
+//返回监听地址，端口为0时返回系统分配的端口
+func (s *UDPServer) Addr() net.Addr {
+	if s.addr == nil {
+		return nil
+	}
+	return s.addr
+}
+
+//返回套接字的文件句柄
+func (s *UDPServer) Fd() int {
+	return s.fd
+}
+
+//停止接收，唤醒等待中的Serve并等待其返回后关闭套接字。
+//在处理函数中调用时不等待，由Serve返回时关闭套接字
+func (s *UDPServer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+
+	//shutdown唤醒阻塞在poll中的Serve
+	atomic.StoreInt32(&s.ep.shut, 1)
+	syscall.Shutdown(s.fd, syscall.SHUT_RDWR)
+	if s.serving == 0 {
+		s.closeFd()
+		s.mu.Unlock()
+		return s.closeErr
+	}
+	wait := s.handling == 0
+	s.mu.Unlock()
+
+	if !wait {
+		return nil
+	}
+	<-s.done
+	return s.closeErr
+}
+
+func (s *UDPServer) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
@@ -0,0 +1,108 @@
+package endpoint
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func listenUDPServer(t *testing.T) *UDPServer {
+	s, err := ListenUDP(&UDPServerConfig{Network: "udp", Address: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+//Close应等待Serve返回后才关闭套接字
+func TestUDPServerCloseWaitsForServe(t *testing.T) {
+	s := listenUDPServer(t)
+	fd := s.Fd()
+
+	served := make(chan struct{})
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.Serve(func(data []byte, from net.Addr) {
+			close(served)
+		})
+	}()
+	c, err := net.Dial("udp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err = c.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	<-served
+
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	serving := s.serving
+	s.mu.Unlock()
+	if serving != 0 {
+		t.Errorf("Close returned with %v Serve still running", serving)
+	}
+	if fdValid(fd) {
+		t.Errorf("fd %v still open after Close", fd)
+	}
+	if err = <-serveErr; err != ErrListenerClosed {
+		t.Errorf("Serve = %v, want ErrListenerClosed", err)
+	}
+}
+
+//在处理函数中关闭服务端不应死锁，Serve返回时关闭套接字
+func TestUDPServerCloseFromHandler(t *testing.T) {
+	s := listenUDPServer(t)
+	fd := s.Fd()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.Serve(func(data []byte, from net.Addr) {
+			s.EndPoint().Close()
+		})
+	}()
+	c, err := net.Dial("udp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err = c.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = <-serveErr; err != ErrListenerClosed {
+		t.Errorf("Serve = %v, want ErrListenerClosed", err)
+	}
+	if fdValid(fd) {
+		t.Errorf("fd %v still open after Serve returned", fd)
+	}
+}
+
+//先关闭EndPoint再关闭服务端不应关闭复用该描述符的其他文件
+func TestUDPServerEndPointCloseOnce(t *testing.T) {
+	s := listenUDPServer(t)
+	fd := s.Fd()
+	if err := s.EndPoint().Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+	if fds[0] != fd && fds[1] != fd {
+		t.Logf("fd %v not reused", fd)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !fdValid(fds[0]) || !fdValid(fds[1]) {
+		t.Error("UDPServer.Close closed a reused descriptor")
+	}
+}
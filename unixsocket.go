@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -15,6 +16,8 @@ type unixsocket struct {
 	sockAddr     syscall.Sockaddr //目标UnixSocket的socket地址
 	readTimeout  time.Duration    //一次完全数据包的收取超时
 	writeTimeout time.Duration    //一次完整数据包的发送超时
+	maxReadSize  int              //单次读取的最大报文长度
+	maxWriteSize int              //单次发送的最大报文长度
 }
 
 //创建unixsocket对象
@@ -32,7 +35,7 @@ func (p *unixsocket) Open(config EndPointConfig) (err error) {
 
 	//解析目标UnixSocket地址
 	if p.sockAddr, family, p.netAddr, err = getUnixSockaddr(c.Network, c.Address); err != nil {
-		err = fmt.Errorf("unixsocket: getUnixSockaddr %v %v: %v", c.Network, c.Address)
+		err = fmt.Errorf("unixsocket: getUnixSockaddr %v %v: %v", c.Network, c.Address, err)
 		return
 	}
 
@@ -44,21 +47,38 @@ func (p *unixsocket) Open(config EndPointConfig) (err error) {
 
 	//连接UnixSocket地址
 	if err = syscall.Connect(p.fd, p.sockAddr); err != nil {
-		err = fmt.Errorf("tcp: Connect: %v", os.NewSyscallError("connect", err))
+		syscall.Close(p.fd)
+		p.fd = -1
+		err = fmt.Errorf("unixsocket: Connect: %w", os.NewSyscallError("connect", err))
 		return
 	}
 
-	//设置读写超时
-	if c.ReadTimeout > 0 {
-		p.readTimeout = c.ReadTimeout
-	}
-	if c.WriteTimeout > 0 {
-		p.writeTimeout = c.WriteTimeout
-	}
+	//设置读写超时，未配置时使用默认值
+	p.readTimeout, p.writeTimeout = defaultTimeouts(EndPointUnix, c.ReadTimeout, c.WriteTimeout)
+
+	//设置报文长度限制
+	p.maxReadSize = c.MaxReadSize
+	p.maxWriteSize = c.MaxWriteSize
 
 	return
 }
 
+//关闭发送方向，对端读到EOF，仍可继续读取
+func (p *unixsocket) CloseWrite() error {
+	if p.fd == -1 {
+		return fmt.Errorf("unixsocket: not open")
+	}
+	return os.NewSyscallError("shutdown", syscall.Shutdown(p.fd, syscall.SHUT_WR))
+}
+
+//关闭接收方向，仍可继续发送
+func (p *unixsocket) CloseRead() error {
+	if p.fd == -1 {
+		return fmt.Errorf("unixsocket: not open")
+	}
+	return os.NewSyscallError("shutdown", syscall.Shutdown(p.fd, syscall.SHUT_RD))
+}
+
 //返回endpoint类型
 func (p *unixsocket) Type() EndPointType {
 	return EndPointUnix
@@ -68,18 +88,25 @@ func (p *unixsocket) Type() EndPointType {
 func (p *unixsocket) Close() error {
 	if p.fd != -1 {
 		syscall.Close(p.fd)
+		p.fd = -1
 	}
 
 	return nil
 }
 
 //读取UnixSocket数据
-func (p *unixsocket) Read(b []byte) (int, error) {
-	return syscall.Read(p.fd, b)
+func (p *unixsocket) Read(b []byte) (n int, err error) {
+	if n, err = syscall.Read(p.fd, limitReadBuffer(b, p.maxReadSize)); err == nil {
+		n, err = checkReadSize("unixsocket", n, p.maxReadSize)
+	}
+	return
 }
 
 //写UnixSocket数据
 func (p *unixsocket) Write(b []byte) (int, error) {
+	if err := checkWriteSize("unixsocket", len(b), p.maxWriteSize); err != nil {
+		return 0, err
+	}
 	return syscall.Write(p.fd, b)
 }
 
@@ -100,7 +127,7 @@ func (p *unixsocket) NetAddr() net.Addr {
 
 //返回UnixSocket的socket地址
 func (p *unixsocket) SockAddr() syscall.Sockaddr {
-	return p.SockAddr()
+	return p.sockAddr
 }
 
 //返回读超时
@@ -113,8 +140,22 @@ func (p *unixsocket) WriteTimeout() time.Duration {
 	return p.writeTimeout
 }
 
-//解析UnixSocket地址
+//修改读超时
+func (p *unixsocket) SetReadTimeout(d time.Duration) {
+	p.readTimeout = d
+}
+
+//修改写超时
+func (p *unixsocket) SetWriteTimeout(d time.Duration) {
+	p.writeTimeout = d
+}
+
+//解析UnixSocket地址。以@或NUL开头的地址为Linux抽象命名空间地址，不对应文件系统中的文件，
+//统一转换为@开头，由syscall在连接时替换为NUL，地址长度不包含结尾的NUL
 func getUnixSockaddr(proto, addr string) (sa syscall.Sockaddr, family int, unixAddr *net.UnixAddr, err error) {
+	if strings.HasPrefix(addr, "\x00") {
+		addr = "@" + addr[1:]
+	}
 	unixAddr, err = net.ResolveUnixAddr(proto, addr)
 	if err != nil {
 		return
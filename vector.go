@@ -0,0 +1,154 @@
+package endpoint
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+//十六进制编码的字节序列，JSON中写作"01 03 00 00 00 0A"，空格可省略
+type HexBytes []byte
+
+//编码为大写、空格分隔的十六进制字符串
+func (h HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strings.ToUpper(fmt.Sprintf("% x", []byte(h))))
+}
+
+//解析十六进制字符串，忽略空白字符
+func (h *HexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		return fmt.Errorf("vector: invalid hex %q: %v", s, err)
+	}
+	*h = b
+	return nil
+}
+
+//协议一致性测试向量：发送请求，期望在超时内收到应答
+type TestVector struct {
+	Name      string   `json:"name"`                 //名称
+	Request   HexBytes `json:"request"`              //发送的请求
+	Response  HexBytes `json:"response,omitempty"`   //期望的应答，为空表示不期望应答
+	Mask      HexBytes `json:"mask,omitempty"`       //应答的比较掩码，与Response等长，为0的比特不比较（比如序号、时间戳），为空表示全部比较
+	TimeoutMS int      `json:"timeout_ms,omitempty"` //等待应答的超时（毫秒），0表示使用EndPoint的读超时
+}
+
+//单个测试向量的结果
+type VectorResult struct {
+	Name    string        //向量名称
+	Pass    bool          //是否通过
+	Got     []byte        //收到的应答
+	Err     error         //未通过的原因
+	Elapsed time.Duration //从发送请求到收到应答的时间
+}
+
+//从JSON文件加载测试向量，文件内容为TestVector数组，供设备厂商提交兼容性认证用例
+func LoadTestVectors(path string) ([]TestVector, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("vector: %v", err)
+	}
+
+	var vectors []TestVector
+	if err = json.Unmarshal(data, &vectors); err != nil {
+		return nil, fmt.Errorf("vector: %v: %v", path, err)
+	}
+	for i, v := range vectors {
+		if len(v.Request) == 0 {
+			return nil, fmt.Errorf("vector: %v: vector %v (%v) has no request", path, i, v.Name)
+		}
+		if len(v.Mask) > 0 && len(v.Mask) != len(v.Response) {
+			return nil, fmt.Errorf("vector: %v: vector %v (%v) mask length %v != response length %v",
+				path, i, v.Name, len(v.Mask), len(v.Response))
+		}
+	}
+
+	return vectors, nil
+}
+
+//依次执行测试向量，返回每个向量的结果，有向量未通过时返回错误
+func RunTestVectors(p EndPoint, vectors []TestVector) ([]VectorResult, error) {
+	results := make([]VectorResult, 0, len(vectors))
+	failures := 0
+	for _, v := range vectors {
+		r := runTestVector(p, &v)
+		if !r.Pass {
+			failures++
+		}
+		results = append(results, r)
+	}
+
+	if failures > 0 {
+		return results, fmt.Errorf("vector: %v of %v vectors failed", failures, len(vectors))
+	}
+	return results, nil
+}
+
+//执行单个测试向量
+func runTestVector(p EndPoint, v *TestVector) (r VectorResult) {
+	r.Name = v.Name
+
+	//丢弃残留数据，避免影响比对
+	if sp, ok := p.(SerialEndPoint); ok {
+		if r.Err = sp.FlushInput(); r.Err != nil {
+			return
+		}
+	}
+
+	start := time.Now()
+	if _, r.Err = p.Write(v.Request); r.Err != nil {
+		r.Err = fmt.Errorf("write: %v", r.Err)
+		return
+	}
+	if len(v.Response) == 0 {
+		r.Pass = true
+		return
+	}
+
+	if v.TimeoutMS > 0 {
+		readTimeout := p.ReadTimeout()
+		if setReadTimeout(p, time.Duration(v.TimeoutMS)*time.Millisecond) {
+			defer setReadTimeout(p, readTimeout)
+		}
+	}
+	b := make([]byte, len(v.Response))
+	n, err := ReadExact(p, b)
+	r.Elapsed = time.Since(start)
+	r.Got = b[:n]
+	if err != nil {
+		r.Err = fmt.Errorf("read %v of %v bytes: %v", n, len(b), err)
+		return
+	}
+
+	if !maskedEqual(r.Got, v.Response, v.Mask) {
+		r.Err = fmt.Errorf("response mismatch: want % X, got % X", []byte(v.Response), r.Got)
+		return
+	}
+	r.Pass = true
+
+	return
+}
+
+//按掩码比较，mask为空时全部比较
+func maskedEqual(got, want, mask []byte) bool {
+	if len(mask) == 0 {
+		return bytes.Equal(got, want)
+	}
+	if len(got) != len(want) || len(mask) != len(want) {
+		return false
+	}
+	for i := range want {
+		if (got[i]^want[i])&mask[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
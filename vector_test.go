@@ -0,0 +1,157 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHexBytesJSON(t *testing.T) {
+	b, err := json.Marshal(HexBytes{0x01, 0x03, 0x0a, 0xff})
+	if err != nil || string(b) != `"01 03 0A FF"` {
+		t.Errorf("Marshal = %s, %v, want \"01 03 0A FF\"", b, err)
+	}
+
+	for in, want := range map[string]string{
+		`"01 03 0A FF"`:    "\x01\x03\x0a\xff",
+		`"01030aff"`:       "\x01\x03\x0a\xff",
+		`" 01\t03\n0a ff"`: "\x01\x03\x0a\xff",
+		`""`:               "",
+	} {
+		var h HexBytes
+		if err := json.Unmarshal([]byte(in), &h); err != nil || string(h) != want {
+			t.Errorf("Unmarshal(%s) = % x, %v, want % x", in, []byte(h), err, want)
+		}
+	}
+	for _, in := range []string{`"0"`, `"0g"`, `"01 0"`, `1`} {
+		var h HexBytes
+		if err := json.Unmarshal([]byte(in), &h); err == nil {
+			t.Errorf("Unmarshal(%s): err = nil", in)
+		}
+	}
+}
+
+func TestLoadTestVectors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		json    string
+		want    int
+		wantErr string
+	}{
+		{"valid", `[{"name":"read","request":"01 03","response":"01 03 02","mask":"FF FF 00","timeout_ms":50},{"name":"write","request":"01 06"}]`, 2, ""},
+		{"empty", `[]`, 0, ""},
+		{"no request", `[{"name":"bad","response":"01"}]`, 0, "vector 0 (bad) has no request"},
+		{"mask length", `[{"name":"m","request":"01","response":"01 02","mask":"FF"}]`, 0, "mask length 1 != response length 2"},
+		{"bad hex", `[{"name":"h","request":"0x01"}]`, 0, "invalid hex"},
+		{"not an array", `{"name":"x"}`, 0, "vector:"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, strings.Replace(tt.name, " ", "_", -1)+".json")
+		if err := ioutil.WriteFile(path, []byte(tt.json), 0644); err != nil {
+			t.Fatal(err)
+		}
+		vectors, err := LoadTestVectors(path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%v: err = %v, want containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || len(vectors) != tt.want {
+			t.Errorf("%v: %v vectors, err %v, want %v", tt.name, len(vectors), err, tt.want)
+		}
+	}
+
+	if _, err := LoadTestVectors(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("missing file: err = nil")
+	}
+}
+
+//模拟设备按请求返回应答，没有对应应答时不回复
+func startVectorDevice(p *chanEndPoint, replies map[string][]byte) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for req := range p.tx {
+			if resp, ok := replies[string(req)]; ok {
+				p.rx <- resp
+			}
+		}
+	}()
+	return func() {
+		close(p.tx)
+		<-done
+	}
+}
+
+func TestRunTestVectors(t *testing.T) {
+	p := newChanEndPoint()
+	p.timeout = time.Second
+	stop := startVectorDevice(p, map[string][]byte{
+		"\x01\x03":     {0x01, 0x03, 0x02, 0x00, 0x2a},
+		"\x01\x04":     {0x01, 0x04, 0x07},
+		"\x01\x05\x00": {0x01, 0x85},
+	})
+
+	vectors := []TestVector{
+		{Name: "exact", Request: HexBytes{0x01, 0x03}, Response: HexBytes{0x01, 0x03, 0x02, 0x00, 0x2a}},
+		{Name: "masked", Request: HexBytes{0x01, 0x04}, Response: HexBytes{0x01, 0x04, 0x00}, Mask: HexBytes{0xff, 0xff, 0x00}},
+		{Name: "no response", Request: HexBytes{0x01, 0x06}},
+		{Name: "mismatch", Request: HexBytes{0x01, 0x05, 0x00}, Response: HexBytes{0x01, 0x05}},
+		{Name: "timeout", Request: HexBytes{0x01, 0x10}, Response: HexBytes{0x01, 0x10}, TimeoutMS: 20},
+	}
+	results, err := RunTestVectors(p, vectors)
+	stop()
+	if err == nil || !strings.Contains(err.Error(), "2 of 5 vectors failed") {
+		t.Errorf("err = %v, want 2 of 5 vectors failed", err)
+	}
+	if len(results) != len(vectors) {
+		t.Fatalf("%v results, want %v", len(results), len(vectors))
+	}
+
+	want := []struct {
+		pass bool
+		err  string
+	}{{true, ""}, {true, ""}, {true, ""}, {false, "response mismatch"}, {false, "read 0 of 2 bytes"}}
+	for i, w := range want {
+		r := results[i]
+		if r.Name != vectors[i].Name || r.Pass != w.pass {
+			t.Errorf("%v: pass %v, want %v (err %v)", vectors[i].Name, r.Pass, w.pass, r.Err)
+		}
+		if w.err != "" && (r.Err == nil || !strings.Contains(r.Err.Error(), w.err)) {
+			t.Errorf("%v: err = %v, want containing %q", vectors[i].Name, r.Err, w.err)
+		}
+	}
+	if p.timeout != time.Second {
+		t.Errorf("read timeout %v after vectors, want restored to 1s", p.timeout)
+	}
+}
+
+func TestMaskedEqual(t *testing.T) {
+	tests := []struct {
+		got, want, mask []byte
+		eq              bool
+	}{
+		{[]byte{1, 2}, []byte{1, 2}, nil, true},
+		{[]byte{1, 2}, []byte{1, 3}, nil, false},
+		{[]byte{1, 2}, []byte{1, 3}, []byte{0xff, 0x00}, true},
+		{[]byte{1, 0x12}, []byte{1, 0x1f}, []byte{0xff, 0xf0}, true},
+		{[]byte{1, 0x22}, []byte{1, 0x1f}, []byte{0xff, 0xf0}, false},
+		{[]byte{1}, []byte{1, 3}, []byte{0xff, 0x00}, false},
+	}
+	for _, tt := range tests {
+		if got := maskedEqual(tt.got, tt.want, tt.mask); got != tt.eq {
+			t.Errorf("maskedEqual(% x, % x, % x) = %v, want %v", tt.got, tt.want, tt.mask, got, tt.eq)
+		}
+	}
+}
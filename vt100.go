@@ -0,0 +1,468 @@
+package endpoint
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//VT100解析状态
+const (
+	vtGround  = iota //普通字符
+	vtEscape         //收到ESC
+	vtCSI            //收到ESC [
+	vtCharset        //收到ESC (或ESC )，等待字符集标识
+	vtOSC            //收到ESC ]，等待BEL或ESC \结束
+	vtOSCEsc         //OSC中收到ESC
+)
+
+//虚拟终端屏幕，解析VT100/ANSI控制序列维护屏幕内容，用于从只提供
+//curses风格控制台界面的设备上抓取数据。只处理光标移动、擦除、滚动等
+//影响屏幕文字的序列，颜色等显示属性被忽略
+type Screen struct {
+	rows, cols  int      //屏幕行列数
+	cells       [][]rune //屏幕内容
+	row, col    int      //光标位置，从0开始
+	savedRow    int      //ESC 7保存的光标行
+	savedCol    int      //ESC 7保存的光标列
+	top, bottom int      //滚动区域，包含两端
+	state       int      //解析状态
+	params      []int    //CSI参数
+	private     bool     //CSI参数以?等私有标记开始
+	partial     []byte   //未接收完整的UTF-8字符
+	wrapPending bool     //光标位于行尾，下一个字符写入前换行
+}
+
+//创建rows行cols列的虚拟屏幕
+func NewScreen(rows, cols int) *Screen {
+	if rows <= 0 {
+		rows = 24
+	}
+	if cols <= 0 {
+		cols = 80
+	}
+
+	s := &Screen{rows: rows, cols: cols}
+	s.Reset()
+	return s
+}
+
+//清屏并复位光标、滚动区域和解析状态
+func (s *Screen) Reset() {
+	s.cells = make([][]rune, s.rows)
+	for i := range s.cells {
+		s.cells[i] = s.blankLine()
+	}
+	s.row, s.col = 0, 0
+	s.savedRow, s.savedCol = 0, 0
+	s.top, s.bottom = 0, s.rows-1
+	s.state = vtGround
+	s.params = nil
+	s.partial = nil
+	s.wrapPending = false
+}
+
+//在quiet内没有新数据时认为屏幕刷新完成，把期间从p读到的数据全部写入屏幕，
+//用于发送按键后等待设备重绘界面
+func (s *Screen) Update(p EndPoint, quiet time.Duration) error {
+	buf := make([]byte, 1024)
+	for {
+		n, err := readWithin(p, buf, quiet)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		s.Write(buf[:n])
+	}
+}
+
+//解析终端输出并更新屏幕，实现io.Writer
+func (s *Screen) Write(b []byte) (int, error) {
+	data := b
+	if len(s.partial) > 0 {
+		data = append(s.partial, b...)
+		s.partial = nil
+	}
+
+	for len(data) > 0 {
+		c := data[0]
+		if s.state != vtGround || c < utf8.RuneSelf {
+			s.feed(rune(c))
+			data = data[1:]
+			continue
+		}
+		if !utf8.FullRune(data) {
+			s.partial = append([]byte(nil), data...)
+			break
+		}
+		r, size := utf8.DecodeRune(data)
+		s.feed(r)
+		data = data[size:]
+	}
+
+	return len(b), nil
+}
+
+//返回屏幕行列数
+func (s *Screen) Size() (rows, cols int) {
+	return s.rows, s.cols
+}
+
+//返回光标位置，从0开始
+func (s *Screen) Cursor() (row, col int) {
+	return s.row, s.col
+}
+
+//返回第row行的文字，去除行尾空格
+func (s *Screen) Line(row int) string {
+	if row < 0 || row >= s.rows {
+		return ""
+	}
+	return strings.TrimRight(string(s.cells[row]), " ")
+}
+
+//返回所有行的文字
+func (s *Screen) Lines() []string {
+	lines := make([]string, s.rows)
+	for i := range lines {
+		lines[i] = s.Line(i)
+	}
+	return lines
+}
+
+//返回第row行从col列开始width个字符的文字，去除两端空格，用于按固定位置抓取字段
+func (s *Screen) Region(row, col, width int) string {
+	if row < 0 || row >= s.rows || col < 0 || col >= s.cols || width <= 0 {
+		return ""
+	}
+	end := col + width
+	if end > s.cols {
+		end = s.cols
+	}
+	return strings.TrimSpace(string(s.cells[row][col:end]))
+}
+
+//查找text在屏幕上第一次出现的位置
+func (s *Screen) Find(text string) (row, col int, ok bool) {
+	for i := range s.cells {
+		line := string(s.cells[i])
+		if j := strings.Index(line, text); j >= 0 {
+			return i, utf8.RuneCountInString(line[:j]), true
+		}
+	}
+	return -1, -1, false
+}
+
+//返回整个屏幕的文字，行间以换行分隔
+func (s *Screen) String() string {
+	return strings.TrimRight(strings.Join(s.Lines(), "\n"), "\n")
+}
+
+//处理一个字符
+func (s *Screen) feed(r rune) {
+	switch s.state {
+	case vtGround:
+		s.ground(r)
+	case vtEscape:
+		s.escape(r)
+	case vtCSI:
+		s.csi(r)
+	case vtCharset:
+		s.state = vtGround
+	case vtOSC:
+		if r == 0x07 {
+			s.state = vtGround
+		} else if r == 0x1b {
+			s.state = vtOSCEsc
+		}
+	case vtOSCEsc:
+		if r == '\\' {
+			s.state = vtGround
+		} else {
+			s.state = vtOSC
+		}
+	}
+}
+
+//处理普通字符和C0控制字符
+func (s *Screen) ground(r rune) {
+	switch r {
+	case 0x1b:
+		s.state = vtEscape
+	case '\r':
+		s.col = 0
+		s.wrapPending = false
+	case '\n', '\v', '\f':
+		s.lineFeed()
+	case '\b':
+		if s.col > 0 {
+			s.col--
+		}
+		s.wrapPending = false
+	case '\t':
+		s.col = (s.col/8 + 1) * 8
+		if s.col >= s.cols {
+			s.col = s.cols - 1
+		}
+	default:
+		if r < 0x20 || r == 0x7f {
+			return
+		}
+		if s.wrapPending {
+			s.col = 0
+			s.lineFeed()
+		}
+		s.cells[s.row][s.col] = r
+		if s.col == s.cols-1 {
+			s.wrapPending = true
+		} else {
+			s.col++
+		}
+	}
+}
+
+//处理ESC之后的字符
+func (s *Screen) escape(r rune) {
+	s.state = vtGround
+	switch r {
+	case '[':
+		s.state = vtCSI
+		s.params = s.params[:0]
+		s.private = false
+	case ']':
+		s.state = vtOSC
+	case '(', ')':
+		s.state = vtCharset
+	case '7':
+		s.savedRow, s.savedCol = s.row, s.col
+	case '8':
+		s.moveTo(s.savedRow, s.savedCol)
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.col = 0
+		s.lineFeed()
+	case 'M':
+		s.reverseLineFeed()
+	case 'c':
+		s.Reset()
+	}
+}
+
+//处理CSI序列的参数和结束字符
+func (s *Screen) csi(r rune) {
+	switch {
+	case r >= '0' && r <= '9':
+		if len(s.params) == 0 {
+			s.params = append(s.params, 0)
+		}
+		i := len(s.params) - 1
+		if s.params[i] < 10000 {
+			s.params[i] = s.params[i]*10 + int(r-'0')
+		}
+		return
+	case r == ';':
+		if len(s.params) == 0 {
+			s.params = append(s.params, 0)
+		}
+		s.params = append(s.params, 0)
+		return
+	case r == '?' || r == '>' || r == '=' || r == '!':
+		s.private = true
+		return
+	case r >= 0x20 && r < 0x40: //中间字符
+		return
+	}
+
+	s.state = vtGround
+	if s.private {
+		//私有模式（光标显示、应用键盘等）不影响屏幕文字
+		return
+	}
+
+	n := s.param(0, 1)
+	switch r {
+	case 'A':
+		s.moveTo(s.row-n, s.col)
+	case 'B', 'e':
+		s.moveTo(s.row+n, s.col)
+	case 'C', 'a':
+		s.moveTo(s.row, s.col+n)
+	case 'D':
+		s.moveTo(s.row, s.col-n)
+	case 'E':
+		s.moveTo(s.row+n, 0)
+	case 'F':
+		s.moveTo(s.row-n, 0)
+	case 'G', '`':
+		s.moveTo(s.row, n-1)
+	case 'd':
+		s.moveTo(n-1, s.col)
+	case 'H', 'f':
+		s.moveTo(n-1, s.param(1, 1)-1)
+	case 'J':
+		s.eraseDisplay(s.param(0, 0))
+	case 'K':
+		s.eraseLine(s.param(0, 0))
+	case 'X':
+		s.clear(s.row, s.col, s.col+n)
+	case 'P':
+		line := s.cells[s.row]
+		if n > s.cols-s.col {
+			n = s.cols - s.col
+		}
+		copy(line[s.col:], line[s.col+n:])
+		s.clear(s.row, s.cols-n, s.cols)
+	case '@':
+		line := s.cells[s.row]
+		if n > s.cols-s.col {
+			n = s.cols - s.col
+		}
+		copy(line[s.col+n:], line[s.col:])
+		s.clear(s.row, s.col, s.col+n)
+	case 'L':
+		if s.row >= s.top && s.row <= s.bottom {
+			s.scrollDown(s.row, n)
+		}
+	case 'M':
+		if s.row >= s.top && s.row <= s.bottom {
+			s.scrollUp(s.row, n)
+		}
+	case 'S':
+		s.scrollUp(s.top, n)
+	case 'T':
+		s.scrollDown(s.top, n)
+	case 'r':
+		top, bottom := s.param(0, 1)-1, s.param(1, s.rows)-1
+		if bottom >= s.rows {
+			bottom = s.rows - 1
+		}
+		if top < bottom {
+			s.top, s.bottom = top, bottom
+			s.moveTo(0, 0)
+		}
+	case 's':
+		s.savedRow, s.savedCol = s.row, s.col
+	case 'u':
+		s.moveTo(s.savedRow, s.savedCol)
+	}
+}
+
+//返回第i个CSI参数，缺省或为0时返回def
+func (s *Screen) param(i, def int) int {
+	if i >= len(s.params) || s.params[i] == 0 {
+		return def
+	}
+	return s.params[i]
+}
+
+//移动光标，超出屏幕时取边界
+func (s *Screen) moveTo(row, col int) {
+	if row < 0 {
+		row = 0
+	} else if row >= s.rows {
+		row = s.rows - 1
+	}
+	if col < 0 {
+		col = 0
+	} else if col >= s.cols {
+		col = s.cols - 1
+	}
+	s.row, s.col = row, col
+	s.wrapPending = false
+}
+
+//光标下移一行，位于滚动区域底部时上滚
+func (s *Screen) lineFeed() {
+	s.wrapPending = false
+	if s.row == s.bottom {
+		s.scrollUp(s.top, 1)
+	} else if s.row < s.rows-1 {
+		s.row++
+	}
+}
+
+//光标上移一行，位于滚动区域顶部时下滚
+func (s *Screen) reverseLineFeed() {
+	s.wrapPending = false
+	if s.row == s.top {
+		s.scrollDown(s.top, 1)
+	} else if s.row > 0 {
+		s.row--
+	}
+}
+
+//从from行到滚动区域底部上滚n行，底部补空行
+func (s *Screen) scrollUp(from, n int) {
+	if n > s.bottom-from+1 {
+		n = s.bottom - from + 1
+	}
+	copy(s.cells[from:s.bottom+1], s.cells[from+n:s.bottom+1])
+	for i := s.bottom - n + 1; i <= s.bottom; i++ {
+		s.cells[i] = s.blankLine()
+	}
+}
+
+//从from行到滚动区域底部下滚n行，from处补空行
+func (s *Screen) scrollDown(from, n int) {
+	if n > s.bottom-from+1 {
+		n = s.bottom - from + 1
+	}
+	copy(s.cells[from+n:s.bottom+1], s.cells[from:s.bottom+1])
+	for i := from; i < from+n; i++ {
+		s.cells[i] = s.blankLine()
+	}
+}
+
+//擦除屏幕：0光标到屏幕末尾，1屏幕开始到光标，2整个屏幕
+func (s *Screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.clear(s.row, s.col, s.cols)
+		for i := s.row + 1; i < s.rows; i++ {
+			s.cells[i] = s.blankLine()
+		}
+	case 1:
+		for i := 0; i < s.row; i++ {
+			s.cells[i] = s.blankLine()
+		}
+		s.clear(s.row, 0, s.col+1)
+	case 2, 3:
+		for i := range s.cells {
+			s.cells[i] = s.blankLine()
+		}
+	}
+}
+
+//擦除光标所在行：0光标到行尾，1行首到光标，2整行
+func (s *Screen) eraseLine(mode int) {
+	switch mode {
+	case 0:
+		s.clear(s.row, s.col, s.cols)
+	case 1:
+		s.clear(s.row, 0, s.col+1)
+	case 2:
+		s.clear(s.row, 0, s.cols)
+	}
+}
+
+//把row行[from, to)列填为空格
+func (s *Screen) clear(row, from, to int) {
+	if to > s.cols {
+		to = s.cols
+	}
+	for i := from; i < to; i++ {
+		s.cells[row][i] = ' '
+	}
+}
+
+//返回一行空格
+func (s *Screen) blankLine() []rune {
+	line := make([]rune, s.cols)
+	for i := range line {
+		line[i] = ' '
+	}
+	return line
+}
@@ -0,0 +1,99 @@
+package endpoint
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScreen(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		want      []string //4行10列屏幕的内容
+		row       int      //光标行
+		col       int      //光标列
+		anyCursor bool     //不检查光标位置
+	}{
+		{"text", "abc\r\ndef", []string{"abc", "def", "", ""}, 1, 3, false},
+		{"cursor position", "\x1b[3;5Hx\x1b[Hy", []string{"y", "", "    x", ""}, 0, 1, false},
+		{"cursor position default", "abc\x1b[;Hz", []string{"zbc", "", "", ""}, 0, 1, false},
+		{"cursor up down", "\x1b[4;1H\x1b[2Aa\x1b[Bb", []string{"", "a", " b", ""}, 2, 2, false},
+		{"cursor forward back", "abcdef\x1b[3Dx\x1b[2Cy", []string{"abcxefy", "", "", ""}, 0, 7, false},
+		{"cursor clamp", "\x1b[99;99Hx\x1b[99Ay", []string{"         y", "", "", "         x"}, 0, 9, true},
+		{"column and row absolute", "\x1b[3Gx\x1b[2dy", []string{"  x", "   y", "", ""}, 1, 4, false},
+		{"next and previous line", "ab\x1b[2Ec\x1b[Fd", []string{"ab", "d", "c", ""}, 1, 1, false},
+		{"save restore", "ab\x1b[s\x1b[3;3Hx\x1b[uc", []string{"abc", "", "  x", ""}, 0, 3, false},
+		{"esc save restore", "ab\x1b7\r\nx\x1b8c", []string{"abc", "x", "", ""}, 0, 3, false},
+		{"erase to end of line", "abcdef\x1b[3D\x1b[K", []string{"abc", "", "", ""}, 0, 3, false},
+		{"erase to start of line", "abcdef\x1b[3D\x1b[1K", []string{"    ef", "", "", ""}, 0, 3, false},
+		{"erase line", "abcdef\x1b[2K", []string{"", "", "", ""}, 0, 6, false},
+		{"erase below", "aaa\r\nbbb\r\nccc\x1b[2;2H\x1b[J", []string{"aaa", "b", "", ""}, 1, 1, false},
+		{"erase above", "aaa\r\nbbb\r\nccc\x1b[2;2H\x1b[1J", []string{"", "  b", "ccc", ""}, 1, 1, false},
+		{"erase display", "aaa\r\nbbb\x1b[2J", []string{"", "", "", ""}, 1, 3, false},
+		{"erase characters", "abcdef\r\x1b[C\x1b[2X", []string{"a  def", "", "", ""}, 0, 1, false},
+		{"delete characters", "abcdef\r\x1b[C\x1b[2P", []string{"adef", "", "", ""}, 0, 1, false},
+		{"insert characters", "abcdef\r\x1b[C\x1b[2@", []string{"a  bcdef", "", "", ""}, 0, 1, false},
+		{"scroll at bottom", "1\r\n2\r\n3\r\n4\r\n5", []string{"2", "3", "4", "5"}, 3, 1, false},
+		{"scroll region", "top\x1b[2;3r\x1b[2;1H2\r\n3\r\n4", []string{"top", "3", "4", ""}, 2, 1, false},
+		{"reverse index", "a\r\nb\x1b[H\x1bMc", []string{"c", "a", "b", ""}, 0, 1, false},
+		{"insert lines", "a\r\nb\r\nc\x1b[2;1H\x1b[L", []string{"a", "", "b", "c"}, 1, 0, false},
+		{"delete lines", "a\r\nb\r\nc\x1b[1;1H\x1b[M", []string{"b", "c", "", ""}, 0, 0, false},
+		{"scroll up", "a\r\nb\x1b[S", []string{"b", "", "", ""}, 1, 1, true},
+		{"scroll down", "a\r\nb\x1b[T", []string{"", "a", "b", ""}, 1, 1, true},
+		{"wrap", "0123456789ab", []string{"0123456789", "ab", "", ""}, 1, 2, false},
+		{"wrap pending", "0123456789", []string{"0123456789", "", "", ""}, 0, 9, false},
+		{"wrap pending cleared by CR", "0123456789\rx", []string{"x123456789", "", "", ""}, 0, 1, false},
+		{"wrap at bottom", "\x1b[4;1H0123456789x", []string{"", "", "0123456789", "x"}, 3, 1, false},
+		{"tab", "a\tb", []string{"a       b", "", "", ""}, 0, 9, false},
+		{"backspace", "ab\bc", []string{"ac", "", "", ""}, 0, 2, false},
+		{"private mode", "\x1b[?25lab\x1b[?25h", []string{"ab", "", "", ""}, 0, 2, false},
+		{"attributes", "\x1b[1;31ma\x1b[0mb", []string{"ab", "", "", ""}, 0, 2, false},
+		{"charset", "\x1b(Ba\x1b)0b", []string{"ab", "", "", ""}, 0, 2, false},
+		{"OSC BEL", "\x1b]0;title\x07ab", []string{"ab", "", "", ""}, 0, 2, false},
+		{"OSC ST", "\x1b]0;ti\x1btle\x1b\\ab", []string{"ab", "", "", ""}, 0, 2, false},
+		{"reset", "abc\x1bcd", []string{"d", "", "", ""}, 0, 1, false},
+		{"UTF-8", "温度:25", []string{"温度:25", "", "", ""}, 0, 5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			whole := NewScreen(4, 10)
+			whole.Write([]byte(tt.in))
+
+			//逐字节写入时结果应相同，控制序列和UTF-8字符可能被拆开
+			split := NewScreen(4, 10)
+			for i := 0; i < len(tt.in); i++ {
+				split.Write([]byte{tt.in[i]})
+			}
+
+			for _, s := range []*Screen{whole, split} {
+				if got := s.Lines(); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+					t.Errorf("lines = %q, want %q", got, tt.want)
+				}
+				if row, col := s.Cursor(); !tt.anyCursor && (row != tt.row || col != tt.col) {
+					t.Errorf("cursor = %v,%v, want %v,%v", row, col, tt.row, tt.col)
+				}
+			}
+		})
+	}
+}
+
+func TestScreenQuery(t *testing.T) {
+	s := NewScreen(4, 20)
+	s.Write([]byte("Temp:  25.5 C\r\n\x1b[3;5HStatus: OK"))
+
+	if got := s.Region(0, 5, 7); got != "25.5" {
+		t.Errorf("Region = %q, want \"25.5\"", got)
+	}
+	if row, col, ok := s.Find("OK"); !ok || row != 2 || col != 12 {
+		t.Errorf("Find = %v, %v, %v, want 2, 12, true", row, col, ok)
+	}
+	if _, _, ok := s.Find("missing"); ok {
+		t.Error("Find(missing) = true")
+	}
+	if got, want := s.String(), "Temp:  25.5 C\n\n    Status: OK"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+	if got := s.Line(-1) + s.Line(4) + s.Region(0, 20, 1); got != "" {
+		t.Errorf("out of range = %q, want empty", got)
+	}
+}